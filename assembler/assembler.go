@@ -0,0 +1,365 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Assemble turns qbasm (as produced by disassembler.Disassemble) back into bytes.
+//
+// Syntax:
+//
+//	; comment
+//	Label:
+//	mnemonic operand...
+//	bytes 01 02 03
+//
+// Jump operands are either labels (@Label) or raw offsets (+0x14).
+// Checksum operands are either raw (#738C9ADE) or quoted names ("foo").
+func Assemble(source string) ([]byte, error) {
+	type statement struct {
+		LineNumber int
+		Mnemonic   string
+		Operands   []string
+		Offset     int
+		Size       int
+	}
+
+	mnemonics := disassembler.MnemonicToOpcode()
+	labels := make(map[string]int)
+	var statements []statement
+
+	// pass 1: tokenise, work out the size of every statement and the offset of every label
+	offset := 0
+	for i, line := range strings.Split(strings.Replace(source, "\r", "", -1), "\n") {
+		lineNumber := i + 1
+		tokens, err := tokenise(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+
+		if strings.HasSuffix(tokens[0], ":") && len(tokens) == 1 {
+			label := strings.TrimSuffix(tokens[0], ":")
+			if _, exists := labels[label]; exists {
+				return nil, fmt.Errorf("line %d: label '%s' is defined twice", lineNumber, label)
+			}
+			labels[label] = offset
+			continue
+		}
+
+		s := statement{
+			LineNumber: lineNumber,
+			Mnemonic:   tokens[0],
+			Operands:   tokens[1:],
+			Offset:     offset,
+		}
+		size, err := statementSize(s.Mnemonic, s.Operands, mnemonics)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+		s.Size = size
+		statements = append(statements, s)
+		offset += size
+	}
+
+	// pass 2: encode
+	var bytes []byte
+	write := func(b ...byte) {
+		bytes = append(bytes, b...)
+	}
+	writeUint16 := func(n uint16) {
+		var buffer [2]byte
+		binary.LittleEndian.PutUint16(buffer[:], n)
+		write(buffer[:]...)
+	}
+	writeUint32 := func(n uint32) {
+		var buffer [4]byte
+		binary.LittleEndian.PutUint32(buffer[:], n)
+		write(buffer[:]...)
+	}
+
+	for _, s := range statements {
+		fail := func(format string, arguments ...interface{}) ([]byte, error) {
+			return nil, fmt.Errorf("line %d (%s): %s", s.LineNumber, s.Mnemonic, fmt.Sprintf(format, arguments...))
+		}
+
+		// jumps are relative, either to the start or the end of the offset
+		resolveJump := func(operand string, relativeTo int) (int, error) {
+			if strings.HasPrefix(operand, "@") {
+				target, ok := labels[operand[1:]]
+				if !ok {
+					return 0, fmt.Errorf("undefined label '%s'", operand[1:])
+				}
+				return target - relativeTo, nil
+			}
+			value, err := strconv.ParseInt(operand, 0, 64)
+			if err != nil {
+				return 0, fmt.Errorf("bad jump offset '%s'", operand)
+			}
+			return int(value), nil
+		}
+
+		if s.Mnemonic == "bytes" {
+			for _, operand := range s.Operands {
+				decoded, err := hex.DecodeString(operand)
+				if err != nil {
+					return fail("bad hex byte '%s'", operand)
+				}
+				write(decoded...)
+			}
+			continue
+		}
+
+		opcode := mnemonics[s.Mnemonic]
+		info := disassembler.Opcodes[opcode]
+		write(opcode)
+
+		switch info.Operands {
+		case disassembler.Operands_None:
+		case disassembler.Operands_Uint16:
+			value, err := resolveJump(s.Operands[0], s.Offset+1)
+			if err != nil {
+				return fail("%s", err)
+			}
+			if value < 0 || value > math.MaxUint16 {
+				return fail("jump offset %#x doesn't fit in 2 bytes", value)
+			}
+			writeUint16(uint16(value))
+		case disassembler.Operands_Uint32:
+			if opcode == disassembler.Opcode_LongJump {
+				value, err := resolveJump(s.Operands[0], s.Offset+5)
+				if err != nil {
+					return fail("%s", err)
+				}
+				writeUint32(uint32(int32(value)))
+			} else if opcode == disassembler.Opcode_Checksum {
+				checksum, err := parseChecksum(s.Operands[0])
+				if err != nil {
+					return fail("%s", err)
+				}
+				writeUint32(checksum)
+			} else {
+				value, err := strconv.ParseInt(s.Operands[0], 0, 64)
+				if err != nil || value < math.MinInt32 || value > math.MaxUint32 {
+					return fail("bad integer '%s'", s.Operands[0])
+				}
+				writeUint32(uint32(value))
+			}
+		case disassembler.Operands_Float, disassembler.Operands_Pair, disassembler.Operands_Vector:
+			for _, operand := range s.Operands {
+				bits, err := parseFloatBits(operand)
+				if err != nil {
+					return fail("%s", err)
+				}
+				writeUint32(bits)
+			}
+		case disassembler.Operands_SizedString:
+			terminated := true
+			operand := s.Operands[0]
+			if operand == "unterminated" {
+				terminated = false
+				operand = s.Operands[1]
+			}
+			text, err := strconv.Unquote(operand)
+			if err != nil {
+				return fail("bad string %s", operand)
+			}
+			size := len(text)
+			if terminated {
+				size++
+			}
+			writeUint32(uint32(size))
+			write([]byte(text)...)
+			if terminated {
+				write(0)
+			}
+		case disassembler.Operands_NameTableEntry:
+			var name string
+			var checksum uint32
+			var err error
+			if len(s.Operands) == 1 {
+				name, err = strconv.Unquote(s.Operands[0])
+				checksum = compiler.StringToChecksum(name)
+			} else {
+				checksum, err = parseChecksum(s.Operands[0])
+				if err == nil {
+					name, err = strconv.Unquote(s.Operands[1])
+				}
+			}
+			if err != nil {
+				return fail("%s", err)
+			}
+			writeUint32(checksum)
+			write([]byte(name)...)
+			write(0)
+		case disassembler.Operands_Random:
+			numBranches := len(s.Operands)
+			weights := make([]uint16, numBranches)
+			targets := make([]string, numBranches)
+			for i, operand := range s.Operands {
+				parts := strings.SplitN(operand, ":", 2)
+				weight, err := strconv.ParseUint(parts[0], 0, 16)
+				if err != nil {
+					return fail("bad weight in '%s'", operand)
+				}
+				weights[i] = uint16(weight)
+				targets[i] = parts[1]
+			}
+			writeUint32(uint32(numBranches))
+			for _, weight := range weights {
+				writeUint16(weight)
+			}
+			for i, target := range targets {
+				endOfOffset := s.Offset + 5 + 2*numBranches + 4*(i+1)
+				value, err := resolveJump(target, endOfOffset)
+				if err != nil {
+					return fail("%s", err)
+				}
+				writeUint32(uint32(int32(value)))
+			}
+		default:
+			return fail("operands can't be assembled, use 'bytes' instead")
+		}
+	}
+
+	return bytes, nil
+}
+
+// statementSize checks the shape of a statement and works out how many bytes it will assemble to.
+func statementSize(mnemonic string, operands []string, mnemonics map[string]byte) (int, error) {
+	expectOperands := func(count int) error {
+		if len(operands) != count {
+			return fmt.Errorf("'%s' takes %d operand(s), got %d", mnemonic, count, len(operands))
+		}
+		return nil
+	}
+
+	if mnemonic == "bytes" {
+		for _, operand := range operands {
+			if len(operand) != 2 {
+				return 0, fmt.Errorf("bytes are written as two hex digits each, got '%s'", operand)
+			}
+		}
+		return len(operands), nil
+	}
+
+	opcode, ok := mnemonics[mnemonic]
+	if !ok {
+		return 0, fmt.Errorf("unknown mnemonic '%s'", mnemonic)
+	}
+
+	switch disassembler.Opcodes[opcode].Operands {
+	case disassembler.Operands_None:
+		return 1, expectOperands(0)
+	case disassembler.Operands_Uint16:
+		return 3, expectOperands(1)
+	case disassembler.Operands_Uint32, disassembler.Operands_Float:
+		return 5, expectOperands(1)
+	case disassembler.Operands_Pair:
+		return 9, expectOperands(2)
+	case disassembler.Operands_Vector:
+		return 13, expectOperands(3)
+	case disassembler.Operands_SizedString:
+		if len(operands) == 2 && operands[0] == "unterminated" {
+			text, err := strconv.Unquote(operands[1])
+			return 5 + len(text), err
+		}
+		if err := expectOperands(1); err != nil {
+			return 0, err
+		}
+		text, err := strconv.Unquote(operands[0])
+		return 5 + len(text) + 1, err
+	case disassembler.Operands_NameTableEntry:
+		if len(operands) < 1 || len(operands) > 2 {
+			return 0, fmt.Errorf("'%s' takes a name, optionally preceded by a checksum", mnemonic)
+		}
+		name, err := strconv.Unquote(operands[len(operands)-1])
+		return 5 + len(name) + 1, err
+	case disassembler.Operands_Random:
+		for _, operand := range operands {
+			if !strings.Contains(operand, ":") {
+				return 0, fmt.Errorf("random branches are written as weight:@Label, got '%s'", operand)
+			}
+		}
+		return 5 + 6*len(operands), nil
+	}
+	return 0, fmt.Errorf("'%s' can't be assembled, use 'bytes' instead", mnemonic)
+}
+
+func parseChecksum(operand string) (uint32, error) {
+	if strings.HasPrefix(operand, "#") {
+		value, err := strconv.ParseUint(operand[1:], 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("bad checksum '%s'", operand)
+		}
+		return uint32(value), nil
+	}
+	name, err := strconv.Unquote(operand)
+	if err != nil {
+		return 0, fmt.Errorf("checksums are written as #XXXXXXXX or \"name\", got '%s'", operand)
+	}
+	return compiler.StringToChecksum(name), nil
+}
+
+func parseFloatBits(operand string) (uint32, error) {
+	if strings.HasPrefix(operand, "0x") {
+		bits, err := strconv.ParseUint(operand[2:], 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("bad float bits '%s'", operand)
+		}
+		return uint32(bits), nil
+	}
+	value, err := strconv.ParseFloat(operand, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad float '%s'", operand)
+	}
+	return math.Float32bits(float32(value)), nil
+}
+
+// tokenise splits a line into whitespace-separated tokens, keeping quoted strings intact and dropping comments.
+func tokenise(line string) ([]string, error) {
+	var tokens []string
+	i := 0
+	for i < len(line) {
+		switch {
+		case line[i] == ' ' || line[i] == '\t':
+			i++
+		case line[i] == ';':
+			return tokens, nil
+		case line[i] == '"':
+			end := i + 1
+			for {
+				if end >= len(line) {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				if line[end] == '\\' {
+					end += 2
+					continue
+				}
+				if line[end] == '"' {
+					break
+				}
+				end++
+			}
+			tokens = append(tokens, line[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(line) && line[end] != ' ' && line[end] != '\t' && line[end] != ';' {
+				end++
+			}
+			tokens = append(tokens, line[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
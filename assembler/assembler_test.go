@@ -0,0 +1,96 @@
+package assembler_test
+
+import (
+	"bytes"
+	"github.com/byxor/NeverScript/assembler"
+	"github.com/byxor/NeverScript/disassembler"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	qbasm := `
+    ; a comment
+Start:
+    checksum "Foo"
+    checksum #12345678  ; raw
+    int -1
+    float 1.5
+    string "hi"
+    short_jump @End
+    bytes 01 02
+End:
+    long_jump @Start
+    end_of_file
+`
+	expected := []byte{
+		0x16, 0xDE, 0x9A, 0x8C, 0x73,
+		0x16, 0x78, 0x56, 0x34, 0x12,
+		0x17, 0xFF, 0xFF, 0xFF, 0xFF,
+		0x1A, 0x00, 0x00, 0xC0, 0x3F,
+		0x1B, 0x03, 0x00, 0x00, 0x00, 'h', 'i', 0x00,
+		0x49, 0x04, 0x00, // relative to the start of the offset
+		0x01, 0x02,
+		0x2E, 0xDA, 0xFF, 0xFF, 0xFF, // relative to the end of the offset
+		0x00,
+	}
+	byteCode, err := assembler.Assemble(qbasm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(byteCode, expected) {
+		t.Errorf("Expected % x, got % x", expected, byteCode)
+	}
+}
+
+// Disassembling then assembling gives back the same bytes.
+func TestAssembleDisassembly(t *testing.T) {
+	paths, err := filepath.Glob("../compiler/testdata/golden/*.qb")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("Couldn't find any QB files: %v", err)
+	}
+	for _, path := range paths {
+		byteCode, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		qbasm := disassembler.Disassemble(disassembler.DisassemblyArguments{ByteCode: byteCode})
+		reassembled, err := assembler.Assemble(qbasm)
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		if !bytes.Equal(reassembled, byteCode) {
+			t.Errorf("%s: reassembling the disassembly changed the bytes", path)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	testCases := []struct {
+		qbasm         string
+		expectedError string
+	}{
+		{"newline\nfrobnicate 1", "line 2: unknown mnemonic 'frobnicate'"},
+		{"int", "line 1: 'int' takes 1 operand(s), got 0"},
+		{"int one", "line 1 (int): bad integer 'one'"},
+		{"int 0x100000000", "line 1 (int): bad integer '0x100000000'"},
+		{"checksum Foo", "line 1 (checksum): checksums are written as #XXXXXXXX or \"name\", got 'Foo'"},
+		{"checksum #NOPE", "line 1 (checksum): bad checksum '#NOPE'"},
+		{"float pi", "line 1 (float): bad float 'pi'"},
+		{`string "hi`, "line 1: unterminated string"},
+		{"bytes 1 2", "line 1: bytes are written as two hex digits each, got '1'"},
+		{"bytes zz", "line 1 (bytes): bad hex byte 'zz'"},
+		{"random 1:@A 2", "line 1: random branches are written as weight:@Label, got '2'"},
+		{"short_jump @Nowhere", "line 1 (short_jump): undefined label 'Nowhere'"},
+		{"short_jump far", "line 1 (short_jump): bad jump offset 'far'"},
+		{"Start:\nnewline\nStart:", "line 3: label 'Start' is defined twice"},
+	}
+	for _, testCase := range testCases {
+		_, err := assembler.Assemble(testCase.qbasm)
+		if err == nil || err.Error() != testCase.expectedError {
+			t.Errorf("Expected error '%s' for %q, got %v", testCase.expectedError, testCase.qbasm, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package checksum_recovery
+
+import (
+	"github.com/byxor/NeverScript/compiler"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type Method int
+
+const (
+	Method_Word Method = iota
+	Method_Combination
+	Method_BruteForce
+)
+
+func (method Method) String() string {
+	return [...]string{
+		"word",
+		"combination",
+		"brute force",
+	}[method]
+}
+
+// A Candidate is a name that hashes to one of the unknown checksums.
+// Short brute-forced names are likely to be right, but the longer they get the more likely they are to be collisions.
+type Candidate struct {
+	Checksum uint32
+	Name     string
+	Method   Method
+}
+
+type Arguments struct {
+	Checksums []uint32 // the unknown checksums
+
+	Words    []string // names to try as they are (and between each prefix/suffix)
+	Parts    []string // pieces of names to combine, e.g. "Skater_", "Menu", "Got"
+	MaxParts int      // the most parts combined into one name
+	Prefixes []string // tried before every word, combination of parts and brute-forced name
+	Suffixes []string // tried after every word, combination of parts and brute-forced name
+
+	BruteForceLength int    // try every name up to this length (0 turns brute force off)
+	Alphabet         string // characters used when brute forcing; checksums ignore case, so lowercase is enough
+
+	Workers int // defaults to the number of CPUs
+}
+
+const DefaultAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789_"
+
+// Recover searches for names with the given checksums, spreading the work across every CPU.
+// Candidates are sorted by checksum, then by the method that found them (words first), then by length.
+func Recover(arguments Arguments) []Candidate {
+	targets := make(map[uint32]bool, len(arguments.Checksums))
+	for _, checksum := range arguments.Checksums {
+		targets[checksum] = true
+	}
+	alphabet := arguments.Alphabet
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	workers := arguments.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	prefixes := append([]string{""}, arguments.Prefixes...)
+	suffixes := append([]string{""}, arguments.Suffixes...)
+
+	var candidates []Candidate
+	var mutex sync.Mutex
+	found := make(map[Candidate]bool)
+
+	// Each job owns one prefix and the first piece of the name, and checks every suffix after every name it builds.
+	type job struct {
+		Prefix string
+		Method Method
+		First  int // index into Words, Parts or the alphabet
+	}
+	run := func(j job) {
+		var name []byte
+		checkSuffixes := func(checksum uint32) {
+			for _, suffix := range suffixes {
+				if full := compiler.ExtendChecksum(checksum, suffix); targets[full] {
+					candidate := Candidate{full, j.Prefix + string(name) + suffix, j.Method}
+					mutex.Lock()
+					if !found[candidate] {
+						found[candidate] = true
+						candidates = append(candidates, candidate)
+					}
+					mutex.Unlock()
+				}
+			}
+		}
+
+		start := compiler.ExtendChecksum(compiler.ChecksumSeed, j.Prefix)
+		switch j.Method {
+		case Method_Word:
+			word := arguments.Words[j.First]
+			name = append(name, word...)
+			checkSuffixes(compiler.ExtendChecksum(start, word))
+		case Method_Combination:
+			var combine func(checksum uint32, numParts int)
+			combine = func(checksum uint32, numParts int) {
+				checkSuffixes(checksum)
+				if numParts >= arguments.MaxParts {
+					return
+				}
+				for _, part := range arguments.Parts {
+					length := len(name)
+					name = append(name, part...)
+					combine(compiler.ExtendChecksum(checksum, part), numParts+1)
+					name = name[:length]
+				}
+			}
+			part := arguments.Parts[j.First]
+			name = append(name, part...)
+			combine(compiler.ExtendChecksum(start, part), 1)
+		case Method_BruteForce:
+			var bruteForce func(checksum uint32)
+			bruteForce = func(checksum uint32) {
+				checkSuffixes(checksum)
+				if len(name) >= arguments.BruteForceLength {
+					return
+				}
+				for i := 0; i < len(alphabet); i++ {
+					name = append(name, alphabet[i])
+					bruteForce(compiler.ExtendChecksum(checksum, alphabet[i:i+1]))
+					name = name[:len(name)-1]
+				}
+			}
+			name = append(name, alphabet[j.First])
+			bruteForce(compiler.ExtendChecksum(start, alphabet[j.First:j.First+1]))
+		}
+	}
+
+	jobs := make(chan job)
+	var waitGroup sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for j := range jobs {
+				run(j)
+			}
+		}()
+	}
+	for _, prefix := range prefixes {
+		for i := range arguments.Words {
+			jobs <- job{prefix, Method_Word, i}
+		}
+		if arguments.MaxParts > 0 {
+			for i := range arguments.Parts {
+				jobs <- job{prefix, Method_Combination, i}
+			}
+		}
+		if arguments.BruteForceLength > 0 {
+			for i := range alphabet {
+				jobs <- job{prefix, Method_BruteForce, i}
+			}
+		}
+	}
+	close(jobs)
+	waitGroup.Wait()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Checksum != b.Checksum {
+			return a.Checksum < b.Checksum
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		if len(a.Name) != len(b.Name) {
+			return len(a.Name) < len(b.Name)
+		}
+		return a.Name < b.Name
+	})
+	return candidates
+}
+
+// SplitIntoParts breaks known names into the pieces they're made of, keeping underscores on the end of the piece
+// before them and splitting CamelCase, e.g. "Skater_GotMenu" gives "Skater_", "Got" and "Menu".
+func SplitIntoParts(names []string) []string {
+	var parts []string
+	seen := make(map[string]bool)
+	save := func(part string) {
+		if part != "" && !seen[strings.ToLower(part)] {
+			seen[strings.ToLower(part)] = true
+			parts = append(parts, part)
+		}
+	}
+	for _, name := range names {
+		start := 0
+		for i := 1; i < len(name); i++ {
+			previous, current := rune(name[i-1]), rune(name[i])
+			if previous == '_' || (unicode.IsUpper(current) && unicode.IsLower(previous)) {
+				save(name[start:i])
+				start = i
+			}
+		}
+		save(name[start:])
+	}
+	return parts
+}
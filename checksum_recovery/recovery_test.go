@@ -0,0 +1,71 @@
+package checksum_recovery_test
+
+import (
+	"github.com/byxor/NeverScript/checksum_recovery"
+	"github.com/byxor/NeverScript/compiler"
+	"strings"
+	"testing"
+)
+
+func TestExtendChecksum(t *testing.T) {
+	for _, name := range []string{"Skater_GotMenu", "a", "ab", "Kickflip_Score"} {
+		for i := 0; i <= len(name); i++ {
+			extended := compiler.ExtendChecksum(compiler.ExtendChecksum(compiler.ChecksumSeed, name[:i]), name[i:])
+			if expected := compiler.StringToChecksum(name); extended != expected {
+				t.Errorf("Extending '%s' with '%s' gave %08X, expected %08X", name[:i], name[i:], extended, expected)
+			}
+		}
+	}
+}
+
+func TestSplitIntoParts(t *testing.T) {
+	parts := checksum_recovery.SplitIntoParts([]string{"Skater_GotMenu", "skater_LostMenu", "ABC", "x"})
+	expected := []string{"Skater_", "Got", "Menu", "Lost", "ABC", "x"}
+	if strings.Join(parts, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected parts [%s], got [%s]", strings.Join(expected, " "), strings.Join(parts, " "))
+	}
+}
+
+func TestRecover(t *testing.T) {
+	testCases := []struct {
+		name   string
+		method checksum_recovery.Method
+	}{
+		{"Kickflip_Score", checksum_recovery.Method_Word},
+		{"Skater_LostBoard", checksum_recovery.Method_Combination},
+		{"Skater_z9", checksum_recovery.Method_BruteForce},
+	}
+	var checksums []uint32
+	for _, testCase := range testCases {
+		checksums = append(checksums, compiler.StringToChecksum(testCase.name))
+	}
+
+	candidates := checksum_recovery.Recover(checksum_recovery.Arguments{
+		Checksums:        checksums,
+		Words:            []string{"Kickflip", "Heelflip"},
+		Parts:            checksum_recovery.SplitIntoParts([]string{"Skater_GotMenu", "Skater_LostBoard"}),
+		MaxParts:         3,
+		Prefixes:         []string{"Skater_"},
+		Suffixes:         []string{"_Score"},
+		BruteForceLength: 2,
+		Workers:          4,
+	})
+
+	for _, testCase := range testCases {
+		checksum := compiler.StringToChecksum(testCase.name)
+		var found []string
+		wasFound := false
+		for _, candidate := range candidates {
+			if candidate.Checksum != checksum {
+				continue
+			}
+			found = append(found, candidate.Name+" ("+candidate.Method.String()+")")
+			if strings.EqualFold(candidate.Name, testCase.name) && candidate.Method == testCase.method {
+				wasFound = true
+			}
+		}
+		if !wasFound {
+			t.Errorf("Expected to find '%s' by %s, found [%s]", testCase.name, testCase.method, strings.Join(found, ", "))
+		}
+	}
+}
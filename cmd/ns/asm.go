@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/assembler"
+	"io/ioutil"
+	"log"
+)
+
+func RunAsm(args []string) {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	outputFilename := flags.String("o", "", "")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: ns asm [-o file.qb] <file.qbasm>")
+	}
+
+	inputFilename := flags.Arg(0)
+	source, err := ioutil.ReadFile(inputFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	byteCode, err := assembler.Assemble(string(source))
+	if err != nil {
+		log.Fatalf("%s: %s", inputFilename, err)
+	}
+
+	if *outputFilename == "" {
+		*outputFilename = WithQbExtension(inputFilename)
+	}
+	if err := ioutil.WriteFile(*outputFilename, byteCode, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("  Created '%s'.\n", *outputFilename)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RunAst dumps the AST of a NeverScript, blub or QB file as JSON, or compiles an AST written as JSON into a QB file.
+func RunAst(args []string) {
+	flags := flag.NewFlagSet("ast", flag.ExitOnError)
+	outputFilename := flags.String("o", "", "")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: ns ast [-o file.json] <file.ns|file.q|file.qb>\n       ns ast [-o file.qb] <file.json>")
+	}
+
+	inputFilename := flags.Arg(0)
+	switch strings.ToLower(filepath.Ext(inputFilename)) {
+	case ".json":
+		jsonBytes, err := ioutil.ReadFile(inputFilename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rootNode, err := compiler.AstFromJson(jsonBytes)
+		if err != nil {
+			log.Fatalf("%s: %s", inputFilename, err)
+		}
+		bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: rootNode}
+		compiler.GenerateBytecode(&bytecodeCompiler)
+
+		if *outputFilename == "" {
+			*outputFilename = WithQbExtension(inputFilename)
+		}
+		if err := ioutil.WriteFile(*outputFilename, bytecodeCompiler.Bytes, 0644); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("  Created '%s'.\n", *outputFilename)
+		return
+	case ".qb":
+		byteCode, err := ioutil.ReadFile(inputFilename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		arguments := decompiler.Arguments{ByteCode: byteCode}
+		if err := decompiler.ParseByteCode(&arguments); err != nil {
+			log.Fatalf("%s: %s", inputFilename, err)
+		}
+		for _, problem := range arguments.Problems {
+			fmt.Fprintf(os.Stderr, "  Warning: %s\n", problem)
+		}
+		writeAst(decompiler.ToCompilerAst(arguments.RootNode), *outputFilename)
+	default:
+		var lexer compiler.Lexer
+		var parser compiler.Parser
+		if err := compiler.ParseFile(inputFilename, &lexer, &parser); err != nil {
+			log.Fatalf("%s: %s", inputFilename, err)
+		}
+		writeAst(parser.Result.Node, *outputFilename)
+	}
+}
+
+// writeAst writes to stdout when there's no output file.
+func writeAst(rootNode compiler.AstNode, outputFilename string) {
+	jsonBytes, err := compiler.AstToJson(rootNode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	jsonBytes = append(jsonBytes, '\n')
+	if outputFilename == "" {
+		os.Stdout.Write(jsonBytes)
+		return
+	}
+	if err := ioutil.WriteFile(outputFilename, jsonBytes, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("  Created '%s'.\n", outputFilename)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"log"
+	"os"
+	"strings"
+)
+
+type checksumResult struct {
+	Input     string   `json:"input"`
+	Checksum  string   `json:"checksum"`
+	Names     []string `json:"names"`
+	Collision bool     `json:"collision"`
+}
+
+// RunChecksum computes checksums for names, and finds the known names for checksums (written as 0x1234ABCD or
+// #1234ABCD). Inputs are read from stdin when none are given.
+func RunChecksum(args []string) {
+	flags := flag.NewFlagSet("checksum", flag.ExitOnError)
+	var dictionaryPaths stringListFlag
+	flags.Var(&dictionaryPaths, "dictionary", "")
+	outputJson := flags.Bool("json", false, "")
+	flags.Parse(args)
+
+	inputs := flags.Args()
+	if len(inputs) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				inputs = append(inputs, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(inputs) == 0 {
+		log.Fatal("Usage: ns checksum [-dictionary names.txt]... [-json] <name|0xCHECKSUM>...")
+	}
+
+	var dictionary []compiler.ChecksumDictionaryEntry
+	for _, dictionaryPath := range dictionaryPaths {
+		entries, err := compiler.ReadChecksumDictionaryEntries(dictionaryPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dictionary = append(dictionary, entries...)
+	}
+
+	var results []checksumResult
+	for _, lookup := range compiler.LookUpChecksums(inputs, dictionary) {
+		results = append(results, checksumResult{
+			Input:     lookup.Input,
+			Checksum:  fmt.Sprintf("0x%08X", lookup.Checksum),
+			Names:     lookup.Names,
+			Collision: lookup.IsCollision(),
+		})
+	}
+
+	if *outputJson {
+		bytes, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(bytes))
+		return
+	}
+	for _, result := range results {
+		switch {
+		case len(result.Names) == 0:
+			fmt.Printf("%s  (unknown)\n", result.Checksum)
+		case result.Collision:
+			fmt.Printf("%s  %s  (collision)\n", result.Checksum, strings.Join(result.Names, ", "))
+		default:
+			fmt.Printf("%s  %s\n", result.Checksum, result.Names[0])
+		}
+	}
+}
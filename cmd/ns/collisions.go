@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"log"
+	"os"
+)
+
+// RunCollisions compiles every source file in a project (without writing any QB files) and reports different names
+// that share a checksum, including names from the given dictionaries.
+func RunCollisions(args []string) {
+	flags := flag.NewFlagSet("collisions", flag.ExitOnError)
+	var dictionaryPaths stringListFlag
+	flags.Var(&dictionaryPaths, "dictionary", "")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		log.Fatal("Usage: ns collisions [-dictionary names.txt]... <file.ns|file.q|directory>...")
+	}
+
+	usage := compiler.NewChecksumUsage()
+	numFiles, err := usage.AddSourceFiles(flags.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	numNames := len(usage.Uses)
+
+	if !reportChecksumCollisions(usage, dictionaryPaths) {
+		fmt.Printf("  No collisions between %d checksum(s) in %d file(s).\n", numNames, numFiles)
+		return
+	}
+	os.Exit(1)
+}
+
+// reportChecksumCollisions adds the dictionaries' names to the usage, then prints a warning for each collision. It
+// returns whether there were any.
+func reportChecksumCollisions(usage *compiler.ChecksumUsage, dictionaryPaths []string) bool {
+	for _, dictionaryPath := range dictionaryPaths {
+		entries, err := compiler.ReadChecksumDictionaryEntries(dictionaryPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		usage.AddDictionary(entries, dictionaryPath)
+	}
+	collisions := usage.Collisions()
+	for _, collision := range collisions {
+		fmt.Printf("  Warning: %s\n", collision)
+	}
+	return len(collisions) > 0
+}
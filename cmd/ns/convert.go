@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+func RunConvert(args []string) {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	outputFilename := flags.String("o", "", "")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: ns convert [-o file.ns] <file.q>")
+	}
+
+	inputFilename := flags.Arg(0)
+	sourceCode, err := ioutil.ReadFile(inputFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *outputFilename == "" {
+		*outputFilename = WithNsExtension(inputFilename)
+	}
+
+	var lexer compiler.Lexer
+	lexer.SourceCode = strings.Replace(string(sourceCode), "\r", "", -1)
+	lexer.SourceCodeSize = len(lexer.SourceCode)
+	compiler.LexBlubSourceCode(&lexer)
+
+	var parser compiler.Parser
+	parser.Tokens = lexer.Tokens
+	compiler.BuildAbstractSyntaxTreeFromBlub(&parser)
+	if !parser.Result.WasSuccessful {
+		log.Fatal(parser.Result.Reason)
+	}
+
+	// Names are already on the checksum tokens, so no name table is needed.
+	rootNode := decompiler.RecogniseCompilerIdioms(parser.Result.Node, nil)
+	nsCode, err := decompiler.DecompileAstNode(rootNode, 0, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*outputFilename, []byte(nsCode), 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("  Created '%s'.\n", *outputFilename)
+}
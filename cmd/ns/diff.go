@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+// RunDiff compares two QB files script by script and global by global, and exits with 1 when they're different.
+func RunDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	var dictionaryPaths stringListFlag
+	flags.Var(&dictionaryPaths, "dictionary", "")
+	summary := flags.Bool("summary", false, "")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		log.Fatal("Usage: ns diff [-dictionary names.txt]... [-summary] <old.qb> <new.qb>")
+	}
+
+	arguments := decompiler.DiffArguments{
+		OldName:    flags.Arg(0),
+		NewName:    flags.Arg(1),
+		Dictionary: make(map[uint32]string),
+	}
+	var err error
+	if arguments.OldByteCode, err = ioutil.ReadFile(arguments.OldName); err != nil {
+		log.Fatal(err)
+	}
+	if arguments.NewByteCode, err = ioutil.ReadFile(arguments.NewName); err != nil {
+		log.Fatal(err)
+	}
+	for _, dictionaryPath := range dictionaryPaths {
+		dictionary, err := compiler.ReadChecksumDictionary(dictionaryPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for checksum, name := range dictionary { // earlier dictionaries take priority
+			if _, exists := arguments.Dictionary[checksum]; !exists {
+				arguments.Dictionary[checksum] = name
+			}
+		}
+	}
+
+	if err := decompiler.DiffByteCode(&arguments); err != nil {
+		log.Fatal(err)
+	}
+	for _, problem := range arguments.OldProblems {
+		fmt.Printf("  Warning: '%s': %s\n", arguments.OldName, problem)
+	}
+	for _, problem := range arguments.NewProblems {
+		fmt.Printf("  Warning: '%s': %s\n", arguments.NewName, problem)
+	}
+
+	counts := make(map[decompiler.ChangeKind]int)
+	for _, change := range arguments.Changes {
+		counts[change.Kind]++
+		symbol := map[decompiler.ChangeKind]string{
+			decompiler.ChangeKind_Added:    "+",
+			decompiler.ChangeKind_Removed:  "-",
+			decompiler.ChangeKind_Modified: "~",
+		}[change.Kind]
+		fmt.Printf("%s %s (%s)\n", symbol, change.Item, change.Kind)
+		if change.Kind == decompiler.ChangeKind_Modified && !*summary {
+			fmt.Printf("%s\n", strings.TrimRight(change.Diff, "\n"))
+		}
+	}
+
+	if len(arguments.Changes) == 0 {
+		fmt.Printf("  No differences between %d item(s).\n", len(arguments.OldItems))
+		return
+	}
+	fmt.Printf("  %d item(s) changed: %d added, %d removed, %d modified.\n", len(arguments.Changes),
+		counts[decompiler.ChangeKind_Added], counts[decompiler.ChangeKind_Removed], counts[decompiler.ChangeKind_Modified])
+	os.Exit(1)
+}
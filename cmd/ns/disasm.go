@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/disassembler"
+	"io/ioutil"
+	"log"
+)
+
+func RunDisasm(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	outputFilename := flags.String("o", "", "")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: ns disasm [-o file.qbasm] <file.qb>")
+	}
+
+	inputFilename := flags.Arg(0)
+	byteCode, err := ioutil.ReadFile(inputFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *outputFilename == "" {
+		*outputFilename = WithQbasmExtension(inputFilename)
+	}
+
+	code := disassembler.Disassemble(disassembler.DisassemblyArguments{ByteCode: byteCode})
+	if err := ioutil.WriteFile(*outputFilename, []byte(code), 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("  Created '%s'.\n", *outputFilename)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/json_conversion"
+	"io/ioutil"
+	"log"
+)
+
+// RunExport writes the globals of a QB file as JSON.
+func RunExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	outputFilename := flags.String("o", "", "")
+	format := flags.String("format", "json", "")
+	var dictionaryPaths stringListFlag
+	flags.Var(&dictionaryPaths, "dictionary", "")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: ns export [-format json] [-dictionary names.txt]... [-o file.json] <file.qb>")
+	}
+	if *format != "json" {
+		log.Fatalf("Unknown format '%s' (only json is supported)", *format)
+	}
+
+	inputFilename := flags.Arg(0)
+	arguments := json_conversion.ExportArguments{Dictionary: make(map[uint32]string)}
+	var err error
+	if arguments.ByteCode, err = ioutil.ReadFile(inputFilename); err != nil {
+		log.Fatal(err)
+	}
+	for _, dictionaryPath := range dictionaryPaths {
+		dictionary, err := compiler.ReadChecksumDictionary(dictionaryPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for checksum, name := range dictionary { // earlier dictionaries take priority
+			if _, exists := arguments.Dictionary[checksum]; !exists {
+				arguments.Dictionary[checksum] = name
+			}
+		}
+	}
+
+	if err := json_conversion.Export(&arguments); err != nil {
+		log.Fatal(err)
+	}
+	for _, warning := range arguments.Warnings {
+		fmt.Printf("  Warning: %s\n", warning)
+	}
+
+	if *outputFilename == "" {
+		*outputFilename = WithJsonExtension(inputFilename)
+	}
+	if err := ioutil.WriteFile(*outputFilename, arguments.Json, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("  Created '%s'.\n", *outputFilename)
+}
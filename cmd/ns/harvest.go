@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func RunHarvest(args []string) {
+	flags := flag.NewFlagSet("harvest", flag.ExitOnError)
+	outputFilename := flags.String("o", "dictionary.txt", "")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		log.Fatal("Usage: ns harvest [-o dictionary.txt] <file.qb|file.ns|file.q|dictionary.txt|directory>...")
+	}
+
+	dictionary := make(map[uint32]string)
+	numFiles := 0
+	harvest := func(path string) error {
+		names, err := harvestNames(path)
+		if err != nil {
+			return err
+		}
+		for checksum, name := range names {
+			if _, exists := dictionary[checksum]; !exists && name != "" {
+				dictionary[checksum] = name
+			}
+		}
+		numFiles++
+		return nil
+	}
+
+	for _, path := range flags.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !info.IsDir() {
+			if err := harvest(path); err != nil {
+				log.Fatal(err)
+			}
+			continue
+		}
+		err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".qb", ".ns", ".q":
+				return harvest(path)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := ioutil.WriteFile(*outputFilename, []byte(compiler.FormatChecksumDictionary(dictionary)), 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("  Harvested %d name(s) from %d file(s).\n", len(dictionary), numFiles)
+	fmt.Printf("  Created '%s'.\n", *outputFilename)
+}
+
+// harvestNames collects names from a QB file's name table, the identifiers in NeverScript or blub source code, or an
+// existing dictionary.
+func harvestNames(path string) (map[uint32]string, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[uint32]string)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".qb":
+		return disassembler.ScrapeNameTable(bytes), nil
+	case ".ns", ".q":
+		var lexer compiler.Lexer
+		lexer.SourceCode = strings.Replace(string(bytes), "\r", "", -1)
+		lexer.SourceCodeSize = len(lexer.SourceCode)
+		if compiler.IsBlubFile(path) {
+			compiler.LexBlubSourceCode(&lexer)
+		} else {
+			compiler.LexSourceCode(&lexer)
+		}
+		for _, token := range lexer.Tokens {
+			if token.Kind == compiler.TokenKind_Identifier {
+				names[compiler.StringToChecksum(token.Data)] = token.Data
+			}
+		}
+		return names, nil
+	default:
+		return compiler.ParseChecksumDictionary(string(bytes))
+	}
+}
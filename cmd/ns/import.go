@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/json_conversion"
+	"io/ioutil"
+	"log"
+)
+
+// RunImport turns JSON written by 'ns export' (or anything else using the same format) into a QB file.
+func RunImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	outputFilename := flags.String("o", "", "")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: ns import [-o file.qb] <file.json>")
+	}
+
+	inputFilename := flags.Arg(0)
+	jsonBytes, err := ioutil.ReadFile(inputFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	byteCode, err := json_conversion.Import(jsonBytes)
+	if err != nil {
+		log.Fatalf("%s: %s", inputFilename, err)
+	}
+
+	if *outputFilename == "" {
+		*outputFilename = WithQbExtension(inputFilename)
+	}
+	if err := ioutil.WriteFile(*outputFilename, byteCode, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("  Created '%s'.\n", *outputFilename)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+func RunListing(args []string) {
+	if len(args) != 1 {
+		log.Fatal("Usage: ns listing <file.qb>")
+	}
+
+	byteCode, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listingArguments := disassembler.ListingArguments{
+		ByteCode: byteCode,
+	}
+	if sourceMap, err := compiler.ReadSourceMap(compiler.SourceMapPath(args[0])); err == nil {
+		listingArguments.SourceMap = sourceMap
+		if sourceCode, err := ioutil.ReadFile(sourceMap.SourceFilePath); err == nil {
+			listingArguments.SourceLines = strings.Split(strings.Replace(string(sourceCode), "\r", "", -1), "\n")
+		}
+	}
+
+	fmt.Print(disassembler.MakeListing(listingArguments))
+}
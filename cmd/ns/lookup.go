@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+)
+
+func RunLookup(args []string) {
+	if len(args) < 2 {
+		log.Fatal("Usage: ns lookup <file.qb|file.qb.map> <offset>...")
+	}
+
+	sourceMapPath := args[0]
+	if !strings.HasSuffix(sourceMapPath, ".map") {
+		sourceMapPath = compiler.SourceMapPath(sourceMapPath)
+	}
+	sourceMap, err := compiler.ReadSourceMap(sourceMapPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var sourceLines []string
+	if sourceCode, err := ioutil.ReadFile(sourceMap.SourceFilePath); err == nil {
+		sourceLines = strings.Split(strings.Replace(string(sourceCode), "\r", "", -1), "\n")
+	}
+
+	for _, offsetText := range args[1:] {
+		offset, err := strconv.ParseInt(offsetText, 0, 64)
+		if err != nil {
+			log.Fatalf("Couldn't parse offset '%s': %s", offsetText, err)
+		}
+
+		entry, found := sourceMap.Lookup(int(offset))
+		if !found {
+			fmt.Printf("%#06x -> no source (name table or padding)\n", offset)
+			continue
+		}
+
+		location := fmt.Sprintf("%s:%d:%d", sourceMap.SourceFilePath, entry.LineNumber, entry.Column)
+		if entry.Script != "" {
+			location += fmt.Sprintf(" (script %s)", entry.Script)
+		}
+		fmt.Printf("%#06x -> %s\n", offset, location)
+		if entry.LineNumber >= 1 && entry.LineNumber <= len(sourceLines) {
+			fmt.Printf("    %d | %s\n", entry.LineNumber, sourceLines[entry.LineNumber-1])
+		}
+	}
+}
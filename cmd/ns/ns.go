@@ -6,11 +6,11 @@ import (
 	"fmt"
 	"github.com/byxor/NeverScript/compiler"
 	"github.com/byxor/NeverScript/decompiler"
+	"github.com/byxor/NeverScript/disassembler"
 	"github.com/byxor/NeverScript/pre_generator"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -29,19 +29,73 @@ const (
 
 	usage = `
 COMPILATION:
-    -c                 (required string)  Specify a file to compile (.ns).
+    -c                 (required string)  Specify a file to compile (.ns, or .q for roq's blub syntax).
     -o                 (optional string)  Specify the output file name (.qb).
     -showHexDump       (optional flag)    Display the compiled bytecode in hex format.
-    -decompileWithRoq  (optional flag)    Display output from roq decompiler (roq.exe must be in your PATH).
+    -showListing       (optional flag)    Display an annotated listing of the compiled bytecode.
+    -sourceMap         (optional flag)    Write a source map next to the output file (.qb.map).
+    -decompileWithRoq  (optional flag)    Display the compiled code in roq's blub syntax.
+    -collisions        (optional string)  Specify what to do when different names share a checksum: warn (default),
+                                          error or ignore. Names in each -dictionary are checked too.
+    -optimise          (optional flag)    Make the bytecode smaller (removes extra newlines, dead branches,
+                                          unreachable code and globals that nothing in the file uses).
+    -keep              (optional string)  Specify a global that -optimise must keep, e.g. one used by the game or
+                                          another QB file (repeatable).
 
 PRE GENERATION:
     -p                 (required string)  Specify a pre spec file (.ps).
     -showHexDump       (optional flag)    Display the pre bytes in hex format.
+    -skipVerify        (optional flag)    Pack QB files even if 'ns verify' finds problems with them.
 
-DECOMPILATION (very incomplete):
+DECOMPILATION:
     -d                 (required string)  Specify a file to decompile (.qb).
-    -o                 (optional string)  Specify the output file name (.ns).
+    -o                 (optional string)  Specify the output file name (.ns, or .q for blub).
+    -syntax            (optional string)  Specify the output syntax: ns (default) or blub (roq's syntax).
+    -dictionary        (optional string)  Specify a checksum dictionary to name checksums missing from the file (repeatable).
     -showCode          (optional flag)    Display the decompiled code as text.
+
+COMMANDS:
+    lookup <file.qb|file.qb.map> <offset>...
+                       Find the source lines that produced the given QB byte offsets (needs -sourceMap).
+    listing <file.qb>  Display an annotated listing of any QB file (uses file.qb.map when present).
+    disasm [-o file.qbasm] <file.qb>
+                       Disassemble a QB file into editable qbasm.
+    asm [-o file.qb] <file.qbasm>
+                       Assemble qbasm back into a QB file (byte-for-byte identical when unedited).
+    convert [-o file.ns] <file.q>
+                       Convert roq's blub syntax into NeverScript.
+    harvest [-o dictionary.txt] <file.qb|file.ns|file.q|dictionary.txt|directory>...
+                       Collect names from QB name tables and source code into a checksum dictionary.
+    checksum [-dictionary names.txt]... [-json] <name|0xCHECKSUM>...
+                       Compute the checksums of names, or look up the names of checksums (reads stdin when no
+                       arguments are given). Collisions between different names are reported.
+    collisions [-dictionary names.txt]... <file.ns|file.q|directory>...
+                       Find different names that share a checksum across a whole project (exits with 1 if any do).
+    recover [-dictionary names.txt]... [-words words.txt]... [-part Got]... [-prefix Skater_]... [-suffix _Menu]...
+            [-parts 2] [-brute 0] [-alphabet abc...] [-workers N] [-save names.txt] <0xCHECKSUM|file.qb>...
+                       Search for the names of unknown checksums (given directly, or found in QB files without names).
+    verify <file.qb>...
+                       Check the structure of QB files (balanced blocks, jump offsets, name table...) without
+                       decompiling them (exits with 1 if there are problems).
+    diff [-dictionary names.txt]... [-summary] <old.qb> <new.qb>
+                       Show the scripts and globals that were added, removed or modified between two QB files, with
+                       a diff of each modified one (exits with 1 if there are differences).
+    export [-format json] [-dictionary names.txt]... [-o file.json] <file.qb>
+                       Write the globals of a QB file (structs, arrays, ints...) as JSON.
+    import [-o file.qb] <file.json>
+                       Turn JSON written by 'ns export' back into a QB file.
+    table [-name Global] [-delimiter ,] [-o file.ns|file.qb] <file.csv|file.tsv>
+                       Turn a sheet with 'name:type' headers (int, float, string, checksum, pair, vector) into a
+                       global array of structs, one struct per row (.tsv files are tab-separated).
+    ast [-o file.json] <file.ns|file.q|file.qb>
+                       Dump the abstract syntax tree of a file as JSON (to stdout unless -o is used).
+    ast [-o file.qb] <file.json>
+                       Compile an abstract syntax tree written as JSON (e.g. by 'ns ast') into a QB file.
+    repl [-show tokens,ast,json,bytecode,decompiled] [-optimise]
+                       Type NeverScript and see its tokens, AST, annotated bytecode and decompiled code straight away
+                       (type :help inside for commands).
+    run [-seed N] [-maxSteps N] <script> <file.qb|file.ns|file.q>...
+                       Run a script without the game (printf prints; other engine functions are shown and succeed).
 `
 
 	version = "0.6"
@@ -54,10 +108,45 @@ type CommandLineArguments struct {
 	OutputFileName   *string
 	ShowHexDump      *bool
 	ShowCode         *bool
+	Syntax           *string
+	Dictionaries     *stringListFlag
+	Collisions       *string
 	DecompileWithRoq *bool
+	SourceMap        *bool
+	ShowListing      *bool
+	SkipVerify       *bool
+	Optimise         *bool
+	KeepGlobals      *stringListFlag
+}
+
+var subcommands = map[string]func(args []string){
+	"lookup":     RunLookup,
+	"listing":    RunListing,
+	"disasm":     RunDisasm,
+	"asm":        RunAsm,
+	"convert":    RunConvert,
+	"harvest":    RunHarvest,
+	"checksum":   RunChecksum,
+	"collisions": RunCollisions,
+	"recover":    RunRecover,
+	"verify":     RunVerify,
+	"diff":       RunDiff,
+	"export":     RunExport,
+	"import":     RunImport,
+	"table":      RunTable,
+	"ast":        RunAst,
+	"repl":       RunRepl,
+	"run":        RunRun,
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			subcommand(os.Args[2:])
+			return
+		}
+	}
+
 	arguments := ParseCommandLineArguments()
 	// Hardcoded arguments for testing:
 	/* if len(os.Args) == 1 {
@@ -79,13 +168,35 @@ func ParseCommandLineArguments() CommandLineArguments {
 		PreSpecFile:      flag.String("p", "", ""),
 		OutputFileName:   flag.String("o", "", ""),
 		ShowHexDump:      flag.Bool("showHexDump", false, ""),
-		ShowCode:      flag.Bool("showCode", false, ""),
+		ShowCode:         flag.Bool("showCode", false, ""),
+		Syntax:           flag.String("syntax", "ns", ""),
+		Dictionaries:     &stringListFlag{},
+		Collisions:       flag.String("collisions", "warn", ""),
 		DecompileWithRoq: flag.Bool("decompileWithRoq", false, ""),
+		SourceMap:        flag.Bool("sourceMap", false, ""),
+		ShowListing:      flag.Bool("showListing", false, ""),
+		SkipVerify:       flag.Bool("skipVerify", false, ""),
+		Optimise:         flag.Bool("optimise", false, ""),
+		KeepGlobals:      &stringListFlag{},
 	}
+	flag.Var(args.Dictionaries, "dictionary", "")
+	flag.Var(args.KeepGlobals, "keep", "")
 	flag.Parse()
 	return args
 }
 
+// stringListFlag collects every use of a repeatable flag.
+type stringListFlag []string
+
+func (list *stringListFlag) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringListFlag) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
 func RunNeverscript(arguments CommandLineArguments) {
 	argumentsWereSupplied := false
 
@@ -97,12 +208,53 @@ func RunNeverscript(arguments CommandLineArguments) {
 			outputFilename = WithQbExtension(*arguments.FileToCompile)
 		}
 
+		switch *arguments.Collisions {
+		case "warn", "error", "ignore":
+		default:
+			log.Fatalf("Unknown collision mode '%s' (expected warn, error or ignore)", *arguments.Collisions)
+		}
+
 		fmt.Printf("\nCompiling '%s' (may freeze)...\n", *arguments.FileToCompile)
 		var lexer compiler.Lexer
 		var parser compiler.Parser
 		var bytecodeCompiler compiler.BytecodeCompiler
-		compiler.Compile(*arguments.FileToCompile, outputFilename, &lexer, &parser, &bytecodeCompiler)
+		if *arguments.SourceMap || *arguments.ShowListing {
+			bytecodeCompiler.SourceMap = &compiler.SourceMap{}
+		}
+		if *arguments.Collisions != "ignore" {
+			bytecodeCompiler.Checksums = compiler.NewChecksumUsage()
+		}
+		if *arguments.Optimise {
+			bytecodeCompiler.Optimiser = &compiler.Optimiser{KeepGlobals: *arguments.KeepGlobals}
+		}
+		if err := compiler.CompileToBytes(*arguments.FileToCompile, &lexer, &parser, &bytecodeCompiler); err != nil {
+			log.Fatal(err)
+		}
+		if optimiser := bytecodeCompiler.Optimiser; optimiser != nil {
+			fmt.Printf("  Optimised away %d byte(s): %d newline(s), %d branch(es), %d if statement(s), %d unreachable node(s) and %d global(s).\n",
+				optimiser.BytesSaved, optimiser.NewLinesRemoved, optimiser.BranchesRemoved, optimiser.IfStatementsRemoved,
+				optimiser.UnreachableNodesRemoved, len(optimiser.GlobalsRemoved))
+			if len(optimiser.GlobalsRemoved) > 0 {
+				fmt.Printf("  Removed unused global(s) (use -keep to keep them): %s\n", strings.Join(optimiser.GlobalsRemoved, ", "))
+			}
+		}
+		if bytecodeCompiler.Checksums != nil {
+			foundCollisions := reportChecksumCollisions(bytecodeCompiler.Checksums, *arguments.Dictionaries)
+			if foundCollisions && *arguments.Collisions == "error" {
+				log.Fatal("Refusing to compile names that share a checksum (use -collisions=warn to allow them)")
+			}
+		}
+		if err := ioutil.WriteFile(outputFilename, bytecodeCompiler.Bytes, 0644); err != nil {
+			log.Fatal(err)
+		}
 		fmt.Printf("  Created '%s'.\n", outputFilename)
+		if *arguments.SourceMap {
+			sourceMapFilename := compiler.SourceMapPath(outputFilename)
+			if err := compiler.WriteSourceMap(sourceMapFilename, bytecodeCompiler.SourceMap); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("  Created '%s'.\n", sourceMapFilename)
+		}
 
 		if *arguments.ShowHexDump {
 			fmt.Printf("\n%s\n", hex.Dump(bytecodeCompiler.Bytes))
@@ -110,15 +262,38 @@ func RunNeverscript(arguments CommandLineArguments) {
 			fmt.Println()
 		}
 
+		if *arguments.ShowListing {
+			fmt.Printf("%s\n", disassembler.MakeListing(disassembler.ListingArguments{
+				ByteCode:    bytecodeCompiler.Bytes,
+				SourceMap:   bytecodeCompiler.SourceMap,
+				SourceLines: strings.Split(lexer.SourceCode, "\n"),
+			}))
+		}
+
 		if *arguments.DecompileWithRoq {
-			fmt.Println("Roq decompiler output (may freeze):")
-			roqCmd := exec.Command("roq.exe", "-d", outputFilename)
-			decompiledCode, _ := roqCmd.Output()
-			fmt.Println(string(decompiledCode))
+			fmt.Println("Roq decompiler output:")
+			decompilerArguments := decompiler.Arguments{
+				ByteCode: bytecodeCompiler.Bytes,
+				Syntax:   decompiler.Syntax_Blub,
+			}
+			if err := decompiler.Decompile(&decompilerArguments); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(decompilerArguments.SourceCode)
 		}
 	} else if *arguments.FileToDecompile != "" {
 		argumentsWereSupplied = true
 
+		var syntax decompiler.Syntax
+		switch *arguments.Syntax {
+		case "ns":
+			syntax = decompiler.Syntax_NeverScript
+		case "blub":
+			syntax = decompiler.Syntax_Blub
+		default:
+			log.Fatalf("Unknown syntax '%s' (expected ns or blub)", *arguments.Syntax)
+		}
+
 		fmt.Printf("\nDecompiling '%s' (may freeze)...\n", *arguments.FileToDecompile)
 		byteCode, err := ioutil.ReadFile(*arguments.FileToDecompile)
 		if err != nil {
@@ -127,11 +302,34 @@ func RunNeverscript(arguments CommandLineArguments) {
 
 		var decompilerArguments decompiler.Arguments
 		decompilerArguments.ByteCode = byteCode
-		decompiler.Decompile(&decompilerArguments)
+		decompilerArguments.Syntax = syntax
+		decompilerArguments.Dictionary = make(map[uint32]string)
+		for _, dictionaryPath := range *arguments.Dictionaries {
+			dictionary, err := compiler.ReadChecksumDictionary(dictionaryPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for checksum, name := range dictionary { // earlier dictionaries take priority
+				if _, exists := decompilerArguments.Dictionary[checksum]; !exists {
+					decompilerArguments.Dictionary[checksum] = name
+				}
+			}
+			fmt.Printf("  Loaded %d name(s) from '%s'.\n", len(dictionary), dictionaryPath)
+		}
+		if err := decompiler.Decompile(&decompilerArguments); err != nil {
+			log.Fatal(err)
+		}
+		for _, problem := range decompilerArguments.Problems {
+			fmt.Printf("  Warning: %s\n", problem)
+		}
 
 		outputFilename := *arguments.OutputFileName
 		if outputFilename == "" {
-			outputFilename = WithNsExtension(*arguments.FileToDecompile)
+			if syntax == decompiler.Syntax_Blub {
+				outputFilename = WithQExtension(*arguments.FileToDecompile)
+			} else {
+				outputFilename = WithNsExtension(*arguments.FileToDecompile)
+			}
 		}
 
 		ioutil.WriteFile(outputFilename, []byte(decompilerArguments.SourceCode), 0644)
@@ -152,6 +350,25 @@ func RunNeverscript(arguments CommandLineArguments) {
 
 		fmt.Printf("\nGenerating pre file from spec '%s'...\n", *arguments.PreSpecFile)
 		preSpec := pre_generator.ParsePreSpec(*arguments.PreSpecFile)
+		if !*arguments.SkipVerify {
+			numProblems := 0
+			for _, item := range preSpec {
+				if !strings.EqualFold(filepath.Ext(item.PathOnDisk), ".qb") {
+					continue
+				}
+				byteCode, err := ioutil.ReadFile(item.PathOnDisk)
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, problem := range disassembler.Verify(byteCode) {
+					fmt.Printf("  '%s': %s\n", item.PathOnDisk, problem)
+					numProblems++
+				}
+			}
+			if numProblems > 0 {
+				log.Fatalf("Found %d problem(s) in the QB files (use -skipVerify to pack them anyway)", numProblems)
+			}
+		}
 		pre := pre_generator.MakePre(preSpec)
 		ioutil.WriteFile(*arguments.PreSpecFile, pre, 0466)
 		fmt.Printf("  Created '%s'.\n\n", outputFilename)
@@ -184,6 +401,18 @@ func WithNsExtension(fileName string) string {
 	return withoutExtension(fileName) + ".ns"
 }
 
+func WithQExtension(fileName string) string {
+	return withoutExtension(fileName) + ".q"
+}
+
+func WithQbasmExtension(fileName string) string {
+	return withoutExtension(fileName) + ".qbasm"
+}
+
+func WithJsonExtension(fileName string) string {
+	return withoutExtension(fileName) + ".json"
+}
+
 func withoutExtension(fileName string) string {
 	fileExtension := filepath.Ext(fileName)
 	end := len(fileName) - len(fileExtension)
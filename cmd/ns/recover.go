@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/checksum_recovery"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+func RunRecover(args []string) {
+	flags := flag.NewFlagSet("recover", flag.ExitOnError)
+	var dictionaryPaths, wordListPaths, parts, prefixes, suffixes stringListFlag
+	flags.Var(&dictionaryPaths, "dictionary", "")
+	flags.Var(&wordListPaths, "words", "")
+	flags.Var(&parts, "part", "")
+	flags.Var(&prefixes, "prefix", "")
+	flags.Var(&suffixes, "suffix", "")
+	maxParts := flags.Int("parts", 2, "")
+	bruteForceLength := flags.Int("brute", 0, "")
+	alphabet := flags.String("alphabet", checksum_recovery.DefaultAlphabet, "")
+	workers := flags.Int("workers", runtime.NumCPU(), "")
+	savePath := flags.String("save", "", "")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		log.Fatal("Usage: ns recover [-dictionary names.txt]... [-words words.txt]... [-part Got]... [-prefix Skater_]... " +
+			"[-suffix _Menu]... [-parts 2] [-brute 0] [-alphabet abc...] [-workers N] [-save names.txt] <0xCHECKSUM|file.qb>...")
+	}
+
+	known := make(map[uint32]string)
+	var knownNames []string
+	for _, dictionaryPath := range dictionaryPaths {
+		dictionary, err := compiler.ReadChecksumDictionary(dictionaryPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for checksum, name := range dictionary {
+			if _, exists := known[checksum]; !exists {
+				known[checksum] = name
+				knownNames = append(knownNames, name)
+			}
+		}
+	}
+
+	// unknown checksums are given directly, or found in QB files
+	var unknownChecksums []uint32
+	isUnknown := make(map[uint32]bool)
+	saveUnknown := func(checksum uint32) {
+		if _, isKnown := known[checksum]; !isKnown && !isUnknown[checksum] {
+			isUnknown[checksum] = true
+			unknownChecksums = append(unknownChecksums, checksum)
+		}
+	}
+	for _, arg := range flags.Args() {
+		digits := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(arg, "0x"), "0X"), "#")
+		if digits != arg {
+			checksum, err := strconv.ParseUint(digits, 16, 32)
+			if err != nil {
+				log.Fatalf("Bad checksum '%s'", arg)
+			}
+			saveUnknown(uint32(checksum))
+			continue
+		}
+		byteCode, err := ioutil.ReadFile(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		nameTable := disassembler.ScrapeNameTable(byteCode)
+		for _, checksum := range disassembler.ScrapeChecksums(byteCode) {
+			if _, isNamed := nameTable[checksum]; !isNamed {
+				saveUnknown(checksum)
+			}
+		}
+	}
+	if len(unknownChecksums) == 0 {
+		fmt.Println("  No unknown checksums to recover.")
+		return
+	}
+
+	words := append([]string{}, knownNames...)
+	for _, wordListPath := range wordListPaths {
+		text, err := ioutil.ReadFile(wordListPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.Replace(string(text), "\r", "", -1), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "//") {
+				words = append(words, line)
+			}
+		}
+	}
+
+	arguments := checksum_recovery.Arguments{
+		Checksums:        unknownChecksums,
+		Words:            words,
+		Parts:            checksum_recovery.SplitIntoParts(append(append([]string{}, parts...), words...)),
+		MaxParts:         *maxParts,
+		Prefixes:         prefixes,
+		Suffixes:         suffixes,
+		BruteForceLength: *bruteForceLength,
+		Alphabet:         *alphabet,
+		Workers:          *workers,
+	}
+	fmt.Printf("  Searching for %d checksum(s) with %d word(s), %d part(s), %d prefix(es) and %d suffix(es) on %d worker(s)...\n",
+		len(unknownChecksums), len(arguments.Words), len(arguments.Parts), len(prefixes), len(suffixes), *workers)
+	candidates := checksum_recovery.Recover(arguments)
+
+	bestCandidates := make(map[uint32]string)
+	for _, candidate := range candidates {
+		if _, exists := bestCandidates[candidate.Checksum]; !exists {
+			bestCandidates[candidate.Checksum] = candidate.Name
+		}
+		fmt.Printf("0x%08X  %s  (%s)\n", candidate.Checksum, candidate.Name, candidate.Method)
+	}
+	fmt.Printf("  Found names for %d of %d checksum(s).\n", len(bestCandidates), len(unknownChecksums))
+
+	if *savePath != "" && len(bestCandidates) > 0 {
+		header := "// recovered by ns recover\n"
+		if existingText, err := ioutil.ReadFile(*savePath); err == nil {
+			existing, err := compiler.ParseChecksumDictionary(string(existingText))
+			if err != nil {
+				log.Fatalf("%s: %s", *savePath, err)
+			}
+			for checksum := range existing {
+				delete(bestCandidates, checksum)
+			}
+			// don't join the header onto an unfinished last line
+			if len(existingText) > 0 && existingText[len(existingText)-1] != '\n' {
+				header = "\n" + header
+			}
+		} else if !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+		file, err := os.OpenFile(*savePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		if _, err := file.WriteString(header + compiler.FormatChecksumDictionary(bestCandidates)); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("  Saved %d name(s) to '%s'.\n", len(bestCandidates), *savePath)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+const replHelp = `Type NeverScript and it's compiled as soon as it's complete. Input continues on the next line while a
+'{' or '[' is open, a string or comment is unfinished, or a line ends with '\'.
+
+    :show [sections]   Show or choose what's displayed for each snippet: tokens, ast, json, bytecode, decompiled
+                       (comma-separated, or 'all').
+    :optimise          Turn -optimise on or off.
+    :cancel            Throw away the snippet being typed.
+    :help              Show this message.
+    :quit              Leave (so does end of input).
+`
+
+var replSections = []string{"tokens", "ast", "json", "bytecode", "decompiled"}
+
+type replState struct {
+	output   io.Writer
+	sections map[string]bool
+	optimise bool
+}
+
+// RunRepl reads NeverScript snippets from stdin and shows the tokens, AST, bytecode and decompiled code of each one.
+func RunRepl(args []string) {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	show := flags.String("show", "tokens,ast,bytecode,decompiled", "")
+	optimise := flags.Bool("optimise", false, "")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		log.Fatal("Usage: ns repl [-show tokens,ast,json,bytecode,decompiled] [-optimise]")
+	}
+	sections, err := parseReplSections(*show)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	state := replState{output: os.Stdout, sections: sections, optimise: *optimise}
+	fmt.Fprintf(state.output, "NeverScript %s. Type :help for help.\n", version)
+	state.run(os.Stdin)
+}
+
+func (state *replState) run(input io.Reader) {
+	scanner := bufio.NewScanner(input)
+	var snippet strings.Builder
+	for {
+		if snippet.Len() == 0 {
+			fmt.Fprint(state.output, "ns> ")
+		} else {
+			fmt.Fprint(state.output, "... ")
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(state.output)
+			return
+		}
+		line := scanner.Text()
+
+		if command := strings.TrimSpace(line); strings.HasPrefix(command, ":") {
+			if command == ":cancel" {
+				snippet.Reset()
+				continue
+			}
+			if snippet.Len() == 0 {
+				if !state.runCommand(command) {
+					return
+				}
+				continue
+			}
+		}
+
+		snippet.WriteString(line)
+		snippet.WriteString("\n")
+		if compiler.IsUnfinished(snippet.String()) {
+			continue
+		}
+		if strings.TrimSpace(snippet.String()) != "" {
+			state.evaluate(snippet.String())
+		}
+		snippet.Reset()
+	}
+}
+
+// runCommand returns false when the REPL should stop.
+func (state *replState) runCommand(command string) bool {
+	fields := strings.Fields(command)
+	switch fields[0] {
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help":
+		fmt.Fprint(state.output, replHelp)
+	case ":optimise":
+		state.optimise = !state.optimise
+		fmt.Fprintf(state.output, "Optimising: %t\n", state.optimise)
+	case ":show":
+		if len(fields) > 1 {
+			sections, err := parseReplSections(strings.Join(fields[1:], ","))
+			if err != nil {
+				fmt.Fprintln(state.output, err)
+				break
+			}
+			state.sections = sections
+		}
+		var shown []string
+		for _, section := range replSections {
+			if state.sections[section] {
+				shown = append(shown, section)
+			}
+		}
+		fmt.Fprintf(state.output, "Showing: %s\n", strings.Join(shown, ", "))
+	default:
+		fmt.Fprintf(state.output, "Unknown command '%s' (type :help for help)\n", fields[0])
+	}
+	return true
+}
+
+func parseReplSections(list string) (map[string]bool, error) {
+	sections := make(map[string]bool)
+	for _, section := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if section == "all" {
+			for _, section := range replSections {
+				sections[section] = true
+			}
+			continue
+		}
+		known := false
+		for _, knownSection := range replSections {
+			known = known || section == knownSection
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown section '%s' (expected %s or all)", section, strings.Join(replSections, ", "))
+		}
+		sections[section] = true
+	}
+	return sections, nil
+}
+
+func (state *replState) evaluate(snippet string) {
+	out := state.output
+	var lexer compiler.Lexer
+	var parser compiler.Parser
+	err := compiler.ParseSourceCode(snippet, false, &lexer, &parser)
+
+	if state.sections["tokens"] {
+		fmt.Fprintln(out, "Tokens:")
+		for _, token := range lexer.Tokens {
+			fmt.Fprintf(out, "  %3d:%-3d  %-22s  %s\n", token.LineNumber, token.Column,
+				strings.TrimPrefix(token.Kind.String(), "TokenKind_"), strings.Replace(token.Data, "\n", "\\n", -1))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Error: %s\n", strings.TrimSpace(err.Error()))
+		return
+	}
+	rootNode := parser.Result.Node
+
+	if state.sections["ast"] {
+		fmt.Fprintln(out, "AST:")
+		compiler.Walk(rootNode, compiler.Visitor{
+			Enter: func(node compiler.AstNode, parents []compiler.AstNode) bool {
+				fmt.Fprintf(out, "  %s%s\n", strings.Repeat("  ", len(parents)), describeAstNode(node))
+				return true
+			},
+		})
+	}
+	if state.sections["json"] {
+		jsonBytes, err := compiler.AstToJson(rootNode)
+		if err != nil {
+			fmt.Fprintf(out, "Error: %s\n", err)
+			return
+		}
+		fmt.Fprintf(out, "JSON:\n%s\n", jsonBytes)
+	}
+
+	bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: rootNode, SourceMap: &compiler.SourceMap{}}
+	if state.optimise {
+		// nothing else can refer to a snippet's globals, so they're all kept
+		var globals []string
+		for _, node := range rootNode.Data.(compiler.AstData_Root).BodyNodes {
+			if data, ok := node.Data.(compiler.AstData_Assignment); ok {
+				if name, ok := data.NameNode.Data.(compiler.AstData_Checksum); ok && name.HasName() {
+					globals = append(globals, name.ChecksumToken.Data)
+				}
+			}
+		}
+		bytecodeCompiler.Optimiser = &compiler.Optimiser{KeepGlobals: globals}
+	}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+	if state.sections["bytecode"] {
+		fmt.Fprintf(out, "Bytecode (%d bytes):\n", len(bytecodeCompiler.Bytes))
+		listing := disassembler.MakeListing(disassembler.ListingArguments{
+			ByteCode:    bytecodeCompiler.Bytes,
+			SourceMap:   bytecodeCompiler.SourceMap,
+			SourceLines: strings.Split(lexer.SourceCode, "\n"),
+		})
+		for _, row := range strings.Split(strings.TrimSuffix(listing, "\n"), "\n") {
+			fmt.Fprintf(out, "  %s\n", row)
+		}
+	}
+
+	if state.sections["decompiled"] {
+		decompilerArguments := decompiler.Arguments{ByteCode: bytecodeCompiler.Bytes, Syntax: decompiler.Syntax_NeverScript}
+		if err := decompiler.Decompile(&decompilerArguments); err != nil {
+			fmt.Fprintf(out, "Error: %s\n", err)
+			return
+		}
+		fmt.Fprintln(out, "Decompiled:")
+		for _, line := range strings.Split(strings.Trim(decompilerArguments.SourceCode, "\n"), "\n") {
+			fmt.Fprintf(out, "  %s\n", line)
+		}
+		for _, problem := range decompilerArguments.Problems {
+			fmt.Fprintf(out, "  Warning: %s\n", problem)
+		}
+
+		roundTrip, err := compiler.CompileSourceCode(decompilerArguments.SourceCode, false)
+		if err != nil {
+			fmt.Fprintln(out, "  (the decompiled code doesn't compile)")
+			return
+		}
+		if bytes.Equal(roundTrip, bytecodeCompiler.Bytes) {
+			fmt.Fprintln(out, "  (compiles back into the same bytes)")
+		} else {
+			fmt.Fprintf(out, "  (compiles back into different bytes: %d instead of %d)\n", len(roundTrip), len(bytecodeCompiler.Bytes))
+		}
+	}
+}
+
+// describeAstNode gives a node's kind, and its value when it has one.
+func describeAstNode(node compiler.AstNode) string {
+	kind := strings.TrimPrefix(node.Kind.String(), "AstKind_")
+	switch data := node.Data.(type) {
+	case compiler.AstData_Checksum:
+		if data.HasName() {
+			return fmt.Sprintf("%s %s (#%08X)", kind, data.ChecksumToken.Data, data.Checksum())
+		}
+		return fmt.Sprintf("%s #%08X", kind, data.Checksum())
+	case compiler.AstData_Integer:
+		return fmt.Sprintf("%s %d", kind, data.Value())
+	case compiler.AstData_Float:
+		return fmt.Sprintf("%s %g", kind, data.Value())
+	case compiler.AstData_String:
+		if data.IsLocalString {
+			return fmt.Sprintf("%s '%s'", kind, strings.Replace(data.Text(), "\n", "\\n", -1))
+		}
+		return fmt.Sprintf("%s \"%s\"", kind, strings.Replace(data.Text(), "\n", "\\n", -1))
+	case compiler.AstData_IfStatement:
+		for _, isBooleanInvocation := range data.BooleanInvocationData {
+			if isBooleanInvocation {
+				return kind + " (boolean invocation)"
+			}
+		}
+	}
+	return kind
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/interpreter"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var printfParameter = regexp.MustCompile(`%[A-Za-z_][A-Za-z0-9_]*`)
+
+// RunRun loads QB (or NeverScript/blub) files and runs one of their scripts without the game. printf is the only
+// built-in; other engine functions are printed and treated as succeeding.
+func RunRun(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	seed := flags.Int64("seed", 0, "")
+	maxSteps := flags.Int("maxSteps", 1000000, "")
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		log.Fatal("Usage: ns run [-seed N] [-maxSteps N] <script> <file.qb|file.ns|file.q>...")
+	}
+
+	qb := interpreter.NewInterpreter()
+	qb.Random = rand.New(rand.NewSource(*seed))
+	qb.MaxSteps = *maxSteps
+	qb.Register("printf", func(call *interpreter.Call) (bool, error) {
+		var text string
+		for _, element := range call.Arguments.Elements {
+			if s, ok := element.Value.(string); ok && element.Name == 0 {
+				text = s
+				break
+			}
+		}
+		// printf "speed: %s" s=10 substitutes each %name with the parameter called name
+		fmt.Println(printfParameter.ReplaceAllStringFunc(text, func(parameter string) string {
+			if value, ok := call.Arguments.Get(parameter[1:]); ok {
+				if s, ok := value.(string); ok {
+					return s
+				}
+				return qb.Format(value)
+			}
+			return parameter
+		}))
+		return true, nil
+	})
+	qb.Fallback = func(call *interpreter.Call) (bool, error) {
+		name := qb.Name(call.Name)
+		if call.Object != nil {
+			name = qb.Format(call.Object) + ":" + name
+		}
+		fmt.Printf("  Called %s %s\n", name, qb.Format(call.Arguments))
+		return true, nil
+	}
+
+	for _, filename := range flags.Args()[1:] {
+		var byteCode []byte
+		if strings.ToLower(filepath.Ext(filename)) == ".qb" {
+			var err error
+			if byteCode, err = ioutil.ReadFile(filename); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			var lexer compiler.Lexer
+			var parser compiler.Parser
+			bytecodeCompiler := compiler.BytecodeCompiler{}
+			if err := compiler.CompileToBytes(filename, &lexer, &parser, &bytecodeCompiler); err != nil {
+				log.Fatalf("%s: %s", filename, err)
+			}
+			byteCode = bytecodeCompiler.Bytes
+		}
+		if err := qb.Load(byteCode); err != nil {
+			log.Fatalf("%s: %s", filename, err)
+		}
+	}
+
+	returned, err := qb.Run(flags.Arg(0), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("  Returned %s\n", qb.Format(returned))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/byxor/NeverScript/table_conversion"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// RunTable turns a CSV/TSV sheet with 'name:type' headers into a global array of structs, one struct per row.
+func RunTable(args []string) {
+	flags := flag.NewFlagSet("table", flag.ExitOnError)
+	globalName := flags.String("name", "", "")
+	delimiter := flags.String("delimiter", "", "")
+	outputFilename := flags.String("o", "", "")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: ns table [-name Global] [-delimiter ,] [-o file.ns|file.qb] <file.csv|file.tsv>")
+	}
+
+	inputFilename := flags.Arg(0)
+	if *delimiter == "" {
+		*delimiter = ","
+		if strings.EqualFold(filepath.Ext(inputFilename), ".tsv") {
+			*delimiter = "\t"
+		}
+	} else if *delimiter == `\t` {
+		*delimiter = "\t"
+	}
+	if utf8.RuneCountInString(*delimiter) != 1 {
+		log.Fatalf("The delimiter must be a single character, not '%s'", *delimiter)
+	}
+	separator, _ := utf8.DecodeRuneInString(*delimiter)
+
+	if *globalName == "" {
+		*globalName = withoutExtension(filepath.Base(inputFilename))
+	}
+	if *outputFilename == "" {
+		*outputFilename = WithNsExtension(inputFilename)
+	}
+
+	file, err := os.Open(inputFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	table, err := table_conversion.ReadTable(file, separator)
+	if err != nil {
+		log.Fatalf("%s: %s", inputFilename, err)
+	}
+
+	var output []byte
+	if strings.EqualFold(filepath.Ext(*outputFilename), ".qb") {
+		output, err = table.ToByteCode(*globalName)
+	} else {
+		var sourceCode string
+		sourceCode, err = table.ToNeverScript(*globalName)
+		output = []byte(sourceCode)
+	}
+	if err != nil {
+		log.Fatalf("%s: %s", inputFilename, err)
+	}
+
+	if err := ioutil.WriteFile(*outputFilename, output, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("  Created '%s' (%d rows).\n", *outputFilename, len(table.Rows))
+}
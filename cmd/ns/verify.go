@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"github.com/byxor/NeverScript/disassembler"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+func RunVerify(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: ns verify <file.qb>...")
+	}
+
+	numBadFiles := 0
+	for _, path := range args {
+		byteCode, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		problems := disassembler.Verify(byteCode)
+		if len(problems) == 0 {
+			fmt.Printf("  '%s' is OK.\n", path)
+			continue
+		}
+		numBadFiles++
+		fmt.Printf("  '%s' has %d problem(s):\n", path, len(problems))
+		for _, problem := range problems {
+			fmt.Printf("    %s\n", problem)
+		}
+	}
+	if numBadFiles > 0 {
+		os.Exit(1)
+	}
+}
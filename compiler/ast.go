@@ -1,8 +1,16 @@
 package compiler
 
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+)
+
 type AstNode struct {
-	Kind AstKind
-	Data AstData
+	Kind   AstKind
+	Data   AstData
+	Offset int // where the node starts in the bytecode it was decompiled from (only set by the decompiler)
 }
 
 type AstKind int
@@ -52,7 +60,7 @@ const (
 )
 
 func (astKind AstKind) String() string {
-	return [...]string{
+	names := [...]string{
 		"AstKind_Root",
 		"AstKind_Assignment",
 		"AstKind_Invocation",
@@ -94,7 +102,11 @@ func (astKind AstKind) String() string {
 		"AstKind_Random",
 		"AstKind_EndOfFile",
 		"AstKind_NameTableEntry",
-	}[astKind]
+	}
+	if astKind < 0 || int(astKind) >= len(names) {
+		return "AstKind(" + strconv.Itoa(int(astKind)) + ")"
+	}
+	return names[astKind]
 }
 
 type AstData interface {
@@ -131,6 +143,7 @@ func (astData AstData_Script) astData() {}
 
 type AstData_WhileLoop struct {
 	BodyNodes    []AstNode
+	IsRaw        bool // written as it is, without the infinite loop bypasser NeverScript adds (blub loops are raw)
 }
 func (astData AstData_WhileLoop) astData() {}
 
@@ -138,6 +151,7 @@ type AstData_IfStatement struct {
 	BooleanInvocationData []bool
 	Conditions            []AstNode
 	Bodies                [][]AstNode
+	IsSwitch              bool // rebuilt from a switch (0x3C) by the decompiler, but compiled as an if/else chain
 }
 func (astData AstData_IfStatement) astData() {}
 
@@ -171,8 +185,9 @@ type AstData_Integer struct {
 func (astData AstData_Integer) astData() {}
 
 type AstData_String struct {
-	StringToken Token
-	StringBytes []byte
+	StringToken   Token
+	StringBytes   []byte
+	IsLocalString bool // local strings (0x1C) are only made by the decompiler and the JSON importer
 }
 func (astData AstData_String) astData() {}
 
@@ -227,4 +242,49 @@ type AstData_NameTableEntry struct {
 	ChecksumBytes []byte
 	Name string
 }
-func (astData AstData_NameTableEntry) astData() {}
\ No newline at end of file
+func (astData AstData_NameTableEntry) astData() {}
+
+// Value is the integer in IntegerBytes when they're set (by the decompiler, the blub parser or the qb package),
+// otherwise the integer written in IntegerToken.
+func (astData AstData_Integer) Value() int32 {
+	if len(astData.IntegerBytes) == 4 {
+		return int32(binary.LittleEndian.Uint32(astData.IntegerBytes))
+	}
+	value, _ := strconv.ParseInt(astData.IntegerToken.Data, 10, 32)
+	return int32(value)
+}
+
+// Value is the float in FloatBytes when they're set, otherwise the float written in FloatToken.
+func (astData AstData_Float) Value() float32 {
+	if len(astData.FloatBytes) == 4 {
+		return math.Float32frombits(binary.LittleEndian.Uint32(astData.FloatBytes))
+	}
+	value, _ := strconv.ParseFloat(astData.FloatToken.Data, 32)
+	return float32(value)
+}
+
+// HasName is true when the checksum comes from a name (which belongs in the name table), rather than from
+// ChecksumBytes or a #XXXXXXXX token.
+func (astData AstData_Checksum) HasName() bool {
+	return !astData.IsRawChecksum && astData.ChecksumToken.Data != ""
+}
+
+// Checksum is the checksum of the name in ChecksumToken, or the raw checksum in ChecksumBytes or a #XXXXXXXX token.
+func (astData AstData_Checksum) Checksum() uint32 {
+	if astData.HasName() {
+		return StringToChecksum(astData.ChecksumToken.Data)
+	}
+	if len(astData.ChecksumBytes) == 4 {
+		return binary.LittleEndian.Uint32(astData.ChecksumBytes)
+	}
+	checksum, _ := strconv.ParseUint(strings.TrimPrefix(astData.ChecksumToken.Data, "#"), 16, 32)
+	return uint32(checksum)
+}
+
+// Text is the string without quotes, from StringToken when it's set, otherwise from StringBytes (without the NUL).
+func (astData AstData_String) Text() string {
+	if astData.StringToken.Data != "" {
+		return astData.StringToken.Data[1 : len(astData.StringToken.Data)-1]
+	}
+	return strings.TrimSuffix(string(astData.StringBytes), "\x00")
+}
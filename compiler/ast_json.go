@@ -0,0 +1,471 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The JSON encoding of the AST is meant for other tools, so it doesn't depend on the Go types:
+//
+//   - Every node is an object with a "kind" (its AstKind without the "AstKind_" prefix) and the fields below.
+//   - Root: "body". Script: "name", "parameters", "body".
+//     WhileLoop: "body", and "raw": true for loops without the infinite loop bypasser (like blub loops).
+//   - IfStatement: "branches", each with a "condition" (and "booleanInvocation": true for if @(...)) and a "body".
+//     The last branch has no condition when there's an else.
+//   - Random: "branches", each with a "weight" and a "body".
+//   - Assignment: "name", "value". Invocation: "script", "arguments".
+//   - Return, LogicalNot, UnaryExpression (parentheses) and LocalReference: "value".
+//   - Binary expressions (AdditionExpression, LogicalAnd, DotExpression...): "left", "right".
+//   - Struct and Array: "elements". ArrayAccess: "array", "index".
+//   - Checksum: "checksum" ("#XXXXXXXX"), and "name" when it has one. NameTableEntry: "checksum", "name".
+//   - Integer: "value". Float: "value" (a number, or "0xXXXXXXXX" bits for NaN and infinity).
+//     String: "value", and "local": true for local strings. Pair and Vector: "value", an array of numbers.
+//   - Comment: "text".
+//   - NewLine, Comma, Break, AllArguments and EndOfFile have no other fields.
+//   - Checksums, numbers, strings and comments from source code have a "line" and "column".
+
+type jsonField struct {
+	Key   string
+	Value interface{}
+}
+
+// jsonObject keeps its fields in order, so "kind" comes first.
+type jsonObject []jsonField
+
+func (object jsonObject) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, field := range object {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+func (node AstNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encodeAstNode(node))
+}
+
+func (node *AstNode) UnmarshalJSON(jsonBytes []byte) error {
+	decoded, err := decodeAstNode(jsonBytes, "root")
+	if err != nil {
+		return err
+	}
+	*node = decoded
+	return nil
+}
+
+// AstToJson writes a node (usually the root) as indented JSON.
+func AstToJson(node AstNode) ([]byte, error) {
+	return json.MarshalIndent(encodeAstNode(node), "", "  ")
+}
+
+// AstFromJson reads a node written by AstToJson (or by another tool using the same format).
+// The node can be passed straight to GenerateBytecode.
+func AstFromJson(jsonBytes []byte) (AstNode, error) {
+	return decodeAstNode(jsonBytes, "root")
+}
+
+func encodeAstNode(node AstNode) jsonObject {
+	object := jsonObject{{"kind", strings.TrimPrefix(AstKind(node.Kind).String(), "AstKind_")}}
+	add := func(key string, value interface{}) {
+		object = append(object, jsonField{key, value})
+	}
+	nodes := func(nodes []AstNode) []jsonObject {
+		objects := []jsonObject{}
+		for _, node := range nodes {
+			objects = append(objects, encodeAstNode(node))
+		}
+		return objects
+	}
+	addPosition := func(token Token) {
+		if token.LineNumber > 0 {
+			add("line", token.LineNumber)
+			add("column", token.Column)
+		}
+	}
+	floats := func(floatNodes ...AstNode) []interface{} {
+		var values []interface{}
+		for _, floatNode := range floatNodes {
+			values = append(values, encodeFloat(floatNode.Data.(AstData_Float).Value()))
+		}
+		return values
+	}
+
+	switch data := node.Data.(type) {
+	case AstData_Root:
+		add("body", nodes(data.BodyNodes))
+	case AstData_Assignment:
+		add("name", encodeAstNode(data.NameNode))
+		add("value", encodeAstNode(data.ValueNode))
+	case AstData_Invocation:
+		add("script", encodeAstNode(data.ScriptIdentifierNode))
+		add("arguments", nodes(data.ParameterNodes))
+	case AstData_Script:
+		add("name", encodeAstNode(data.NameNode))
+		add("parameters", nodes(data.DefaultParameterNodes))
+		add("body", nodes(data.BodyNodes))
+	case AstData_WhileLoop:
+		add("body", nodes(data.BodyNodes))
+		if data.IsRaw {
+			add("raw", true)
+		}
+	case AstData_IfStatement:
+		branches := []jsonObject{}
+		for i, body := range data.Bodies {
+			var branch jsonObject
+			if i < len(data.Conditions) {
+				branch = append(branch, jsonField{"condition", encodeAstNode(data.Conditions[i])})
+				if i < len(data.BooleanInvocationData) && data.BooleanInvocationData[i] {
+					branch = append(branch, jsonField{"booleanInvocation", true})
+				}
+			}
+			branches = append(branches, append(branch, jsonField{"body", nodes(body)}))
+		}
+		add("branches", branches)
+	case AstData_Random:
+		branches := []jsonObject{}
+		for i, body := range data.Branches {
+			branches = append(branches, jsonObject{
+				{"weight", data.BranchWeights[i].Data.(AstData_Integer).Value()},
+				{"body", nodes(body)},
+			})
+		}
+		add("branches", branches)
+	case AstData_Comment:
+		add("text", data.CommentToken.Data)
+		addPosition(data.CommentToken)
+	case AstData_LocalReference:
+		add("value", encodeAstNode(data.Node))
+	case AstData_UnaryExpression:
+		add("value", encodeAstNode(data.Node))
+	case AstData_BinaryExpression:
+		add("left", encodeAstNode(data.LeftNode))
+		add("right", encodeAstNode(data.RightNode))
+	case AstData_Checksum:
+		add("checksum", fmt.Sprintf("#%08X", data.Checksum()))
+		if data.HasName() {
+			add("name", data.ChecksumToken.Data)
+		}
+		addPosition(data.ChecksumToken)
+	case AstData_Integer:
+		add("value", data.Value())
+		addPosition(data.IntegerToken)
+	case AstData_Float:
+		add("value", encodeFloat(data.Value()))
+		addPosition(data.FloatToken)
+	case AstData_String:
+		add("value", data.Text())
+		if data.IsLocalString {
+			add("local", true)
+		}
+		addPosition(data.StringToken)
+	case AstData_Pair:
+		add("value", floats(data.FloatNodeA, data.FloatNodeB))
+	case AstData_Vector:
+		add("value", floats(data.FloatNodeA, data.FloatNodeB, data.FloatNodeC))
+	case AstData_Struct:
+		add("elements", nodes(data.ElementNodes))
+	case AstData_Array:
+		add("elements", nodes(data.ElementNodes))
+	case AstData_ArrayAccess:
+		add("array", encodeAstNode(data.Array))
+		add("index", encodeAstNode(data.Index))
+	case AstData_NameTableEntry:
+		add("checksum", fmt.Sprintf("#%08X", binary.LittleEndian.Uint32(data.ChecksumBytes)))
+		add("name", data.Name)
+	}
+	return object
+}
+
+func encodeFloat(f float32) interface{} {
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return fmt.Sprintf("0x%08X", math.Float32bits(f))
+	}
+	return json.Number(strconv.FormatFloat(float64(f), 'g', -1, 32))
+}
+
+var astKindsByName = func() map[string]AstKind {
+	kinds := make(map[string]AstKind)
+	for kind := AstKind(AstKind_Root); kind <= AstKind_NameTableEntry; kind++ {
+		kinds[strings.TrimPrefix(kind.String(), "AstKind_")] = kind
+	}
+	return kinds
+}()
+
+func decodeAstNode(jsonBytes []byte, path string) (AstNode, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(jsonBytes, &object); err != nil || object == nil {
+		return AstNode{}, fmt.Errorf("%s: Expected a node, e.g. {\"kind\": \"NewLine\"}", path)
+	}
+	failure := func(format string, arguments ...interface{}) (AstNode, error) {
+		return AstNode{}, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, arguments...))
+	}
+
+	var kindName string
+	if err := json.Unmarshal(object["kind"], &kindName); err != nil {
+		return failure("Expected a \"kind\"")
+	}
+	kind, isKnownKind := astKindsByName[kindName]
+	if !isKnownKind {
+		return failure("Unknown kind '%s'", kindName)
+	}
+
+	// the first error is kept, so the fields can be read one after another without checking each one
+	var err error
+	field := func(key string, value interface{}, isRequired bool) {
+		raw, exists := object[key]
+		if err != nil || (!exists && !isRequired) {
+			return
+		}
+		if !exists {
+			err = fmt.Errorf("%s: Missing \"%s\"", path, key)
+		} else if unmarshalErr := json.Unmarshal(raw, value); unmarshalErr != nil {
+			err = fmt.Errorf("%s.%s: %s", path, key, unmarshalErr)
+		}
+	}
+	nodeAt := func(raw json.RawMessage, path string) AstNode {
+		if err != nil {
+			return AstNode{}
+		}
+		var decoded AstNode
+		decoded, err = decodeAstNode(raw, path)
+		return decoded
+	}
+	node := func(key string) AstNode {
+		var raw json.RawMessage
+		field(key, &raw, true)
+		return nodeAt(raw, path+"."+key)
+	}
+	nodesAt := func(raws []json.RawMessage, path string) []AstNode {
+		var decoded []AstNode
+		for i, raw := range raws {
+			decoded = append(decoded, nodeAt(raw, fmt.Sprintf("%s[%d]", path, i)))
+		}
+		return decoded
+	}
+	nodes := func(key string) []AstNode {
+		var raws []json.RawMessage
+		field(key, &raws, false)
+		return nodesAt(raws, path+"."+key)
+	}
+	token := func(kind TokenKind, data string) Token {
+		token := Token{Kind: kind, Data: data}
+		field("line", &token.LineNumber, false)
+		field("column", &token.Column, false)
+		return token
+	}
+	floatAt := func(raw json.RawMessage, path string) AstNode {
+		if err != nil {
+			return AstNode{}
+		}
+		var value float32
+		var bits string
+		if json.Unmarshal(raw, &bits) == nil && strings.HasPrefix(bits, "0x") {
+			parsedBits, parseErr := strconv.ParseUint(bits[2:], 16, 32)
+			if parseErr != nil {
+				err = fmt.Errorf("%s: '%s' isn't 32 bits of hex", path, bits)
+			}
+			value = math.Float32frombits(uint32(parsedBits))
+		} else if parsed, parseErr := strconv.ParseFloat(string(raw), 32); parseErr == nil {
+			value = float32(parsed)
+		} else {
+			err = fmt.Errorf("%s: %s isn't a 32-bit float", path, raw)
+		}
+		floatBytes := make([]byte, 4)
+		binary.LittleEndian.PutUint32(floatBytes, math.Float32bits(value))
+		return AstNode{
+			Kind: AstKind_Float,
+			Data: AstData_Float{
+				FloatToken: token(TokenKind_Float, strconv.FormatFloat(float64(value), 'g', -1, 32)),
+				FloatBytes: floatBytes,
+			},
+		}
+	}
+	floats := func(count int) []AstNode {
+		var raws []json.RawMessage
+		field("value", &raws, true)
+		if err == nil && len(raws) != count {
+			err = fmt.Errorf("%s.value: Expected %d numbers, found %d", path, count, len(raws))
+		}
+		var floatNodes []AstNode
+		for i, raw := range raws {
+			floatNodes = append(floatNodes, floatAt(raw, fmt.Sprintf("%s.value[%d]", path, i)))
+		}
+		return floatNodes
+	}
+	checksum := func() []byte {
+		var text string
+		field("checksum", &text, true)
+		value, parseErr := strconv.ParseUint(strings.TrimPrefix(text, "#"), 16, 32)
+		if err == nil && (parseErr != nil || !strings.HasPrefix(text, "#")) {
+			err = fmt.Errorf("%s.checksum: Expected #XXXXXXXX, found '%s'", path, text)
+		}
+		checksumBytes := make([]byte, 4)
+		binary.LittleEndian.PutUint32(checksumBytes, uint32(value))
+		return checksumBytes
+	}
+
+	decoded := AstNode{Kind: kind, Data: AstData_Empty{}}
+	switch kind {
+	case AstKind_Root:
+		decoded.Data = AstData_Root{BodyNodes: nodes("body")}
+	case AstKind_Assignment:
+		decoded.Data = AstData_Assignment{NameNode: node("name"), ValueNode: node("value")}
+	case AstKind_Invocation:
+		decoded.Data = AstData_Invocation{ScriptIdentifierNode: node("script"), ParameterNodes: nodes("arguments")}
+	case AstKind_Script:
+		data := AstData_Script{NameNode: node("name"), DefaultParameterNodes: nodes("parameters"), BodyNodes: nodes("body")}
+		if err == nil && data.NameNode.Kind != AstKind_Checksum {
+			return failure("A script's name has to be a Checksum")
+		}
+		decoded.Data = data
+	case AstKind_WhileLoop:
+		data := AstData_WhileLoop{BodyNodes: nodes("body")}
+		field("raw", &data.IsRaw, false)
+		decoded.Data = data
+	case AstKind_IfStatement:
+		var branches []map[string]json.RawMessage
+		field("branches", &branches, true)
+		var data AstData_IfStatement
+		for i, branch := range branches {
+			branchPath := fmt.Sprintf("%s.branches[%d]", path, i)
+			if condition, hasCondition := branch["condition"]; hasCondition {
+				if len(data.Bodies) > len(data.Conditions) && err == nil {
+					err = fmt.Errorf("%s: Only the last branch can be an else (without a condition)", branchPath)
+				}
+				var isBooleanInvocation bool
+				if raw, exists := branch["booleanInvocation"]; exists && err == nil {
+					if unmarshalErr := json.Unmarshal(raw, &isBooleanInvocation); unmarshalErr != nil {
+						err = fmt.Errorf("%s.booleanInvocation: %s", branchPath, unmarshalErr)
+					}
+				}
+				data.Conditions = append(data.Conditions, nodeAt(condition, branchPath+".condition"))
+				data.BooleanInvocationData = append(data.BooleanInvocationData, isBooleanInvocation)
+			} else if i == 0 && err == nil {
+				err = fmt.Errorf("%s: The first branch needs a condition", branchPath)
+			}
+			var body []json.RawMessage
+			if unmarshalErr := json.Unmarshal(branch["body"], &body); unmarshalErr != nil && branch["body"] != nil && err == nil {
+				err = fmt.Errorf("%s.body: %s", branchPath, unmarshalErr)
+			}
+			data.Bodies = append(data.Bodies, nodesAt(body, branchPath+".body"))
+		}
+		if len(branches) == 0 && err == nil {
+			err = fmt.Errorf("%s.branches: An if-statement needs at least one branch", path)
+		}
+		decoded.Data = data
+	case AstKind_Random:
+		var branches []struct {
+			Weight uint16
+			Body   []json.RawMessage
+		}
+		field("branches", &branches, true)
+		var data AstData_Random
+		for i, branch := range branches {
+			data.BranchWeights = append(data.BranchWeights, integerNode(int32(branch.Weight), Token{}))
+			data.Branches = append(data.Branches, nodesAt(branch.Body, fmt.Sprintf("%s.branches[%d].body", path, i)))
+		}
+		if len(branches) == 0 && err == nil {
+			err = fmt.Errorf("%s.branches: Random needs at least one branch", path)
+		}
+		decoded.Data = data
+	case AstKind_Comment:
+		var text string
+		field("text", &text, true)
+		tokenKind := TokenKind_SingleLineComment
+		if strings.HasPrefix(text, "/*") {
+			tokenKind = TokenKind_MultiLineComment
+		}
+		decoded.Data = AstData_Comment{CommentToken: token(tokenKind, text)}
+	case AstKind_LocalReference:
+		decoded.Data = AstData_LocalReference{Node: node("value")}
+	case AstKind_Return:
+		value := node("value")
+		if err == nil && value.Kind != AstKind_Checksum && value.Kind != AstKind_Invocation {
+			return failure("A return's value has to be a Checksum (return) or an Invocation (return x=1)")
+		}
+		decoded.Data = AstData_UnaryExpression{Node: value}
+	case AstKind_LogicalNot, AstKind_UnaryExpression:
+		decoded.Data = AstData_UnaryExpression{Node: node("value")}
+	case AstKind_LogicalAnd, AstKind_LogicalOr,
+		AstKind_AdditionExpression, AstKind_SubtractionExpression, AstKind_MultiplicationExpression, AstKind_DivisionExpression,
+		AstKind_GreaterThanExpression, AstKind_GreaterThanEqualsExpression, AstKind_LessThanExpression, AstKind_LessThanEqualsExpression,
+		AstKind_EqualsExpression, AstKind_NotEqualExpression, AstKind_DotExpression, AstKind_ColonExpression:
+		decoded.Data = AstData_BinaryExpression{LeftNode: node("left"), RightNode: node("right")}
+	case AstKind_Checksum:
+		var name string
+		field("name", &name, false)
+		if name != "" {
+			decoded.Data = AstData_Checksum{ChecksumToken: token(TokenKind_Identifier, name)}
+		} else {
+			checksumBytes := checksum()
+			decoded.Data = AstData_Checksum{
+				IsRawChecksum: true,
+				ChecksumToken: token(TokenKind_RawChecksum, fmt.Sprintf("#%08X", binary.LittleEndian.Uint32(checksumBytes))),
+				ChecksumBytes: checksumBytes,
+			}
+		}
+	case AstKind_Integer:
+		var value int32
+		field("value", &value, true)
+		decoded = integerNode(value, token(TokenKind_Integer, strconv.Itoa(int(value))))
+	case AstKind_Float:
+		decoded = floatAt(object["value"], path+".value")
+	case AstKind_String:
+		var text string
+		var isLocalString bool
+		field("value", &text, true)
+		field("local", &isLocalString, false)
+		decoded.Data = AstData_String{StringToken: token(TokenKind_String, "\""+text+"\""), IsLocalString: isLocalString}
+	case AstKind_Pair:
+		floatNodes := floats(2)
+		if err == nil {
+			decoded.Data = AstData_Pair{FloatNodeA: floatNodes[0], FloatNodeB: floatNodes[1]}
+		}
+	case AstKind_Vector:
+		floatNodes := floats(3)
+		if err == nil {
+			decoded.Data = AstData_Vector{FloatNodeA: floatNodes[0], FloatNodeB: floatNodes[1], FloatNodeC: floatNodes[2]}
+		}
+	case AstKind_Struct:
+		decoded.Data = AstData_Struct{ElementNodes: nodes("elements")}
+	case AstKind_Array:
+		decoded.Data = AstData_Array{ElementNodes: nodes("elements")}
+	case AstKind_ArrayAccess:
+		decoded.Data = AstData_ArrayAccess{Array: node("array"), Index: node("index")}
+	case AstKind_NameTableEntry:
+		var name string
+		checksumBytes := checksum()
+		field("name", &name, true)
+		decoded.Data = AstData_NameTableEntry{ChecksumBytes: checksumBytes, Name: name}
+	}
+	if err != nil {
+		return AstNode{}, err
+	}
+	return decoded, nil
+}
+
+func integerNode(value int32, token Token) AstNode {
+	integerBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(integerBytes, uint32(value))
+	return AstNode{
+		Kind: AstKind_Integer,
+		Data: AstData_Integer{IntegerToken: token, IntegerBytes: integerBytes},
+	}
+}
@@ -0,0 +1,127 @@
+package compiler_test
+
+import (
+	"bytes"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Every test input is parsed, written as JSON and read back, which should compile into the same bytes.
+func TestAstJsonRoundTrip(t *testing.T) {
+	for _, input := range testInputs(t) {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			var lexer compiler.Lexer
+			var parser compiler.Parser
+			if err := compiler.ParseFile(input, &lexer, &parser); err != nil {
+				t.Fatal(err)
+			}
+			jsonBytes, err := compiler.AstToJson(parser.Result.Node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rootNode, err := compiler.AstFromJson(jsonBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: rootNode}
+			compiler.GenerateBytecode(&bytecodeCompiler)
+			if !bytes.Equal(compile(t, input), bytecodeCompiler.Bytes) {
+				t.Error("The AST read back from JSON compiled into different bytes")
+			}
+			if reencoded, _ := compiler.AstToJson(rootNode); !bytes.Equal(jsonBytes, reencoded) {
+				t.Error("The AST read back from JSON was written as different JSON")
+			}
+		})
+	}
+}
+
+// Trees from the decompiler have checksums and numbers without tokens, and name table entries. Once they've been
+// through decompiler.ToCompilerAst, they should compile back into the same bytes.
+func TestAstJsonOfDecompiledByteCode(t *testing.T) {
+	for _, input := range testInputs(t) {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			byteCode := compile(t, input)
+			arguments := decompiler.Arguments{ByteCode: byteCode}
+			if err := decompiler.ParseByteCode(&arguments); err != nil {
+				t.Fatal(err)
+			}
+			jsonBytes, err := compiler.AstToJson(decompiler.ToCompilerAst(arguments.RootNode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, expected := range []string{`"kind": "NameTableEntry"`, `"kind": "EndOfFile"`} {
+				if !strings.Contains(string(jsonBytes), expected) {
+					t.Errorf("Expected the JSON to contain %s", expected)
+				}
+			}
+			rootNode, err := compiler.AstFromJson(jsonBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reencoded, _ := compiler.AstToJson(rootNode); !bytes.Equal(jsonBytes, reencoded) {
+				t.Error("The AST read back from JSON was written as different JSON")
+			}
+
+			bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: rootNode}
+			compiler.GenerateBytecode(&bytecodeCompiler)
+			checkSameByteCode(t, byteCode, bytecodeCompiler.Bytes)
+		})
+	}
+}
+
+// A script named by a raw checksum keeps that checksum, rather than being named "#738C9ADE".
+func TestAstJsonOfRawChecksumNames(t *testing.T) {
+	var lexer compiler.Lexer
+	var parser compiler.Parser
+	if err := compiler.ParseSourceCode("script #738C9ADE a=1 {\n}\n", false, &lexer, &parser); err != nil {
+		t.Fatal(err)
+	}
+	jsonBytes, err := compiler.AstToJson(parser.Result.Node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(jsonBytes), `"checksum": "#738C9ADE"`) || strings.Contains(string(jsonBytes), `"name": "#738C9ADE"`) {
+		t.Errorf("Expected the script's name to be the checksum #738C9ADE, got:\n%s", jsonBytes)
+	}
+
+	rootNode, err := compiler.AstFromJson(jsonBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: rootNode}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+	if !bytes.Contains(bytecodeCompiler.Bytes, []byte{0x16, 0xDE, 0x9A, 0x8C, 0x73}) {
+		t.Error("Expected the script to be named by the checksum #738C9ADE")
+	}
+	if bytes.Contains(bytecodeCompiler.Bytes, []byte("#738C9ADE")) {
+		t.Error("Expected no name table entry for the checksum #738C9ADE")
+	}
+}
+
+func TestAstJsonErrors(t *testing.T) {
+	testCases := []struct {
+		json          string
+		expectedError string
+	}{
+		{`[]`, `root: Expected a node`},
+		{`{"kind": "Nope"}`, `root: Unknown kind 'Nope'`},
+		{`{"kind": "Root", "body": [{"kind": "Assignment", "name": {"kind": "Checksum", "name": "x"}}]}`, `root.body[0]: Missing "value"`},
+		{`{"kind": "Root", "body": [{"kind": "Integer", "value": 1.5}]}`, `root.body[0].value: `},
+		{`{"kind": "Float", "value": "fast"}`, `root.value: "fast" isn't a 32-bit float`},
+		{`{"kind": "Checksum", "checksum": "1234"}`, `root.checksum: Expected #XXXXXXXX, found '1234'`},
+		{`{"kind": "Vector", "value": [1, 2]}`, `root.value: Expected 3 numbers, found 2`},
+		{`{"kind": "IfStatement", "branches": [{"body": []}]}`, `root.branches[0]: The first branch needs a condition`},
+		{`{"kind": "IfStatement", "branches": [{"condition": {"kind": "Integer", "value": 1}}, {}, {"condition": {"kind": "Integer", "value": 1}}]}`, `root.branches[2]: Only the last branch can be an else`},
+		{`{"kind": "Random", "branches": []}`, `root.branches: Random needs at least one branch`},
+	}
+	for _, testCase := range testCases {
+		_, err := compiler.AstFromJson([]byte(testCase.json))
+		if err == nil || !strings.HasPrefix(err.Error(), testCase.expectedError) {
+			t.Errorf("Expected error '%s...' for %s, got %v", testCase.expectedError, testCase.json, err)
+		}
+	}
+}
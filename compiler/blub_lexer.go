@@ -0,0 +1,250 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// LexBlubSourceCode does lexical analysis of roq's "blub" syntax, producing the same kinds of tokens as LexSourceCode
+// so BuildAbstractSyntaxTreeFromBlub can produce the same AST.
+//
+// Whitespace isn't significant in blub; new-lines are written explicitly as ':i'.
+func LexBlubSourceCode(lexer *Lexer) {
+
+	CanFindKeyword := func(keyword string) bool {
+		return strings.HasPrefix(lexer.SourceCode[lexer.Index:], keyword)
+	}
+
+	// Like CanFindKeyword, but doesn't match the start of a longer word (e.g. "if" in "ifdef").
+	CanFindWord := func(word string) bool {
+		if !CanFindKeyword(word) {
+			return false
+		}
+		end := lexer.Index + len(word)
+		if end >= len(lexer.SourceCode) {
+			return true
+		}
+		next := rune(lexer.SourceCode[end])
+		return !(unicode.IsLetter(next) || unicode.IsDigit(next) || next == '_')
+	}
+
+	// CanFindCall finds things like "%i(10,0000000a)", returning the whole call and the text between the parentheses.
+	CanFindCall := func(prefix string) (string, string, bool) {
+		if !CanFindKeyword(prefix + "(") {
+			return "", "", false
+		}
+		start := lexer.Index
+		end := strings.IndexByte(lexer.SourceCode[start:], ')')
+		if end == -1 {
+			return "", "", false
+		}
+		end += start + 1
+		return lexer.SourceCode[start:end], lexer.SourceCode[start+len(prefix)+1 : end-1], true
+	}
+
+	// Strings aren't escaped, so the length is used to find the end of the text (falling back to the first '")' if
+	// the length is wrong, e.g. after the text was edited by hand).
+	CanFindString := func(prefix string) (string, string, bool) {
+		if !CanFindKeyword(prefix + "(") {
+			return "", "", false
+		}
+		start := lexer.Index
+		comma := strings.Index(lexer.SourceCode[start:], ",\"")
+		if comma == -1 {
+			return "", "", false
+		}
+		comma += start
+		textStart := comma + 2
+		size, err := strconv.Atoi(lexer.SourceCode[start+len(prefix)+1 : comma])
+		if err == nil && textStart+size+2 <= len(lexer.SourceCode) && lexer.SourceCode[textStart+size:textStart+size+2] == "\")" {
+			return lexer.SourceCode[start : textStart+size+2], lexer.SourceCode[textStart : textStart+size], true
+		}
+		textEnd := strings.Index(lexer.SourceCode[textStart:], "\")")
+		if textEnd == -1 {
+			return "", "", false
+		}
+		textEnd += textStart
+		return lexer.SourceCode[start : textEnd+2], lexer.SourceCode[textStart:textEnd], true
+	}
+
+	CanFindName := func() (string, bool) {
+		if lexer.SourceCode[lexer.Index] != '$' {
+			return "", false
+		}
+		end := strings.IndexAny(lexer.SourceCode[lexer.Index+1:], "$\n")
+		if end == -1 || lexer.SourceCode[lexer.Index+1+end] != '$' {
+			return "", false
+		}
+		return lexer.SourceCode[lexer.Index : lexer.Index+end+2], true
+	}
+
+	CanFindSingleLineComment := func() (string, bool) {
+		if !CanFindKeyword("//") {
+			return "", false
+		}
+		end := strings.IndexByte(lexer.SourceCode[lexer.Index:], '\n')
+		if end == -1 {
+			return lexer.SourceCode[lexer.Index:], true
+		}
+		return lexer.SourceCode[lexer.Index : lexer.Index+end], true
+	}
+
+	CanFindMultiLineComment := func() (string, bool) {
+		if !CanFindKeyword("/*") {
+			return "", false
+		}
+		end := strings.Index(lexer.SourceCode[lexer.Index+2:], "*/")
+		if end == -1 {
+			return lexer.SourceCode[lexer.Index:], true
+		}
+		return lexer.SourceCode[lexer.Index : lexer.Index+2+end+2], true
+	}
+
+	SaveToken := func(kind TokenKind, data string, size int) {
+		startOfLine := strings.LastIndexByte(lexer.SourceCode[:lexer.Index], '\n') + 1
+		lexer.Tokens = append(lexer.Tokens, Token{
+			Kind:       kind,
+			Data:       data,
+			LineNumber: lexer.LineNumber,
+			Column:     lexer.Index - startOfLine + 1,
+		})
+		lexer.NumTokens++
+		lexer.LineNumber += strings.Count(lexer.SourceCode[lexer.Index:lexer.Index+size], "\n")
+		lexer.Index += size
+	}
+
+	lexer.LineNumber = 1
+	for lexer.Index < lexer.SourceCodeSize {
+		if whole, inside, found := CanFindCall("%i"); found {
+			value, err := strconv.ParseInt(strings.TrimSpace(strings.Split(inside, ",")[0]), 10, 64)
+			if err != nil {
+				fmt.Printf("\nLexer failed at integer: '%s'...\n", whole)
+				break
+			}
+			SaveToken(TokenKind_Integer, strconv.Itoa(int(int32(value))), len(whole))
+		} else if whole, inside, found := CanFindCall("%f"); found {
+			SaveToken(TokenKind_Float, strings.TrimSpace(inside), len(whole))
+		} else if whole, inside, found := CanFindCall("%vec2"); found {
+			SaveToken(TokenKind_Pair, inside, len(whole))
+		} else if whole, inside, found := CanFindCall("%vec3"); found {
+			SaveToken(TokenKind_Vector, inside, len(whole))
+		} else if whole, text, found := CanFindString("%s"); found {
+			SaveToken(TokenKind_String, "\""+text+"\"", len(whole))
+		} else if whole, text, found := CanFindString("%sc"); found { // local strings become normal strings
+			SaveToken(TokenKind_String, "\""+text+"\"", len(whole))
+		} else if whole, inside, found := CanFindCall("select"); found {
+			SaveToken(TokenKind_Random, inside, len(whole))
+		} else if whole, inside, found := CanFindCall(":OFFSET"); found {
+			SaveToken(TokenKind_RandomOffset, inside, len(whole))
+		} else if whole, inside, found := CanFindCall(":POS"); found {
+			SaveToken(TokenKind_RandomPosition, inside, len(whole))
+		} else if whole, inside, found := CanFindCall(":BREAKTO"); found {
+			SaveToken(TokenKind_RandomBreak, inside, len(whole))
+		} else if name, found := CanFindName(); found {
+			SaveToken(TokenKind_Identifier, name[1:len(name)-1], len(name))
+		} else if CanFindKeyword("#\"") { // #"0x1234abcd"
+			end := strings.IndexByte(lexer.SourceCode[lexer.Index+2:], '"')
+			if end == -1 {
+				fmt.Printf("\nLexer failed at unterminated checksum...\n")
+				break
+			}
+			whole := lexer.SourceCode[lexer.Index : lexer.Index+2+end+1]
+			checksum, err := strconv.ParseUint(whole[2:len(whole)-1], 0, 32)
+			if err != nil {
+				fmt.Printf("\nLexer failed at checksum: '%s'...\n", whole)
+				break
+			}
+			SaveToken(TokenKind_RawChecksum, fmt.Sprintf("#%08X", checksum), len(whole))
+		} else if comment, found := CanFindSingleLineComment(); found {
+			SaveToken(TokenKind_SingleLineComment, comment, len(comment))
+		} else if comment, found := CanFindMultiLineComment(); found {
+			SaveToken(TokenKind_MultiLineComment, comment, len(comment))
+		} else if CanFindKeyword("%GLOBAL%") {
+			SaveToken(TokenKind_LocalReference, "%GLOBAL%", 8)
+		} else if CanFindWord(":i") {
+			SaveToken(TokenKind_NewLine, ":i", 2)
+		} else if CanFindWord(":end") {
+			SaveToken(TokenKind_EndOfFile, ":end", 4)
+		} else if CanFindKeyword(":a{") {
+			SaveToken(TokenKind_LeftSquareBracket, ":a{", 3)
+		} else if CanFindKeyword(":a}") {
+			SaveToken(TokenKind_RightSquareBracket, ":a}", 3)
+		} else if CanFindKeyword(":s{") {
+			SaveToken(TokenKind_LeftCurlyBrace, ":s{", 3)
+		} else if CanFindKeyword(":s}") {
+			SaveToken(TokenKind_RightCurlyBrace, ":s}", 3)
+		} else if CanFindKeyword("<=") {
+			SaveToken(TokenKind_LessThanEquals, "<=", 2)
+		} else if CanFindKeyword(">=") {
+			SaveToken(TokenKind_GreaterThanEquals, ">=", 2)
+		} else {
+			switch lexer.SourceCode[lexer.Index] {
+			case ' ', '\t', '\r':
+				lexer.Index++
+			case '\n':
+				lexer.LineNumber++
+				lexer.Index++
+			case '=':
+				SaveToken(TokenKind_Equals, "=", 1)
+			case ';':
+				SaveToken(TokenKind_Comma, ";", 1)
+			case '(':
+				SaveToken(TokenKind_LeftParenthesis, "(", 1)
+			case ')':
+				SaveToken(TokenKind_RightParenthesis, ")", 1)
+			case '<':
+				SaveToken(TokenKind_LeftAngleBracket, "<", 1)
+			case '>':
+				SaveToken(TokenKind_RightAngleBracket, ">", 1)
+			case '+':
+				SaveToken(TokenKind_Plus, "+", 1)
+			case '-':
+				SaveToken(TokenKind_Minus, "-", 1)
+			case '*':
+				SaveToken(TokenKind_Asterisk, "*", 1)
+			case '/':
+				SaveToken(TokenKind_ForwardSlash, "/", 1)
+			case '.':
+				SaveToken(TokenKind_Dot, ".", 1)
+			case ':':
+				SaveToken(TokenKind_Colon, ":", 1)
+			default:
+				keywords := []struct {
+					Word string
+					Kind TokenKind
+				}{
+					{"function", TokenKind_Script},
+					{"endfunction", TokenKind_EndScript},
+					{"if", TokenKind_If},
+					{"else", TokenKind_Else},
+					{"endif", TokenKind_EndIf},
+					{"while", TokenKind_While},
+					{"loop_to", TokenKind_EndWhile},
+					{"continue", TokenKind_Break},
+					{"return", TokenKind_Return},
+					{"isNull", TokenKind_AllArguments},
+					{"AND", TokenKind_And},
+					{"OR", TokenKind_Or},
+					{"NOT", TokenKind_Bang},
+				}
+				foundKeyword := false
+				for _, keyword := range keywords {
+					if CanFindWord(keyword.Word) {
+						SaveToken(keyword.Kind, keyword.Word, len(keyword.Word))
+						foundKeyword = true
+						break
+					}
+				}
+				if !foundKeyword {
+					character := lexer.SourceCode[lexer.Index]
+					fmt.Printf("\nLexer failed at character: '%c' (%#x) on line %d...\n", character, character, lexer.LineNumber)
+					lexer.Tokens = lexer.Tokens[:lexer.NumTokens]
+					return
+				}
+			}
+		}
+	}
+	lexer.Tokens = lexer.Tokens[:lexer.NumTokens]
+}
@@ -0,0 +1,732 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// BuildAbstractSyntaxTreeFromBlub parses tokens from LexBlubSourceCode into the same AST that BuildAbstractSyntaxTree
+// produces, so it can be compiled by GenerateBytecode.
+//
+// Literal nodes also have their bytes filled in (like nodes from the decompiler), so the AST can be rendered as
+// NeverScript by the decompiler package.
+func BuildAbstractSyntaxTreeFromBlub(parser *Parser) {
+	var ParseRoot func() ParseResult
+	var ParseStatement func(index int) ParseResult
+	var ParseBodyOfCode func(index int, endKinds ...TokenKind) (ParseResult, []AstNode)
+	var ParseScript func(index int) ParseResult
+	var ParseIfStatement func(index int) ParseResult
+	var ParseWhileLoop func(index int) ParseResult
+	var ParseReturn func(index int) ParseResult
+	var ParseRandom func(index int) ParseResult
+	var ParseAssignment func(index int) ParseResult
+	var ParseParameters func(index int) ([]AstNode, int)
+	var ParseParameter func(index int) ParseResult
+	var ParseExpression func(index int, allowInvocations bool, allowEquals bool) ParseResult
+	var ParseOperand func(index int, allowInvocations bool) ParseResult
+	var ParseElements func(index int, endKind TokenKind) ([]AstNode, int, bool)
+	var ParseChecksum func(index int) ParseResult
+	var ParseInteger func(index int) ParseResult
+	var ParseFloat func(token Token) (AstNode, bool)
+	var GetKind func(index int) TokenKind
+	var GetToken func(index int) Token
+
+	failure := func(reason string) ParseResult {
+		return ParseResult{
+			WasSuccessful: false,
+			Reason:        reason,
+		}
+	}
+
+	simpleNode := func(kind AstKind) ParseResult {
+		return ParseResult{
+			WasSuccessful:  true,
+			Node:           AstNode{Kind: kind, Data: AstData_Empty{}},
+			TokensConsumed: 1,
+		}
+	}
+
+	isChecksumKind := func(kind TokenKind) bool {
+		return kind == TokenKind_Identifier || kind == TokenKind_RawChecksum
+	}
+
+	// blub puts operands and parameters next to each other, so this is what decides where an invocation's parameters end.
+	isStartOfOperand := func(kind TokenKind) bool {
+		switch kind {
+		case TokenKind_Identifier, TokenKind_RawChecksum, TokenKind_Integer, TokenKind_Float, TokenKind_String,
+			TokenKind_Pair, TokenKind_Vector, TokenKind_LeftParenthesis, TokenKind_LeftSquareBracket,
+			TokenKind_LeftCurlyBrace, TokenKind_LocalReference, TokenKind_AllArguments, TokenKind_Bang, TokenKind_Random:
+			return true
+		}
+		return false
+	}
+
+	// Precedence matches the decompiler's; '=' is only a comparison inside parentheses.
+	binaryOperators := map[TokenKind]struct {
+		Kind       AstKind
+		Precedence int
+	}{
+		TokenKind_Or:                {AstKind_LogicalOr, 1},
+		TokenKind_And:               {AstKind_LogicalAnd, 2},
+		TokenKind_Equals:            {AstKind_EqualsExpression, 3},
+		TokenKind_LeftAngleBracket:  {AstKind_LessThanExpression, 3},
+		TokenKind_LessThanEquals:    {AstKind_LessThanEqualsExpression, 3},
+		TokenKind_RightAngleBracket: {AstKind_GreaterThanExpression, 3},
+		TokenKind_GreaterThanEquals: {AstKind_GreaterThanEqualsExpression, 3},
+		TokenKind_Plus:              {AstKind_AdditionExpression, 4},
+		TokenKind_Minus:             {AstKind_SubtractionExpression, 4},
+		TokenKind_Asterisk:          {AstKind_MultiplicationExpression, 5},
+		TokenKind_ForwardSlash:      {AstKind_DivisionExpression, 5},
+	}
+
+	// GenerateBytecode already wraps these in parentheses.
+	isParenthesisedByCompiler := func(kind AstKind) bool {
+		switch kind {
+		case AstKind_AdditionExpression, AstKind_SubtractionExpression, AstKind_MultiplicationExpression,
+			AstKind_DivisionExpression, AstKind_EqualsExpression, AstKind_LessThanExpression,
+			AstKind_LessThanEqualsExpression, AstKind_GreaterThanExpression, AstKind_GreaterThanEqualsExpression:
+			return true
+		}
+		return false
+	}
+
+	ParseRoot = func() ParseResult {
+		var bodyNodes AstNodeBuffer
+		index := 0
+		for {
+			if GetKind(index) == TokenKind_OutOfRange {
+				break
+			}
+			if GetKind(index) == TokenKind_EndOfFile {
+				index++
+				bodyNodes.TokensConsumed++
+				continue
+			}
+			statementParseResult := ParseStatement(index)
+			if !statementParseResult.WasSuccessful {
+				return failure(fmt.Sprintf("Failed to parse blub on line %d: %s", GetToken(index).LineNumber, statementParseResult.Reason))
+			}
+			bodyNodes.MaybeSave(statementParseResult)
+			index += statementParseResult.TokensConsumed
+		}
+
+		return ParseResult{
+			WasSuccessful: true,
+			Node: AstNode{
+				Kind: AstKind_Root,
+				Data: AstData_Root{
+					BodyNodes: bodyNodes.Nodes,
+				},
+			},
+			TokensConsumed: index,
+		}
+	}
+
+	ParseStatement = func(index int) ParseResult {
+		switch GetKind(index) {
+		case TokenKind_NewLine:
+			return simpleNode(AstKind_NewLine)
+		case TokenKind_Break:
+			return simpleNode(AstKind_Break)
+		case TokenKind_SingleLineComment, TokenKind_MultiLineComment:
+			return ParseResult{
+				WasSuccessful:  true,
+				Node:           AstNode{Kind: AstKind_Comment, Data: AstData_Comment{CommentToken: GetToken(index)}},
+				TokensConsumed: 1,
+			}
+		case TokenKind_Script:
+			return ParseScript(index)
+		case TokenKind_If:
+			return ParseIfStatement(index)
+		case TokenKind_While:
+			return ParseWhileLoop(index)
+		case TokenKind_Return:
+			return ParseReturn(index)
+		}
+		if parseResult := ParseAssignment(index); parseResult.WasSuccessful {
+			return parseResult
+		}
+		if parseResult := ParseExpression(index, true, false); parseResult.WasSuccessful {
+			return parseResult
+		}
+		token := GetToken(index)
+		return failure(fmt.Sprintf("Expected a statement, found %s '%s' on line %d", token.Kind, token.Data, token.LineNumber))
+	}
+
+	ParseBodyOfCode = func(index int, endKinds ...TokenKind) (ParseResult, []AstNode) {
+		var bodyNodes AstNodeBuffer
+		for {
+			kind := GetKind(index + bodyNodes.TokensConsumed)
+			for _, endKind := range endKinds {
+				if kind == endKind {
+					return ParseResult{
+						WasSuccessful:  true,
+						TokensConsumed: bodyNodes.TokensConsumed,
+					}, bodyNodes.Nodes
+				}
+			}
+			if kind == TokenKind_OutOfRange || kind == TokenKind_EndOfFile {
+				return failure(fmt.Sprintf("Reached the end of the file looking for %s", endKinds[0])), nil
+			}
+			statementParseResult := ParseStatement(index + bodyNodes.TokensConsumed)
+			if !statementParseResult.WasSuccessful {
+				return statementParseResult, nil
+			}
+			bodyNodes.MaybeSave(statementParseResult)
+		}
+	}
+
+	ParseScript = func(index int) ParseResult {
+		oldIndex := index
+		index++
+
+		nameParseResult := ParseChecksum(index)
+		if !nameParseResult.WasSuccessful {
+			return failure(WrapStr("Failed to parse script name", nameParseResult.Reason))
+		}
+		index += nameParseResult.TokensConsumed
+
+		defaultParameterNodes, tokensConsumed := ParseParameters(index)
+		index += tokensConsumed
+
+		bodyParseResult, bodyNodes := ParseBodyOfCode(index, TokenKind_EndScript)
+		if !bodyParseResult.WasSuccessful {
+			return failure(WrapStr("Failed to parse script body", bodyParseResult.Reason))
+		}
+		index += bodyParseResult.TokensConsumed + 1
+
+		return ParseResult{
+			WasSuccessful: true,
+			Node: AstNode{
+				Kind: AstKind_Script,
+				Data: AstData_Script{
+					NameNode:              nameParseResult.Node,
+					DefaultParameterNodes: defaultParameterNodes,
+					BodyNodes:             bodyNodes,
+				},
+			},
+			TokensConsumed: index - oldIndex,
+		}
+	}
+
+	ParseIfStatement = func(index int) ParseResult {
+		oldIndex := index
+		index++
+
+		conditionParseResult := ParseExpression(index, true, false)
+		if !conditionParseResult.WasSuccessful {
+			return failure(WrapStr("Failed to parse if condition", conditionParseResult.Reason))
+		}
+		index += conditionParseResult.TokensConsumed
+
+		bodyParseResult, bodyNodes := ParseBodyOfCode(index, TokenKind_Else, TokenKind_EndIf)
+		if !bodyParseResult.WasSuccessful {
+			return failure(WrapStr("Failed to parse if body", bodyParseResult.Reason))
+		}
+		index += bodyParseResult.TokensConsumed
+		bodies := [][]AstNode{bodyNodes}
+
+		if GetKind(index) == TokenKind_Else {
+			index++
+			elseParseResult, elseNodes := ParseBodyOfCode(index, TokenKind_EndIf)
+			if !elseParseResult.WasSuccessful {
+				return failure(WrapStr("Failed to parse else body", elseParseResult.Reason))
+			}
+			index += elseParseResult.TokensConsumed
+			bodies = append(bodies, elseNodes)
+		}
+		index++ // endif
+
+		return ParseResult{
+			WasSuccessful: true,
+			Node: AstNode{
+				Kind: AstKind_IfStatement,
+				Data: AstData_IfStatement{
+					BooleanInvocationData: []bool{false},
+					Conditions:            []AstNode{conditionParseResult.Node},
+					Bodies:                bodies,
+				},
+			},
+			TokensConsumed: index - oldIndex,
+		}
+	}
+
+	ParseWhileLoop = func(index int) ParseResult {
+		bodyParseResult, bodyNodes := ParseBodyOfCode(index+1, TokenKind_EndWhile)
+		if !bodyParseResult.WasSuccessful {
+			return failure(WrapStr("Failed to parse while body", bodyParseResult.Reason))
+		}
+		return ParseResult{
+			WasSuccessful: true,
+			Node: AstNode{
+				Kind: AstKind_WhileLoop,
+				Data: AstData_WhileLoop{
+					BodyNodes: bodyNodes,
+					IsRaw:     true,
+				},
+			},
+			TokensConsumed: 1 + bodyParseResult.TokensConsumed + 1,
+		}
+	}
+
+	ParseReturn = func(index int) ParseResult {
+		parameterNodes, tokensConsumed := ParseParameters(index + 1)
+		return ParseResult{
+			WasSuccessful: true,
+			Node: AstNode{
+				Kind: AstKind_Return,
+				Data: AstData_UnaryExpression{
+					Node: AstNode{
+						Kind: AstKind_Invocation,
+						Data: AstData_Invocation{
+							ScriptIdentifierNode: AstNode{
+								Kind: AstKind_Checksum,
+								Data: AstData_Checksum{ChecksumToken: GetToken(index)},
+							},
+							ParameterNodes: parameterNodes,
+						},
+					},
+				},
+			},
+			TokensConsumed: 1 + tokensConsumed,
+		}
+	}
+
+	// select(2f,2, 0a 00 05 00) :OFFSET(0):OFFSET(1) :POS(0) ... :BREAKTO(2) :POS(1) ... :POS(2)
+	ParseRandom = func(index int) ParseResult {
+		oldIndex := index
+		arguments := strings.SplitN(GetToken(index).Data, ",", 3)
+		if len(arguments) != 3 {
+			return failure(fmt.Sprintf("Expected 3 arguments to select, got '%s'", GetToken(index).Data))
+		}
+		numBranches, err := strconv.Atoi(strings.TrimSpace(arguments[1]))
+		weightBytes := strings.Fields(arguments[2])
+		if err != nil || numBranches < 1 || len(weightBytes) != numBranches*2 {
+			return failure(fmt.Sprintf("Branch weights don't match the number of branches in select(%s)", GetToken(index).Data))
+		}
+		var branchWeights []AstNode
+		for i := 0; i < numBranches; i++ {
+			low, errLow := strconv.ParseUint(weightBytes[i*2], 16, 8)
+			high, errHigh := strconv.ParseUint(weightBytes[i*2+1], 16, 8)
+			if errLow != nil || errHigh != nil {
+				return failure(fmt.Sprintf("Bad branch weight in select(%s)", GetToken(index).Data))
+			}
+			weightToken := GetToken(index)
+			weightToken.Kind = TokenKind_Integer
+			weightToken.Data = strconv.Itoa(int(low | high<<8))
+			branchWeights = append(branchWeights, AstNode{Kind: AstKind_Integer, Data: integerData(weightToken)})
+		}
+		index++
+
+		for GetKind(index) == TokenKind_RandomOffset {
+			index++
+		}
+
+		var branches [][]AstNode
+		for {
+			if GetKind(index) != TokenKind_RandomPosition {
+				return failure(fmt.Sprintf("Expected :POS(...) at the start of a select branch, found %s", GetKind(index)))
+			}
+			index++
+			if len(branches) == numBranches { // the final :POS marks the end
+				break
+			}
+			branchParseResult, branchNodes := ParseBodyOfCode(index, TokenKind_RandomBreak, TokenKind_RandomPosition)
+			if !branchParseResult.WasSuccessful {
+				return failure(WrapStr("Failed to parse select branch", branchParseResult.Reason))
+			}
+			index += branchParseResult.TokensConsumed
+			if GetKind(index) == TokenKind_RandomBreak {
+				index++
+			}
+			branches = append(branches, branchNodes)
+		}
+
+		return ParseResult{
+			WasSuccessful: true,
+			Node: AstNode{
+				Kind: AstKind_Random,
+				Data: AstData_Random{
+					BranchWeights: branchWeights,
+					Branches:      branches,
+				},
+			},
+			TokensConsumed: index - oldIndex,
+		}
+	}
+
+	ParseAssignment = func(index int) ParseResult {
+		var nameParseResult ParseResult
+		if isChecksumKind(GetKind(index)) {
+			nameParseResult = ParseChecksum(index)
+		} else if GetKind(index) == TokenKind_LocalReference && isChecksumKind(GetKind(index+1)) {
+			nameParseResult = ParseOperand(index, false)
+		}
+		if !nameParseResult.WasSuccessful || GetKind(index+nameParseResult.TokensConsumed) != TokenKind_Equals {
+			return failure("Not an assignment")
+		}
+		valueParseResult := ParseExpression(index+nameParseResult.TokensConsumed+1, false, false)
+		if !valueParseResult.WasSuccessful {
+			return failure(WrapStr("Failed to parse assigned value", valueParseResult.Reason))
+		}
+		return ParseResult{
+			WasSuccessful: true,
+			Node: AstNode{
+				Kind: AstKind_Assignment,
+				Data: AstData_Assignment{
+					NameNode:  nameParseResult.Node,
+					ValueNode: valueParseResult.Node,
+				},
+			},
+			TokensConsumed: nameParseResult.TokensConsumed + 1 + valueParseResult.TokensConsumed,
+		}
+	}
+
+	ParseParameters = func(index int) ([]AstNode, int) {
+		var parameterNodes []AstNode
+		tokensConsumed := 0
+		for isStartOfOperand(GetKind(index + tokensConsumed)) {
+			parameterParseResult := ParseParameter(index + tokensConsumed)
+			if !parameterParseResult.WasSuccessful {
+				break
+			}
+			parameterNodes = append(parameterNodes, parameterParseResult.Node)
+			tokensConsumed += parameterParseResult.TokensConsumed
+		}
+		return parameterNodes, tokensConsumed
+	}
+
+	ParseParameter = func(index int) ParseResult {
+		if assignmentParseResult := ParseAssignment(index); assignmentParseResult.WasSuccessful {
+			return assignmentParseResult
+		}
+		return ParseExpression(index, false, false)
+	}
+
+	ParseExpression = func(index int, allowInvocations bool, allowEquals bool) ParseResult {
+		var parseBinaryExpression func(index int, minimumPrecedence int) ParseResult
+		parseBinaryExpression = func(index int, minimumPrecedence int) ParseResult {
+			leftParseResult := ParseOperand(index, allowInvocations)
+			if !leftParseResult.WasSuccessful {
+				return leftParseResult
+			}
+			for {
+				operatorIndex := index + leftParseResult.TokensConsumed
+				operator, isOperator := binaryOperators[GetKind(operatorIndex)]
+				if !isOperator || operator.Precedence < minimumPrecedence ||
+					(operator.Kind == AstKind_EqualsExpression && !allowEquals) {
+					return leftParseResult
+				}
+				rightParseResult := parseBinaryExpression(operatorIndex+1, operator.Precedence+1)
+				if !rightParseResult.WasSuccessful {
+					return failure(WrapStr(fmt.Sprintf("Failed to parse right side of '%s'", GetToken(operatorIndex).Data), rightParseResult.Reason))
+				}
+				leftParseResult = ParseResult{
+					WasSuccessful: true,
+					Node: AstNode{
+						Kind: operator.Kind,
+						Data: AstData_BinaryExpression{
+							LeftNode:  leftParseResult.Node,
+							RightNode: rightParseResult.Node,
+						},
+					},
+					TokensConsumed: leftParseResult.TokensConsumed + 1 + rightParseResult.TokensConsumed,
+				}
+			}
+		}
+		return parseBinaryExpression(index, 1)
+	}
+
+	ParseOperand = func(index int, allowInvocations bool) ParseResult {
+		var operandParseResult ParseResult
+		token := GetToken(index)
+
+		switch token.Kind {
+		case TokenKind_Bang:
+			notParseResult := ParseOperand(index+1, false)
+			if !notParseResult.WasSuccessful {
+				return failure(WrapStr("Failed to parse operand of NOT", notParseResult.Reason))
+			}
+			return ParseResult{
+				WasSuccessful: true,
+				Node: AstNode{
+					Kind: AstKind_LogicalNot,
+					Data: AstData_UnaryExpression{Node: notParseResult.Node},
+				},
+				TokensConsumed: 1 + notParseResult.TokensConsumed,
+			}
+		case TokenKind_LeftParenthesis:
+			innerParseResult := ParseExpression(index+1, true, true)
+			if !innerParseResult.WasSuccessful {
+				return failure(WrapStr("Failed to parse expression in parentheses", innerParseResult.Reason))
+			}
+			if GetKind(index+1+innerParseResult.TokensConsumed) != TokenKind_RightParenthesis {
+				return failure(fmt.Sprintf("Expected ')' on line %d", GetToken(index+1+innerParseResult.TokensConsumed).LineNumber))
+			}
+			operandParseResult = ParseResult{
+				WasSuccessful:  true,
+				Node:           innerParseResult.Node,
+				TokensConsumed: 1 + innerParseResult.TokensConsumed + 1,
+			}
+			if !isParenthesisedByCompiler(innerParseResult.Node.Kind) {
+				operandParseResult.Node = AstNode{
+					Kind: AstKind_UnaryExpression,
+					Data: AstData_UnaryExpression{Node: innerParseResult.Node},
+				}
+			}
+		case TokenKind_Integer:
+			operandParseResult = ParseInteger(index)
+		case TokenKind_Float:
+			floatNode, ok := ParseFloat(token)
+			if !ok {
+				return failure(fmt.Sprintf("Bad float '%s' on line %d", token.Data, token.LineNumber))
+			}
+			operandParseResult = ParseResult{WasSuccessful: true, Node: floatNode, TokensConsumed: 1}
+		case TokenKind_String:
+			operandParseResult = ParseResult{
+				WasSuccessful: true,
+				Node: AstNode{
+					Kind: AstKind_String,
+					Data: AstData_String{
+						StringToken: token,
+						StringBytes: append([]byte(token.Data[1:len(token.Data)-1]), 0),
+					},
+				},
+				TokensConsumed: 1,
+			}
+		case TokenKind_Pair, TokenKind_Vector:
+			var floatNodes []AstNode
+			for _, component := range strings.Split(token.Data, ",") {
+				floatToken := token
+				floatToken.Kind = TokenKind_Float
+				floatToken.Data = strings.TrimSpace(component)
+				floatNode, ok := ParseFloat(floatToken)
+				if !ok {
+					return failure(fmt.Sprintf("Bad float '%s' on line %d", floatToken.Data, token.LineNumber))
+				}
+				floatNodes = append(floatNodes, floatNode)
+			}
+			if token.Kind == TokenKind_Pair && len(floatNodes) == 2 {
+				operandParseResult.Node = AstNode{
+					Kind: AstKind_Pair,
+					Data: AstData_Pair{FloatNodeA: floatNodes[0], FloatNodeB: floatNodes[1]},
+				}
+			} else if token.Kind == TokenKind_Vector && len(floatNodes) == 3 {
+				operandParseResult.Node = AstNode{
+					Kind: AstKind_Vector,
+					Data: AstData_Vector{FloatNodeA: floatNodes[0], FloatNodeB: floatNodes[1], FloatNodeC: floatNodes[2]},
+				}
+			} else {
+				return failure(fmt.Sprintf("Wrong number of components in '%s' on line %d", token.Data, token.LineNumber))
+			}
+			operandParseResult.WasSuccessful = true
+			operandParseResult.TokensConsumed = 1
+		case TokenKind_AllArguments:
+			operandParseResult = simpleNode(AstKind_AllArguments)
+		case TokenKind_LeftSquareBracket, TokenKind_LeftCurlyBrace:
+			endKind := TokenKind_RightSquareBracket
+			if token.Kind == TokenKind_LeftCurlyBrace {
+				endKind = TokenKind_RightCurlyBrace
+			}
+			elementNodes, tokensConsumed, ok := ParseElements(index+1, endKind)
+			if !ok {
+				return failure(fmt.Sprintf("Couldn't find the end of '%s' on line %d", token.Data, token.LineNumber))
+			}
+			operandParseResult = ParseResult{WasSuccessful: true, TokensConsumed: 1 + tokensConsumed + 1}
+			if token.Kind == TokenKind_LeftSquareBracket {
+				operandParseResult.Node = AstNode{Kind: AstKind_Array, Data: AstData_Array{ElementNodes: elementNodes}}
+			} else {
+				operandParseResult.Node = AstNode{Kind: AstKind_Struct, Data: AstData_Struct{ElementNodes: elementNodes}}
+			}
+		case TokenKind_Random:
+			operandParseResult = ParseRandom(index)
+		case TokenKind_LocalReference:
+			checksumParseResult := ParseChecksum(index + 1)
+			if !checksumParseResult.WasSuccessful {
+				return failure(WrapStr("Failed to parse %GLOBAL% reference", checksumParseResult.Reason))
+			}
+			operandParseResult = ParseResult{
+				WasSuccessful: true,
+				Node: AstNode{
+					Kind: AstKind_LocalReference,
+					Data: AstData_LocalReference{Node: checksumParseResult.Node},
+				},
+				TokensConsumed: 2,
+			}
+			if GetKind(index+2) == TokenKind_LeftSquareBracket {
+				indexParseResult := ParseExpression(index+3, true, true)
+				if !indexParseResult.WasSuccessful || GetKind(index+3+indexParseResult.TokensConsumed) != TokenKind_RightSquareBracket {
+					return failure(fmt.Sprintf("Failed to parse array access on line %d", token.LineNumber))
+				}
+				operandParseResult = ParseResult{
+					WasSuccessful: true,
+					Node: AstNode{
+						Kind: AstKind_ArrayAccess,
+						Data: AstData_ArrayAccess{
+							Array: operandParseResult.Node,
+							Index: indexParseResult.Node,
+						},
+					},
+					TokensConsumed: 3 + indexParseResult.TokensConsumed + 1,
+				}
+			}
+		case TokenKind_Identifier, TokenKind_RawChecksum:
+			operandParseResult = ParseChecksum(index)
+			if allowInvocations {
+				parameterNodes, tokensConsumed := ParseParameters(index + 1)
+				if len(parameterNodes) > 0 {
+					operandParseResult = ParseResult{
+						WasSuccessful: true,
+						Node: AstNode{
+							Kind: AstKind_Invocation,
+							Data: AstData_Invocation{
+								ScriptIdentifierNode: operandParseResult.Node,
+								ParameterNodes:       parameterNodes,
+							},
+						},
+						TokensConsumed: 1 + tokensConsumed,
+					}
+				}
+			}
+		default:
+			return failure(fmt.Sprintf("Expected an operand, found %s '%s' on line %d", token.Kind, token.Data, token.LineNumber))
+		}
+		if !operandParseResult.WasSuccessful {
+			return operandParseResult
+		}
+
+		// roq has the names of 0x08 and 0x42 swapped, so '.' is a colon expression and ':' is a dot expression
+		for GetKind(index+operandParseResult.TokensConsumed) == TokenKind_Dot ||
+			GetKind(index+operandParseResult.TokensConsumed) == TokenKind_Colon {
+			operatorIndex := index + operandParseResult.TokensConsumed
+			kind := AstKind(AstKind_ColonExpression)
+			if GetKind(operatorIndex) == TokenKind_Colon {
+				kind = AstKind_DotExpression
+			}
+			rightParseResult := ParseOperand(operatorIndex+1, false)
+			if !rightParseResult.WasSuccessful {
+				return failure(WrapStr(fmt.Sprintf("Failed to parse right side of '%s'", GetToken(operatorIndex).Data), rightParseResult.Reason))
+			}
+			operandParseResult = ParseResult{
+				WasSuccessful: true,
+				Node: AstNode{
+					Kind: kind,
+					Data: AstData_BinaryExpression{
+						LeftNode:  operandParseResult.Node,
+						RightNode: rightParseResult.Node,
+					},
+				},
+				TokensConsumed: operandParseResult.TokensConsumed + 1 + rightParseResult.TokensConsumed,
+			}
+		}
+		return operandParseResult
+	}
+
+	ParseElements = func(index int, endKind TokenKind) ([]AstNode, int, bool) {
+		var elementNodes []AstNode
+		tokensConsumed := 0
+		for {
+			elementIndex := index + tokensConsumed
+			switch GetKind(elementIndex) {
+			case endKind:
+				return elementNodes, tokensConsumed, true
+			case TokenKind_NewLine:
+				elementNodes = append(elementNodes, AstNode{Kind: AstKind_NewLine, Data: AstData_Empty{}})
+				tokensConsumed++
+				continue
+			case TokenKind_Comma:
+				elementNodes = append(elementNodes, AstNode{Kind: AstKind_Comma, Data: AstData_Empty{}})
+				tokensConsumed++
+				continue
+			}
+			elementParseResult := ParseParameter(elementIndex)
+			if !elementParseResult.WasSuccessful {
+				return nil, 0, false
+			}
+			elementNodes = append(elementNodes, elementParseResult.Node)
+			tokensConsumed += elementParseResult.TokensConsumed
+		}
+	}
+
+	ParseChecksum = func(index int) ParseResult {
+		token := GetToken(index)
+		if !isChecksumKind(token.Kind) {
+			return failure(fmt.Sprintf("Expected a checksum, found %s '%s' on line %d", token.Kind, token.Data, token.LineNumber))
+		}
+		var checksum uint32
+		if token.Kind == TokenKind_RawChecksum {
+			temp, _ := strconv.ParseUint(token.Data[1:], 16, 32)
+			checksum = uint32(temp)
+		} else {
+			checksum = StringToChecksum(token.Data)
+		}
+		checksumBytes := make([]byte, 4)
+		binary.LittleEndian.PutUint32(checksumBytes, checksum)
+		return ParseResult{
+			WasSuccessful: true,
+			Node: AstNode{
+				Kind: AstKind_Checksum,
+				Data: AstData_Checksum{
+					IsRawChecksum: token.Kind == TokenKind_RawChecksum,
+					ChecksumToken: token,
+					ChecksumBytes: checksumBytes,
+				},
+			},
+			TokensConsumed: 1,
+		}
+	}
+
+	ParseInteger = func(index int) ParseResult {
+		return ParseResult{
+			WasSuccessful:  true,
+			Node:           AstNode{Kind: AstKind_Integer, Data: integerData(GetToken(index))},
+			TokensConsumed: 1,
+		}
+	}
+
+	ParseFloat = func(token Token) (AstNode, bool) {
+		value, err := strconv.ParseFloat(token.Data, 32)
+		if err != nil {
+			return AstNode{}, false
+		}
+		floatBytes := make([]byte, 4)
+		binary.LittleEndian.PutUint32(floatBytes, math.Float32bits(float32(value)))
+		return AstNode{
+			Kind: AstKind_Float,
+			Data: AstData_Float{
+				FloatToken: token,
+				FloatBytes: floatBytes,
+			},
+		}, true
+	}
+
+	GetKind = func(index int) TokenKind {
+		return GetToken(index).Kind
+	}
+
+	GetToken = func(index int) Token {
+		if numOfTokens := len(parser.Tokens); index < 0 || index >= numOfTokens {
+			return Token{
+				Kind:       TokenKind_OutOfRange,
+				Data:       fmt.Sprintf("<index=%d,numOfTokens=%d>", index, numOfTokens),
+				LineNumber: -1,
+			}
+		}
+		return parser.Tokens[index]
+	}
+
+	parser.Result = ParseRoot()
+}
+
+func integerData(token Token) AstData_Integer {
+	value, _ := strconv.ParseInt(token.Data, 10, 32)
+	integerBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(integerBytes, uint32(value))
+	return AstData_Integer{
+		IntegerToken: token,
+		IntegerBytes: integerBytes,
+	}
+}
@@ -4,10 +4,21 @@ func StringToChecksum(identifier string) uint32 {
 	if identifier == "" {
 		return 0
 	}
+	return ExtendChecksum(ChecksumSeed, identifier)
+}
+
+// ChecksumSeed is where every checksum starts before any characters are added.
+const ChecksumSeed uint32 = 0xffffffff
 
-	var rc uint32 = 0xffffffff
+// ExtendChecksum continues a checksum as if more characters were added to the end of the name, so names sharing a
+// prefix can be hashed without starting again:
+//
+//	ExtendChecksum(ExtendChecksum(ChecksumSeed, "Skater_"), "Menu") == StringToChecksum("Skater_Menu")
+func ExtendChecksum(checksum uint32, characters string) uint32 {
+	rc := checksum
+	for i := 0; i < len(characters); i++ {
+		ch := characters[i]
 
-	for _, ch := range []byte(identifier) {
 		// Make identifier lowercase
 		if ch >= 'A' && ch <= 'Z' {
 			ch = 'a' + ch - 'A'
@@ -0,0 +1,114 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A ChecksumUse is a name that was turned into a checksum, and where it came from (a source line or a dictionary).
+type ChecksumUse struct {
+	Name     string
+	Location string
+}
+
+// ChecksumUsage records the names given to each checksum across a project, so that different names sharing a checksum
+// (which silently overwrite each other's globals) can be found.
+type ChecksumUsage struct {
+	Uses map[uint32][]ChecksumUse // only the first use of each name is kept
+}
+
+type ChecksumCollision struct {
+	Checksum uint32
+	Uses     []ChecksumUse
+}
+
+func NewChecksumUsage() *ChecksumUsage {
+	return &ChecksumUsage{Uses: make(map[uint32][]ChecksumUse)}
+}
+
+func (usage *ChecksumUsage) Add(checksum uint32, name, location string) {
+	for _, use := range usage.Uses[checksum] {
+		if IsSameChecksumName(use.Name, name) {
+			return
+		}
+	}
+	usage.Uses[checksum] = append(usage.Uses[checksum], ChecksumUse{name, location})
+}
+
+// AddDictionary records names from a dictionary (e.g. the engine's names), but only for checksums that have already
+// been used. Collisions between the dictionary's own names aren't the project's problem.
+func (usage *ChecksumUsage) AddDictionary(entries []ChecksumDictionaryEntry, location string) {
+	for _, entry := range entries {
+		if _, isUsed := usage.Uses[entry.Checksum]; isUsed {
+			usage.Add(entry.Checksum, entry.Name, location)
+		}
+	}
+}
+
+// AddSourceFiles compiles every source file (.ns or .q) in the given files and directories without writing any QB files,
+// recording the names they use. It returns how many files were compiled.
+func (usage *ChecksumUsage) AddSourceFiles(paths []string) (int, error) {
+	numFiles := 0
+	check := func(path string) error {
+		var lexer Lexer
+		var parser Parser
+		bytecodeCompiler := BytecodeCompiler{Checksums: usage}
+		if err := CompileToBytes(path, &lexer, &parser, &bytecodeCompiler); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		numFiles++
+		return nil
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return numFiles, err
+		}
+		if !info.IsDir() {
+			if err := check(path); err != nil {
+				return numFiles, err
+			}
+			continue
+		}
+		err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".ns", ".q":
+				return check(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return numFiles, err
+		}
+	}
+	return numFiles, nil
+}
+
+// Collisions returns every checksum with more than one name, sorted by checksum.
+func (usage *ChecksumUsage) Collisions() []ChecksumCollision {
+	var collisions []ChecksumCollision
+	for checksum, uses := range usage.Uses {
+		if len(uses) > 1 {
+			collisions = append(collisions, ChecksumCollision{checksum, uses})
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].Checksum < collisions[j].Checksum
+	})
+	return collisions
+}
+
+func (collision ChecksumCollision) String() string {
+	var uses []string
+	for _, use := range collision.Uses {
+		uses = append(uses, fmt.Sprintf("'%s' (%s)", use.Name, use.Location))
+	}
+	return fmt.Sprintf("0x%08X is shared by %s", collision.Checksum, strings.Join(uses, " and "))
+}
@@ -0,0 +1,107 @@
+package compiler_test
+
+import (
+	"github.com/byxor/NeverScript/compiler"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// "Name__8x" and "Name_ksofa" share the checksum 0x2A0A027B.
+const collidingName1, collidingName2 = "Name__8x", "Name_ksofa"
+
+func TestChecksumCollisions(t *testing.T) {
+	usage := compiler.NewChecksumUsage()
+	for _, name := range []string{collidingName1, collidingName2, collidingName1, "Unique"} {
+		usage.Add(compiler.StringToChecksum(name), name, "a.ns:1")
+	}
+
+	collisions := usage.Collisions()
+	if len(collisions) != 1 {
+		t.Fatalf("Expected 1 collision, got %v", collisions)
+	}
+	expected := "0x2A0A027B is shared by 'Name__8x' (a.ns:1) and 'Name_ksofa' (a.ns:1)"
+	if collisions[0].String() != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, collisions[0])
+	}
+}
+
+// StringToChecksum ignores case and treats '/' as '\', so names that only differ in those ways aren't collisions.
+func TestChecksumCollisionsIgnoreCaseAndSlashes(t *testing.T) {
+	usage := compiler.NewChecksumUsage()
+	for _, name := range []string{"SkaterInit", "skaterinit", "SKATERINIT", `levels\foo\bar`, "Levels/Foo/Bar"} {
+		usage.Add(compiler.StringToChecksum(name), name, "a.ns:1")
+	}
+	if collisions := usage.Collisions(); len(collisions) != 0 {
+		t.Errorf("Expected no collisions, got %v", collisions)
+	}
+	if uses := usage.Uses[compiler.StringToChecksum("SkaterInit")]; len(uses) != 1 || uses[0].Name != "SkaterInit" {
+		t.Errorf("Expected only the first use of SkaterInit to be kept, got %v", uses)
+	}
+}
+
+// Dictionary names only count for checksums the project uses, so collisions within a dictionary are ignored.
+func TestChecksumCollisionsWithDictionaries(t *testing.T) {
+	usage := compiler.NewChecksumUsage()
+	usage.Add(compiler.StringToChecksum(collidingName1), collidingName1, "a.ns:1")
+	usage.AddDictionary([]compiler.ChecksumDictionaryEntry{
+		{compiler.StringToChecksum(collidingName1), "name__8X"},
+		{compiler.StringToChecksum(collidingName2), collidingName2},
+		{0x12345678, "Unused"},
+		{0x12345678, "AlsoUnused"},
+	}, "names.txt")
+
+	collisions := usage.Collisions()
+	if len(collisions) != 1 {
+		t.Fatalf("Expected 1 collision, got %v", collisions)
+	}
+	expected := "0x2A0A027B is shared by 'Name__8x' (a.ns:1) and 'Name_ksofa' (names.txt)"
+	if collisions[0].String() != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, collisions[0])
+	}
+	if _, isUsed := usage.Uses[0x12345678]; isUsed {
+		t.Error("Expected names for checksums the project doesn't use to be ignored")
+	}
+}
+
+func TestChecksumCollisionsAcrossSourceFiles(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		"a.ns":         collidingName1 + " = 1\n",
+		"scripts/b.ns": "script Foo {\n    " + collidingName2 + " = 2\n}\n",
+		"notes.txt":    "not code",
+	}
+	for name, contents := range files {
+		path := filepath.Join(directory, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage := compiler.NewChecksumUsage()
+	numFiles, err := usage.AddSourceFiles([]string{directory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numFiles != 2 {
+		t.Errorf("Expected 2 files to be compiled, got %d", numFiles)
+	}
+	collisions := usage.Collisions()
+	if len(collisions) != 1 {
+		t.Fatalf("Expected 1 collision, got %v", collisions)
+	}
+	for _, expected := range []string{filepath.Join(directory, "a.ns") + ":1", filepath.Join(directory, "scripts", "b.ns") + ":2"} {
+		if !strings.Contains(collisions[0].String(), expected) {
+			t.Errorf("Expected the collision to mention %s, got '%s'", expected, collisions[0])
+		}
+	}
+
+	if _, err := usage.AddSourceFiles([]string{filepath.Join(directory, "missing.ns")}); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -1,18 +1,49 @@
 package compiler
 
 import (
+	"errors"
 	"io/ioutil"
 	"log"
+	"path/filepath"
 	"strings"
 )
 
 func Compile(nsFilePath, qbFilePath string, lexer *Lexer, parser *Parser, bytecodeCompiler *BytecodeCompiler) {
-	{ // read source code into memory & store it in lexer
-		bytes, err := ioutil.ReadFile(nsFilePath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		lexer.SourceCode = string(bytes)
+	if err := CompileToBytes(nsFilePath, lexer, parser, bytecodeCompiler); err != nil {
+		log.Fatal(err)
+	}
+
+	ioutil.WriteFile(qbFilePath, bytecodeCompiler.Bytes, 0644)
+}
+
+// CompileToBytes is like Compile, but leaves the bytecode in bytecodeCompiler.Bytes instead of writing it to a file.
+func CompileToBytes(nsFilePath string, lexer *Lexer, parser *Parser, bytecodeCompiler *BytecodeCompiler) error {
+	if err := ParseFile(nsFilePath, lexer, parser); err != nil {
+		return err
+	}
+
+	bytecodeCompiler.RootAstNode = parser.Result.Node
+	bytecodeCompiler.SourceFilePath = nsFilePath
+	if bytecodeCompiler.SourceMap != nil {
+		bytecodeCompiler.SourceMap.SourceFilePath = nsFilePath
+	}
+	GenerateBytecode(bytecodeCompiler)
+	return nil
+}
+
+// ParseFile lexes and parses a NeverScript (or blub) file, leaving the AST in parser.Result.Node.
+func ParseFile(nsFilePath string, lexer *Lexer, parser *Parser) error {
+	bytes, err := ioutil.ReadFile(nsFilePath)
+	if err != nil {
+		return err
+	}
+	return ParseSourceCode(string(bytes), IsBlubFile(nsFilePath), lexer, parser)
+}
+
+// ParseSourceCode is like ParseFile, but reads the source code from a string.
+func ParseSourceCode(sourceCode string, isBlub bool, lexer *Lexer, parser *Parser) error {
+	{ // store source code in lexer
+		lexer.SourceCode = sourceCode
 
 		// Remove weird windows line-endings
 		lexer.SourceCode = strings.Replace(lexer.SourceCode, "\r", "", -1)
@@ -20,16 +51,67 @@ func Compile(nsFilePath, qbFilePath string, lexer *Lexer, parser *Parser, byteco
 		lexer.SourceCodeSize = len(lexer.SourceCode)
 	}
 
-	LexSourceCode(lexer)
-
-	parser.Tokens = lexer.Tokens
-	BuildAbstractSyntaxTree(parser)
+	if isBlub {
+		LexBlubSourceCode(lexer)
+		parser.Tokens = lexer.Tokens
+		BuildAbstractSyntaxTreeFromBlub(parser)
+	} else {
+		LexSourceCode(lexer)
+		parser.Tokens = lexer.Tokens
+		BuildAbstractSyntaxTree(parser)
+	}
 	if !parser.Result.WasSuccessful {
-		log.Fatal(parser.Result.Reason)
+		return errors.New(parser.Result.Reason)
 	}
+	return nil
+}
 
-	bytecodeCompiler.RootAstNode = parser.Result.Node
-	GenerateBytecode(bytecodeCompiler)
+// CompileSourceCode lexes, parses and compiles source code from a string, giving its bytecode.
+func CompileSourceCode(sourceCode string, isBlub bool) ([]byte, error) {
+	var lexer Lexer
+	var parser Parser
+	if err := ParseSourceCode(sourceCode, isBlub, &lexer, &parser); err != nil {
+		return nil, err
+	}
+	bytecodeCompiler := BytecodeCompiler{RootAstNode: parser.Result.Node}
+	GenerateBytecode(&bytecodeCompiler)
+	return bytecodeCompiler.Bytes, nil
+}
 
-	ioutil.WriteFile(qbFilePath, bytecodeCompiler.Bytes, 0644)
+// IsUnfinished tells whether source code looks like it's still being typed: an open '{' or '[', an unfinished string or
+// comment, or a '\' at the end of the last line.
+func IsUnfinished(sourceCode string) bool {
+	var lexer Lexer
+	lexer.SourceCode = sourceCode
+	lexer.SourceCodeSize = len(sourceCode)
+	LexSourceCode(&lexer)
+
+	depth := 0
+	var lastToken, tokenBeforeLast Token
+	for _, token := range lexer.Tokens {
+		switch token.Kind {
+		case TokenKind_LeftCurlyBrace, TokenKind_LeftSquareBracket:
+			depth++
+		case TokenKind_RightCurlyBrace, TokenKind_RightSquareBracket:
+			depth--
+		}
+		tokenBeforeLast, lastToken = lastToken, token
+	}
+	if depth > 0 {
+		return true
+	}
+	switch lastToken.Kind {
+	case TokenKind_String:
+		return len(lastToken.Data) < 2 || !strings.HasSuffix(lastToken.Data, "\"")
+	case TokenKind_MultiLineComment:
+		return !strings.HasSuffix(lastToken.Data, "*/")
+	case TokenKind_NewLine:
+		return tokenBeforeLast.Kind == TokenKind_BackwardSlash
+	}
+	return false
+}
+
+// IsBlubFile tells whether a source file is written in roq's "blub" syntax (.q) rather than NeverScript.
+func IsBlubFile(filePath string) bool {
+	return strings.EqualFold(filepath.Ext(filePath), ".q")
 }
@@ -0,0 +1,212 @@
+package compiler_test
+
+import (
+	"bytes"
+	"flag"
+	"github.com/byxor/NeverScript/assembler"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"github.com/pmezard/go-difflib/difflib"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+ * Every .ns and .q file in testdata is compiled, and the output is compared against the golden files in
+ * testdata/golden (the bytecode, an annotated listing, and the code decompiled back into both syntaxes).
+ *
+ * When the compiler's output changes on purpose, review the diffs and then regenerate the golden files:
+ *
+ *     go test ./compiler -update
+ */
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+func TestGoldenFiles(t *testing.T) {
+	for _, input := range testInputs(t) {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			var lexer compiler.Lexer
+			var parser compiler.Parser
+			var bytecodeCompiler compiler.BytecodeCompiler
+			bytecodeCompiler.SourceMap = &compiler.SourceMap{}
+			if err := compiler.CompileToBytes(input, &lexer, &parser, &bytecodeCompiler); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "golden", filepath.Base(input))
+
+			checkGoldenFile(t, golden+".qb", bytecodeCompiler.Bytes)
+			checkGoldenFile(t, golden+".listing", []byte(disassembler.MakeListing(disassembler.ListingArguments{
+				ByteCode:    bytecodeCompiler.Bytes,
+				SourceMap:   bytecodeCompiler.SourceMap,
+				SourceLines: strings.Split(lexer.SourceCode, "\n"),
+			})))
+			checkGoldenFile(t, golden+".decompiled.ns", []byte(decompile(t, bytecodeCompiler.Bytes, decompiler.Syntax_NeverScript)))
+			checkGoldenFile(t, golden+".decompiled.q", []byte(decompile(t, bytecodeCompiler.Bytes, decompiler.Syntax_Blub)))
+		})
+	}
+}
+
+func TestCompilerOutputIsValid(t *testing.T) {
+	for _, input := range testInputs(t) {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			for _, problem := range disassembler.Verify(compile(t, input)) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+// Decompiling to NeverScript or blub and compiling again should give back the same bytes.
+func TestDecompilerRoundTrip(t *testing.T) {
+	syntaxes := []struct {
+		extension string
+		syntax    decompiler.Syntax
+	}{
+		{".ns", decompiler.Syntax_NeverScript},
+		{".q", decompiler.Syntax_Blub},
+	}
+	for _, input := range testInputs(t) {
+		for _, syntax := range syntaxes {
+			t.Run(filepath.Base(input)+syntax.extension, func(t *testing.T) {
+				byteCode := compile(t, input)
+				decompiledPath := filepath.Join(t.TempDir(), "decompiled"+syntax.extension)
+				if err := ioutil.WriteFile(decompiledPath, []byte(decompile(t, byteCode, syntax.syntax)), 0644); err != nil {
+					t.Fatal(err)
+				}
+				checkSameByteCode(t, byteCode, compile(t, decompiledPath))
+			})
+		}
+	}
+}
+
+// Disassembling and assembling again should give back the same bytes.
+func TestAssemblerRoundTrip(t *testing.T) {
+	for _, input := range testInputs(t) {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			byteCode := compile(t, input)
+			reassembled, err := assembler.Assemble(disassembler.Disassemble(disassembler.DisassemblyArguments{ByteCode: byteCode}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSameByteCode(t, byteCode, reassembled)
+		})
+	}
+}
+
+func testInputs(t *testing.T) []string {
+	var inputs []string
+	for _, pattern := range []string{"*.ns", "*.q"} {
+		matches, err := filepath.Glob(filepath.Join("testdata", pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, matches...)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("No test inputs found in testdata")
+	}
+	return inputs
+}
+
+func compile(t *testing.T, path string) []byte {
+	t.Helper()
+	var lexer compiler.Lexer
+	var parser compiler.Parser
+	var bytecodeCompiler compiler.BytecodeCompiler
+	if err := compiler.CompileToBytes(path, &lexer, &parser, &bytecodeCompiler); err != nil {
+		t.Fatalf("Failed to compile '%s': %s", path, err)
+	}
+	return bytecodeCompiler.Bytes
+}
+
+func decompile(t *testing.T, byteCode []byte, syntax decompiler.Syntax) string {
+	t.Helper()
+	arguments := decompiler.Arguments{ByteCode: byteCode, Syntax: syntax}
+	if err := decompiler.Decompile(&arguments); err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range arguments.Problems {
+		t.Error(problem)
+	}
+	return arguments.SourceCode
+}
+
+func checkGoldenFile(t *testing.T, path string, actual []byte) {
+	t.Helper()
+	if *update {
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("Golden file '%s' doesn't exist yet (run 'go test ./compiler -update' to create it)", path)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(expected, actual) {
+		return
+	}
+	if strings.HasSuffix(path, ".qb") {
+		t.Errorf("'%s' changed (see the .listing diff for details)", path)
+		return
+	}
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(expected)),
+		B:        difflib.SplitLines(string(actual)),
+		FromFile: path,
+		ToFile:   "actual",
+		Context:  3,
+	})
+	t.Errorf("'%s' changed:\n%s", path, diff)
+}
+
+func checkSameByteCode(t *testing.T, expected, actual []byte) {
+	t.Helper()
+	if bytes.Equal(expected, actual) {
+		return
+	}
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(disassembler.Disassemble(disassembler.DisassemblyArguments{ByteCode: expected})),
+		B:        difflib.SplitLines(disassembler.Disassemble(disassembler.DisassemblyArguments{ByteCode: actual})),
+		FromFile: "expected",
+		ToFile:   "actual",
+		Context:  3,
+	})
+	t.Errorf("Bytecode changed:\n%s", diff)
+}
+
+func TestIsUnfinished(t *testing.T) {
+	testCases := []struct {
+		sourceCode string
+		expected   bool
+	}{
+		{"", false},
+		{"x = 1\n", false},
+		{"script Foo {\n", true},
+		{"script Foo {\n    x = {\n    }\n", true},
+		{"script Foo {\n    x = 1\n}\n", false},
+		{"x = [\n", true},
+		{"x = [1 2\n3]\n", false},
+		{"x = \"hello\n", true},
+		{"x = \"hello\"\n", false},
+		{"x = \"\n", true},
+		{"/* a comment\n", true},
+		{"/* a comment */\n", false},
+		{"// a comment {\n", false},
+		{"Foo a = 1 \\\n", true},
+		{"Foo a = 1 \\\nb = 2\n", false},
+		{"}\n", false}, // too many closers are left for the parser to report
+	}
+	for _, testCase := range testCases {
+		if actual := compiler.IsUnfinished(testCase.sourceCode); actual != testCase.expected {
+			t.Errorf("IsUnfinished(%q) = %t, expected %t", testCase.sourceCode, actual, testCase.expected)
+		}
+	}
+}
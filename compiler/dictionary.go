@@ -0,0 +1,192 @@
+package compiler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type ChecksumDictionaryEntry struct {
+	Checksum uint32
+	Name     string
+}
+
+// ParseChecksumDictionaryEntries reads a list of names for checksums. Each line is either a name, or a checksum
+// followed by whitespace and its name (for names that don't hash to their checksum). Blank lines and lines starting
+// with '//' are ignored:
+//
+//	// names from the skater scripts
+//	SkaterInit
+//	0x1CA1FF20 some name
+func ParseChecksumDictionaryEntries(text string) ([]ChecksumDictionaryEntry, error) {
+	var entries []ChecksumDictionaryEntry
+	for i, line := range strings.Split(strings.Replace(text, "\r", "", -1), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		name := line
+		checksum := StringToChecksum(name)
+		if strings.HasPrefix(line, "0x") || strings.HasPrefix(line, "0X") {
+			// the checksum and name can be separated by any spaces or tabs, so columns can be lined up
+			separator := strings.IndexFunc(line, unicode.IsSpace)
+			if separator == -1 {
+				return nil, fmt.Errorf("line %d: expected a name after the checksum", i+1)
+			}
+			value, err := strconv.ParseUint(line[2:separator], 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad checksum '%s'", i+1, line[:separator])
+			}
+			checksum = uint32(value)
+			name = strings.TrimSpace(line[separator:])
+		}
+
+		entries = append(entries, ChecksumDictionaryEntry{checksum, name})
+	}
+	return entries, nil
+}
+
+// ParseChecksumDictionary is like ParseChecksumDictionaryEntries, but when several names have the same checksum, only
+// the first one is kept.
+func ParseChecksumDictionary(text string) (map[uint32]string, error) {
+	entries, err := ParseChecksumDictionaryEntries(text)
+	if err != nil {
+		return nil, err
+	}
+	dictionary := make(map[uint32]string)
+	for _, entry := range entries {
+		if _, exists := dictionary[entry.Checksum]; !exists {
+			dictionary[entry.Checksum] = entry.Name
+		}
+	}
+	return dictionary, nil
+}
+
+func ReadChecksumDictionaryEntries(path string) ([]ChecksumDictionaryEntry, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ParseChecksumDictionaryEntries(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return entries, nil
+}
+
+func ReadChecksumDictionary(path string) (map[uint32]string, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dictionary, err := ParseChecksumDictionary(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return dictionary, nil
+}
+
+// FormatChecksumDictionary writes a dictionary in the format read by ParseChecksumDictionary, sorted by name.
+// Checksums are only written for names that don't hash to them.
+func FormatChecksumDictionary(dictionary map[uint32]string) string {
+	var entries []ChecksumDictionaryEntry
+	for checksum, name := range dictionary {
+		entries = append(entries, ChecksumDictionaryEntry{checksum, name})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := strings.ToLower(entries[i].Name), strings.ToLower(entries[j].Name)
+		if a != b {
+			return a < b
+		}
+		return entries[i].Checksum < entries[j].Checksum
+	})
+
+	var text strings.Builder
+	for _, e := range entries {
+		// names that would be misread on their own also get a checksum
+		isAmbiguous := strings.HasPrefix(strings.ToLower(e.Name), "0x") || strings.HasPrefix(e.Name, "//")
+		if StringToChecksum(e.Name) == e.Checksum && !isAmbiguous {
+			text.WriteString(e.Name + "\n")
+		} else {
+			text.WriteString(fmt.Sprintf("0x%08X %s\n", e.Checksum, e.Name))
+		}
+	}
+	return text.String()
+}
+
+// IsSameChecksumName tells whether two names are the same as far as StringToChecksum is concerned (it ignores case,
+// and treats '/' as '\'), so they aren't a collision.
+func IsSameChecksumName(a, b string) bool {
+	normalise := func(name string) string {
+		return strings.Replace(strings.ToLower(name), "/", "\\", -1)
+	}
+	return normalise(a) == normalise(b)
+}
+
+// A ChecksumLookup is the result of looking up a name or a checksum.
+type ChecksumLookup struct {
+	Input    string
+	Checksum uint32
+	Names    []string // for a name, the name itself followed by any others with the same checksum
+}
+
+// IsCollision is true when different names share the checksum.
+func (lookup ChecksumLookup) IsCollision() bool {
+	return len(lookup.Names) > 1
+}
+
+// LookUpChecksums computes the checksums of names, and finds the known names of checksums (written as 0x1234ABCD or
+// #1234ABCD). The known names are the dictionary's and the names being looked up.
+func LookUpChecksums(inputs []string, dictionary []ChecksumDictionaryEntry) []ChecksumLookup {
+	knownNames := make(map[uint32][]string)
+	addName := func(checksum uint32, name string) {
+		for _, knownName := range knownNames[checksum] {
+			if IsSameChecksumName(knownName, name) {
+				return
+			}
+		}
+		knownNames[checksum] = append(knownNames[checksum], name)
+	}
+	for _, entry := range dictionary {
+		addName(entry.Checksum, entry.Name)
+	}
+	for _, input := range inputs {
+		if _, isChecksum := parseChecksumInput(input); !isChecksum {
+			addName(StringToChecksum(input), input)
+		}
+	}
+
+	var lookups []ChecksumLookup
+	for _, input := range inputs {
+		checksum, isChecksum := parseChecksumInput(input)
+		names := []string{}
+		if !isChecksum {
+			checksum = StringToChecksum(input)
+			names = append(names, input)
+		}
+		for _, name := range knownNames[checksum] {
+			if isChecksum || !IsSameChecksumName(name, input) {
+				names = append(names, name)
+			}
+		}
+		lookups = append(lookups, ChecksumLookup{input, checksum, names})
+	}
+	return lookups
+}
+
+func parseChecksumInput(input string) (uint32, bool) {
+	var digits string
+	if strings.HasPrefix(input, "0x") || strings.HasPrefix(input, "0X") {
+		digits = input[2:]
+	} else if strings.HasPrefix(input, "#") {
+		digits = input[1:]
+	} else {
+		return 0, false
+	}
+	checksum, err := strconv.ParseUint(digits, 16, 32)
+	return uint32(checksum), err == nil
+}
@@ -0,0 +1,138 @@
+package compiler_test
+
+import (
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"testing"
+)
+
+func TestParseChecksumDictionaryEntries(t *testing.T) {
+	text := "// names from the skater scripts\r\n" +
+		"SkaterInit\n" +
+		"\n" +
+		"0x1CA1FF20 some name\n" +
+		"0X0000ABCD\ttabbed\n" +
+		"0x12345678      lined up  \n" +
+		"  // indented comment\n"
+	entries, err := compiler.ParseChecksumDictionaryEntries(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []compiler.ChecksumDictionaryEntry{
+		{compiler.StringToChecksum("SkaterInit"), "SkaterInit"},
+		{0x1CA1FF20, "some name"},
+		{0x0000ABCD, "tabbed"},
+		{0x12345678, "lined up"},
+	}
+	if fmt.Sprint(entries) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, entries)
+	}
+}
+
+func TestParseChecksumDictionaryEntriesErrors(t *testing.T) {
+	testCases := []struct {
+		text          string
+		expectedError string
+	}{
+		{"Foo\n0x1CA1FF20\n", "line 2: expected a name after the checksum"},
+		{"0x1CA1FF20   \n", "line 1: expected a name after the checksum"},
+		{"0xNOPE name\n", "line 1: bad checksum '0xNOPE'"},
+		{"0x123456789 name\n", "line 1: bad checksum '0x123456789'"},
+	}
+	for _, testCase := range testCases {
+		_, err := compiler.ParseChecksumDictionaryEntries(testCase.text)
+		if err == nil || err.Error() != testCase.expectedError {
+			t.Errorf("Expected error '%s' for %q, got %v", testCase.expectedError, testCase.text, err)
+		}
+	}
+}
+
+// Only the first name for each checksum is kept.
+func TestParseChecksumDictionary(t *testing.T) {
+	dictionary, err := compiler.ParseChecksumDictionary("0x00000001 first\n0x00000001 second\nFoo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dictionary) != 2 || dictionary[1] != "first" || dictionary[compiler.StringToChecksum("Foo")] != "Foo" {
+		t.Errorf("Unexpected dictionary %v", dictionary)
+	}
+}
+
+func TestFormatChecksumDictionary(t *testing.T) {
+	dictionary := map[uint32]string{
+		compiler.StringToChecksum("SkaterInit"): "SkaterInit",
+		compiler.StringToChecksum("apple"):      "apple",
+		0x1CA1FF20:                              "some name",
+		compiler.StringToChecksum("0xBEEF"):     "0xBEEF",  // would be read as a checksum on its own
+		compiler.StringToChecksum("// note"):    "// note", // would be read as a comment on its own
+	}
+	expected := fmt.Sprintf("0x%08X // note\n0x%08X 0xBEEF\napple\nSkaterInit\n0x1CA1FF20 some name\n",
+		compiler.StringToChecksum("// note"), compiler.StringToChecksum("0xBEEF"))
+	text := compiler.FormatChecksumDictionary(dictionary)
+	if text != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, text)
+	}
+
+	// formatting and parsing again should give back the same dictionary
+	parsed, err := compiler.ParseChecksumDictionary(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(dictionary) {
+		t.Errorf("Expected %d names after parsing, got %v", len(dictionary), parsed)
+	}
+	for checksum, name := range dictionary {
+		if parsed[checksum] != name {
+			t.Errorf("Expected 0x%08X to be '%s' after parsing, got '%s'", checksum, name, parsed[checksum])
+		}
+	}
+	if reformatted := compiler.FormatChecksumDictionary(parsed); reformatted != text {
+		t.Errorf("Formatting the parsed dictionary gave:\n%s\ninstead of:\n%s", reformatted, text)
+	}
+}
+
+func TestIsSameChecksumName(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"SkaterInit", "SkaterInit", true},
+		{"SkaterInit", "skaterINIT", true},
+		{`levels\foo`, "Levels/Foo", true},
+		{"SkaterInit", "SkaterInit2", false},
+		{"Name__8x", "Name_ksofa", false}, // same checksum, different names
+	}
+	for _, testCase := range testCases {
+		if actual := compiler.IsSameChecksumName(testCase.a, testCase.b); actual != testCase.expected {
+			t.Errorf("IsSameChecksumName(%q, %q) = %t, expected %t", testCase.a, testCase.b, actual, testCase.expected)
+		}
+		if testCase.expected && compiler.StringToChecksum(testCase.a) != compiler.StringToChecksum(testCase.b) {
+			t.Errorf("%q and %q are the same name but have different checksums", testCase.a, testCase.b)
+		}
+	}
+}
+
+func TestLookUpChecksums(t *testing.T) {
+	dictionary := []compiler.ChecksumDictionaryEntry{
+		{compiler.StringToChecksum("SkaterInit"), "SkaterInit"},
+		{compiler.StringToChecksum(collidingName2), collidingName2},
+	}
+	inputs := []string{"skaterinit", "#2A0A027B", "0x00000001", fmt.Sprintf("0x%08X", compiler.StringToChecksum("SkaterInit")), collidingName1, "#NOPE"}
+	expected := []compiler.ChecksumLookup{
+		{"skaterinit", compiler.StringToChecksum("SkaterInit"), []string{"skaterinit"}},
+		{"#2A0A027B", 0x2A0A027B, []string{collidingName2, collidingName1}},
+		{"0x00000001", 1, []string{}},
+		{inputs[3], compiler.StringToChecksum("SkaterInit"), []string{"SkaterInit"}},
+		{collidingName1, 0x2A0A027B, []string{collidingName1, collidingName2}},
+		{"#NOPE", compiler.StringToChecksum("#NOPE"), []string{"#NOPE"}}, // not a checksum, so it's a name
+	}
+	lookups := compiler.LookUpChecksums(inputs, dictionary)
+	if fmt.Sprint(lookups) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, lookups)
+	}
+	for i, lookup := range lookups {
+		if isCollision := len(expected[i].Names) > 1; lookup.IsCollision() != isCollision {
+			t.Errorf("Expected IsCollision() = %t for %s", isCollision, lookup.Input)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package compiler_test
+
+import (
+	"github.com/byxor/NeverScript/compiler"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * Fuzz targets for each stage of the compiler. No input should be able to make any of them panic (or hang).
+ *
+ *     go test ./compiler -run '^$' -fuzz FuzzGenerateBytecode
+ */
+
+// addSourceCodeSeeds seeds a fuzz target with the syntax guide and the test corpus.
+func addSourceCodeSeeds(f *testing.F, patterns ...string) {
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, path := range paths {
+			sourceCode, err := ioutil.ReadFile(path)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(string(sourceCode))
+		}
+	}
+}
+
+// silenceStdout hides the lexer's error messages, which would otherwise flood the fuzzer's output.
+func silenceStdout(f *testing.F) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		f.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	f.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+func lex(sourceCode string, isBlub bool) compiler.Lexer {
+	var lexer compiler.Lexer
+	lexer.SourceCode = sourceCode
+	lexer.SourceCodeSize = len(sourceCode)
+	if isBlub {
+		compiler.LexBlubSourceCode(&lexer)
+	} else {
+		compiler.LexSourceCode(&lexer)
+	}
+	return lexer
+}
+
+func parse(sourceCode string, isBlub bool) compiler.Parser {
+	var parser compiler.Parser
+	parser.Tokens = lex(sourceCode, isBlub).Tokens
+	if isBlub {
+		compiler.BuildAbstractSyntaxTreeFromBlub(&parser)
+	} else {
+		compiler.BuildAbstractSyntaxTree(&parser)
+	}
+	return parser
+}
+
+func generateBytecode(sourceCode string, isBlub bool) {
+	parser := parse(sourceCode, isBlub)
+	if !parser.Result.WasSuccessful {
+		return
+	}
+	bytecodeCompiler := compiler.BytecodeCompiler{
+		RootAstNode: parser.Result.Node,
+		SourceMap:   &compiler.SourceMap{},
+		Checksums:   compiler.NewChecksumUsage(),
+	}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+}
+
+func FuzzLexSourceCode(f *testing.F) {
+	addSourceCodeSeeds(f, "../docs/*.ns", "testdata/*.ns")
+	silenceStdout(f)
+	f.Fuzz(func(t *testing.T, sourceCode string) {
+		lex(sourceCode, false)
+	})
+}
+
+func FuzzBuildAbstractSyntaxTree(f *testing.F) {
+	addSourceCodeSeeds(f, "../docs/*.ns", "testdata/*.ns")
+	silenceStdout(f)
+	f.Fuzz(func(t *testing.T, sourceCode string) {
+		parse(sourceCode, false)
+	})
+}
+
+func FuzzGenerateBytecode(f *testing.F) {
+	addSourceCodeSeeds(f, "../docs/*.ns", "testdata/*.ns")
+	silenceStdout(f)
+	f.Fuzz(func(t *testing.T, sourceCode string) {
+		generateBytecode(sourceCode, false)
+	})
+}
+
+// roq's blub syntax goes through its own lexer and parser, but the same code generator.
+func FuzzCompileBlub(f *testing.F) {
+	addSourceCodeSeeds(f, "testdata/*.q", "testdata/golden/*.q")
+	silenceStdout(f)
+	f.Fuzz(func(t *testing.T, sourceCode string) {
+		generateBytecode(sourceCode, true)
+	})
+}
+
+// FuzzAstFromJson checks that any tree that's read without an error can be compiled.
+func FuzzAstFromJson(f *testing.F) {
+	for _, sourceCode := range []string{
+		"x = 1.5\ny = \"hi\"\nz = [(1.0, 2.0), (1.0, 2.0, 3.0), {a=#1CA1FF20 b}]\n",
+		"script Foo x=1 {\n    if @(Bar) {\n        return x=<x>\n    } else {\n        Baz a.b:c[0]\n    }\n}\n",
+		"script Loops {\n    while {\n        break\n    }\n    random {\n        1 {}\n    }\n}\n",
+	} {
+		parser := parse(sourceCode, false)
+		jsonBytes, err := compiler.AstToJson(parser.Result.Node)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(jsonBytes))
+	}
+	f.Add(`{"kind": "Root", "body": [{"kind": "Return", "value": {"kind": "Integer", "value": 1}}]}`)
+	silenceStdout(f)
+	f.Fuzz(func(t *testing.T, jsonText string) {
+		rootNode, err := compiler.AstFromJson([]byte(jsonText))
+		if err != nil {
+			return
+		}
+		bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: rootNode}
+		compiler.GenerateBytecode(&bytecodeCompiler)
+	})
+}
@@ -12,6 +12,8 @@ type Lexer struct {
 	Index          int
 	LineNumber     int
 
+	LineNumberAtStartOfToken int
+
 	Tokens    []Token
 	NumTokens int
 
@@ -30,6 +32,19 @@ func LexSourceCode(lexer *Lexer) { // do lexical analysis (build an array of Tok
 		return CanFindKeywordAtIndex(keyword, lexer.Index)
 	}
 
+	// Like CanFindKeyword, but doesn't match the start of a longer identifier (e.g. "or" in "order").
+	CanFindWord := func(word string) bool {
+		if !CanFindKeyword(word) {
+			return false
+		}
+		end := lexer.Index + len(word)
+		if end >= len(lexer.SourceCode) {
+			return true
+		}
+		next := rune(lexer.SourceCode[end])
+		return !(unicode.IsLetter(next) || unicode.IsDigit(next) || next == '_')
+	}
+
 	CanFindSingleLineComment := func() (string, bool) {
 		if CanFindKeyword("//") {
 			start := lexer.Index
@@ -72,6 +87,20 @@ func LexSourceCode(lexer *Lexer) { // do lexical analysis (build an array of Tok
 		return "", false
 	}
 
+	// e.g. #"levels\mainmenu.qb", for names that can't be written as identifiers
+	CanFindChecksumLiteral := func() (string, bool) {
+		if !CanFindKeyword("#\"") {
+			return "", false
+		}
+		start := lexer.Index
+		for end := start + 2; end < len(lexer.SourceCode) && lexer.SourceCode[end] != '\n'; end++ {
+			if lexer.SourceCode[end] == '"' {
+				return lexer.SourceCode[start : end+1], true
+			}
+		}
+		return "", false
+	}
+
 	CanFindRawChecksum := func() (string, bool) {
 		start := lexer.Index
 		end := start
@@ -81,6 +110,9 @@ func LexSourceCode(lexer *Lexer) { // do lexical analysis (build an array of Tok
 		end++
 
 		for i := 0; i < 8; i++ {
+			if end >= len(lexer.SourceCode) {
+				return "", false
+			}
 			switch lexer.SourceCode[end] {
 			case '0':
 				fallthrough
@@ -180,7 +212,7 @@ func LexSourceCode(lexer *Lexer) { // do lexical analysis (build an array of Tok
 		for {
 			switch stage {
 			case 0:
-				if unicode.IsDigit(rune(lexer.SourceCode[end])) {
+				if end < len(lexer.SourceCode) && unicode.IsDigit(rune(lexer.SourceCode[end])) {
 					stage = 1
 				} else {
 					return "", false
@@ -244,10 +276,12 @@ func LexSourceCode(lexer *Lexer) { // do lexical analysis (build an array of Tok
 	}
 
 	SaveToken := func(lexer *Lexer, kind TokenKind, data string) {
+		startOfLine := strings.LastIndexByte(lexer.SourceCode[:lexer.Index], '\n') + 1
 		lexer.Tokens = append(lexer.Tokens, Token{
-			Kind: kind,
-			Data: data,
-			LineNumber: lexer.LineNumber,
+			Kind:       kind,
+			Data:       data,
+			LineNumber: lexer.LineNumberAtStartOfToken,
+			Column:     lexer.Index - startOfLine + 1,
 		})
 		lexer.NumTokens++
 	}
@@ -257,6 +291,7 @@ func LexSourceCode(lexer *Lexer) { // do lexical analysis (build an array of Tok
 		if lexer.Index >= lexer.SourceCodeSize {
 			break
 		}
+		lexer.LineNumberAtStartOfToken = lexer.LineNumber
 
 		if data, found := CanFindFloat(); found {
 			SaveToken(lexer, TokenKind_Float, data)
@@ -273,6 +308,10 @@ func LexSourceCode(lexer *Lexer) { // do lexical analysis (build an array of Tok
 		} else if data, found := CanFindMultiLineComment(); found {
 			SaveToken(lexer, TokenKind_MultiLineComment, data)
 			lexer.Index += len(data)
+		} else if data, found := CanFindChecksumLiteral(); found {
+			// the name is hashed and saved in the name table like any other identifier
+			SaveToken(lexer, TokenKind_Identifier, data[2:len(data)-1])
+			lexer.Index += len(data)
 		} else if data, found := CanFindRawChecksum(); found {
 			SaveToken(lexer, TokenKind_RawChecksum, data)
 			lexer.Index += len(data)
@@ -348,31 +387,31 @@ func LexSourceCode(lexer *Lexer) { // do lexical analysis (build an array of Tok
 				lexer.Index++
 			default:
 				// Check for multi-character tokens
-				if CanFindKeyword("or") {
+				if CanFindWord("or") {
 					SaveToken(lexer, TokenKind_Or, "or")
 					lexer.Index += 2
-				} else if CanFindKeyword("if") {
+				} else if CanFindWord("if") {
 					SaveToken(lexer, TokenKind_If, "if")
 					lexer.Index += 2
-				} else if CanFindKeyword("and") {
+				} else if CanFindWord("and") {
 					SaveToken(lexer, TokenKind_And, "and")
 					lexer.Index += 3
-				} else if CanFindKeyword("else") {
+				} else if CanFindWord("else") {
 					SaveToken(lexer, TokenKind_Else, "else")
 					lexer.Index += 4
-				} else if CanFindKeyword("while") {
+				} else if CanFindWord("while") {
 					SaveToken(lexer, TokenKind_While, "while")
 					lexer.Index += 5
-				} else if CanFindKeyword("break") {
+				} else if CanFindWord("break") {
 					SaveToken(lexer, TokenKind_Break, "break")
 					lexer.Index += 5
-				} else if CanFindKeyword("script") {
+				} else if CanFindWord("script") {
 					SaveToken(lexer, TokenKind_Script, "script")
 					lexer.Index += 6
-				} else if CanFindKeyword("random") {
+				} else if CanFindWord("random") {
 					SaveToken(lexer, TokenKind_Random, "random")
 					lexer.Index += 6
-				} else if CanFindKeyword("return") {
+				} else if CanFindWord("return") {
 					SaveToken(lexer, TokenKind_Return, "return")
 					lexer.Index += 6
 				} else if identifier, found := CanFindIdentifier(); found {
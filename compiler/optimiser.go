@@ -0,0 +1,326 @@
+package compiler
+
+// An Optimiser shrinks the bytecode of a file by rewriting its AST before any bytecode is generated.
+// It removes:
+//
+//   - comments, and runs of newlines (only one newline is needed to end a line),
+//   - branches of if statements whose conditions are always false, and the branches after one that's always true,
+//   - if statements with empty bodies (when their conditions can't have side effects) and empty else branches,
+//   - unreachable code after 'return' and 'break',
+//   - root-level assignments (globals) that nothing in the file refers to, unless they're listed in KeepGlobals.
+//
+// Globals can also be used by other QB files and by the game itself, which the optimiser can't see.
+type Optimiser struct {
+	KeepGlobals []string // globals to keep even when nothing in the file refers to them
+
+	// filled in by Optimise
+	NewLinesRemoved         int
+	BranchesRemoved         int
+	IfStatementsRemoved     int
+	UnreachableNodesRemoved int
+	GlobalsRemoved          []string
+	BytesSaved              int // filled in by GenerateBytecode
+}
+
+// Optimise returns an optimised copy of the AST. The original isn't modified.
+func Optimise(rootNode AstNode, optimiser *Optimiser) AstNode {
+	var optimiseNode func(node AstNode) AstNode
+	var optimiseBody func(nodes []AstNode) []AstNode
+
+	isEmptyBody := func(nodes []AstNode) bool {
+		for _, node := range nodes {
+			if node.Kind != AstKind_NewLine && node.Kind != AstKind_Comment {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Returns the optimised if statement, the nodes to put in its place (when it's reduced to its else branch), and
+	// whether it should be kept at all.
+	optimiseIf := func(node AstNode) (AstNode, []AstNode, bool) {
+		data := node.Data.(AstData_IfStatement)
+		isBooleanInvocation := func(i int) bool {
+			return i < len(data.BooleanInvocationData) && data.BooleanInvocationData[i]
+		}
+		hasElse := len(data.Bodies) > len(data.Conditions)
+
+		var booleanInvocationData []bool
+		var conditions []AstNode
+		var bodies [][]AstNode
+		var elseBody []AstNode
+		if hasElse {
+			elseBody = data.Bodies[len(data.Conditions)]
+		}
+		for i, condition := range data.Conditions {
+			value, isConstant := evaluateConstant(condition)
+			if isConstant && !isBooleanInvocation(i) {
+				if value == 0 {
+					optimiser.BranchesRemoved++
+					continue
+				}
+				// every branch after this one is dead, and this one becomes the else
+				optimiser.BranchesRemoved += len(data.Bodies) - i - 1
+				elseBody = data.Bodies[i]
+				hasElse = true
+				break
+			}
+			booleanInvocationData = append(booleanInvocationData, isBooleanInvocation(i))
+			conditions = append(conditions, condition)
+			bodies = append(bodies, data.Bodies[i])
+		}
+
+		if hasElse && isEmptyBody(elseBody) {
+			optimiser.BranchesRemoved++
+			hasElse = false
+		}
+		if len(conditions) == 0 {
+			optimiser.IfStatementsRemoved++
+			if hasElse {
+				return AstNode{}, elseBody, false
+			}
+			return AstNode{}, nil, false
+		}
+		if !hasElse {
+			canBeRemoved := true
+			for i, condition := range conditions {
+				if isBooleanInvocation(i) || !hasNoSideEffects(condition) || !isEmptyBody(bodies[i]) {
+					canBeRemoved = false
+				}
+			}
+			if canBeRemoved {
+				optimiser.IfStatementsRemoved++
+				return AstNode{}, nil, false
+			}
+		} else {
+			bodies = append(bodies, elseBody)
+		}
+
+		node.Data = AstData_IfStatement{
+			BooleanInvocationData: booleanInvocationData,
+			Conditions:            conditions,
+			Bodies:                bodies,
+		}
+		return node, nil, true
+	}
+
+	// Keeps the first newline of each run, since newlines separate statements (and elements of structs & arrays).
+	removeRedundantNewLines := func(nodes []AstNode) []AstNode {
+		var optimisedNodes []AstNode
+		for _, node := range nodes {
+			if node.Kind == AstKind_Comment {
+				continue
+			}
+			if node.Kind == AstKind_NewLine && len(optimisedNodes) > 0 && optimisedNodes[len(optimisedNodes)-1].Kind == AstKind_NewLine {
+				optimiser.NewLinesRemoved++
+				continue
+			}
+			optimisedNodes = append(optimisedNodes, node)
+		}
+		return optimisedNodes
+	}
+
+	optimiseBody = func(nodes []AstNode) []AstNode {
+		var optimisedNodes []AstNode
+		for _, node := range nodes {
+			node = optimiseNode(node)
+			if node.Kind == AstKind_IfStatement {
+				optimisedIf, replacementNodes, isKept := optimiseIf(node)
+				if !isKept {
+					optimisedNodes = append(optimisedNodes, replacementNodes...)
+					continue
+				}
+				node = optimisedIf
+			}
+			optimisedNodes = append(optimisedNodes, node)
+		}
+
+		// nothing after a return or break runs, apart from the newline that ends its line
+		for i, node := range optimisedNodes {
+			if node.Kind != AstKind_Return && node.Kind != AstKind_Break {
+				continue
+			}
+			end := i + 1
+			for end < len(optimisedNodes) && optimisedNodes[end].Kind == AstKind_Comment {
+				end++
+			}
+			if end < len(optimisedNodes) && optimisedNodes[end].Kind == AstKind_NewLine {
+				end++
+			}
+			for _, unreachableNode := range optimisedNodes[end:] {
+				if unreachableNode.Kind != AstKind_NewLine && unreachableNode.Kind != AstKind_Comment {
+					optimiser.UnreachableNodesRemoved++
+				}
+			}
+			optimisedNodes = optimisedNodes[:end]
+			break
+		}
+
+		return removeRedundantNewLines(optimisedNodes)
+	}
+
+	optimiseNode = func(node AstNode) AstNode {
+		switch data := node.Data.(type) {
+		case AstData_Root:
+			node.Data = AstData_Root{BodyNodes: optimiseBody(data.BodyNodes)}
+		case AstData_Script:
+			data.BodyNodes = optimiseBody(data.BodyNodes)
+			node.Data = data
+		case AstData_WhileLoop:
+			data.BodyNodes = optimiseBody(data.BodyNodes)
+			node.Data = data
+		case AstData_IfStatement:
+			bodies := make([][]AstNode, len(data.Bodies))
+			for i, body := range data.Bodies {
+				bodies[i] = optimiseBody(body)
+			}
+			data.Bodies = bodies
+			node.Data = data
+		case AstData_Random:
+			branches := make([][]AstNode, len(data.Branches))
+			for i, branch := range data.Branches {
+				branches[i] = optimiseBody(branch)
+			}
+			data.Branches = branches
+			node.Data = data
+		case AstData_Struct:
+			node.Data = AstData_Struct{ElementNodes: removeRedundantNewLines(optimiseElements(data.ElementNodes, optimiseNode))}
+		case AstData_Array:
+			node.Data = AstData_Array{ElementNodes: removeRedundantNewLines(optimiseElements(data.ElementNodes, optimiseNode))}
+		case AstData_Assignment:
+			data.ValueNode = optimiseNode(data.ValueNode)
+			node.Data = data
+		case AstData_Invocation:
+			data.ParameterNodes = optimiseElements(data.ParameterNodes, optimiseNode)
+			node.Data = data
+		}
+		return node
+	}
+
+	rootNode = optimiseNode(rootNode)
+	rootNode.Data = AstData_Root{BodyNodes: removeUnusedGlobals(rootNode.Data.(AstData_Root).BodyNodes, optimiser)}
+	rootNode.Data = AstData_Root{BodyNodes: removeRedundantNewLines(rootNode.Data.(AstData_Root).BodyNodes)}
+	return rootNode
+}
+
+func optimiseElements(nodes []AstNode, optimiseNode func(node AstNode) AstNode) []AstNode {
+	optimisedNodes := make([]AstNode, len(nodes))
+	for i, node := range nodes {
+		optimisedNodes[i] = optimiseNode(node)
+	}
+	return optimisedNodes
+}
+
+// Removing one global can leave others unused (when it was the only thing referring to them), so this repeats until
+// nothing else can be removed.
+func removeUnusedGlobals(rootNodes []AstNode, optimiser *Optimiser) []AstNode {
+	keep := make(map[uint32]bool)
+	for _, name := range optimiser.KeepGlobals {
+		keep[StringToChecksum(name)] = true
+	}
+
+	for {
+		uses := make(map[uint32]int)
+		for _, node := range rootNodes {
+			forEachChecksum(node, func(data AstData_Checksum) {
+				uses[data.Checksum()]++
+			})
+		}
+
+		var usedNodes []AstNode
+		for _, node := range rootNodes {
+			if node.Kind == AstKind_Assignment {
+				nameNode := node.Data.(AstData_Assignment).NameNode
+				if nameNode.Kind == AstKind_Checksum {
+					data := nameNode.Data.(AstData_Checksum)
+					if checksum := data.Checksum(); uses[checksum] == 1 && !keep[checksum] {
+						optimiser.GlobalsRemoved = append(optimiser.GlobalsRemoved, data.ChecksumToken.Data)
+						continue
+					}
+				}
+			}
+			usedNodes = append(usedNodes, node)
+		}
+
+		if len(usedNodes) == len(rootNodes) {
+			return rootNodes
+		}
+		rootNodes = usedNodes
+	}
+}
+
+// forEachChecksum calls f for every checksum in a node, including the node itself.
+func forEachChecksum(node AstNode, f func(data AstData_Checksum)) {
+	Walk(node, Visitor{EnterKinds: map[AstKind]func(node AstNode, parents []AstNode){
+		AstKind_Checksum: func(node AstNode, parents []AstNode) {
+			f(node.Data.(AstData_Checksum))
+		},
+	}})
+}
+
+// evaluateConstant works out the value of a condition made of integers, e.g. (1 > 2) or NOT 0.
+// Like the game, anything other than 0 is true.
+func evaluateConstant(node AstNode) (int64, bool) {
+	boolean := func(b bool) int64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	switch node.Kind {
+	case AstKind_Integer:
+		return int64(node.Data.(AstData_Integer).Value()), true
+	case AstKind_UnaryExpression:
+		return evaluateConstant(node.Data.(AstData_UnaryExpression).Node)
+	case AstKind_LogicalNot:
+		value, isConstant := evaluateConstant(node.Data.(AstData_UnaryExpression).Node)
+		return boolean(value == 0), isConstant
+	}
+
+	data, isBinaryExpression := node.Data.(AstData_BinaryExpression)
+	if !isBinaryExpression {
+		return 0, false
+	}
+	left, isLeftConstant := evaluateConstant(data.LeftNode)
+	right, isRightConstant := evaluateConstant(data.RightNode)
+	if !isLeftConstant || !isRightConstant {
+		return 0, false
+	}
+	switch node.Kind {
+	case AstKind_LogicalAnd:
+		return boolean(left != 0 && right != 0), true
+	case AstKind_LogicalOr:
+		return boolean(left != 0 || right != 0), true
+	case AstKind_EqualsExpression:
+		return boolean(left == right), true
+	case AstKind_NotEqualExpression:
+		return boolean(left != right), true
+	case AstKind_LessThanExpression:
+		return boolean(left < right), true
+	case AstKind_LessThanEqualsExpression:
+		return boolean(left <= right), true
+	case AstKind_GreaterThanExpression:
+		return boolean(left > right), true
+	case AstKind_GreaterThanEqualsExpression:
+		return boolean(left >= right), true
+	}
+	return 0, false
+}
+
+// hasNoSideEffects tells whether a condition is made only of values and operators. A bare checksum doesn't count,
+// since the game runs the script when the name belongs to one.
+func hasNoSideEffects(node AstNode) bool {
+	switch data := node.Data.(type) {
+	case AstData_Integer, AstData_Float, AstData_String, AstData_Pair, AstData_Vector:
+		return true
+	case AstData_LocalReference:
+		return true
+	case AstData_UnaryExpression:
+		return hasNoSideEffects(data.Node)
+	case AstData_BinaryExpression:
+		return node.Kind != AstKind_DotExpression && node.Kind != AstKind_ColonExpression &&
+			hasNoSideEffects(data.LeftNode) && hasNoSideEffects(data.RightNode)
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package compiler_test
+
+import (
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Each input is optimised and compared against the bytecode of the expected code (compiled without optimising).
+func TestOptimiser(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		keepGlobals []string
+		input       string
+		expected    string
+	}{
+		{
+			name:     "extra newlines and comments",
+			input:    "// comment\n\nscript Foo {\n\n    // comment\n    x = 1\n\n\n    y = 2\n}\n\n\n",
+			expected: "script Foo {\n    x = 1\n    y = 2\n}\n",
+		},
+		{
+			name:     "newlines in structs and arrays",
+			input:    "script Foo {\n    x = {\n\n        a = 1\n\n    }\n    y = [\n\n 1\n\n 2\n ]\n}\n",
+			expected: "script Foo {\n    x = {\n        a = 1\n    }\n    y = [\n 1\n 2\n ]\n}\n",
+		},
+		{
+			name:     "constant false branches",
+			input:    "script Foo {\n    if 0 {\n        a\n    } else if (1 > 2) {\n        b\n    } else if c {\n        c\n    }\n}\n",
+			expected: "script Foo {\n    if c {\n        c\n    }\n}\n",
+		},
+		{
+			name:     "constant true branch",
+			input:    "script Foo {\n    if a {\n        a\n    } else if (1 = 1) {\n        b\n    } else {\n        c\n    }\n}\n",
+			expected: "script Foo {\n    if a {\n        a\n    } else {\n        b\n    }\n}\n",
+		},
+		{
+			name:     "only the else branch is left",
+			input:    "script Foo {\n    if ! 1 {\n        a\n    } else {\n        b\n    }\n}\n",
+			expected: "script Foo {\n    b\n}\n",
+		},
+		{
+			name:     "empty if statements",
+			input:    "script Foo {\n    if (<x> = 1) {\n\n    }\n    if a {\n        a\n    } else {\n    }\n}\n",
+			expected: "script Foo {\n    if a {\n        a\n    }\n}\n",
+		},
+		{
+			name:     "empty if statements whose conditions might run scripts",
+			input:    "script Foo {\n    if IsDone {}\n    if @(IsDone) {}\n}\n",
+			expected: "script Foo {\n    if IsDone {}\n    if @(IsDone) {}\n}\n",
+		},
+		{
+			name:     "unreachable code",
+			input:    "script Foo {\n    while {\n        break\n        a\n    }\n    return x=1\n    b\n    c\n}\n",
+			expected: "script Foo {\n    while {\n        break\n    }\n    return x=1\n}\n",
+		},
+		{
+			name:     "unused globals",
+			input:    "unused = 1\nusedByUnused = 2\nalsoUnused = [usedByUnused]\nused = 3\nscript Foo {\n    x = used\n}\n",
+			expected: "used = 3\nscript Foo {\n    x = used\n}\n",
+		},
+		{
+			name:        "kept globals",
+			keepGlobals: []string{"Unused"},
+			input:       "unused = 1\nalsoUnused = 2\n",
+			expected:    "unused = 1\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			optimiser := compiler.Optimiser{KeepGlobals: test.keepGlobals}
+			optimised := compileOptimised(t, test.input, &optimiser)
+			checkSameByteCode(t, compileSourceCode(t, test.expected), optimised)
+			if unoptimised := compileSourceCode(t, test.input); optimiser.BytesSaved != len(unoptimised)-len(optimised) {
+				t.Errorf("Reported %d byte(s) saved, but %d were", optimiser.BytesSaved, len(unoptimised)-len(optimised))
+			}
+		})
+	}
+}
+
+func TestOptimisedOutputIsValid(t *testing.T) {
+	for _, input := range testInputs(t) {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			var lexer compiler.Lexer
+			var parser compiler.Parser
+			bytecodeCompiler := compiler.BytecodeCompiler{Optimiser: &compiler.Optimiser{}}
+			if err := compiler.CompileToBytes(input, &lexer, &parser, &bytecodeCompiler); err != nil {
+				t.Fatal(err)
+			}
+			for _, problem := range disassembler.Verify(bytecodeCompiler.Bytes) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+// Measuring the bytes saved shouldn't print warnings a second time.
+func TestOptimiserWarnsOnce(t *testing.T) {
+	unknownNode := compiler.AstNode{Kind: compiler.AstKind(1000)}
+	rootNode := compiler.AstNode{Kind: compiler.AstKind_Root, Data: compiler.AstData_Root{BodyNodes: []compiler.AstNode{unknownNode}}}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: rootNode, Optimiser: &compiler.Optimiser{}}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+	os.Stdout = stdout
+	writer.Close()
+	output, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := strings.Count(string(output), "Warning: no bytecode generated"); count != 1 {
+		t.Errorf("Expected 1 warning, got %d:\n%s", count, output)
+	}
+}
+
+func compileSourceCode(t *testing.T, sourceCode string) []byte {
+	t.Helper()
+	byteCode, err := compiler.CompileSourceCode(sourceCode, false)
+	if err != nil {
+		t.Fatalf("Failed to compile %q: %s", sourceCode, err)
+	}
+	return byteCode
+}
+
+// compileOptimised is like compileSourceCode, but optimises the AST before generating the bytecode.
+func compileOptimised(t *testing.T, sourceCode string, optimiser *compiler.Optimiser) []byte {
+	t.Helper()
+	var lexer compiler.Lexer
+	var parser compiler.Parser
+	if err := compiler.ParseSourceCode(sourceCode, false, &lexer, &parser); err != nil {
+		t.Fatalf("Failed to compile %q: %s", sourceCode, err)
+	}
+	bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: parser.Result.Node, Optimiser: optimiser}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+	return bytecodeCompiler.Bytes
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
-	"strconv"
 )
 
 type CustomByteBuffer struct {
@@ -15,9 +14,23 @@ type BytecodeCompiler struct {
 	RootAstNode AstNode
 	Bytes       []byte
 	NextLoopBypasserId int
+	SourceMap   *SourceMap // optional, populated when not nil
+	Checksums   *ChecksumUsage // optional, populated when not nil
+	SourceFilePath string // used to locate names in Checksums
+	Optimiser   *Optimiser // optional, the AST is optimised first when not nil
+	isMeasuring bool // the unoptimised pass that measures Optimiser.BytesSaved, which mustn't repeat warnings
 }
 
 func GenerateBytecode(compiler *BytecodeCompiler) {
+	if compiler.Optimiser != nil {
+		unoptimised := BytecodeCompiler{RootAstNode: compiler.RootAstNode, isMeasuring: true}
+		GenerateBytecode(&unoptimised)
+		compiler.RootAstNode = Optimise(compiler.RootAstNode, compiler.Optimiser)
+		defer func() {
+			compiler.Optimiser.BytesSaved = len(unoptimised.Bytes) - len(compiler.Bytes)
+		}()
+	}
+
 	write := func(bytes ...byte) {
 		compiler.Bytes = append(compiler.Bytes, bytes...)
 	}
@@ -60,6 +73,30 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 	}
 
 	nameTable := make(map[string]uint32)
+	var nameTableOrder []string // names in order of first use, so the output is the same every time
+
+	currentScriptName := ""
+	recordSourceMapEntry := func(node AstNode, start int) {
+		end := len(compiler.Bytes)
+		if end <= start || node.Kind == AstKind_Root {
+			return
+		}
+		token, found := FindFirstToken(node)
+		if !found {
+			return
+		}
+		scriptName := currentScriptName
+		if node.Kind == AstKind_Script {
+			scriptName = token.Data
+		}
+		compiler.SourceMap.Entries = append(compiler.SourceMap.Entries, SourceMapEntry{
+			Start:      start,
+			End:        end,
+			LineNumber: token.LineNumber,
+			Column:     token.Column,
+			Script:     scriptName,
+		})
+	}
 
 	var writeBytecodeForNode func(node AstNode)
 	var writeBytecodeForIf func(node AstNode)
@@ -73,6 +110,10 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 	var writeBytecodeForFloat func(node AstNode)
 
 	writeBytecodeForNode = func(node AstNode) {
+		if compiler.SourceMap != nil {
+			start := len(compiler.Bytes)
+			defer recordSourceMapEntry(node, start)
+		}
 		switch node.Kind {
 		case AstKind_Root:
 			for _, rootNode := range node.Data.(AstData_Root).BodyNodes {
@@ -96,9 +137,12 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 		case AstKind_Float:
 			writeBytecodeForFloat(node)
 		case AstKind_String:
-			write(0x1B)
-			stringData := node.Data.(AstData_String).StringToken.Data
-			stringData = stringData[1 : len(stringData)-1]
+			if node.Data.(AstData_String).IsLocalString {
+				write(0x1C)
+			} else {
+				write(0x1B)
+			}
+			stringData := node.Data.(AstData_String).Text()
 			writeLittleUint32(uint32(len(stringData) + 1))
 			write([]byte(stringData)...)
 			write(0)
@@ -177,6 +221,7 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 			//})
 		case AstKind_Script:
 			data := node.Data.(AstData_Script)
+			currentScriptName = data.NameNode.Data.(AstData_Checksum).ChecksumToken.Data
 			write(0x23)
 			writeBytecodeForNode(data.NameNode)
 			for _, defaultParameterNode := range data.DefaultParameterNodes {
@@ -186,6 +231,7 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 				writeBytecodeForNode(bodyNode)
 			}
 			write(0x24)
+			currentScriptName = ""
 		case AstKind_IfStatement:
 			writeBytecodeForIf(node)
 		case AstKind_Random:
@@ -198,8 +244,7 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 
 			// write branch weights
 			for i := 0; i < numBranches; i++ {
-				branchWeightAsInt, _ := strconv.ParseInt(data.BranchWeights[i].Data.(AstData_Integer).IntegerToken.Data, 10, 32)
-				writeLittleUint16(uint16(branchWeightAsInt))
+				writeLittleUint16(uint16(data.BranchWeights[i].Data.(AstData_Integer).Value()))
 			}
 
 			branchOffsetsIndex := len(compiler.Bytes)
@@ -256,6 +301,14 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 			}
 
 		case AstKind_WhileLoop:
+			if node.Data.(AstData_WhileLoop).IsRaw {
+				write(0x20)
+				for _, bodyNode := range node.Data.(AstData_WhileLoop).BodyNodes {
+					writeBytecodeForNode(bodyNode)
+				}
+				write(0x21)
+				break
+			}
 			compilerGeneratedChecksum := AstNode{
 				Kind: AstKind_Checksum,
 				Data: AstData_Checksum{
@@ -408,7 +461,19 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 			write(5)
 			writeBytecodeForNode(data.Index)
 			write(6)
+		case AstKind_NameTableEntry:
+			// only in decompiled trees; the entry is written with the others at the end
+			data := node.Data.(AstData_NameTableEntry)
+			if _, exists := nameTable[data.Name]; !exists {
+				nameTableOrder = append(nameTableOrder, data.Name)
+			}
+			nameTable[data.Name] = binary.LittleEndian.Uint32(data.ChecksumBytes)
+		case AstKind_EndOfFile:
+			// only in decompiled trees; the end of the file is always written
 		default:
+			if compiler.isMeasuring {
+				break
+			}
 			fmt.Printf("Warning: no bytecode generated for AstNode of type '%s'\n", node.Kind.String())
 		}
 	}
@@ -503,14 +568,20 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 		write(0x16)
 		data := node.Data.(AstData_Checksum)
 
-		var checksum uint32
-		if data.IsRawChecksum {
-			temp, _ := strconv.ParseInt(data.ChecksumToken.Data[1:], 16, 32)
-			checksum = uint32(temp)
-		} else {
+		checksum := data.Checksum()
+		if data.HasName() {
 			name := data.ChecksumToken.Data
-			checksum = StringToChecksum(name)
+			if _, exists := nameTable[name]; !exists {
+				nameTableOrder = append(nameTableOrder, name)
+			}
 			nameTable[name] = checksum
+			if compiler.Checksums != nil {
+				location := fmt.Sprintf("line %d", data.ChecksumToken.LineNumber)
+				if compiler.SourceFilePath != "" {
+					location = fmt.Sprintf("%s:%d", compiler.SourceFilePath, data.ChecksumToken.LineNumber)
+				}
+				compiler.Checksums.Add(checksum, name, location)
+			}
 		}
 
 		writeLittleUint32(checksum)
@@ -518,44 +589,31 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 
 	writeBytecodeForInteger = func(node AstNode) {
 		write(0x17)
-		intValue, _ := strconv.ParseInt(node.Data.(AstData_Integer).IntegerToken.Data, 10, 32)
-		writeLittleUint32(uint32(intValue))
+		writeLittleUint32(uint32(node.Data.(AstData_Integer).Value()))
+	}
+
+	writeFloat := func(node AstNode) {
+		writeLittleUint32(math.Float32bits(node.Data.(AstData_Float).Value()))
 	}
 
 	writeBytecodeForFloat = func(node AstNode) {
 		write(0x1A)
-		floatValue, _ := strconv.ParseFloat(node.Data.(AstData_Float).FloatToken.Data, 32)
-		var bytesValue [4]byte
-		binary.LittleEndian.PutUint32(bytesValue[:], math.Float32bits(float32(floatValue)))
-		write(bytesValue[:]...)
+		writeFloat(node)
 	}
 
 	writeBytecodeForPair = func(node AstNode) {
 		write(0x1F)
-		floatValueA, _ := strconv.ParseFloat(node.Data.(AstData_Pair).FloatNodeA.Data.(AstData_Float).FloatToken.Data, 32)
-		var bytesValueA [4]byte
-		binary.LittleEndian.PutUint32(bytesValueA[:], math.Float32bits(float32(floatValueA)))
-		write(bytesValueA[:]...)
-		floatValueB, _ := strconv.ParseFloat(node.Data.(AstData_Pair).FloatNodeB.Data.(AstData_Float).FloatToken.Data, 32)
-		var bytesValueB [4]byte
-		binary.LittleEndian.PutUint32(bytesValueB[:], math.Float32bits(float32(floatValueB)))
-		write(bytesValueB[:]...)
+		data := node.Data.(AstData_Pair)
+		writeFloat(data.FloatNodeA)
+		writeFloat(data.FloatNodeB)
 	}
 
 	writeBytecodeForVector = func(node AstNode) {
 		write(0x1E)
-		floatValueA, _ := strconv.ParseFloat(node.Data.(AstData_Vector).FloatNodeA.Data.(AstData_Float).FloatToken.Data, 32)
-		var bytesValueA [4]byte
-		binary.LittleEndian.PutUint32(bytesValueA[:], math.Float32bits(float32(floatValueA)))
-		write(bytesValueA[:]...)
-		floatValueB, _ := strconv.ParseFloat(node.Data.(AstData_Vector).FloatNodeB.Data.(AstData_Float).FloatToken.Data, 32)
-		var bytesValueB [4]byte
-		binary.LittleEndian.PutUint32(bytesValueB[:], math.Float32bits(float32(floatValueB)))
-		write(bytesValueB[:]...)
-		floatValueC, _ := strconv.ParseFloat(node.Data.(AstData_Vector).FloatNodeC.Data.(AstData_Float).FloatToken.Data, 32)
-		var bytesValueC [4]byte
-		binary.LittleEndian.PutUint32(bytesValueC[:], math.Float32bits(float32(floatValueC)))
-		write(bytesValueC[:]...)
+		data := node.Data.(AstData_Vector)
+		writeFloat(data.FloatNodeA)
+		writeFloat(data.FloatNodeB)
+		writeFloat(data.FloatNodeC)
 	}
 
 	writeBytecodeForIfElse = func(conditionNode AstNode, bodyNodes []AstNode, elseNodes []AstNode, hasElse bool, isBooleanInvocation bool) {
@@ -634,10 +692,19 @@ func GenerateBytecode(compiler *BytecodeCompiler) {
 
 	// -----------
 
+	// a decompiled tree's name table entries come first, so names the compiler adds (like loop bypassers) don't
+	// change their order
+	if rootData, ok := compiler.RootAstNode.Data.(AstData_Root); ok {
+		for _, node := range rootData.BodyNodes {
+			if node.Kind == AstKind_NameTableEntry {
+				writeBytecodeForNode(node)
+			}
+		}
+	}
 	writeBytecodeForNode(compiler.RootAstNode)
 
-	for name, checksum := range nameTable {
-		writeNameTableEntry(checksum, name)
+	for _, name := range nameTableOrder {
+		writeNameTableEntry(nameTable[name], name)
 	}
 	write(0)
 }
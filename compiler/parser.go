@@ -46,6 +46,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 	// TODO(brandon): var SkipOverCommentsAndEscapedNewlines func(index int) int
 	var GetKind func(index int) TokenKind
 	var GetToken func(index int) Token
+	var GetTokens func(index int) []Token
 
 	ParseRoot = func() ParseResult {
 		var bodyNodes AstNodeBuffer
@@ -73,12 +74,12 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 			}
 		}
 
-		// Display
-		if numOfTokens := len(parser.Tokens); bodyNodes.TokensConsumed < numOfTokens {
+		// Display (index, not bodyNodes.TokensConsumed, which counts the new-line added above)
+		if numOfTokens := len(parser.Tokens); index < numOfTokens {
 			var messageBuilder strings.Builder
 			messageBuilder.WriteString("\n\nFinished parsing but didn't read all tokens.\n")
-			messageBuilder.WriteString(fmt.Sprintf("Read %d/%d (%d left unread).\n", bodyNodes.TokensConsumed, numOfTokens, numOfTokens-bodyNodes.TokensConsumed))
-			for _, unreadToken := range parser.Tokens[bodyNodes.TokensConsumed:numOfTokens] {
+			messageBuilder.WriteString(fmt.Sprintf("Read %d/%d (%d left unread).\n", index, numOfTokens, numOfTokens-index))
+			for _, unreadToken := range parser.Tokens[index:numOfTokens] {
 				messageBuilder.WriteString(fmt.Sprintf("  %+v,\n", unreadToken))
 			}
 			messageBuilder.WriteString(fmt.Sprintf("\nPotential cause: %s\n", bodyNodeParseResult.Reason))
@@ -123,7 +124,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 
 		return ParseResult{
 			WasSuccessful: false,
-			Reason:        TokensNotRecognisedError(parser.Tokens[index:], "a root body node"),
+			Reason:        TokensNotRecognisedError(GetTokens(index), "a root body node"),
 		}
 	}
 
@@ -178,7 +179,10 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 					TokensConsumed: 2 + parseResult.TokensConsumed,
 				}
 			}
-			if GetKind(index) == TokenKind_Minus {
+			// '-' is only a sign when it touches the number, so "x - 6" isn't read as invoking x with -6
+			if GetKind(index) == TokenKind_Minus &&
+				GetToken(index+1).LineNumber == GetToken(index).LineNumber &&
+				GetToken(index+1).Column == GetToken(index).Column+1 {
 				nextToken := GetToken(index + 1)
 				if nextToken.Kind == TokenKind_Integer {
 					return ParseResult{
@@ -190,6 +194,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 									Kind:       TokenKind_Integer,
 									Data:       "-" + nextToken.Data,
 									LineNumber: nextToken.LineNumber,
+									Column:     GetToken(index).Column,
 								},
 							},
 						},
@@ -205,6 +210,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 									Kind:       TokenKind_Float,
 									Data:       "-" + nextToken.Data,
 									LineNumber: nextToken.LineNumber,
+									Column:     GetToken(index).Column,
 								},
 							},
 						},
@@ -242,7 +248,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 			}
 			return ParseResult{
 				WasSuccessful: false,
-				Reason:        TokensNotRecognisedError(parser.Tokens[index:], "an expression"),
+				Reason:        TokensNotRecognisedError(GetTokens(index), "an expression"),
 			}
 		}
 
@@ -376,7 +382,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 							Node:           AstNode{
 								Kind: AstKind_ArrayAccess,
 								Data: AstData_ArrayAccess{
-									Array: secondExpressionParseResult.Node,
+									Array: expressionParseResult.Node,
 									Index: secondExpressionParseResult.Node,
 								},
 							},
@@ -394,6 +400,15 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 		oldIndex := index
 		index++
 
+		isFloatAt := func(index int) bool {
+			return GetKind(index) == TokenKind_Float ||
+				(GetKind(index) == TokenKind_Minus && GetKind(index+1) == TokenKind_Float)
+		}
+		// the components of pairs & vectors have to be plain floats, not expressions that start with one
+		isFloat := func(parseResult ParseResult) bool {
+			return parseResult.Node.Kind == AstKind_Float
+		}
+
 		firstParseResult := ParseExpression(index, true)
 		if firstParseResult.WasSuccessful {
 			index += firstParseResult.TokensConsumed
@@ -412,11 +427,11 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 
 			if GetKind(index) == TokenKind_Comma {
 				index++
-				if GetKind(index) == TokenKind_Float {
+				if isFloatAt(index) {
 					secondParseResult := ParseExpression(index, true)
 					if secondParseResult.WasSuccessful {
 						index += secondParseResult.TokensConsumed
-						if GetKind(index) == TokenKind_RightParenthesis {
+						if GetKind(index) == TokenKind_RightParenthesis && isFloat(firstParseResult) && isFloat(secondParseResult) {
 							return ParseResult{
 								WasSuccessful: true,
 								Node: AstNode{
@@ -431,11 +446,12 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 						}
 						if GetKind(index) == TokenKind_Comma {
 							index++
-							if GetKind(index) == TokenKind_Float {
+							if isFloatAt(index) {
 								thirdParseResult := ParseExpression(index, true)
 								if thirdParseResult.WasSuccessful {
 									index += thirdParseResult.TokensConsumed
-									if GetKind(index) == TokenKind_RightParenthesis {
+									if GetKind(index) == TokenKind_RightParenthesis &&
+										isFloat(firstParseResult) && isFloat(secondParseResult) && isFloat(thirdParseResult) {
 										return ParseResult{
 											WasSuccessful: true,
 											Node: AstNode{
@@ -514,7 +530,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 
 		return ParseResult{
 			WasSuccessful: false,
-			Reason:        TokensNotRecognisedError(parser.Tokens[oldIndex:], "an expression beginning with a left parenthesis"),
+			Reason:        TokensNotRecognisedError(GetTokens(oldIndex), "an expression beginning with a left parenthesis"),
 		}
 	}
 
@@ -542,7 +558,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 		if checksumOrInvocation.WasSuccessful == false {
 			return ParseResult{
 				WasSuccessful: false,
-				Reason:        TokensNotRecognisedError(parser.Tokens[index:], "an invocation or checksum node"),
+				Reason:        TokensNotRecognisedError(GetTokens(index), "an invocation or checksum node"),
 			}
 		}
 
@@ -609,6 +625,13 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 	}
 
 	ParseString = func(index int) ParseResult {
+		token := GetToken(index)
+		if len(token.Data) < 2 || !strings.HasSuffix(token.Data, "\"") {
+			return ParseResult{
+				WasSuccessful: false,
+				Reason:        fmt.Sprintf("Unterminated string on line %d", token.LineNumber),
+			}
+		}
 		return ParseResult{
 			WasSuccessful: true,
 			Node: AstNode{
@@ -627,6 +650,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 		// gather array elements
 		var elementNodes AstNodeBuffer
 		for {
+			indexBeforeThisIteration := index
 			if GetKind(index) == TokenKind_BackwardSlash && GetKind(index+1) == TokenKind_NewLine {
 				index += 2
 				elementNodes.TokensConsumed += 2
@@ -650,6 +674,12 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 				elementNodes.MaybeSave(expressionParseResult)
 				index += expressionParseResult.TokensConsumed
 			}
+			if index == indexBeforeThisIteration {
+				return ParseResult{
+					WasSuccessful: false,
+					Reason:        TokensNotRecognisedError(GetTokens(index), "an array element"),
+				}
+			}
 		}
 
 		return ParseResult{
@@ -710,7 +740,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 			} else if index == indexAfterLastIteration {
 				return ParseResult{
 					WasSuccessful: false,
-					Reason:        TokensNotRecognisedError(parser.Tokens[index:], "a struct element"),
+					Reason:        TokensNotRecognisedError(GetTokens(index), "a struct element"),
 				}
 			}
 			indexAfterLastIteration = index
@@ -916,6 +946,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 						Kind: AstKind_Checksum,
 						Data: AstData_Checksum{
 							ChecksumToken: nameToken,
+							IsRawChecksum: nameToken.Kind == TokenKind_RawChecksum,
 						},
 					},
 					DefaultParameterNodes: defaultParameters.Nodes,
@@ -1069,7 +1100,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 
 				if GetKind(index) == TokenKind_LeftCurlyBrace {
 					anotherBodyParseResult, bodyNodes := ParseBodyOfCode(index)
-					if bodyParseResult.WasSuccessful {
+					if anotherBodyParseResult.WasSuccessful {
 						index += anotherBodyParseResult.TokensConsumed
 						saveBody(anotherBodyParseResult, bodyNodes)
 					} else {
@@ -1117,7 +1148,10 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 		var bodyNodes AstNodeBuffer
 		for {
 			if GetKind(index) == TokenKind_OutOfRange {
-				break
+				return ParseResult{
+					WasSuccessful: false,
+					Reason:        "Reached the end of the file before finding '}' at the end of the body of code",
+				}, []AstNode{}
 			} else if GetKind(index) == TokenKind_RightCurlyBrace {
 				index++
 				break
@@ -1146,7 +1180,10 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 				bodyNodes.MaybeSave(parseResult)
 				index += parseResult.TokensConsumed
 			} else {
-				TokensNotRecognisedError(parser.Tokens[index:], "a script body node")
+				return ParseResult{
+					WasSuccessful: false,
+					Reason:        TokensNotRecognisedError(GetTokens(index), "a script body node"),
+				}, []AstNode{}
 			}
 		}
 
@@ -1220,13 +1257,19 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 			if !bodyParseResult.WasSuccessful {
 				return ParseResult{
 					WasSuccessful: false,
-					Reason:        WrapStr("Failed to parse body for branch", integerParseResult.Reason),
+					Reason:        WrapStr("Failed to parse body for branch", bodyParseResult.Reason),
 				}
 			}
 			index += bodyParseResult.TokensConsumed
 
 			saveBranch(integerParseResult.Node, bodyNodes)
 		}
+		if numBranches == 0 {
+			return ParseResult{
+				WasSuccessful: false,
+				Reason:        "Random needs at least one branch",
+			}
+		}
 
 		return ParseResult{
 			WasSuccessful: true,
@@ -1305,7 +1348,7 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 		}
 		return ParseResult{
 			WasSuccessful: false,
-			Reason:        TokensNotRecognisedError(parser.Tokens[index:], "a parameter"),
+			Reason:        TokensNotRecognisedError(GetTokens(index), "a parameter"),
 		}
 	}
 
@@ -1415,6 +1458,13 @@ func BuildAbstractSyntaxTree(parser *Parser) {
 		return parser.Tokens[index]
 	}
 
+	GetTokens = func(index int) []Token {
+		if index >= len(parser.Tokens) {
+			return nil
+		}
+		return parser.Tokens[index:]
+	}
+
 	parser.Result = ParseRoot()
 }
 
@@ -1451,9 +1501,17 @@ func (this *AstNodeBuffer) MaybeSave(parseResult ParseResult) {
 }
 
 func TokensNotRecognisedError(tokens []Token, notRecognisedAs string) string {
+	// Only the first few tokens are shown. This is called for every failed attempt while parsing, so listing the rest of
+	// the file each time would make large files with mistakes take forever to compile.
+	const maxTokensShown = 20
+
 	var messageBuilder strings.Builder
 	messageBuilder.WriteString(fmt.Sprintf("Token stream not recognised as %s: [\n", notRecognisedAs))
-	for _, token := range tokens {
+	for i, token := range tokens {
+		if i >= maxTokensShown {
+			messageBuilder.WriteString(fmt.Sprintf("  ... (%d more)\n", len(tokens)-maxTokensShown))
+			break
+		}
 		messageBuilder.WriteString(fmt.Sprintf("  %+v,\n", token))
 	}
 	messageBuilder.WriteString("]")
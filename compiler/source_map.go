@@ -0,0 +1,121 @@
+package compiler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// A SourceMap links ranges of compiled QB bytes back to the NeverScript source they were generated from.
+// Ranges can be nested (e.g. an integer inside an assignment inside a script), so lookups prefer the smallest match.
+type SourceMap struct {
+	SourceFilePath string           `json:"sourceFilePath"`
+	Entries        []SourceMapEntry `json:"entries"`
+}
+
+type SourceMapEntry struct {
+	Start      int    `json:"start"` // inclusive
+	End        int    `json:"end"`   // exclusive
+	LineNumber int    `json:"line"`
+	Column     int    `json:"column"`
+	Script     string `json:"script,omitempty"`
+}
+
+func (sourceMap *SourceMap) Lookup(offset int) (SourceMapEntry, bool) {
+	var bestEntry SourceMapEntry
+	found := false
+	for _, entry := range sourceMap.Entries {
+		if offset < entry.Start || offset >= entry.End {
+			continue
+		}
+		if !found || (entry.End-entry.Start) < (bestEntry.End-bestEntry.Start) {
+			bestEntry = entry
+			found = true
+		}
+	}
+	return bestEntry, found
+}
+
+func WriteSourceMap(path string, sourceMap *SourceMap) error {
+	bytes, err := json.MarshalIndent(sourceMap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, 0644)
+}
+
+func ReadSourceMap(path string) (*SourceMap, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sourceMap SourceMap
+	if err := json.Unmarshal(bytes, &sourceMap); err != nil {
+		return nil, err
+	}
+	return &sourceMap, nil
+}
+
+func SourceMapPath(qbFilePath string) string {
+	return qbFilePath + ".map"
+}
+
+// FindFirstToken finds the earliest source token that a node was parsed from.
+// Nodes synthesised by the compiler (e.g. while-loop bypassers) have no tokens of their own.
+func FindFirstToken(node AstNode) (Token, bool) {
+	fromNodes := func(nodes ...AstNode) (Token, bool) {
+		for _, childNode := range nodes {
+			if token, found := FindFirstToken(childNode); found {
+				return token, true
+			}
+		}
+		return Token{}, false
+	}
+
+	isRealToken := func(token Token) bool {
+		return token.Data != "" && token.LineNumber > 0
+	}
+
+	switch data := node.Data.(type) {
+	case AstData_Root:
+		return fromNodes(data.BodyNodes...)
+	case AstData_Assignment:
+		return fromNodes(data.NameNode, data.ValueNode)
+	case AstData_Invocation:
+		return fromNodes(append([]AstNode{data.ScriptIdentifierNode}, data.ParameterNodes...)...)
+	case AstData_Script:
+		return fromNodes(data.NameNode)
+	case AstData_WhileLoop:
+		return fromNodes(data.BodyNodes...)
+	case AstData_IfStatement:
+		return fromNodes(data.Conditions...)
+	case AstData_Comment:
+		return data.CommentToken, isRealToken(data.CommentToken)
+	case AstData_LocalReference:
+		return fromNodes(data.Node)
+	case AstData_Checksum:
+		return data.ChecksumToken, isRealToken(data.ChecksumToken)
+	case AstData_Float:
+		return data.FloatToken, isRealToken(data.FloatToken)
+	case AstData_Integer:
+		return data.IntegerToken, isRealToken(data.IntegerToken)
+	case AstData_String:
+		return data.StringToken, isRealToken(data.StringToken)
+	case AstData_BinaryExpression:
+		return fromNodes(data.LeftNode, data.RightNode)
+	case AstData_Pair:
+		return fromNodes(data.FloatNodeA, data.FloatNodeB)
+	case AstData_Vector:
+		return fromNodes(data.FloatNodeA, data.FloatNodeB, data.FloatNodeC)
+	case AstData_UnaryExpression:
+		return fromNodes(data.Node)
+	case AstData_Struct:
+		return fromNodes(data.ElementNodes...)
+	case AstData_Array:
+		return fromNodes(data.ElementNodes...)
+	case AstData_ArrayAccess:
+		return fromNodes(data.Array, data.Index)
+	case AstData_Random:
+		return fromNodes(data.BranchWeights...)
+	}
+	return Token{}, false
+}
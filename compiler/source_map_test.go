@@ -0,0 +1,120 @@
+package compiler_test
+
+import (
+	"bytes"
+	"github.com/byxor/NeverScript/compiler"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceMapLookup(t *testing.T) {
+	sourceMap := compiler.SourceMap{Entries: []compiler.SourceMapEntry{
+		{Start: 0, End: 20, LineNumber: 1, Script: "Foo"},
+		{Start: 5, End: 15, LineNumber: 2, Script: "Foo"},
+		{Start: 10, End: 15, LineNumber: 3, Script: "Foo"},
+	}}
+	testCases := []struct {
+		offset       int
+		expectedLine int // 0 when nothing should be found
+	}{
+		{0, 1},
+		{4, 1},
+		{5, 2},
+		{12, 3}, // the smallest entry wins
+		{14, 3},
+		{15, 1}, // ends are exclusive
+		{19, 1},
+		{20, 0}, // past the end
+		{-1, 0},
+	}
+	for _, testCase := range testCases {
+		entry, found := sourceMap.Lookup(testCase.offset)
+		if found != (testCase.expectedLine != 0) || entry.LineNumber != testCase.expectedLine {
+			t.Errorf("Lookup(%d) = %v, %t, expected line %d", testCase.offset, entry, found, testCase.expectedLine)
+		}
+	}
+
+	var emptySourceMap compiler.SourceMap
+	if entry, found := emptySourceMap.Lookup(0); found {
+		t.Errorf("Expected nothing to be found in an empty source map, got %v", entry)
+	}
+}
+
+func TestSourceMapOfCompiledCode(t *testing.T) {
+	var lexer compiler.Lexer
+	var parser compiler.Parser
+	if err := compiler.ParseSourceCode("x = 1\nscript Foo {\n    y = 2\n}\n", false, &lexer, &parser); err != nil {
+		t.Fatal(err)
+	}
+	bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: parser.Result.Node, SourceMap: &compiler.SourceMap{}}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+	byteCode := bytecodeCompiler.Bytes
+
+	two := bytes.Index(byteCode, []byte{0x17, 0x02, 0x00, 0x00, 0x00})
+	if two == -1 {
+		t.Fatal("Couldn't find the integer 2 in the bytecode")
+	}
+	// the start and the middle of the instruction both map back to it
+	for _, offset := range []int{two, two + 2} {
+		entry, found := bytecodeCompiler.SourceMap.Lookup(offset)
+		if !found || entry.LineNumber != 3 || entry.Column != 9 || entry.Script != "Foo" {
+			t.Errorf("Lookup(%#x) = %v, %t, expected line 3, column 9 in Foo", offset, entry, found)
+		}
+	}
+	if entry, found := bytecodeCompiler.SourceMap.Lookup(len(byteCode)); found {
+		t.Errorf("Expected nothing to be found past the end of the bytecode, got %v", entry)
+	}
+}
+
+func TestReadSourceMap(t *testing.T) {
+	path := compiler.SourceMapPath(filepath.Join(t.TempDir(), "foo.qb"))
+	if _, err := compiler.ReadSourceMap(path); err == nil {
+		t.Error("Expected an error for a QB file without a source map")
+	}
+
+	sourceMap := compiler.SourceMap{SourceFilePath: "foo.ns", Entries: []compiler.SourceMapEntry{{0, 5, 1, 1, ""}}}
+	if err := compiler.WriteSourceMap(path, &sourceMap); err != nil {
+		t.Fatal(err)
+	}
+	readSourceMap, err := compiler.ReadSourceMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readSourceMap.SourceFilePath != "foo.ns" || len(readSourceMap.Entries) != 1 || readSourceMap.Entries[0] != sourceMap.Entries[0] {
+		t.Errorf("Expected %v, got %v", sourceMap, *readSourceMap)
+	}
+}
+
+func TestFindFirstToken(t *testing.T) {
+	testCases := []struct {
+		sourceCode   string
+		expectedData string
+		expectedLine int
+	}{
+		{"x = 1", "x", 1},
+		{"\n\n// hello\nx = 1", "// hello", 3},
+		{"script Foo {\n    y = 2\n}", "Foo", 1},
+		{"Foo a = [1 2]", "Foo", 1},
+	}
+	for _, testCase := range testCases {
+		var lexer compiler.Lexer
+		var parser compiler.Parser
+		if err := compiler.ParseSourceCode(testCase.sourceCode, false, &lexer, &parser); err != nil {
+			t.Fatal(err)
+		}
+		token, found := compiler.FindFirstToken(parser.Result.Node)
+		if !found || token.Data != testCase.expectedData || token.LineNumber != testCase.expectedLine {
+			t.Errorf("Expected '%s' on line %d for %q, got %v, %t", testCase.expectedData, testCase.expectedLine, testCase.sourceCode, token, found)
+		}
+	}
+
+	// nodes made by the compiler have no tokens
+	synthesised := compiler.AstNode{Kind: compiler.AstKind_Integer, Data: compiler.AstData_Integer{}}
+	if token, found := compiler.FindFirstToken(synthesised); found {
+		t.Errorf("Expected no token for a synthesised node, got %v", token)
+	}
+	empty := compiler.AstNode{Kind: compiler.AstKind_Root, Data: compiler.AstData_Root{}}
+	if token, found := compiler.FindFirstToken(empty); found {
+		t.Errorf("Expected no token for an empty file, got %v", token)
+	}
+}
@@ -4,6 +4,7 @@ type Token struct {
 	Kind       TokenKind
 	Data       string
 	LineNumber int
+	Column     int
 }
 
 type TokenKind int
@@ -45,6 +46,19 @@ const (
 	TokenKind_Dot
 	TokenKind_And
 	TokenKind_Or
+	TokenKind_EndIf
+	TokenKind_EndScript
+	TokenKind_EndWhile
+	TokenKind_LessThanEquals
+	TokenKind_GreaterThanEquals
+	TokenKind_Pair
+	TokenKind_Vector
+	TokenKind_LocalReference
+	TokenKind_AllArguments
+	TokenKind_RandomOffset
+	TokenKind_RandomPosition
+	TokenKind_RandomBreak
+	TokenKind_EndOfFile
 	TokenKind_OutOfRange
 )
 
@@ -86,6 +100,19 @@ func (tokenKind TokenKind) String() string {
 		"TokenKind_Dot",
 		"TokenKind_And",
 		"TokenKind_Or",
+		"TokenKind_EndIf",
+		"TokenKind_EndScript",
+		"TokenKind_EndWhile",
+		"TokenKind_LessThanEquals",
+		"TokenKind_GreaterThanEquals",
+		"TokenKind_Pair",
+		"TokenKind_Vector",
+		"TokenKind_LocalReference",
+		"TokenKind_AllArguments",
+		"TokenKind_RandomOffset",
+		"TokenKind_RandomPosition",
+		"TokenKind_RandomBreak",
+		"TokenKind_EndOfFile",
 		"TokenKind_OutOfRange",
 	}[tokenKind]
 }
@@ -0,0 +1,192 @@
+package compiler
+
+// mapChildren returns a copy of a node with each child replaced by child(childNode), and each body of code (the
+// statements of the root, a script, an if-statement branch, a while loop or a random branch) replaced by
+// body(bodyNodes). Children are visited in the order they appear in source code. The original node isn't changed.
+func mapChildren(node AstNode, child func(node AstNode) AstNode, body func(nodes []AstNode) []AstNode) AstNode {
+	children := func(nodes []AstNode) []AstNode {
+		if nodes == nil {
+			return nil
+		}
+		mappedNodes := make([]AstNode, len(nodes))
+		for i, node := range nodes {
+			mappedNodes[i] = child(node)
+		}
+		return mappedNodes
+	}
+
+	switch data := node.Data.(type) {
+	case AstData_Root:
+		data.BodyNodes = body(data.BodyNodes)
+		node.Data = data
+	case AstData_Assignment:
+		data.NameNode = child(data.NameNode)
+		data.ValueNode = child(data.ValueNode)
+		node.Data = data
+	case AstData_Invocation:
+		data.ScriptIdentifierNode = child(data.ScriptIdentifierNode)
+		data.ParameterNodes = children(data.ParameterNodes)
+		node.Data = data
+	case AstData_Script:
+		data.NameNode = child(data.NameNode)
+		data.DefaultParameterNodes = children(data.DefaultParameterNodes)
+		data.BodyNodes = body(data.BodyNodes)
+		node.Data = data
+	case AstData_WhileLoop:
+		data.BodyNodes = body(data.BodyNodes)
+		node.Data = data
+	case AstData_IfStatement:
+		conditions := make([]AstNode, len(data.Conditions))
+		bodies := make([][]AstNode, len(data.Bodies))
+		for i := 0; i < len(data.Conditions) || i < len(data.Bodies); i++ {
+			if i < len(data.Conditions) {
+				conditions[i] = child(data.Conditions[i])
+			}
+			if i < len(data.Bodies) {
+				bodies[i] = body(data.Bodies[i])
+			}
+		}
+		data.Conditions = conditions
+		data.Bodies = bodies
+		node.Data = data
+	case AstData_Random:
+		weights := make([]AstNode, len(data.BranchWeights))
+		branches := make([][]AstNode, len(data.Branches))
+		for i := 0; i < len(data.BranchWeights) || i < len(data.Branches); i++ {
+			if i < len(data.BranchWeights) {
+				weights[i] = child(data.BranchWeights[i])
+			}
+			if i < len(data.Branches) {
+				branches[i] = body(data.Branches[i])
+			}
+		}
+		data.BranchWeights = weights
+		data.Branches = branches
+		node.Data = data
+	case AstData_LocalReference:
+		data.Node = child(data.Node)
+		node.Data = data
+	case AstData_UnaryExpression:
+		data.Node = child(data.Node)
+		node.Data = data
+	case AstData_BinaryExpression:
+		data.LeftNode = child(data.LeftNode)
+		data.RightNode = child(data.RightNode)
+		node.Data = data
+	case AstData_Pair:
+		data.FloatNodeA = child(data.FloatNodeA)
+		data.FloatNodeB = child(data.FloatNodeB)
+		node.Data = data
+	case AstData_Vector:
+		data.FloatNodeA = child(data.FloatNodeA)
+		data.FloatNodeB = child(data.FloatNodeB)
+		data.FloatNodeC = child(data.FloatNodeC)
+		node.Data = data
+	case AstData_Struct:
+		data.ElementNodes = children(data.ElementNodes)
+		node.Data = data
+	case AstData_Array:
+		data.ElementNodes = children(data.ElementNodes)
+		node.Data = data
+	case AstData_ArrayAccess:
+		data.Array = child(data.Array)
+		data.Index = child(data.Index)
+		node.Data = data
+	}
+	return node
+}
+
+// Children lists the child nodes of a node, in the order they appear in source code.
+func Children(node AstNode) []AstNode {
+	var childNodes []AstNode
+	collect := func(node AstNode) AstNode {
+		childNodes = append(childNodes, node)
+		return node
+	}
+	mapChildren(node, collect, func(nodes []AstNode) []AstNode {
+		for _, node := range nodes {
+			collect(node)
+		}
+		return nodes
+	})
+	return childNodes
+}
+
+// A Visitor is called for each node in a tree by Walk. Every callback is optional.
+// parents holds the node's ancestors, closest last, and is only valid until the callback returns.
+type Visitor struct {
+	Enter      func(node AstNode, parents []AstNode) bool        // called before the node's children, which are skipped when it returns false
+	Leave      func(node AstNode, parents []AstNode)             // called after the node's children
+	EnterKinds map[AstKind]func(node AstNode, parents []AstNode) // called before Enter, for nodes of each kind
+	LeaveKinds map[AstKind]func(node AstNode, parents []AstNode) // called before Leave, for nodes of each kind
+}
+
+// Walk visits a node and everything beneath it, depth first and in source code order.
+func Walk(node AstNode, visitor Visitor) {
+	var parents []AstNode
+	var walk func(node AstNode)
+	walk = func(node AstNode) {
+		if f, exists := visitor.EnterKinds[node.Kind]; exists {
+			f(node, parents)
+		}
+		if visitor.Enter != nil && !visitor.Enter(node, parents) {
+			return
+		}
+		parents = append(parents, node)
+		for _, childNode := range Children(node) {
+			walk(childNode)
+		}
+		parents = parents[:len(parents)-1]
+		if f, exists := visitor.LeaveKinds[node.Kind]; exists {
+			f(node, parents)
+		}
+		if visitor.Leave != nil {
+			visitor.Leave(node, parents)
+		}
+	}
+	walk(node)
+}
+
+// A Rewriter replaces nodes in a tree with Rewrite. Every callback is optional.
+type Rewriter struct {
+	Enter      func(node AstNode) AstNode             // called before the node's children; the children of the node it returns are rewritten next
+	Leave      func(node AstNode) AstNode             // called after the node's children have been rewritten
+	EnterKinds map[AstKind]func(node AstNode) AstNode // called before Enter, for nodes of each kind
+	LeaveKinds map[AstKind]func(node AstNode) AstNode // called before Leave, for nodes of each kind
+	Body       func(nodes []AstNode) []AstNode        // called for each body of code after its statements have been rewritten, so statements can be added or removed
+}
+
+// Rewrite returns a copy of a tree with nodes replaced by the rewriter. The original tree isn't changed.
+func Rewrite(node AstNode, rewriter Rewriter) AstNode {
+	var rewrite func(node AstNode) AstNode
+	rewriteBody := func(nodes []AstNode) []AstNode {
+		if nodes == nil {
+			return nil
+		}
+		rewrittenNodes := make([]AstNode, len(nodes))
+		for i, node := range nodes {
+			rewrittenNodes[i] = rewrite(node)
+		}
+		if rewriter.Body != nil {
+			return rewriter.Body(rewrittenNodes)
+		}
+		return rewrittenNodes
+	}
+	rewrite = func(node AstNode) AstNode {
+		if f, exists := rewriter.EnterKinds[node.Kind]; exists {
+			node = f(node)
+		}
+		if rewriter.Enter != nil {
+			node = rewriter.Enter(node)
+		}
+		node = mapChildren(node, rewrite, rewriteBody)
+		if f, exists := rewriter.LeaveKinds[node.Kind]; exists {
+			node = f(node)
+		}
+		if rewriter.Leave != nil {
+			node = rewriter.Leave(node)
+		}
+		return node
+	}
+	return rewrite(node)
+}
@@ -0,0 +1,193 @@
+package compiler_test
+
+import (
+	"bytes"
+	"github.com/byxor/NeverScript/compiler"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	rootNode := parse(`script Foo {
+    if (<x> > 1) {
+        printf "big"
+    } else {
+        printf "small" x=<x>
+    }
+}
+`, false).Result.Node
+
+	var entered, left []string
+	var printfParents []string
+	compiler.Walk(rootNode, compiler.Visitor{
+		Enter: func(node compiler.AstNode, parents []compiler.AstNode) bool {
+			entered = append(entered, strings.TrimPrefix(node.Kind.String(), "AstKind_"))
+			return node.Kind != compiler.AstKind_GreaterThanExpression // skip the condition's children
+		},
+		Leave: func(node compiler.AstNode, parents []compiler.AstNode) {
+			left = append(left, strings.TrimPrefix(node.Kind.String(), "AstKind_"))
+		},
+		EnterKinds: map[compiler.AstKind]func(node compiler.AstNode, parents []compiler.AstNode){
+			compiler.AstKind_Invocation: func(node compiler.AstNode, parents []compiler.AstNode) {
+				var kinds []string
+				for _, parent := range parents {
+					kinds = append(kinds, strings.TrimPrefix(parent.Kind.String(), "AstKind_"))
+				}
+				printfParents = append(printfParents, strings.Join(kinds, " > "))
+			},
+		},
+	})
+
+	expected := "Root NewLine Script Checksum NewLine IfStatement GreaterThanExpression NewLine Invocation Checksum String NewLine " +
+		"NewLine Invocation Checksum String Assignment Checksum LocalReference Checksum NewLine NewLine NewLine"
+	if strings.Join(entered, " ") != expected {
+		t.Errorf("Expected nodes to be entered in the order\n%s\ngot\n%s", expected, strings.Join(entered, " "))
+	}
+	if len(left) != len(entered)-1 || left[len(left)-1] != "Root" {
+		t.Errorf("Expected every entered node but the skipped one to be left, with the root last, got %v", left)
+	}
+	if parents := "Root > Script > IfStatement"; len(printfParents) != 2 || printfParents[0] != parents || printfParents[1] != parents {
+		t.Errorf("Expected both invocations to be inside '%s', got %v", parents, printfParents)
+	}
+}
+
+// Rewriting without changing anything should give an identical tree (which compiles into the same bytes).
+func TestRewriteWithoutChanges(t *testing.T) {
+	for _, input := range testInputs(t) {
+		var lexer compiler.Lexer
+		var parser compiler.Parser
+		if err := compiler.ParseFile(input, &lexer, &parser); err != nil {
+			t.Fatal(err)
+		}
+		rewritten := compiler.Rewrite(parser.Result.Node, compiler.Rewriter{})
+		bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: rewritten}
+		compiler.GenerateBytecode(&bytecodeCompiler)
+		if !bytes.Equal(compile(t, input), bytecodeCompiler.Bytes) {
+			t.Errorf("%s: Rewriting without changes gave different bytes", filepath.Base(input))
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	rootNode := parse(`script Foo {
+    old_name x=1
+    print "remove me"
+    if (<x> > 1) {
+        print "and me"
+        old_name
+    }
+}
+`, false).Result.Node
+	originalBytes := generateBytecodeForNode(rootNode)
+
+	isPrint := func(node compiler.AstNode) bool {
+		return node.Kind == compiler.AstKind_Invocation &&
+			node.Data.(compiler.AstData_Invocation).ScriptIdentifierNode.Data.(compiler.AstData_Checksum).ChecksumToken.Data == "print"
+	}
+	rewritten := compiler.Rewrite(rootNode, compiler.Rewriter{
+		LeaveKinds: map[compiler.AstKind]func(node compiler.AstNode) compiler.AstNode{
+			compiler.AstKind_Checksum: func(node compiler.AstNode) compiler.AstNode {
+				data := node.Data.(compiler.AstData_Checksum)
+				if data.ChecksumToken.Data == "old_name" {
+					data.ChecksumToken.Data = "new_name"
+				}
+				node.Data = data
+				return node
+			},
+		},
+		Body: func(nodes []compiler.AstNode) []compiler.AstNode {
+			var kept []compiler.AstNode
+			for i, node := range nodes {
+				if isPrint(node) {
+					continue
+				}
+				if node.Kind == compiler.AstKind_NewLine && i > 0 && isPrint(nodes[i-1]) {
+					continue
+				}
+				kept = append(kept, node)
+			}
+			return kept
+		},
+	})
+
+	expected := parse(`script Foo {
+    new_name x=1
+    if (<x> > 1) {
+        new_name
+    }
+}
+`, false).Result.Node
+	if !bytes.Equal(generateBytecodeForNode(expected), generateBytecodeForNode(rewritten)) {
+		t.Error("The rewritten tree didn't compile into the expected bytes")
+	}
+	if !bytes.Equal(originalBytes, generateBytecodeForNode(rootNode)) {
+		t.Error("Rewriting changed the original tree")
+	}
+}
+
+// Kind callbacks run just before Enter and just before Leave, in both Walk and Rewrite.
+func TestKindCallbackOrder(t *testing.T) {
+	rootNode := parse("x = 1\n", false).Result.Node
+	var calls []string
+	record := func(call string, node compiler.AstNode) {
+		calls = append(calls, call+" "+strings.TrimPrefix(node.Kind.String(), "AstKind_"))
+	}
+
+	compiler.Walk(rootNode, compiler.Visitor{
+		Enter: func(node compiler.AstNode, parents []compiler.AstNode) bool {
+			record("Enter", node)
+			return true
+		},
+		Leave: func(node compiler.AstNode, parents []compiler.AstNode) {
+			record("Leave", node)
+		},
+		EnterKinds: map[compiler.AstKind]func(node compiler.AstNode, parents []compiler.AstNode){
+			compiler.AstKind_Assignment: func(node compiler.AstNode, parents []compiler.AstNode) { record("EnterKinds", node) },
+		},
+		LeaveKinds: map[compiler.AstKind]func(node compiler.AstNode, parents []compiler.AstNode){
+			compiler.AstKind_Assignment: func(node compiler.AstNode, parents []compiler.AstNode) { record("LeaveKinds", node) },
+		},
+	})
+	walkCalls := strings.Join(calls, ", ")
+
+	calls = nil
+	compiler.Rewrite(rootNode, compiler.Rewriter{
+		Enter: func(node compiler.AstNode) compiler.AstNode {
+			record("Enter", node)
+			return node
+		},
+		Leave: func(node compiler.AstNode) compiler.AstNode {
+			record("Leave", node)
+			return node
+		},
+		EnterKinds: map[compiler.AstKind]func(node compiler.AstNode) compiler.AstNode{
+			compiler.AstKind_Assignment: func(node compiler.AstNode) compiler.AstNode {
+				record("EnterKinds", node)
+				return node
+			},
+		},
+		LeaveKinds: map[compiler.AstKind]func(node compiler.AstNode) compiler.AstNode{
+			compiler.AstKind_Assignment: func(node compiler.AstNode) compiler.AstNode {
+				record("LeaveKinds", node)
+				return node
+			},
+		},
+	})
+	rewriteCalls := strings.Join(calls, ", ")
+
+	expected := "Enter Root, Enter NewLine, Leave NewLine, EnterKinds Assignment, Enter Assignment, Enter Checksum, Leave Checksum, " +
+		"Enter Integer, Leave Integer, LeaveKinds Assignment, Leave Assignment, Enter NewLine, Leave NewLine, Leave Root"
+	if walkCalls != expected {
+		t.Errorf("Expected Walk to call\n%s\ngot\n%s", expected, walkCalls)
+	}
+	if rewriteCalls != expected {
+		t.Errorf("Expected Rewrite to call\n%s\ngot\n%s", expected, rewriteCalls)
+	}
+}
+
+func generateBytecodeForNode(rootNode compiler.AstNode) []byte {
+	bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: rootNode}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+	return bytecodeCompiler.Bytes
+}
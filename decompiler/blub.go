@@ -0,0 +1,285 @@
+package decompiler
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"math"
+	"strings"
+)
+
+// DecompileAstNodeAsBlub renders the AST in the "blub" syntax used by roq, matching roq's own decompiler output
+// (including its names for some opcodes, e.g. 'continue' for break and '%GLOBAL%' for local references).
+func DecompileAstNodeAsBlub(node compiler.AstNode, nameTable map[uint32]string) (string, error) {
+	var DecompileNode func(node compiler.AstNode, depth int) (string, error)
+	var DecompileNodes func(nodes []compiler.AstNode, depth int, isBlock bool) (string, error)
+
+	nextLabel := 0
+	tabs := func(depth int) string {
+		return strings.Repeat("\t", depth)
+	}
+
+	// In a block, the new-line before the closing keyword is indented at the same depth as the opening keyword.
+	DecompileNodes = func(nodes []compiler.AstNode, depth int, isBlock bool) (string, error) {
+		var code strings.Builder
+		for i, node := range nodes {
+			if node.Kind == compiler.AstKind_NewLine {
+				lineDepth := depth
+				if isBlock && i == len(nodes)-1 {
+					lineDepth--
+				}
+				code.WriteString("\n" + tabs(lineDepth) + ":i ")
+				continue
+			}
+			nodeCode, err := DecompileNode(node, depth)
+			if err != nil {
+				return "", err
+			}
+			code.WriteString(nodeCode)
+		}
+		return code.String(), nil
+	}
+
+	decompileBinaryExpression := func(node compiler.AstNode, operator string, depth int) (string, error) {
+		data := node.Data.(compiler.AstData_BinaryExpression)
+		leftCode, err := DecompileNode(data.LeftNode, depth)
+		if err != nil {
+			return "", err
+		}
+		rightCode, err := DecompileNode(data.RightNode, depth)
+		if err != nil {
+			return "", err
+		}
+		return leftCode + operator + rightCode, nil
+	}
+
+	decompileFloat := func(floatNode compiler.AstNode) string {
+		bits := binary.LittleEndian.Uint32(floatNode.Data.(compiler.AstData_Float).FloatBytes)
+		return fmt.Sprintf("%f", math.Float32frombits(bits))
+	}
+
+	DecompileNode = func(node compiler.AstNode, depth int) (string, error) {
+		switch node.Kind {
+		case compiler.AstKind_Root:
+			data := node.Data.(compiler.AstData_Root)
+			var bodyNodes []compiler.AstNode
+			for _, bodyNode := range data.BodyNodes {
+				if bodyNode.Kind != compiler.AstKind_NameTableEntry {
+					bodyNodes = append(bodyNodes, bodyNode)
+				}
+			}
+			code, err := DecompileNodes(bodyNodes, depth, false)
+			return strings.TrimPrefix(code, "\n"), err
+		case compiler.AstKind_EndOfFile:
+			return ":end", nil
+		case compiler.AstKind_Comment:
+			return node.Data.(compiler.AstData_Comment).CommentToken.Data, nil
+		case compiler.AstKind_Comma:
+			return ";", nil
+		case compiler.AstKind_Break:
+			return "continue\n" + tabs(depth), nil
+		case compiler.AstKind_AllArguments:
+			return "isNull", nil
+		case compiler.AstKind_Checksum:
+			data := node.Data.(compiler.AstData_Checksum)
+			if data.ChecksumToken.Data != "" {
+				return "$" + data.ChecksumToken.Data + "$", nil
+			}
+			checksum := binary.LittleEndian.Uint32(data.ChecksumBytes)
+			if name, ok := nameTable[checksum]; ok {
+				return "$" + name + "$", nil
+			}
+			return fmt.Sprintf("#\"0x%08x\"", checksum), nil
+		case compiler.AstKind_LocalReference:
+			code, err := DecompileNode(node.Data.(compiler.AstData_LocalReference).Node, depth)
+			return "%GLOBAL%" + code, err
+		case compiler.AstKind_Integer:
+			value := binary.LittleEndian.Uint32(node.Data.(compiler.AstData_Integer).IntegerBytes)
+			return fmt.Sprintf("%%i(%d,%08x)", value, value), nil
+		case compiler.AstKind_Float:
+			return "%f(" + decompileFloat(node) + ")", nil
+		case compiler.AstKind_Pair:
+			data := node.Data.(compiler.AstData_Pair)
+			return fmt.Sprintf("%%vec2(%s,%s)", decompileFloat(data.FloatNodeA), decompileFloat(data.FloatNodeB)), nil
+		case compiler.AstKind_Vector:
+			data := node.Data.(compiler.AstData_Vector)
+			return fmt.Sprintf("%%vec3(%s,%s,%s)", decompileFloat(data.FloatNodeA), decompileFloat(data.FloatNodeB), decompileFloat(data.FloatNodeC)), nil
+		case compiler.AstKind_String:
+			stringBytes := node.Data.(compiler.AstData_String).StringBytes
+			if len(stringBytes) > 0 && stringBytes[len(stringBytes)-1] == 0 {
+				stringBytes = stringBytes[:len(stringBytes)-1]
+			}
+			return fmt.Sprintf("%%s(%d,\"%s\")", len(stringBytes), stringBytes), nil
+		case compiler.AstKind_Struct:
+			code, err := DecompileNodes(node.Data.(compiler.AstData_Struct).ElementNodes, depth+1, true)
+			return ":s{" + code + ":s}", err
+		case compiler.AstKind_Array:
+			code, err := DecompileNodes(node.Data.(compiler.AstData_Array).ElementNodes, depth+1, true)
+			return ":a{" + code + ":a}", err
+		case compiler.AstKind_ArrayAccess:
+			data := node.Data.(compiler.AstData_ArrayAccess)
+			arrayCode, err := DecompileNode(data.Array, depth)
+			if err != nil {
+				return "", err
+			}
+			indexCode, err := DecompileNode(data.Index, depth)
+			return arrayCode + ":a{" + indexCode + ":a}", err
+		case compiler.AstKind_Assignment:
+			data := node.Data.(compiler.AstData_Assignment)
+			nameCode, err := DecompileNode(data.NameNode, depth)
+			if err != nil {
+				return "", err
+			}
+			valueCode, err := DecompileNode(data.ValueNode, depth)
+			return nameCode + " = " + valueCode, err
+		case compiler.AstKind_Invocation:
+			data := node.Data.(compiler.AstData_Invocation)
+			nameCode, err := DecompileNode(data.ScriptIdentifierNode, depth)
+			if err != nil {
+				return "", err
+			}
+			parametersCode, err := DecompileNodes(data.ParameterNodes, depth, false)
+			return nameCode + parametersCode, err
+		case compiler.AstKind_Return:
+			data := node.Data.(compiler.AstData_UnaryExpression)
+			var parameterNodes []compiler.AstNode
+			if data.Node.Kind == compiler.AstKind_Invocation {
+				parameterNodes = data.Node.Data.(compiler.AstData_Invocation).ParameterNodes
+			}
+			parametersCode, err := DecompileNodes(parameterNodes, depth, false)
+			return "return\n" + tabs(depth) + parametersCode, err
+		case compiler.AstKind_UnaryExpression:
+			code, err := DecompileNode(node.Data.(compiler.AstData_UnaryExpression).Node, depth)
+			return " (" + code + ") ", err
+		case compiler.AstKind_LogicalNot:
+			code, err := DecompileNode(node.Data.(compiler.AstData_UnaryExpression).Node, depth)
+			return "NOT " + code, err
+		case compiler.AstKind_LogicalAnd:
+			return decompileBinaryExpression(node, " AND ", depth)
+		case compiler.AstKind_LogicalOr:
+			return decompileBinaryExpression(node, " OR ", depth)
+		case compiler.AstKind_AdditionExpression:
+			return decompileBinaryExpression(node, " + ", depth)
+		case compiler.AstKind_SubtractionExpression:
+			return decompileBinaryExpression(node, " - ", depth)
+		case compiler.AstKind_MultiplicationExpression:
+			return decompileBinaryExpression(node, " * ", depth)
+		case compiler.AstKind_DivisionExpression:
+			return decompileBinaryExpression(node, " / ", depth)
+		case compiler.AstKind_EqualsExpression:
+			return decompileBinaryExpression(node, " = ", depth)
+		case compiler.AstKind_LessThanExpression:
+			return decompileBinaryExpression(node, " < ", depth)
+		case compiler.AstKind_LessThanEqualsExpression:
+			return decompileBinaryExpression(node, " <= ", depth)
+		case compiler.AstKind_GreaterThanExpression:
+			return decompileBinaryExpression(node, " > ", depth)
+		case compiler.AstKind_GreaterThanEqualsExpression:
+			return decompileBinaryExpression(node, " >= ", depth)
+		case compiler.AstKind_DotExpression: // roq has the names of 0x08 and 0x42 swapped
+			return decompileBinaryExpression(node, ":", depth)
+		case compiler.AstKind_ColonExpression:
+			return decompileBinaryExpression(node, ".", depth)
+		case compiler.AstKind_Script:
+			data := node.Data.(compiler.AstData_Script)
+			nameCode, err := DecompileNode(data.NameNode, depth)
+			if err != nil {
+				return "", err
+			}
+			parametersCode, err := DecompileNodes(data.DefaultParameterNodes, depth, false)
+			if err != nil {
+				return "", err
+			}
+			bodyCode, err := DecompileNodes(data.BodyNodes, depth+1, true)
+			return "function " + nameCode + parametersCode + bodyCode + "endfunction", err
+		case compiler.AstKind_IfStatement:
+			data := node.Data.(compiler.AstData_IfStatement)
+			var code strings.Builder
+			code.WriteString("if ")
+			conditionCode, err := DecompileNode(data.Conditions[0], depth)
+			if err != nil {
+				return "", err
+			}
+			code.WriteString(conditionCode)
+			bodyCode, err := DecompileNodes(data.Bodies[0], depth+1, true)
+			if err != nil {
+				return "", err
+			}
+			code.WriteString(bodyCode)
+
+			// blub has no 'else if', so the remaining conditions go in a nested if statement
+			var elseNodes []compiler.AstNode
+			if len(data.Conditions) > 1 {
+				newLineNode := compiler.AstNode{Kind: compiler.AstKind_NewLine, Data: compiler.AstData_Empty{}}
+				elseNodes = []compiler.AstNode{
+					newLineNode,
+					{
+						Kind: compiler.AstKind_IfStatement,
+						Data: compiler.AstData_IfStatement{
+							Conditions: data.Conditions[1:],
+							Bodies:     data.Bodies[1:],
+						},
+					},
+					newLineNode,
+				}
+			} else if len(data.Bodies) > 1 {
+				elseNodes = data.Bodies[1]
+			}
+			if len(data.Bodies) > 1 {
+				elseCode, err := DecompileNodes(elseNodes, depth+1, true)
+				if err != nil {
+					return "", err
+				}
+				code.WriteString("else " + elseCode)
+			}
+			code.WriteString("endif ")
+			return code.String(), nil
+		case compiler.AstKind_WhileLoop:
+			data := node.Data.(compiler.AstData_WhileLoop)
+			bodyCode, err := DecompileNodes(data.BodyNodes, depth+1, true)
+			if err != nil {
+				return "", err
+			}
+			if len(data.BodyNodes) == 0 || data.BodyNodes[0].Kind != compiler.AstKind_NewLine {
+				bodyCode = "\n" + tabs(depth+1) + bodyCode
+			}
+			return "while" + bodyCode + "loop_to ", nil
+		case compiler.AstKind_Random:
+			data := node.Data.(compiler.AstData_Random)
+			numBranches := len(data.Branches)
+			var weights []string
+			for _, weightNode := range data.BranchWeights {
+				weightBytes := weightNode.Data.(compiler.AstData_Integer).IntegerBytes
+				weights = append(weights, fmt.Sprintf("%02x %02x", weightBytes[0], weightBytes[1]))
+			}
+			firstLabel := nextLabel
+			endLabel := nextLabel + numBranches
+			nextLabel += numBranches + 1
+
+			var code strings.Builder
+			code.WriteString(fmt.Sprintf("select(2f,%d, %s) ", numBranches, strings.Join(weights, " ")))
+			for i := 0; i < numBranches; i++ {
+				code.WriteString(fmt.Sprintf(":OFFSET(%d)", firstLabel+i))
+			}
+			for i, branch := range data.Branches {
+				if i > 0 {
+					code.WriteString(fmt.Sprintf("\n%s:BREAKTO(%d)", tabs(depth), endLabel))
+				}
+				code.WriteString(fmt.Sprintf("\n%s :POS(%d) ", tabs(depth+1), firstLabel+i))
+				branchCode, err := DecompileNodes(branch, depth+1, false)
+				if err != nil {
+					return "", err
+				}
+				code.WriteString(branchCode)
+			}
+			code.WriteString(fmt.Sprintf(" :POS(%d) ", endLabel))
+			return code.String(), nil
+		case compiler.AstKind_NewLine:
+			return "\n" + tabs(depth) + ":i ", nil
+		}
+		return "", errors.New(WrapLine("Don't know how to produce blub code for AST node", fmt.Sprintf("%+v", node)))
+	}
+
+	return DecompileNode(node, 0)
+}
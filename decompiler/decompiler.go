@@ -1,39 +1,142 @@
 package decompiler
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"github.com/byxor/NeverScript/compiler"
-	"log"
+	"math"
+	"sort"
+)
+
+type Syntax int
+
+const (
+	Syntax_NeverScript Syntax = iota
+	Syntax_Blub               // roq's syntax
 )
 
 type Arguments struct {
 	ByteCode   []byte
+	Syntax     Syntax
+	Dictionary map[uint32]string // optional, names for checksums that aren't in the file's name table
 	RootNode   compiler.AstNode
 	SourceCode string
 	NameTable  map[uint32]string
+	Problems   []Problem
+}
+
+// Problem is a region of bytecode that couldn't be decompiled, which is written into the source code as a comment
+// containing the raw bytes, or something that's decompiled but won't compile back into the same bytes.
+type Problem struct {
+	Index   int
+	Size    int
+	Message string
 }
 
-func Decompile(arguments *Arguments) {
+func (problem Problem) String() string {
+	return fmt.Sprintf("[0x%02X] %s", problem.Index, problem.Message)
+}
+
+// Decompile produces source code even when parts of the bytecode aren't recognised; those parts are listed in arguments.Problems.
+func Decompile(arguments *Arguments) error {
+	arguments.Problems = nil
 	err := ParseByteCode(arguments)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	{ // scrape name table entries (these take priority over the dictionary)
+		arguments.NameTable = make(map[uint32]string, len(arguments.Dictionary))
+		for checksum, name := range arguments.Dictionary {
+			arguments.NameTable[checksum] = name
+		}
+		addNameTableEntries(arguments.NameTable, arguments.RootNode)
 	}
 
-	{ // scrape name table entries
-		arguments.NameTable = make(map[uint32]string, 0)
-		rootData := arguments.RootNode.Data.(compiler.AstData_Root)
-		for _, bodyNode := range rootData.BodyNodes {
-			if bodyNode.Kind == compiler.AstKind_NameTableEntry {
-				data := bodyNode.Data.(compiler.AstData_NameTableEntry)
-				checksum := binary.LittleEndian.Uint32(data.ChecksumBytes)
-				arguments.NameTable[checksum] = data.Name
-			}
+	arguments.Problems = append(arguments.Problems, findUnwritableValues(arguments.RootNode, arguments.Syntax)...)
+	sort.SliceStable(arguments.Problems, func(i, j int) bool {
+		return arguments.Problems[i].Index < arguments.Problems[j].Index
+	})
+
+	if arguments.Syntax == Syntax_Blub {
+		// roq shows the bytecode as-is, so compiler idioms are left alone
+		blubCode, err := DecompileAstNodeAsBlub(arguments.RootNode, arguments.NameTable)
+		if err != nil {
+			return err
 		}
+		arguments.SourceCode = blubCode
+		return nil
 	}
 
+	arguments.RootNode = RecogniseCompilerIdioms(arguments.RootNode, arguments.NameTable)
+
 	nsCode, err := DecompileAstNode(arguments.RootNode, 0, arguments.NameTable)
 	if err != nil {
-		log.Fatalf("\n%s", err)
+		return err
 	}
 	arguments.SourceCode = nsCode
+	return nil
+}
+
+// addNameTableEntries adds the names from the name table entries at the end of a QB file.
+func addNameTableEntries(nameTable map[uint32]string, rootNode compiler.AstNode) {
+	for _, bodyNode := range rootNode.Data.(compiler.AstData_Root).BodyNodes {
+		if bodyNode.Kind == compiler.AstKind_NameTableEntry {
+			data := bodyNode.Data.(compiler.AstData_NameTableEntry)
+			nameTable[binary.LittleEndian.Uint32(data.ChecksumBytes)] = data.Name
+		}
+	}
+}
+
+// findUnwritableValues finds the values that can't be written in the chosen syntax: local strings and switches in
+// either syntax, and NaN and infinite floats and strings containing '"' in NeverScript. They're still decompiled, but
+// compile into different bytes.
+func findUnwritableValues(rootNode compiler.AstNode, syntax Syntax) []Problem {
+	var problems []Problem
+	compiler.Walk(rootNode, compiler.Visitor{
+		EnterKinds: map[compiler.AstKind]func(node compiler.AstNode, parents []compiler.AstNode){
+			compiler.AstKind_Float: func(node compiler.AstNode, parents []compiler.AstNode) {
+				data := node.Data.(compiler.AstData_Float)
+				if f := float64(data.Value()); syntax == Syntax_NeverScript && len(data.FloatBytes) == 4 && (math.IsNaN(f) || math.IsInf(f, 0)) {
+					size := 5 // 0x1A and the float, unless it's part of a pair or vector
+					if len(parents) > 0 && (parents[len(parents)-1].Kind == compiler.AstKind_Pair || parents[len(parents)-1].Kind == compiler.AstKind_Vector) {
+						size = 4
+					}
+					problems = append(problems, Problem{
+						Index:   node.Offset,
+						Size:    size,
+						Message: fmt.Sprintf("NeverScript can't write the float %g (bits 0x%08X)", f, math.Float32bits(data.Value())),
+					})
+				}
+			},
+			compiler.AstKind_String: func(node compiler.AstNode, parents []compiler.AstNode) {
+				data := node.Data.(compiler.AstData_String)
+				if data.IsLocalString {
+					problems = append(problems, Problem{
+						Index:   node.Offset,
+						Size:    5 + len(data.StringBytes),
+						Message: "Local strings (0x1C) are written as ordinary strings",
+					})
+				}
+				if syntax == Syntax_NeverScript && bytes.ContainsRune(data.StringBytes, '"') {
+					problems = append(problems, Problem{
+						Index:   node.Offset,
+						Size:    5 + len(data.StringBytes),
+						Message: "NeverScript can't write strings containing '\"'",
+					})
+				}
+			},
+			compiler.AstKind_IfStatement: func(node compiler.AstNode, parents []compiler.AstNode) {
+				if node.Data.(compiler.AstData_IfStatement).IsSwitch {
+					problems = append(problems, Problem{
+						Index:   node.Offset,
+						Size:    1,
+						Message: "Switches (0x3C) are written as if/else chains",
+					})
+				}
+			},
+		},
+	})
+	return problems
 }
@@ -0,0 +1,156 @@
+package decompiler_test
+
+import (
+	"bytes"
+	"github.com/byxor/NeverScript/assembler"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"github.com/byxor/NeverScript/qb"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnwritableValues(t *testing.T) {
+	byteCode := qb.File().
+		Global("not_a_number", qb.Float(math.Float32frombits(0x7FC00000))).
+		Global("position", qb.Pair(1, float32(math.Inf(1)))).
+		Global("quoted", qb.String(`say "hi"`)).
+		Global("fine", qb.Vector(1, 2, 3)).
+		Bytes()
+
+	arguments := decompiler.Arguments{ByteCode: byteCode}
+	if err := decompiler.Decompile(&arguments); err != nil {
+		t.Fatal(err)
+	}
+	expectedMessages := []string{
+		"NeverScript can't write the float NaN",
+		"NeverScript can't write the float +Inf",
+		"NeverScript can't write strings containing '\"'",
+	}
+	if len(arguments.Problems) != len(expectedMessages) {
+		t.Fatalf("Expected %d problems, got %v", len(expectedMessages), arguments.Problems)
+	}
+	for i, problem := range arguments.Problems {
+		if !strings.HasPrefix(problem.Message, expectedMessages[i]) {
+			t.Errorf("Expected problem %d to start with '%s', got '%s'", i, expectedMessages[i], problem.Message)
+		}
+		if i > 0 && problem.Index <= arguments.Problems[i-1].Index {
+			t.Errorf("Expected the problems in the order of their offsets, got %v", arguments.Problems)
+		}
+	}
+
+	// roq's syntax writes floats and strings in a way that keeps them intact
+	arguments = decompiler.Arguments{ByteCode: byteCode, Syntax: decompiler.Syntax_Blub}
+	if err := decompiler.Decompile(&arguments); err != nil {
+		t.Fatal(err)
+	}
+	if len(arguments.Problems) != 0 {
+		t.Errorf("Expected no problems when decompiling to blub, got %v", arguments.Problems)
+	}
+}
+
+// Shift operators, local strings and switches can't be written in either syntax, so each one is reported.
+func TestUnwritableOpcodes(t *testing.T) {
+	byteCode, err := assembler.Assemble(`
+		newline
+		script_begin
+		checksum "Foo"
+		newline
+		checksum "x"
+		equals
+		open_parenthesis
+		checksum "a"
+		shift_left
+		checksum "b"
+		close_parenthesis
+		newline
+		checksum "y"
+		equals
+		local_string "hi"
+		newline
+		switch
+		checksum "a"
+		newline
+		case
+		int 1
+		newline
+		checksum "x"
+		equals
+		int 2
+		newline
+		short_jump @End
+		default
+		newline
+		checksum "x"
+		equals
+		int 3
+		newline
+	End:
+		end_switch
+		newline
+		script_end
+		newline
+		end_of_file
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"[0x08] Couldn't decompile 19 byte(s) starting with 0x16 (shift operators can't be decompiled)",
+		"[0x22] Local strings (0x1C) are written as ordinary strings",
+		"[0x2B] Switches (0x3C) are written as if/else chains",
+	}
+	for _, syntax := range []decompiler.Syntax{decompiler.Syntax_NeverScript, decompiler.Syntax_Blub} {
+		arguments := decompiler.Arguments{ByteCode: byteCode, Syntax: syntax}
+		if err := decompiler.Decompile(&arguments); err != nil {
+			t.Fatal(err)
+		}
+		var problems []string
+		for _, problem := range arguments.Problems {
+			problems = append(problems, problem.String())
+		}
+		if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("Expected problems:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(problems, "\n"))
+		}
+	}
+}
+
+// Without a name table every name is written as #XXXXXXXX, which should still compile back into the same code.
+func TestRoundTripWithoutNameTable(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("..", "compiler", "testdata", "*.ns"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("No test inputs found (%v)", err)
+	}
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			sourceCode, err := ioutil.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			byteCode := withoutNameTable(t, compileSourceCode(t, string(sourceCode)))
+			for _, syntax := range []struct {
+				name   string
+				syntax decompiler.Syntax
+			}{
+				{"NeverScript", decompiler.Syntax_NeverScript},
+				{"blub", decompiler.Syntax_Blub},
+			} {
+				arguments := decompiler.Arguments{ByteCode: byteCode, Syntax: syntax.syntax}
+				if err := decompiler.Decompile(&arguments); err != nil {
+					t.Fatal(err)
+				}
+				recompiled, err := compiler.CompileSourceCode(arguments.SourceCode, syntax.syntax == decompiler.Syntax_Blub)
+				if err != nil {
+					t.Fatalf("The decompiled %s doesn't compile: %s", syntax.name, err)
+				}
+				// the compiler names its own checksums (like loop bypassers), so only the code is compared
+				if recompiled = withoutNameTable(t, recompiled); !bytes.Equal(byteCode, recompiled) {
+					t.Errorf("Decompiling to %s and compiling again gave different bytes (%d instead of %d)", syntax.name, len(recompiled), len(byteCode))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package decompiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/pmezard/go-difflib/difflib"
+	"strings"
+)
+
+type ItemKind int
+
+const (
+	ItemKind_Script ItemKind = iota
+	ItemKind_Global
+	ItemKind_Other // anything else at the root of the file, e.g. bytes that couldn't be decompiled
+)
+
+func (kind ItemKind) String() string {
+	return [...]string{
+		"script",
+		"global",
+		"other",
+	}[kind]
+}
+
+// An Item is a script, global or other piece of root-level code, decompiled on its own.
+type Item struct {
+	Kind       ItemKind
+	Checksum   uint32
+	Name       string // the name from the shared name table, or #XXXXXXXX
+	Occurrence int    // counts from 0 when an item is defined more than once
+	SourceCode string
+
+	codeWithoutLayout string // compared instead of SourceCode, so structs and arrays can be split over lines differently
+}
+
+func (item Item) String() string {
+	if item.Kind == ItemKind_Other {
+		return fmt.Sprintf("root-level code #%d", item.Occurrence+1)
+	}
+	if item.Occurrence > 0 {
+		return fmt.Sprintf("%s %s (#%d)", item.Kind, item.Name, item.Occurrence+1)
+	}
+	return fmt.Sprintf("%s %s", item.Kind, item.Name)
+}
+
+type ChangeKind int
+
+const (
+	ChangeKind_Added ChangeKind = iota
+	ChangeKind_Removed
+	ChangeKind_Modified
+)
+
+func (kind ChangeKind) String() string {
+	return [...]string{
+		"added",
+		"removed",
+		"modified",
+	}[kind]
+}
+
+type Change struct {
+	Kind ChangeKind
+	Item Item   // the item in the new file (or the old file, when it was removed)
+	Diff string // a unified diff of the item's source code, when it was modified
+}
+
+type DiffArguments struct {
+	OldByteCode []byte
+	NewByteCode []byte
+	OldName     string // used in the headers of the diffs
+	NewName     string
+	Dictionary  map[uint32]string // optional, names for checksums that aren't in either file's name table
+
+	Changes     []Change
+	OldItems    []Item
+	NewItems    []Item
+	OldProblems []Problem
+	NewProblems []Problem
+}
+
+// DiffByteCode decompiles two QB files and compares them script by script and global by global.
+// Both files are decompiled with the same names (from both name tables and the dictionary, with the old file's names
+// taking priority), so a name that's only in one file's name table doesn't show up as a change.
+// Items are matched by their checksums, and aren't modified when only the layout of their structs and arrays changed.
+// Changes are listed in the old file's order, followed by the added items.
+func DiffByteCode(arguments *DiffArguments) error {
+	oldArguments := Arguments{ByteCode: arguments.OldByteCode}
+	if err := ParseByteCode(&oldArguments); err != nil {
+		return fmt.Errorf("%s: %s", arguments.OldName, err)
+	}
+	newArguments := Arguments{ByteCode: arguments.NewByteCode}
+	if err := ParseByteCode(&newArguments); err != nil {
+		return fmt.Errorf("%s: %s", arguments.NewName, err)
+	}
+	arguments.OldProblems = oldArguments.Problems
+	arguments.NewProblems = newArguments.Problems
+
+	nameTable := make(map[uint32]string)
+	for checksum, name := range arguments.Dictionary {
+		nameTable[checksum] = name
+	}
+	for _, rootNode := range []compiler.AstNode{newArguments.RootNode, oldArguments.RootNode} {
+		addNameTableEntries(nameTable, rootNode)
+	}
+
+	var err error
+	if arguments.OldItems, err = SplitIntoItems(oldArguments.RootNode, nameTable); err != nil {
+		return fmt.Errorf("%s: %s", arguments.OldName, err)
+	}
+	if arguments.NewItems, err = SplitIntoItems(newArguments.RootNode, nameTable); err != nil {
+		return fmt.Errorf("%s: %s", arguments.NewName, err)
+	}
+
+	type key struct {
+		Kind       ItemKind
+		Checksum   uint32
+		Occurrence int
+	}
+	keyOf := func(item Item) key {
+		return key{item.Kind, item.Checksum, item.Occurrence}
+	}
+	newItems := make(map[key]Item)
+	for _, item := range arguments.NewItems {
+		newItems[keyOf(item)] = item
+	}
+	isInOldFile := make(map[key]bool)
+
+	arguments.Changes = nil
+	for _, oldItem := range arguments.OldItems {
+		isInOldFile[keyOf(oldItem)] = true
+		newItem, isInNewFile := newItems[keyOf(oldItem)]
+		if !isInNewFile {
+			arguments.Changes = append(arguments.Changes, Change{Kind: ChangeKind_Removed, Item: oldItem})
+			continue
+		}
+		if newItem.codeWithoutLayout == oldItem.codeWithoutLayout {
+			continue
+		}
+		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(oldItem.SourceCode),
+			B:        difflib.SplitLines(newItem.SourceCode),
+			FromFile: fmt.Sprintf("%s (%s)", arguments.OldName, oldItem),
+			ToFile:   fmt.Sprintf("%s (%s)", arguments.NewName, newItem),
+			Context:  3,
+		})
+		arguments.Changes = append(arguments.Changes, Change{Kind: ChangeKind_Modified, Item: newItem, Diff: diff})
+	}
+	for _, newItem := range arguments.NewItems {
+		if !isInOldFile[keyOf(newItem)] {
+			arguments.Changes = append(arguments.Changes, Change{Kind: ChangeKind_Added, Item: newItem})
+		}
+	}
+	return nil
+}
+
+// SplitIntoItems decompiles each script, global and other piece of code at the root of a file on its own.
+// Newlines, name table entries and the end of file aren't items.
+func SplitIntoItems(rootNode compiler.AstNode, nameTable map[uint32]string) ([]Item, error) {
+	rootNode = RecogniseCompilerIdioms(rootNode, nameTable)
+
+	var items []Item
+	occurrences := make(map[ItemKind]map[uint32]int)
+	for _, kind := range []ItemKind{ItemKind_Script, ItemKind_Global, ItemKind_Other} {
+		occurrences[kind] = make(map[uint32]int)
+	}
+
+	for _, node := range rootNode.Data.(compiler.AstData_Root).BodyNodes {
+		var item Item
+		var nameNode compiler.AstNode
+		switch node.Kind {
+		case compiler.AstKind_NewLine, compiler.AstKind_NameTableEntry, compiler.AstKind_EndOfFile:
+			continue
+		case compiler.AstKind_Script:
+			item.Kind = ItemKind_Script
+			nameNode = node.Data.(compiler.AstData_Script).NameNode
+		case compiler.AstKind_Assignment:
+			item.Kind = ItemKind_Global
+			nameNode = node.Data.(compiler.AstData_Assignment).NameNode
+		default:
+			item.Kind = ItemKind_Other
+		}
+
+		if checksum, isChecksum := checksumBytes(nameNode); isChecksum {
+			item.Checksum = binary.LittleEndian.Uint32(checksum)
+			name, err := DecompileAstNode(nameNode, 0, nameTable)
+			if err != nil {
+				return nil, err
+			}
+			item.Name = name
+		} else if item.Kind != ItemKind_Other {
+			item.Kind = ItemKind_Other // e.g. a global named by something other than a checksum
+		}
+		item.Occurrence = occurrences[item.Kind][item.Checksum]
+		occurrences[item.Kind][item.Checksum]++
+
+		sourceCode, err := DecompileAstNode(node, 0, nameTable)
+		if err != nil {
+			return nil, err
+		}
+		item.SourceCode = strings.TrimRight(sourceCode, "\n") + "\n"
+		if item.codeWithoutLayout, err = DecompileAstNode(removeLayout(node), 0, nameTable); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// removeLayout removes the newlines between the elements of structs and arrays.
+func removeLayout(node compiler.AstNode) compiler.AstNode {
+	withoutNewLines := func(nodes []compiler.AstNode) []compiler.AstNode {
+		var result []compiler.AstNode
+		for _, node := range nodes {
+			if node.Kind != compiler.AstKind_NewLine {
+				result = append(result, node)
+			}
+		}
+		return result
+	}
+	return compiler.Rewrite(node, compiler.Rewriter{
+		LeaveKinds: map[compiler.AstKind]func(node compiler.AstNode) compiler.AstNode{
+			compiler.AstKind_Struct: func(node compiler.AstNode) compiler.AstNode {
+				node.Data = compiler.AstData_Struct{ElementNodes: withoutNewLines(node.Data.(compiler.AstData_Struct).ElementNodes)}
+				return node
+			},
+			compiler.AstKind_Array: func(node compiler.AstNode) compiler.AstNode {
+				node.Data = compiler.AstData_Array{ElementNodes: withoutNewLines(node.Data.(compiler.AstData_Array).ElementNodes)}
+				return node
+			},
+		},
+	})
+}
@@ -0,0 +1,126 @@
+package decompiler_test
+
+import (
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"strings"
+	"testing"
+)
+
+const oldCode = `speed = 10
+name = "old"
+script Foo {
+    print "a"
+    print "b"
+}
+script Gone {
+    print "bye"
+}
+`
+
+const newCode = `speed = 12
+name = "old"
+script Foo {
+    print "a"
+    print "c"
+}
+script New {
+    print "hi"
+}
+`
+
+func TestDiffByteCode(t *testing.T) {
+	arguments := diff(t, compileSourceCode(t, oldCode), compileSourceCode(t, newCode), nil)
+
+	var summary []string
+	for _, change := range arguments.Changes {
+		summary = append(summary, change.Item.String()+" "+change.Kind.String())
+	}
+	expected := []string{"global speed modified", "script Foo modified", "script Gone removed", "script New added"}
+	if strings.Join(summary, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("Expected changes [%s], got [%s]", strings.Join(expected, ", "), strings.Join(summary, ", "))
+	}
+	if diff := arguments.Changes[1].Diff; !strings.Contains(diff, "-    print \"b\"\n+    print \"c\"\n") {
+		t.Errorf("Unexpected diff for script Foo:\n%s", diff)
+	}
+}
+
+// Names from either file's name table (or the dictionary) are used for both files, so missing names aren't changes.
+func TestDiffByteCodeWithDifferentNameTables(t *testing.T) {
+	byteCode := compileSourceCode(t, oldCode)
+	withoutNames := withoutNameTable(t, byteCode)
+
+	if arguments := diff(t, byteCode, withoutNames, nil); len(arguments.Changes) != 0 {
+		t.Errorf("Expected no changes, got %v", arguments.Changes)
+	}
+
+	dictionary := map[uint32]string{compiler.StringToChecksum("Foo"): "Foo"}
+	arguments := diff(t, withoutNames, withoutNames, dictionary)
+	var names []string
+	for _, item := range arguments.OldItems {
+		names = append(names, item.Name)
+	}
+	unnamed := func(name string) string {
+		return fmt.Sprintf("#%08X", compiler.StringToChecksum(name))
+	}
+	if expected := []string{unnamed("speed"), unnamed("name"), "Foo", unnamed("Gone")}; strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected item names [%s], got [%s]", strings.Join(expected, " "), strings.Join(names, " "))
+	}
+}
+
+// Splitting structs and arrays over lines differently isn't a change, but changing their elements is.
+func TestDiffByteCodeIgnoresLayout(t *testing.T) {
+	oneLine := "trick = { name = \"Kickflip\" score = 100 }\nscores = [1 2 3]\n"
+	manyLines := "trick = {\n    name = \"Kickflip\"\n    score = 100\n}\nscores = [\n    1\n    2\n    3\n]\n"
+	if arguments := diff(t, compileSourceCode(t, oneLine), compileSourceCode(t, manyLines), nil); len(arguments.Changes) != 0 {
+		t.Errorf("Expected no changes, got %v", arguments.Changes)
+	}
+
+	changed := "trick = {\n    name = \"Kickflip\"\n    score = 200\n}\nscores = [1 2 3]\n"
+	arguments := diff(t, compileSourceCode(t, oneLine), compileSourceCode(t, changed), nil)
+	if len(arguments.Changes) != 1 || arguments.Changes[0].Item.String() != "global trick" {
+		t.Errorf("Expected global trick to be modified, got %v", arguments.Changes)
+	}
+}
+
+func diff(t *testing.T, oldByteCode, newByteCode []byte, dictionary map[uint32]string) decompiler.DiffArguments {
+	t.Helper()
+	arguments := decompiler.DiffArguments{
+		OldByteCode: oldByteCode,
+		NewByteCode: newByteCode,
+		OldName:     "old.qb",
+		NewName:     "new.qb",
+		Dictionary:  dictionary,
+	}
+	if err := decompiler.DiffByteCode(&arguments); err != nil {
+		t.Fatal(err)
+	}
+	return arguments
+}
+
+func compileSourceCode(t *testing.T, sourceCode string) []byte {
+	t.Helper()
+	byteCode, err := compiler.CompileSourceCode(sourceCode, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return byteCode
+}
+
+// withoutNameTable gives the bytecode before the name table, followed by the end of the file.
+func withoutNameTable(t *testing.T, byteCode []byte) []byte {
+	t.Helper()
+	for index := 0; index < len(byteCode); {
+		instruction, err := disassembler.DecodeInstruction(byteCode, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if instruction.Opcode == disassembler.Opcode_NameTableEntry {
+			return append(append([]byte{}, byteCode[:index]...), 0)
+		}
+		index = instruction.End()
+	}
+	return byteCode // there's no name table
+}
@@ -0,0 +1,45 @@
+package decompiler_test
+
+import (
+	"github.com/byxor/NeverScript/decompiler"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * Fuzz targets for the decompiler. No bytecode should be able to make it panic (or hang); anything it doesn't
+ * understand should end up in Arguments.Problems instead.
+ *
+ *     go test ./decompiler -run '^$' -fuzz FuzzDecompile
+ */
+
+func addByteCodeSeeds(f *testing.F) {
+	paths, err := filepath.Glob("../compiler/testdata/golden/*.qb")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		byteCode, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(byteCode)
+	}
+}
+
+func FuzzParseByteCode(f *testing.F) {
+	addByteCodeSeeds(f)
+	f.Fuzz(func(t *testing.T, byteCode []byte) {
+		decompiler.ParseByteCode(&decompiler.Arguments{ByteCode: byteCode})
+	})
+}
+
+func FuzzDecompile(f *testing.F) {
+	addByteCodeSeeds(f)
+	f.Fuzz(func(t *testing.T, byteCode []byte) {
+		for _, syntax := range []decompiler.Syntax{decompiler.Syntax_NeverScript, decompiler.Syntax_Blub} {
+			decompiler.Decompile(&decompiler.Arguments{ByteCode: byteCode, Syntax: syntax})
+		}
+	})
+}
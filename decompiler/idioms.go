@@ -0,0 +1,307 @@
+package decompiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/byxor/NeverScript/compiler"
+	"strings"
+)
+
+// RecogniseCompilerIdioms undoes the lowerings done by the NeverScript compiler, so decompiling our own QB files gives back
+// code that looks like what was written:
+//
+//	__COMPILER__infinite_loop_bypasser_N = 0 + a guarded 'break'   ->  while {}
+//	(Foo) + if (<__boolean_result__> = 1)                           ->  if @(Foo) {}
+//	else { if c {} }                                                ->  else if c {}
+//	return __boolean_result__=1                                     ->  return true
+func RecogniseCompilerIdioms(node compiler.AstNode, nameTable map[uint32]string) compiler.AstNode {
+	recogniseBody := func(bodyNodes []compiler.AstNode) []compiler.AstNode {
+		var result []compiler.AstNode
+		for _, bodyNode := range bodyNodes {
+			result = append(result, RecogniseCompilerIdioms(bodyNode, nameTable))
+		}
+		return recogniseIdiomsInBody(result, nameTable)
+	}
+
+	switch node.Kind {
+	case compiler.AstKind_Root:
+		data := node.Data.(compiler.AstData_Root)
+		data.BodyNodes = recogniseBody(data.BodyNodes)
+		node.Data = data
+	case compiler.AstKind_Script:
+		data := node.Data.(compiler.AstData_Script)
+		data.BodyNodes = recogniseBody(data.BodyNodes)
+		node.Data = data
+	case compiler.AstKind_WhileLoop:
+		data := node.Data.(compiler.AstData_WhileLoop)
+		data.BodyNodes = recogniseBody(data.BodyNodes)
+		node.Data = data
+	case compiler.AstKind_Random:
+		data := node.Data.(compiler.AstData_Random)
+		branches := make([][]compiler.AstNode, len(data.Branches))
+		for i, branch := range data.Branches {
+			branches[i] = recogniseBody(branch)
+		}
+		data.Branches = branches
+		node.Data = data
+	case compiler.AstKind_IfStatement:
+		data := node.Data.(compiler.AstData_IfStatement)
+		bodies := make([][]compiler.AstNode, len(data.Bodies))
+		for i, body := range data.Bodies {
+			bodies[i] = recogniseBody(body)
+		}
+		data.Bodies = bodies
+		node.Data = mergeElseIf(data)
+	case compiler.AstKind_Assignment:
+		data := node.Data.(compiler.AstData_Assignment)
+		data.ValueNode = RecogniseCompilerIdioms(data.ValueNode, nameTable)
+		node.Data = data
+	case compiler.AstKind_Return:
+		data := node.Data.(compiler.AstData_UnaryExpression)
+		if data.Node.Kind == compiler.AstKind_Invocation {
+			invocationData := data.Node.Data.(compiler.AstData_Invocation)
+			var parameterNodes []compiler.AstNode
+			for _, parameterNode := range invocationData.ParameterNodes {
+				parameterNodes = append(parameterNodes, recogniseBooleanReturnValue(parameterNode))
+			}
+			invocationData.ParameterNodes = parameterNodes
+			data.Node.Data = invocationData
+		}
+		node.Data = data
+	}
+	return node
+}
+
+// recogniseIdiomsInBody looks for idioms that span several nodes in a body of code.
+func recogniseIdiomsInBody(bodyNodes []compiler.AstNode, nameTable map[uint32]string) []compiler.AstNode {
+	var result []compiler.AstNode
+	for i := 0; i < len(bodyNodes); i++ {
+		hasPattern := func(kinds ...compiler.AstKind) bool {
+			if i+len(kinds) > len(bodyNodes) {
+				return false
+			}
+			for j, kind := range kinds {
+				if bodyNodes[i+j].Kind != kind {
+					return false
+				}
+			}
+			return true
+		}
+
+		// __COMPILER__infinite_loop_bypasser_N = 0
+		// while {if (<__COMPILER__infinite_loop_bypasser_N> > 0) { break } ...}
+		if hasPattern(compiler.AstKind_Assignment, compiler.AstKind_NewLine, compiler.AstKind_WhileLoop) {
+			if whileLoop, ok := removeLoopBypasser(bodyNodes[i], bodyNodes[i+2], nameTable); ok {
+				result = append(result, whileLoop)
+				i += 2
+				continue
+			}
+		}
+
+		// (Foo)
+		// if (<__boolean_result__> = 1) {...}
+		isStartOfLine := i < 2 || bodyNodes[i-2].Kind == compiler.AstKind_NewLine
+		if hasPattern(compiler.AstKind_NewLine, compiler.AstKind_IfStatement) && i > 0 && isStartOfLine {
+			ifData := bodyNodes[i+1].Data.(compiler.AstData_IfStatement)
+			if isBooleanResultCheck(ifData.Conditions[0]) && isBooleanInvocation(bodyNodes[i-1]) {
+				booleanInvocationData := make([]bool, len(ifData.Conditions))
+				copy(booleanInvocationData, ifData.BooleanInvocationData)
+				booleanInvocationData[0] = true
+				conditions := append([]compiler.AstNode{bodyNodes[i-1]}, ifData.Conditions[1:]...)
+				result[len(result)-1] = compiler.AstNode{
+					Kind: compiler.AstKind_IfStatement,
+					Data: mergeElseIf(compiler.AstData_IfStatement{
+						BooleanInvocationData: booleanInvocationData,
+						Conditions:            conditions,
+						Bodies:                ifData.Bodies,
+					}),
+				}
+				i++
+				continue
+			}
+		}
+
+		result = append(result, bodyNodes[i])
+	}
+	return result
+}
+
+// ToCompilerAst turns a tree from ParseByteCode into the tree the compiler would build for the same code, so it
+// compiles back into the same bytes (e.g. after 'ns ast file.qb'). Compiler idioms are recognised, and parentheses
+// around arithmetic and comparisons are removed, since the compiler writes those itself.
+func ToCompilerAst(rootNode compiler.AstNode) compiler.AstNode {
+	nameTable := make(map[uint32]string)
+	addNameTableEntries(nameTable, rootNode)
+	return compiler.Rewrite(RecogniseCompilerIdioms(rootNode, nameTable), compiler.Rewriter{
+		LeaveKinds: map[compiler.AstKind]func(node compiler.AstNode) compiler.AstNode{
+			compiler.AstKind_UnaryExpression: func(node compiler.AstNode) compiler.AstNode {
+				innerNode := node.Data.(compiler.AstData_UnaryExpression).Node
+				switch innerNode.Kind {
+				case compiler.AstKind_AdditionExpression, compiler.AstKind_SubtractionExpression,
+					compiler.AstKind_MultiplicationExpression, compiler.AstKind_DivisionExpression,
+					compiler.AstKind_LessThanExpression, compiler.AstKind_GreaterThanExpression,
+					compiler.AstKind_EqualsExpression:
+					return innerNode
+				}
+				return node
+			},
+		},
+	})
+}
+
+func removeLoopBypasser(assignment compiler.AstNode, whileLoop compiler.AstNode, nameTable map[uint32]string) (compiler.AstNode, bool) {
+	assignmentData := assignment.Data.(compiler.AstData_Assignment)
+	bypasser, ok := checksumBytes(assignmentData.NameNode)
+	if !ok || !isInteger(assignmentData.ValueNode, 0) {
+		return whileLoop, false
+	}
+	if name, ok := nameTable[binary.LittleEndian.Uint32(bypasser)]; ok && !strings.HasPrefix(name, "__COMPILER__infinite_loop_bypasser_") {
+		return whileLoop, false
+	}
+
+	whileData := whileLoop.Data.(compiler.AstData_WhileLoop)
+	if len(whileData.BodyNodes) == 0 || whileData.BodyNodes[0].Kind != compiler.AstKind_IfStatement {
+		return whileLoop, false
+	}
+	guard := whileData.BodyNodes[0].Data.(compiler.AstData_IfStatement)
+	if len(guard.Conditions) != 1 || len(guard.Bodies) != 1 {
+		return whileLoop, false
+	}
+	comparison := unwrapParentheses(guard.Conditions[0])
+	if comparison.Kind != compiler.AstKind_GreaterThanExpression {
+		return whileLoop, false
+	}
+	comparisonData := comparison.Data.(compiler.AstData_BinaryExpression)
+	if !isLocalReferenceTo(comparisonData.LeftNode, bypasser) || !isInteger(comparisonData.RightNode, 0) {
+		return whileLoop, false
+	}
+	var guardBody []compiler.AstNode
+	for _, bodyNode := range guard.Bodies[0] {
+		if bodyNode.Kind != compiler.AstKind_NewLine {
+			guardBody = append(guardBody, bodyNode)
+		}
+	}
+	if len(guardBody) != 1 || guardBody[0].Kind != compiler.AstKind_Break {
+		return whileLoop, false
+	}
+
+	whileData.BodyNodes = whileData.BodyNodes[1:]
+	whileData.IsRaw = false
+	return compiler.AstNode{
+		Kind: compiler.AstKind_WhileLoop,
+		Data: whileData,
+	}, true
+}
+
+// mergeElseIf turns an 'else' containing nothing but another if statement back into 'else if'.
+func mergeElseIf(data compiler.AstData_IfStatement) compiler.AstData_IfStatement {
+	if len(data.Bodies) != len(data.Conditions)+1 {
+		return data
+	}
+	elseBody := data.Bodies[len(data.Bodies)-1]
+	if len(elseBody) != 3 ||
+		elseBody[0].Kind != compiler.AstKind_NewLine ||
+		elseBody[1].Kind != compiler.AstKind_IfStatement ||
+		elseBody[2].Kind != compiler.AstKind_NewLine {
+		return data
+	}
+	innerData := elseBody[1].Data.(compiler.AstData_IfStatement)
+	booleanInvocationData := make([]bool, len(data.Conditions), len(data.Conditions)+len(innerData.Conditions))
+	copy(booleanInvocationData, data.BooleanInvocationData)
+	innerBooleanInvocationData := make([]bool, len(innerData.Conditions))
+	copy(innerBooleanInvocationData, innerData.BooleanInvocationData)
+
+	var bodies [][]compiler.AstNode
+	bodies = append(bodies, data.Bodies[:len(data.Bodies)-1]...)
+	bodies = append(bodies, innerData.Bodies...)
+	return compiler.AstData_IfStatement{
+		BooleanInvocationData: append(booleanInvocationData, innerBooleanInvocationData...),
+		Conditions:            append(append([]compiler.AstNode{}, data.Conditions...), innerData.Conditions...),
+		Bodies:                bodies,
+	}
+}
+
+// recogniseBooleanReturnValue turns the __boolean_result__=1 and __boolean_result__=0 parameters back into 'true' and 'false'.
+func recogniseBooleanReturnValue(parameterNode compiler.AstNode) compiler.AstNode {
+	if parameterNode.Kind != compiler.AstKind_Assignment {
+		return parameterNode
+	}
+	data := parameterNode.Data.(compiler.AstData_Assignment)
+	if !isChecksumOf(data.NameNode, "__boolean_result__") {
+		return parameterNode
+	}
+	var name string
+	if isInteger(data.ValueNode, 1) {
+		name = "true"
+	} else if isInteger(data.ValueNode, 0) {
+		name = "false"
+	} else {
+		return parameterNode
+	}
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Checksum,
+		Data: compiler.AstData_Checksum{
+			ChecksumToken: compiler.Token{
+				Kind: compiler.TokenKind_Identifier,
+				Data: name,
+			},
+		},
+	}
+}
+
+// isBooleanResultCheck matches (<__boolean_result__> = 1).
+func isBooleanResultCheck(node compiler.AstNode) bool {
+	node = unwrapParentheses(node)
+	if node.Kind != compiler.AstKind_EqualsExpression {
+		return false
+	}
+	data := node.Data.(compiler.AstData_BinaryExpression)
+	if data.LeftNode.Kind != compiler.AstKind_LocalReference || !isInteger(data.RightNode, 1) {
+		return false
+	}
+	return isChecksumOf(data.LeftNode.Data.(compiler.AstData_LocalReference).Node, "__boolean_result__")
+}
+
+func isBooleanInvocation(node compiler.AstNode) bool {
+	switch unwrapParentheses(node).Kind {
+	case compiler.AstKind_Invocation, compiler.AstKind_Checksum, compiler.AstKind_ColonExpression:
+		return true
+	}
+	return false
+}
+
+func unwrapParentheses(node compiler.AstNode) compiler.AstNode {
+	for node.Kind == compiler.AstKind_UnaryExpression {
+		node = node.Data.(compiler.AstData_UnaryExpression).Node
+	}
+	return node
+}
+
+func checksumBytes(node compiler.AstNode) ([]byte, bool) {
+	if node.Kind != compiler.AstKind_Checksum {
+		return nil, false
+	}
+	data := node.Data.(compiler.AstData_Checksum)
+	return data.ChecksumBytes, len(data.ChecksumBytes) == 4
+}
+
+func isChecksumOf(node compiler.AstNode, name string) bool {
+	checksum, ok := checksumBytes(node)
+	return ok && binary.LittleEndian.Uint32(checksum) == compiler.StringToChecksum(name)
+}
+
+func isLocalReferenceTo(node compiler.AstNode, checksum []byte) bool {
+	if node.Kind != compiler.AstKind_LocalReference {
+		return false
+	}
+	referencedChecksum, ok := checksumBytes(node.Data.(compiler.AstData_LocalReference).Node)
+	return ok && bytes.Equal(referencedChecksum, checksum)
+}
+
+func isInteger(node compiler.AstNode, value int32) bool {
+	if node.Kind != compiler.AstKind_Integer {
+		return false
+	}
+	integerBytes := node.Data.(compiler.AstData_Integer).IntegerBytes
+	return len(integerBytes) == 4 && int32(binary.LittleEndian.Uint32(integerBytes)) == value
+}
@@ -10,25 +10,52 @@ import (
 	"strings"
 )
 
+var binaryOperatorSymbols = map[compiler.AstKind]string{
+	compiler.AstKind_AdditionExpression:          "+",
+	compiler.AstKind_SubtractionExpression:       "-",
+	compiler.AstKind_MultiplicationExpression:    "*",
+	compiler.AstKind_DivisionExpression:          "/",
+	compiler.AstKind_EqualsExpression:            "=",
+	compiler.AstKind_LessThanExpression:          "<",
+	compiler.AstKind_LessThanEqualsExpression:    "<=",
+	compiler.AstKind_GreaterThanExpression:       ">",
+	compiler.AstKind_GreaterThanEqualsExpression: ">=",
+}
+
+var keywords = map[string]bool{
+	"or":     true,
+	"if":     true,
+	"and":    true,
+	"else":   true,
+	"while":  true,
+	"break":  true,
+	"script": true,
+	"random": true,
+	"return": true,
+}
+
 func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint32]string) (string, error) {
 	switch node.Kind {
 	case compiler.AstKind_Root:
 		data := node.Data.(compiler.AstData_Root)
-		text := ""
+		var bodyNodes []compiler.AstNode
 		for _, bodyNode := range data.BodyNodes {
-			decompiledBodyNode, err := DecompileAstNode(bodyNode, indentation, nameTable)
-			if err != nil {
-				return "", err
+			if bodyNode.Kind != compiler.AstKind_NameTableEntry && bodyNode.Kind != compiler.AstKind_EndOfFile {
+				bodyNodes = append(bodyNodes, bodyNode)
 			}
-			text += decompiledBodyNode
 		}
-		return text, nil
+		return decompileLines(bodyNodes, indentation, nameTable)
 	case compiler.AstKind_NewLine:
 		return "\n", nil
 	case compiler.AstKind_EndOfFile:
 		return "", nil
+	case compiler.AstKind_Comment:
+		comment := node.Data.(compiler.AstData_Comment).CommentToken.Data
+		return strings.Replace(comment, "\n", "\n"+strings.Repeat("    ", indentation), -1), nil
 	case compiler.AstKind_Comma:
 		return ",", nil
+	case compiler.AstKind_Break:
+		return "break", nil
 	case compiler.AstKind_AllArguments:
 		return "<...>", nil
 	case compiler.AstKind_LogicalNot:
@@ -39,7 +66,7 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 		}
 		return "! " + expressionCode, nil
 	case compiler.AstKind_LocalReference:
-		expressionCode, err := DecompileAstNode(node.Data.(compiler.AstData_UnaryExpression).Node, indentation, nameTable)
+		expressionCode, err := DecompileAstNode(node.Data.(compiler.AstData_LocalReference).Node, indentation, nameTable)
 		if err != nil {
 			return "", err
 		}
@@ -62,22 +89,16 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 			nodeCode = strings.Replace(nodeCode, " = ", "=", 1)
 			code.WriteString(nodeCode)
 		}
-		code.WriteString(" {")
-		indentation++
-		for i, bodyNode := range data.BodyNodes {
-			isFirstNode := i == 0
-			decompiledNode, err := DecompileAstNode(bodyNode, indentation, nameTable)
-			if err != nil {
-				return "", err
-			}
-			if !isFirstNode && data.BodyNodes[i - 1].Kind == compiler.AstKind_NewLine {
-				code.WriteString(strings.Repeat("    ", indentation))
-			}
-			code.WriteString(decompiledNode)
+		code.WriteString(" ")
+		bodyCode, err := decompileBody(data.BodyNodes, indentation, nameTable)
+		if err != nil {
+			return "", err
 		}
-		indentation--
-		code.WriteString("}")
+		code.WriteString(bodyCode)
 		return code.String(), nil
+	case compiler.AstKind_Return:
+		data := node.Data.(compiler.AstData_UnaryExpression)
+		return DecompileAstNode(data.Node, indentation, nameTable)
 	case compiler.AstKind_Invocation:
 		data := node.Data.(compiler.AstData_Invocation)
 		var code strings.Builder
@@ -87,25 +108,16 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 		}
 		code.WriteString(decompiledName)
 		if len(data.ParameterNodes) <= 2 { // render params on 1 line
-			for i, parameterNode := range data.ParameterNodes {
+			for _, parameterNode := range data.ParameterNodes {
 				decompiledNode, err := DecompileAstNode(parameterNode, indentation, nameTable)
 				if err != nil {
 					return "", err
 				}
-				isFirstNode := i == 0
-				isLastNode := i == len(data.ParameterNodes)-1
-				if isFirstNode {
-					if parameterNode.Kind != compiler.AstKind_NewLine {
-						code.WriteString(" ")
-					}
-				}
 				if parameterNode.Kind == compiler.AstKind_Assignment {
 					decompiledNode = strings.Replace(decompiledNode, " = ", "=", 1)
 				}
+				code.WriteString(" ")
 				code.WriteString(decompiledNode)
-				if !isLastNode {
-					code.WriteString(" ")
-				}
 			}
 		} else { // render params across multiple lines
 			indentation++
@@ -114,6 +126,9 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 				if err != nil {
 					return "", err
 				}
+				if parameterNode.Kind == compiler.AstKind_Assignment {
+					decompiledNode = strings.Replace(decompiledNode, " = ", "=", 1)
+				}
 				code.WriteString(" \\\n")
 				code.WriteString(strings.Repeat("    ", indentation))
 				code.WriteString(decompiledNode)
@@ -127,20 +142,27 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 		if err != nil {
 			return "", err
 		}
+		if _, ok := binaryOperatorSymbols[data.Node.Kind]; ok { // already has parentheses
+			return nodeCode, nil
+		}
 		return "(" + nodeCode + ")", nil
 	case compiler.AstKind_Checksum:
 		data := node.Data.(compiler.AstData_Checksum)
-		if data.ChecksumToken.Data != "" {
-			return data.ChecksumToken.Data, nil
+		if name := data.ChecksumToken.Data; name != "" {
+			if data.ChecksumToken.Kind != compiler.TokenKind_Identifier || isValidIdentifier(name) { // e.g. 'return', raw checksums
+				return name, nil
+			}
+			return "#\"" + name + "\"", nil
 		}
 		checksum := binary.LittleEndian.Uint32(data.ChecksumBytes)
 		if resolvedName, ok := nameTable[checksum]; ok {
-			return resolvedName, nil
-		} else {
-			checksumHex := fmt.Sprintf("%#X", data.ChecksumBytes)[2:]
-			checksumHex = strings.Repeat("0", 8-len(checksumHex)) + checksumHex
-			return "#" + checksumHex, nil
+			if isValidIdentifier(resolvedName) {
+				return resolvedName, nil
+			} else if isValidChecksumLiteral(resolvedName, checksum) {
+				return "#\"" + resolvedName + "\"", nil
+			}
 		}
+		return fmt.Sprintf("#%08X", checksum), nil
 	case compiler.AstKind_Float:
 		data := node.Data.(compiler.AstData_Float)
 		bits := binary.LittleEndian.Uint32(data.FloatBytes)
@@ -185,12 +207,16 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 		return fmt.Sprintf("(%s, %s, %s)", RenderFloat(left), RenderFloat(middle), RenderFloat(right)), nil
 	case compiler.AstKind_String:
 		data := node.Data.(compiler.AstData_String)
-		return fmt.Sprintf("\"%s\"", data.StringBytes), nil
+		stringBytes := data.StringBytes
+		if len(stringBytes) > 0 && stringBytes[len(stringBytes)-1] == 0 {
+			stringBytes = stringBytes[:len(stringBytes)-1]
+		}
+		return fmt.Sprintf("\"%s\"", stringBytes), nil
 	case compiler.AstKind_Struct:
 		data := node.Data.(compiler.AstData_Struct)
 		var code strings.Builder
 		code.WriteString("{")
-		if len(data.ElementNodes) > 0 {
+		if len(data.ElementNodes) > 0 && data.ElementNodes[0].Kind != compiler.AstKind_NewLine {
 			code.WriteString(" ")
 		}
 		indentation++
@@ -201,7 +227,7 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 			}
 			isLastElement := i == len(data.ElementNodes)-1
 			isFirstElement := i == 0
-			if (isFirstElement || data.ElementNodes[i - 1].Kind != compiler.AstKind_NewLine) &&
+			if (isFirstElement || data.ElementNodes[i-1].Kind != compiler.AstKind_NewLine) &&
 				element.Kind == compiler.AstKind_Assignment {
 				elementCode = strings.Replace(elementCode, " = ", "=", 1)
 			}
@@ -211,7 +237,7 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 					code.WriteString(strings.Repeat("    ", indentation))
 				}
 			} else {
-				if (!isLastElement && data.ElementNodes[i + 1].Kind != compiler.AstKind_Comma) ||
+				if (!isLastElement && data.ElementNodes[i+1].Kind != compiler.AstKind_Comma && data.ElementNodes[i+1].Kind != compiler.AstKind_NewLine) ||
 					(isLastElement && element.Kind != compiler.AstKind_NewLine) {
 					code.WriteString(" ")
 				}
@@ -230,7 +256,7 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 		data := node.Data.(compiler.AstData_Array)
 		var code strings.Builder
 		code.WriteString("[")
-		if len(data.ElementNodes) > 0 {
+		if len(data.ElementNodes) > 0 && data.ElementNodes[0].Kind != compiler.AstKind_NewLine {
 			code.WriteString(" ")
 		}
 		indentation++
@@ -246,7 +272,7 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 					code.WriteString(strings.Repeat("    ", indentation))
 				}
 			} else {
-				if (!isLastElement && data.ElementNodes[i + 1].Kind != compiler.AstKind_Comma) ||
+				if (!isLastElement && data.ElementNodes[i+1].Kind != compiler.AstKind_Comma && data.ElementNodes[i+1].Kind != compiler.AstKind_NewLine) ||
 					(isLastElement && element.Kind != compiler.AstKind_NewLine) {
 					code.WriteString(" ")
 				}
@@ -261,116 +287,110 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 		}
 		code.WriteString("]")
 		return code.String(), nil
-	case compiler.AstKind_Assignment:
-		data := node.Data.(compiler.AstData_Assignment)
-		decompiledName, err := DecompileAstNode(data.NameNode, indentation, nameTable)
-		if err != nil {
-			return "", err
-		}
-		decompiledValue, err := DecompileAstNode(data.ValueNode, indentation, nameTable)
+	case compiler.AstKind_ArrayAccess:
+		data := node.Data.(compiler.AstData_ArrayAccess)
+		arrayCode, err := DecompileAstNode(data.Array, indentation, nameTable)
 		if err != nil {
 			return "", err
 		}
-		return fmt.Sprintf("%s = %s", decompiledName, decompiledValue), nil
-	case compiler.AstKind_EqualsExpression:
-		data := node.Data.(compiler.AstData_BinaryExpression)
-		leftDecompiled, err := DecompileAstNode(data.LeftNode, indentation, nameTable)
+		indexCode, err := DecompileAstNode(data.Index, indentation, nameTable)
 		if err != nil {
 			return "", err
 		}
-		rightDecompiled, err := DecompileAstNode(data.RightNode, indentation, nameTable)
+		return arrayCode + "[" + indexCode + "]", nil
+	case compiler.AstKind_Assignment:
+		data := node.Data.(compiler.AstData_Assignment)
+		decompiledName, err := DecompileAstNode(data.NameNode, indentation, nameTable)
 		if err != nil {
 			return "", err
 		}
-		return leftDecompiled + " = " + rightDecompiled, nil
-	case compiler.AstKind_LessThanExpression:
-		data := node.Data.(compiler.AstData_BinaryExpression)
-		leftDecompiled, err := DecompileAstNode(data.LeftNode, indentation, nameTable)
+		decompiledValue, err := DecompileAstNode(data.ValueNode, indentation, nameTable)
 		if err != nil {
 			return "", err
 		}
-		rightDecompiled, err := DecompileAstNode(data.RightNode, indentation, nameTable)
+		return fmt.Sprintf("%s = %s", decompiledName, decompiledValue), nil
+	case compiler.AstKind_AdditionExpression,
+		compiler.AstKind_SubtractionExpression,
+		compiler.AstKind_MultiplicationExpression,
+		compiler.AstKind_DivisionExpression,
+		compiler.AstKind_EqualsExpression,
+		compiler.AstKind_LessThanExpression,
+		compiler.AstKind_LessThanEqualsExpression,
+		compiler.AstKind_GreaterThanExpression,
+		compiler.AstKind_GreaterThanEqualsExpression:
+		// The compiler always wraps these in parentheses.
+		code, err := decompileBinaryExpression(node, " "+binaryOperatorSymbols[node.Kind]+" ", indentation, nameTable)
 		if err != nil {
 			return "", err
 		}
-		return leftDecompiled + " < " + rightDecompiled, nil
+		return "(" + code + ")", nil
+	case compiler.AstKind_LogicalAnd:
+		return decompileBinaryExpression(node, " and ", indentation, nameTable)
+	case compiler.AstKind_LogicalOr:
+		return decompileBinaryExpression(node, " or ", indentation, nameTable)
 	case compiler.AstKind_DotExpression:
-		data := node.Data.(compiler.AstData_BinaryExpression)
-		leftDecompiled, err := DecompileAstNode(data.LeftNode, indentation, nameTable)
-		if err != nil {
-			return "", err
-		}
-		rightDecompiled, err := DecompileAstNode(data.RightNode, indentation, nameTable)
-		if err != nil {
-			return "", err
-		}
-		return leftDecompiled + "." + rightDecompiled, nil
+		return decompileBinaryExpression(node, ".", indentation, nameTable)
 	case compiler.AstKind_ColonExpression:
-		data := node.Data.(compiler.AstData_BinaryExpression)
-		leftDecompiled, err := DecompileAstNode(data.LeftNode, indentation, nameTable)
-		if err != nil {
-			return "", err
-		}
-		rightDecompiled, err := DecompileAstNode(data.RightNode, indentation, nameTable)
-		if err != nil {
-			return "", err
-		}
-		return leftDecompiled + ":" + rightDecompiled, nil
-	case compiler.AstKind_GreaterThanExpression:
-		data := node.Data.(compiler.AstData_BinaryExpression)
-		leftDecompiled, err := DecompileAstNode(data.LeftNode, indentation, nameTable)
-		if err != nil {
-			return "", err
-		}
-		rightDecompiled, err := DecompileAstNode(data.RightNode, indentation, nameTable)
-		if err != nil {
-			return "", err
-		}
-		return leftDecompiled + " > " + rightDecompiled, nil
+		return decompileBinaryExpression(node, ":", indentation, nameTable)
 	case compiler.AstKind_IfStatement:
 		data := node.Data.(compiler.AstData_IfStatement)
 		var code strings.Builder
-		code.WriteString("if ")
-		conditionCode, err := DecompileAstNode(data.Conditions[0], indentation, nameTable)
-		if err != nil {
-			return "", err
-		}
-		code.WriteString(conditionCode)
-		renderBody := func(body []compiler.AstNode) (string, error) {
-			var bodyCode strings.Builder
-			bodyCode.WriteString(" {")
-			indentation++
-			for i, bodyNode := range body {
-				isFirstNode := i == 0
-				nodeCode, err := DecompileAstNode(bodyNode, indentation, nameTable)
-				if err != nil {
-					return "", err
-				}
-				if !isFirstNode && len(body) != 0 && body[len(body)-1].Kind == compiler.AstKind_NewLine {
-					bodyCode.WriteString(strings.Repeat("    ", indentation))
-				}
-				bodyCode.WriteString(nodeCode)
+		for i, condition := range data.Conditions {
+			if i > 0 {
+				code.WriteString(" else ")
 			}
-			indentation--
-			if len(body) > 0 {
-				bodyCode.WriteString(strings.Repeat("    ", indentation))
+			code.WriteString("if ")
+			if i < len(data.BooleanInvocationData) && data.BooleanInvocationData[i] {
+				code.WriteString("@")
 			}
-			bodyCode.WriteString("}")
-			return bodyCode.String(), nil
+			conditionCode, err := DecompileAstNode(condition, indentation, nameTable)
+			if err != nil {
+				return "", err
+			}
+			code.WriteString(conditionCode)
+			code.WriteString(" ")
+			bodyCode, err := decompileBody(data.Bodies[i], indentation, nameTable)
+			if err != nil {
+				return "", err
+			}
+			code.WriteString(bodyCode)
 		}
-		bodyCode, err := renderBody(data.Bodies[0])
+		if len(data.Bodies) > len(data.Conditions) { // has 'else'
+			code.WriteString(" else ")
+			elseBodyCode, err := decompileBody(data.Bodies[len(data.Bodies)-1], indentation, nameTable)
+			if err != nil {
+				return "", err
+			}
+			code.WriteString(elseBodyCode)
+		}
+		return code.String(), nil
+	case compiler.AstKind_WhileLoop:
+		data := node.Data.(compiler.AstData_WhileLoop)
+		bodyCode, err := decompileBody(data.BodyNodes, indentation, nameTable)
 		if err != nil {
 			return "", err
 		}
-		code.WriteString(bodyCode)
-		if len(data.Bodies) > 1 { // has 'else'
-			code.WriteString(" else")
-			elseBodyCode, err := renderBody(data.Bodies[1])
+		return "while " + bodyCode, nil
+	case compiler.AstKind_Random:
+		data := node.Data.(compiler.AstData_Random)
+		var code strings.Builder
+		code.WriteString("random {\n")
+		indentation++
+		for i, branch := range data.Branches {
+			weightCode, err := DecompileAstNode(data.BranchWeights[i], indentation, nameTable)
 			if err != nil {
 				return "", err
 			}
-			code.WriteString(elseBodyCode)
+			bodyCode, err := decompileBody(branch, indentation, nameTable)
+			if err != nil {
+				return "", err
+			}
+			code.WriteString(strings.Repeat("    ", indentation))
+			code.WriteString(weightCode + " " + bodyCode + "\n")
 		}
+		indentation--
+		code.WriteString(strings.Repeat("    ", indentation))
+		code.WriteString("}")
 		return code.String(), nil
 	case compiler.AstKind_NameTableEntry:
 		return "", nil
@@ -378,10 +398,94 @@ func DecompileAstNode(node compiler.AstNode, indentation int, nameTable map[uint
 	return "", errors.New(WrapLine("Don't know how to produce code for AST node", fmt.Sprintf("%+v", node)))
 }
 
+// decompileBody renders a block of code surrounded by curly braces, indenting each line inside it.
+func decompileBody(bodyNodes []compiler.AstNode, indentation int, nameTable map[uint32]string) (string, error) {
+	bodyCode, err := decompileLines(bodyNodes, indentation+1, nameTable)
+	if err != nil {
+		return "", err
+	}
+	if len(bodyNodes) == 0 {
+		return "{}", nil
+	}
+	opening, closing := "{", " }"
+	if bodyNodes[0].Kind != compiler.AstKind_NewLine {
+		opening = "{ "
+	}
+	if bodyNodes[len(bodyNodes)-1].Kind == compiler.AstKind_NewLine {
+		closing = strings.Repeat("    ", indentation) + "}"
+	}
+	return opening + bodyCode + closing, nil
+}
+
+// decompileLines renders a sequence of nodes, indenting the start of each line and separating nodes on the same line with spaces.
+func decompileLines(nodes []compiler.AstNode, indentation int, nameTable map[uint32]string) (string, error) {
+	var code strings.Builder
+	for i, node := range nodes {
+		nodeCode, err := DecompileAstNode(node, indentation, nameTable)
+		if err != nil {
+			return "", err
+		}
+		if node.Kind != compiler.AstKind_NewLine && i > 0 {
+			if nodes[i-1].Kind == compiler.AstKind_NewLine {
+				code.WriteString(strings.Repeat("    ", indentation))
+			} else {
+				code.WriteString(" ")
+			}
+		}
+		code.WriteString(nodeCode)
+	}
+	return code.String(), nil
+}
+
+func decompileBinaryExpression(node compiler.AstNode, operator string, indentation int, nameTable map[uint32]string) (string, error) {
+	data := node.Data.(compiler.AstData_BinaryExpression)
+	leftDecompiled, err := DecompileAstNode(data.LeftNode, indentation, nameTable)
+	if err != nil {
+		return "", err
+	}
+	rightDecompiled, err := DecompileAstNode(data.RightNode, indentation, nameTable)
+	if err != nil {
+		return "", err
+	}
+	return leftDecompiled + operator + rightDecompiled, nil
+}
+
+// isValidIdentifier checks whether a name from the name table can be written as-is without the lexer misreading it.
+func isValidIdentifier(name string) bool {
+	if name == "" || keywords[name] {
+		return false
+	}
+	for i, character := range name {
+		isLetter := (character >= 'a' && character <= 'z') || (character >= 'A' && character <= 'Z') || character == '_'
+		isDigit := character >= '0' && character <= '9'
+		if !isLetter && !(isDigit && i > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidChecksumLiteral checks whether a name can be written as #"name" instead (it must still hash to its checksum).
+func isValidChecksumLiteral(name string, checksum uint32) bool {
+	return name != "" && !strings.ContainsAny(name, "\"\n") && compiler.StringToChecksum(name) == checksum
+}
+
+// RenderName writes a name so that the compiler turns it back into the same checksum: as-is when it's a valid
+// identifier, otherwise as a #"name" literal. Names containing quotes or newlines can't be written at all.
+func RenderName(name string) (string, bool) {
+	if isValidIdentifier(name) {
+		return name, true
+	}
+	if isValidChecksumLiteral(name, compiler.StringToChecksum(name)) {
+		return "#\"" + name + "\"", true
+	}
+	return "", false
+}
+
 func RenderFloat(f float32) string {
 	result := strconv.FormatFloat(float64(f), 'f', -1, 32)
 	if !strings.Contains(result, ".") {
 		result += ".0"
 	}
 	return result
-}
\ No newline at end of file
+}
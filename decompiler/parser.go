@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/disassembler"
 	"strings"
 )
 
@@ -31,19 +32,40 @@ func ParserSuccess(bytesRead int, node compiler.AstNode) ParseResult {
 	}
 }
 
-/*
- * The decompiler isn't a priority, but I've written a tiny bit of it just for fun.
- */
+// Operator precedence when rebuilding a flat sequence of binary operators into a tree (higher binds tighter).
+var binaryOperators = map[byte]struct {
+	Kind       compiler.AstKind
+	Precedence int
+}{
+	0x32: {compiler.AstKind_LogicalOr, 1},
+	0x33: {compiler.AstKind_LogicalAnd, 2},
+	0x07: {compiler.AstKind_EqualsExpression, 3},
+	0x12: {compiler.AstKind_LessThanExpression, 3},
+	0x13: {compiler.AstKind_LessThanEqualsExpression, 3},
+	0x14: {compiler.AstKind_GreaterThanExpression, 3},
+	0x15: {compiler.AstKind_GreaterThanEqualsExpression, 3},
+	0x0B: {compiler.AstKind_AdditionExpression, 4},
+	0x0A: {compiler.AstKind_SubtractionExpression, 4},
+	0x0D: {compiler.AstKind_MultiplicationExpression, 5},
+	0x0C: {compiler.AstKind_DivisionExpression, 5},
+}
+
 func ParseByteCode(arguments *Arguments) error {
 	type ParserFunction func(index int) ParseResult
 	var ParseRoot ParserFunction
 	var ParseRootBodyNode ParserFunction
 	var ParseEndOfFile ParserFunction
 	var ParseNewLine ParserFunction
+	var ParseLineNumber ParserFunction
 	var ParseComma ParserFunction
 	var ParseAssignment ParserFunction
 	var ParseScript ParserFunction
 	var ParseIfStatement ParserFunction
+	var ParseOldIfStatement ParserFunction
+	var ParseSwitch ParserFunction
+	var ParseWhileLoop ParserFunction
+	var ParseBreak ParserFunction
+	var ParseRandom ParserFunction
 	var ParseInvocation ParserFunction
 	var ParseReturn ParserFunction
 	var ParseChecksum ParserFunction
@@ -57,15 +79,79 @@ func ParseByteCode(arguments *Arguments) error {
 	var ParseArray ParserFunction
 	var ParseAllArgumentsSymbol ParserFunction
 	var ParseNameTableEntry ParserFunction
+	var ParseOperand func(allowInvocations bool) ParserFunction
 	var ParseExpression func(allowInvocations bool) ParserFunction
+	var ParseBinaryExpression func(allowInvocations bool, allowEquals bool) ParserFunction
 	var ParseBodyOfCode func(index *int) []compiler.AstNode
+	var bodyOfCodeParserFunctions func() []ParserFunction
+	var ParseBodyOfCodeUntil func(index *int, end int) ([]compiler.AstNode, bool)
 
 	bytes := arguments.ByteCode
 	numBytes := len(bytes)
 
+	// byteAt reads a byte without running off the end of the bytecode (0xFF isn't used by any opcode).
+	byteAt := func(index int) byte {
+		if index < 0 || index >= numBytes {
+			return 0xFF
+		}
+		return bytes[index]
+	}
+
+	// hex dump for error messages, clamped to the end of the bytecode
+	dumpBytes := func(index int, size int) string {
+		if index > numBytes {
+			index = numBytes
+		}
+		if index+size > numBytes {
+			size = numBytes - index
+		}
+		return hex.Dump(bytes[index : index+size])
+	}
+
+	// skipUnrecognisedBytes records a problem and turns the bytes up to the next place where parsing can resume into a comment.
+	skipUnrecognisedBytes := func(index int, canResumeAt func(index int) bool) (int, compiler.AstNode) {
+		start := index
+		index++
+		for index < numBytes && !canResumeAt(index) {
+			index++
+		}
+		skippedBytes := bytes[start:index]
+
+		arguments.Problems = append(arguments.Problems, Problem{
+			Index:   start,
+			Size:    len(skippedBytes),
+			Message: fmt.Sprintf("Couldn't decompile %d byte(s) starting with 0x%02X%s", len(skippedBytes), skippedBytes[0], describeSkippedBytes(bytes, start, index)),
+		})
+
+		var comment strings.Builder
+		comment.WriteString(fmt.Sprintf("/* [0x%02X] couldn't decompile %d byte(s):", start, len(skippedBytes)))
+		for i, b := range skippedBytes {
+			if i%16 == 0 {
+				comment.WriteString("\n   ")
+			}
+			comment.WriteString(fmt.Sprintf(" %02x", b))
+		}
+		comment.WriteString("\n*/")
+		return index, compiler.AstNode{
+			Kind: compiler.AstKind_Comment,
+			Data: compiler.AstData_Comment{
+				CommentToken: compiler.Token{
+					Kind: compiler.TokenKind_MultiLineComment,
+					Data: comment.String(),
+				},
+			},
+		}
+	}
+
+	newLineNode := compiler.AstNode{
+		Kind: compiler.AstKind_NewLine,
+		Data: compiler.AstData_Empty{},
+	}
+
 	ParseRoot = func(index int) ParseResult {
 		start := index
 		var bodyNodes []compiler.AstNode
+		startOfLine, numNodesBeforeLine := index, 0
 		hasReadAllBytes := false
 		for {
 			if index >= numBytes {
@@ -74,10 +160,28 @@ func ParseByteCode(arguments *Arguments) error {
 			}
 			bodyNodeParseResult := ParseRootBodyNode(index)
 			if !bodyNodeParseResult.WasSuccessful {
-				return ParserFailure(WrapLine(WrapIndex(index, "Failed to parse root"), bodyNodeParseResult.Reason))
+				// skip the whole line, resuming at the next new-line, script or name table entry
+				bodyNodes = bodyNodes[:numNodesBeforeLine]
+				var comment compiler.AstNode
+				index, comment = skipUnrecognisedBytes(startOfLine, func(index int) bool {
+					switch byteAt(index) {
+					case 0x01, 0x23:
+						return true
+					case 0x2B:
+						return ParseNameTableEntry(index).WasSuccessful
+					}
+					return false
+				})
+				bodyNodes = append(bodyNodes, comment)
+				startOfLine, numNodesBeforeLine = index, len(bodyNodes)
+				continue
 			}
 			bodyNodes = append(bodyNodes, bodyNodeParseResult.Node)
 			index += bodyNodeParseResult.BytesRead
+			if bodyNodeParseResult.Node.Kind != compiler.AstKind_NewLine {
+				continue
+			}
+			startOfLine, numNodesBeforeLine = index, len(bodyNodes)
 		}
 		if !hasReadAllBytes {
 			return ParserFailure(WrapIndex(index, "Some bytes left unread"))
@@ -94,9 +198,11 @@ func ParseByteCode(arguments *Arguments) error {
 		parserFunctions := []ParserFunction{
 			ParseEndOfFile,
 			ParseNewLine,
+			ParseLineNumber,
 			ParseAssignment,
 			ParseScript,
 			ParseNameTableEntry,
+			ParseExpression(true),
 		}
 		parseResults := make([]ParseResult, len(parserFunctions))
 		for i, parserFunction := range parserFunctions {
@@ -109,7 +215,7 @@ func ParseByteCode(arguments *Arguments) error {
 		{
 			var message strings.Builder
 			message.WriteString(WrapIndex(index, "Bytes not recognised as root body node.\n"))
-			message.WriteString(hex.Dump(bytes[index : index+32]))
+			message.WriteString(dumpBytes(index, 32))
 			message.WriteString("\nPOTENTIAL CAUSES.\n")
 			message.WriteString("-------------------------------------------------\n")
 			for _, parseResult := range parseResults {
@@ -123,8 +229,8 @@ func ParseByteCode(arguments *Arguments) error {
 	}
 
 	ParseEndOfFile = func(index int) ParseResult {
-		if bytes[index] != 0 {
-			return ParserFailure(WrapIndex(index, fmt.Sprintf("Not an EOF byte '%#X'", bytes[index])))
+		if byteAt(index) != 0 {
+			return ParserFailure(WrapIndex(index, fmt.Sprintf("Not an EOF byte '%#X'", byteAt(index))))
 		}
 		return ParserSuccess(1, compiler.AstNode{
 			Kind: compiler.AstKind_EndOfFile,
@@ -133,18 +239,26 @@ func ParseByteCode(arguments *Arguments) error {
 	}
 
 	ParseNewLine = func(index int) ParseResult {
-		if bytes[index] != 1 {
-			return ParserFailure(WrapIndex(index, fmt.Sprintf("Not a new-line byte '%#X'", bytes[index])))
+		if byteAt(index) != 1 {
+			return ParserFailure(WrapIndex(index, fmt.Sprintf("Not a new-line byte '%#X'", byteAt(index))))
 		}
-		return ParserSuccess(1, compiler.AstNode{
-			Kind: compiler.AstKind_NewLine,
-			Data: compiler.AstData_Empty{},
-		})
+		return ParserSuccess(1, newLineNode)
+	}
+
+	// Older games (THPS3) store a line number with each new-line.
+	ParseLineNumber = func(index int) ParseResult {
+		if byteAt(index) != 2 {
+			return ParserFailure(WrapIndex(index, fmt.Sprintf("Not a line number byte '%#X'", byteAt(index))))
+		}
+		if index+5 > numBytes {
+			return ParserFailure(WrapIndex(index+5, "Reached EOF when scanning line number"))
+		}
+		return ParserSuccess(5, newLineNode)
 	}
 
 	ParseComma = func(index int) ParseResult {
-		if bytes[index] != 9 {
-			return ParserFailure(WrapIndex(index, fmt.Sprintf("Not a comma byte '%#X'", bytes[index])))
+		if byteAt(index) != 9 {
+			return ParserFailure(WrapIndex(index, fmt.Sprintf("Not a comma byte '%#X'", byteAt(index))))
 		}
 		return ParserSuccess(1, compiler.AstNode{
 			Kind: compiler.AstKind_Comma,
@@ -161,8 +275,8 @@ func ParseByteCode(arguments *Arguments) error {
 		}
 		index += checksumParseResult.BytesRead
 
-		if bytes[index] != 7 {
-			return ParserFailure(WrapIndex(index, fmt.Sprintf("Expected 0x7 ('=') in assignment, got %#X", bytes[index])))
+		if byteAt(index) != 7 {
+			return ParserFailure(WrapIndex(index, fmt.Sprintf("Expected 0x7 ('=') in assignment, got %#X", byteAt(index))))
 		}
 		index++
 
@@ -192,7 +306,7 @@ func ParseByteCode(arguments *Arguments) error {
 	ParseScript = func(index int) ParseResult {
 		start := index
 
-		if bytes[index] != 0x23 {
+		if byteAt(index) != 0x23 {
 			return ParserFailure(WrapIndex(index, "Script doesn't start with 0x23"))
 		}
 		index++
@@ -205,7 +319,7 @@ func ParseByteCode(arguments *Arguments) error {
 
 		var defaultParameters []compiler.AstNode
 		for {
-			if bytes[index] == 1 || bytes[index] == 0x24 {
+			if byteAt(index) == 1 || byteAt(index) == 0x24 {
 				break
 			}
 
@@ -218,10 +332,42 @@ func ParseByteCode(arguments *Arguments) error {
 			}
 		}
 
-		bodyNodes := ParseBodyOfCode(&index)
+		// Problems are only kept if the whole script can be parsed.
+		numProblems := len(arguments.Problems)
+		var bodyNodes []compiler.AstNode
+		startOfLine, numNodesBeforeLine := index, 0
+		for {
+			if index >= numBytes || byteAt(index) == 0x24 {
+				break
+			}
+			bodyNodeParseResult := ParserFailure("")
+			for _, parserFunction := range bodyOfCodeParserFunctions() {
+				if bodyNodeParseResult = parserFunction(index); bodyNodeParseResult.WasSuccessful {
+					break
+				}
+			}
+			if !bodyNodeParseResult.WasSuccessful {
+				// skip the whole line, resuming at the next new-line or the end of the script
+				bodyNodes = bodyNodes[:numNodesBeforeLine]
+				var comment compiler.AstNode
+				index, comment = skipUnrecognisedBytes(startOfLine, func(index int) bool {
+					return byteAt(index) == 0x01 || byteAt(index) == 0x24
+				})
+				bodyNodes = append(bodyNodes, comment)
+				startOfLine, numNodesBeforeLine = index, len(bodyNodes)
+				continue
+			}
+			bodyNodes = append(bodyNodes, bodyNodeParseResult.Node)
+			index += bodyNodeParseResult.BytesRead
+			if bodyNodeParseResult.Node.Kind != compiler.AstKind_NewLine {
+				continue
+			}
+			startOfLine, numNodesBeforeLine = index, len(bodyNodes)
+		}
 
-		if bytes[index] != 0x24 {
-			return ParserFailure(WrapLine(WrapIndex(index, "Script doesn't end with 0x24"), hex.Dump(bytes[index:index+64])))
+		if byteAt(index) != 0x24 {
+			arguments.Problems = arguments.Problems[:numProblems]
+			return ParserFailure(WrapLine(WrapIndex(index, "Script doesn't end with 0x24"), dumpBytes(index, 64)))
 		}
 		index++
 
@@ -238,15 +384,13 @@ func ParseByteCode(arguments *Arguments) error {
 	ParseIfStatement = func(index int) ParseResult {
 		start := index
 
-		if bytes[index] != 0x47 {
+		if byteAt(index) != 0x47 {
 			return ParserFailure(WrapIndex(index, "If statement doesn't start with 0x47"))
 		}
 		index++
 		if index+2 >= numBytes {
 			return ParserFailure(WrapIndex(index+2, "Reached EOF when scanning the jump offset"))
 		}
-		//offsetBytes := bytes[index:index+2]
-		//offsetSize := binary.LittleEndian.Uint16(offsetBytes)
 		index += 2
 
 		conditionParseResult := ParseExpression(true)(index)
@@ -258,143 +402,464 @@ func ParseByteCode(arguments *Arguments) error {
 		bodyNodes := ParseBodyOfCode(&index)
 		bodies := [][]compiler.AstNode{bodyNodes}
 
-		if bytes[index] == 0x48 { // has 'else'
+		if index < numBytes && byteAt(index) == 0x48 { // has 'else'
 			index++
 			index += 2
 			bodyNodes := ParseBodyOfCode(&index)
 			bodies = append(bodies, bodyNodes)
 		}
 
+		if index >= numBytes || byteAt(index) != 0x28 {
+			return ParserFailure(WrapIndex(index, "If statement doesn't end with 0x28"))
+		}
 		index++
+
 		return ParserSuccess(index-start, compiler.AstNode{
 			Kind: compiler.AstKind_IfStatement,
 			Data: compiler.AstData_IfStatement{
-				BooleanInvocationData: make([]bool, 1), // FIXME(brandon): Arbitrary data for now, will crash if number of branches exceeds the capacity
+				BooleanInvocationData: make([]bool, 1),
 				Conditions:            []compiler.AstNode{conditionParseResult.Node},
 				Bodies:                bodies,
 			},
 		})
 	}
 
-	ParseExpression = func(allowInvocations bool) ParserFunction {
-		return func(index int) ParseResult {
-			ParseExpressionInner := func(index int) ParseResult {
-				parserFunctions := []ParserFunction{
-					ParseAllArgumentsSymbol,
-					ParseFloat,
-					ParseInteger,
-					ParsePair,
-					ParseUnaryExpression,
-					ParseVector,
-					ParseStruct,
-					ParseArray,
+	// Older games (THPS3) use 'if', 'else' and 'else if' without jump offsets.
+	ParseOldIfStatement = func(index int) ParseResult {
+		start := index
+
+		if byteAt(index) != 0x25 {
+			return ParserFailure(WrapIndex(index, "Old if statement doesn't start with 0x25"))
+		}
+
+		var conditions []compiler.AstNode
+		var bodies [][]compiler.AstNode
+		for index < numBytes && (byteAt(index) == 0x25 || byteAt(index) == 0x27) {
+			index++
+			conditionParseResult := ParseExpression(true)(index)
+			if !conditionParseResult.WasSuccessful {
+				return ParserFailure(WrapIndex(index, WrapLine("Failed to parse old if statement condition", conditionParseResult.Reason)))
+			}
+			index += conditionParseResult.BytesRead
+			conditions = append(conditions, conditionParseResult.Node)
+			bodies = append(bodies, ParseBodyOfCode(&index))
+		}
+
+		if index < numBytes && byteAt(index) == 0x26 { // has 'else'
+			index++
+			bodies = append(bodies, ParseBodyOfCode(&index))
+		}
+
+		if index >= numBytes || byteAt(index) != 0x28 {
+			return ParserFailure(WrapIndex(index, "Old if statement doesn't end with 0x28"))
+		}
+		index++
+
+		return ParserSuccess(index-start, compiler.AstNode{
+			Kind: compiler.AstKind_IfStatement,
+			Data: compiler.AstData_IfStatement{
+				BooleanInvocationData: make([]bool, len(conditions)),
+				Conditions:            conditions,
+				Bodies:                bodies,
+			},
+		})
+	}
+
+	// NeverScript has no switch statement, so it's rebuilt as an if/else-if chain comparing against each case.
+	ParseSwitch = func(index int) ParseResult {
+		start := index
+
+		if byteAt(index) != 0x3C {
+			return ParserFailure(WrapIndex(index, "Switch doesn't start with 0x3C"))
+		}
+		index++
+
+		valueParseResult := ParseExpression(false)(index)
+		if !valueParseResult.WasSuccessful {
+			return ParserFailure(WrapIndex(index, WrapLine("Failed to parse switch value", valueParseResult.Reason)))
+		}
+		index += valueParseResult.BytesRead
+
+		isEmptyBody := func(body []compiler.AstNode) bool {
+			for _, node := range body {
+				if node.Kind != compiler.AstKind_NewLine {
+					return false
 				}
-				if allowInvocations {
-					parserFunctions = append(parserFunctions, ParseInvocation)
+			}
+			return true
+		}
+		skipShortJump := func() {
+			if index+3 <= numBytes && byteAt(index) == 0x49 {
+				index += 3
+			}
+		}
+
+		var conditions []compiler.AstNode
+		var bodies [][]compiler.AstNode
+		var pendingCondition *compiler.AstNode // cases without a body fall through to the next case
+		hasDefault := false
+		for {
+			for index < numBytes && byteAt(index) == 1 {
+				index++
+			}
+			if index >= numBytes {
+				return ParserFailure(WrapIndex(index, "Reached EOF when scanning switch"))
+			}
+
+			if byteAt(index) == 0x3D {
+				index++
+				break
+			} else if byteAt(index) == 0x3E && !hasDefault {
+				index++
+				caseParseResult := ParseExpression(false)(index)
+				if !caseParseResult.WasSuccessful {
+					return ParserFailure(WrapIndex(index, WrapLine("Failed to parse case value", caseParseResult.Reason)))
 				}
-				parserFunctions = append(
-					parserFunctions,
-					ParseChecksum,
-					ParseString,
-				)
-				for _, parserFunction := range parserFunctions {
-					parseResult := parserFunction(index)
-					oldIndex := index
-					if parseResult.WasSuccessful {
-
-						// Check for binary operators
-						index += parseResult.BytesRead
-						if bytes[index] == 7 {
-							index++
-							rightSideParseResult := ParseExpression(false)(index)
-							if rightSideParseResult.WasSuccessful {
-								index += rightSideParseResult.BytesRead
-								return ParserSuccess(parseResult.BytesRead + 1 + rightSideParseResult.BytesRead, compiler.AstNode{
-									Kind: compiler.AstKind_EqualsExpression,
-									Data: compiler.AstData_BinaryExpression{
-										LeftNode: parseResult.Node,
-										RightNode: rightSideParseResult.Node,
-									},
-								})
-							}
-						} else if bytes[index] == 0x12 {
-							index++
-							rightSideParseResult := ParseExpression(false)(index)
-							if rightSideParseResult.WasSuccessful {
-								index += rightSideParseResult.BytesRead
-								return ParserSuccess(parseResult.BytesRead + 1 + rightSideParseResult.BytesRead, compiler.AstNode{
-									Kind: compiler.AstKind_LessThanExpression,
-									Data: compiler.AstData_BinaryExpression{
-										LeftNode: parseResult.Node,
-										RightNode: rightSideParseResult.Node,
-									},
-								})
-							}
-						} else if bytes[index] == 0x14 {
-							index++
-							rightSideParseResult := ParseExpression(false)(index)
-							if rightSideParseResult.WasSuccessful {
-								index += rightSideParseResult.BytesRead
-								return ParserSuccess(parseResult.BytesRead + 1 + rightSideParseResult.BytesRead, compiler.AstNode{
-									Kind: compiler.AstKind_GreaterThanExpression,
-									Data: compiler.AstData_BinaryExpression{
-										LeftNode: parseResult.Node,
-										RightNode: rightSideParseResult.Node,
-									},
-								})
-							}
-						} else if bytes[index] == 8 {
-							index++
-							rightSideParseResult := ParseExpression(false)(index)
-							if rightSideParseResult.WasSuccessful {
-								index += rightSideParseResult.BytesRead
-								return ParserSuccess(parseResult.BytesRead + 1 + rightSideParseResult.BytesRead, compiler.AstNode{
-									Kind: compiler.AstKind_DotExpression,
-									Data: compiler.AstData_BinaryExpression{
-										LeftNode: parseResult.Node,
-										RightNode: rightSideParseResult.Node,
-									},
-								})
-							}
-						} else if bytes[index] == 0x42 {
-							index++
-							rightSideParseResult := ParseExpression(false)(index)
-							if rightSideParseResult.WasSuccessful {
-								index += rightSideParseResult.BytesRead
-								return ParserSuccess(parseResult.BytesRead + 1 + rightSideParseResult.BytesRead, compiler.AstNode{
-									Kind: compiler.AstKind_ColonExpression,
-									Data: compiler.AstData_BinaryExpression{
-										LeftNode: parseResult.Node,
-										RightNode: rightSideParseResult.Node,
-									},
-								})
-							}
-						}
+				index += caseParseResult.BytesRead
 
-						return parseResult
+				condition := compiler.AstNode{
+					Kind: compiler.AstKind_UnaryExpression,
+					Data: compiler.AstData_UnaryExpression{
+						Node: compiler.AstNode{
+							Kind: compiler.AstKind_EqualsExpression,
+							Data: compiler.AstData_BinaryExpression{
+								LeftNode:  valueParseResult.Node,
+								RightNode: caseParseResult.Node,
+							},
+						},
+					},
+				}
+				if pendingCondition != nil {
+					condition = compiler.AstNode{
+						Kind: compiler.AstKind_LogicalOr,
+						Data: compiler.AstData_BinaryExpression{
+							LeftNode:  *pendingCondition,
+							RightNode: condition,
+						},
 					}
-					index = oldIndex
 				}
-				return ParserFailure(WrapLine(WrapIndex(index, "Bytes not recognised as an expression"), hex.Dump(bytes[index:index+64])))
+
+				body := ParseBodyOfCode(&index)
+				skipShortJump()
+				if isEmptyBody(body) && index < numBytes && byteAt(index) == 0x3E {
+					pendingCondition = &condition
+					continue
+				}
+				pendingCondition = nil
+				conditions = append(conditions, condition)
+				bodies = append(bodies, body)
+			} else if byteAt(index) == 0x3F && !hasDefault {
+				index++
+				hasDefault = true
+				bodies = append(bodies, ParseBodyOfCode(&index))
+				skipShortJump()
+			} else {
+				return ParserFailure(WrapIndex(index, fmt.Sprintf("Unexpected byte in switch '%#X'", byteAt(index))))
+			}
+		}
+
+		if len(conditions) == 0 {
+			return ParserFailure(WrapIndex(start, "Switch has no cases"))
+		}
+
+		return ParserSuccess(index-start, compiler.AstNode{
+			Kind: compiler.AstKind_IfStatement,
+			Data: compiler.AstData_IfStatement{
+				BooleanInvocationData: make([]bool, len(conditions)),
+				Conditions:            conditions,
+				Bodies:                bodies,
+				IsSwitch:              true,
+			},
+		})
+	}
+
+	ParseWhileLoop = func(index int) ParseResult {
+		start := index
+
+		if byteAt(index) != 0x20 {
+			return ParserFailure(WrapIndex(index, "While loop doesn't start with 0x20"))
+		}
+		index++
+
+		bodyNodes := ParseBodyOfCode(&index)
+
+		if index >= numBytes || byteAt(index) != 0x21 {
+			return ParserFailure(WrapIndex(index, "While loop doesn't end with 0x21"))
+		}
+		index++
+
+		return ParserSuccess(index-start, compiler.AstNode{
+			Kind: compiler.AstKind_WhileLoop,
+			Data: compiler.AstData_WhileLoop{
+				BodyNodes: bodyNodes,
+				IsRaw:     true,
+			},
+		})
+	}
+
+	ParseBreak = func(index int) ParseResult {
+		if byteAt(index) != 0x22 {
+			return ParserFailure(WrapIndex(index, "Not a 'break' (expected 0x22)"))
+		}
+		return ParserSuccess(1, compiler.AstNode{
+			Kind: compiler.AstKind_Break,
+			Data: compiler.AstData_Empty{},
+		})
+	}
+
+	// The 'random' variants (0x37, 0x40, 0x41) have no NeverScript equivalent, so they're decompiled as a plain 'random'.
+	ParseRandom = func(index int) ParseResult {
+		start := index
+
+		switch byteAt(index) {
+		case 0x2F, 0x37, 0x40, 0x41:
+		default:
+			return ParserFailure(WrapIndex(index, "Random doesn't start with 0x2F"))
+		}
+		index++
+
+		if index+4 > numBytes {
+			return ParserFailure(WrapIndex(index, "Reached EOF when scanning number of random branches"))
+		}
+		numBranches := int(binary.LittleEndian.Uint32(bytes[index : index+4]))
+		index += 4
+		if numBranches == 0 || index+6*numBranches > numBytes {
+			return ParserFailure(WrapIndex(index, fmt.Sprintf("Random has an invalid number of branches (%d)", numBranches)))
+		}
+
+		var branchWeights []compiler.AstNode
+		for i := 0; i < numBranches; i++ {
+			weightBytes := make([]byte, 4)
+			copy(weightBytes, bytes[index:index+2])
+			branchWeights = append(branchWeights, compiler.AstNode{
+				Kind: compiler.AstKind_Integer,
+				Data: compiler.AstData_Integer{
+					IntegerBytes: weightBytes,
+				},
+			})
+			index += 2
+		}
+
+		branchStarts := make([]int, numBranches)
+		for i := 0; i < numBranches; i++ {
+			offset := int32(binary.LittleEndian.Uint32(bytes[index : index+4]))
+			index += 4
+			branchStarts[i] = index + int(offset) // relative to the end of each offset
+		}
+		if branchStarts[0] != index {
+			return ParserFailure(WrapIndex(index, "First random branch doesn't follow the branch offsets"))
+		}
+
+		// Every branch except the last ends by jumping past the final branch.
+		end := -1
+		if numBranches > 1 {
+			jumpIndex := branchStarts[1] - 5
+			if jumpIndex < index || jumpIndex+5 > numBytes || byteAt(jumpIndex) != 0x2E {
+				return ParserFailure(WrapIndex(jumpIndex, "Random branch doesn't end with a long jump (0x2E)"))
+			}
+			end = jumpIndex + 5 + int(int32(binary.LittleEndian.Uint32(bytes[jumpIndex+1:jumpIndex+5])))
+			if end > numBytes || end < jumpIndex+5 {
+				return ParserFailure(WrapIndex(jumpIndex, "Random jumps past EOF"))
+			}
+		}
+
+		var branches [][]compiler.AstNode
+		for i := 0; i < numBranches; i++ {
+			if index != branchStarts[i] {
+				return ParserFailure(WrapIndex(index, fmt.Sprintf("Random branch %d doesn't start where its offset says (%#X)", i, branchStarts[i])))
+			}
+			var branchNodes []compiler.AstNode
+			if i < numBranches-1 {
+				var ok bool
+				branchNodes, ok = ParseBodyOfCodeUntil(&index, branchStarts[i+1]-5)
+				if !ok {
+					return ParserFailure(WrapIndex(index, fmt.Sprintf("Failed to parse random branch %d", i)))
+				}
+				index += 5
+			} else if end >= 0 {
+				var ok bool
+				branchNodes, ok = ParseBodyOfCodeUntil(&index, end)
+				if !ok {
+					return ParserFailure(WrapIndex(index, fmt.Sprintf("Failed to parse random branch %d", i)))
+				}
+			} else {
+				// There's nothing to say where a lone branch ends, so assume it's a single expression.
+				expressionParseResult := ParseExpression(true)(index)
+				if !expressionParseResult.WasSuccessful {
+					return ParserFailure(WrapLine(WrapIndex(index, "Failed to parse random branch"), expressionParseResult.Reason))
+				}
+				branchNodes = []compiler.AstNode{expressionParseResult.Node}
+				index += expressionParseResult.BytesRead
 			}
-			if bytes[index] == 0x39 {
+			branches = append(branches, branchNodes)
+		}
+
+		return ParserSuccess(index-start, compiler.AstNode{
+			Kind: compiler.AstKind_Random,
+			Data: compiler.AstData_Random{
+				BranchWeights: branchWeights,
+				Branches:      branches,
+			},
+		})
+	}
+
+	ParseOperand = func(allowInvocations bool) ParserFunction {
+		return func(index int) ParseResult {
+			start := index
+
+			if byteAt(index) == 0x39 {
 				index++
-				innerExpressionParseResult := ParseExpressionInner(index)
-				if !innerExpressionParseResult.WasSuccessful {
+				innerParseResult := ParseOperand(allowInvocations)(index)
+				if !innerParseResult.WasSuccessful {
 					return ParserFailure(WrapIndex(index, "No expression after '!' (0x39)"))
 				}
-				return ParserSuccess(1+innerExpressionParseResult.BytesRead, compiler.AstNode{
+				return ParserSuccess(1+innerParseResult.BytesRead, compiler.AstNode{
 					Kind: compiler.AstKind_LogicalNot,
 					Data: compiler.AstData_UnaryExpression{
-						Node: innerExpressionParseResult.Node,
+						Node: innerParseResult.Node,
 					},
 				})
-			} else {
-				return ParseExpressionInner(index)
 			}
+
+			parserFunctions := []ParserFunction{
+				ParseAllArgumentsSymbol,
+				ParseFloat,
+				ParseInteger,
+				ParsePair,
+				ParseUnaryExpression,
+				ParseVector,
+				ParseStruct,
+				ParseArray,
+				ParseRandom,
+			}
+			if allowInvocations {
+				parserFunctions = append(parserFunctions, ParseInvocation)
+			}
+			parserFunctions = append(
+				parserFunctions,
+				ParseChecksum,
+				ParseString,
+			)
+
+			var parseResult ParseResult
+			for _, parserFunction := range parserFunctions {
+				parseResult = parserFunction(index)
+				if parseResult.WasSuccessful {
+					break
+				}
+			}
+			if !parseResult.WasSuccessful {
+				return ParserFailure(WrapLine(WrapIndex(index, "Bytes not recognised as an expression"), dumpBytes(index, 64)))
+			}
+			node := parseResult.Node
+			index += parseResult.BytesRead
+
+			// <array>[index]
+			if node.Kind == compiler.AstKind_LocalReference && index < numBytes && byteAt(index) == 5 {
+				if indexParseResult := ParseExpression(true)(index + 1); indexParseResult.WasSuccessful {
+					closingIndex := index + 1 + indexParseResult.BytesRead
+					if closingIndex < numBytes && byteAt(closingIndex) == 6 {
+						node = compiler.AstNode{
+							Kind: compiler.AstKind_ArrayAccess,
+							Data: compiler.AstData_ArrayAccess{
+								Array: node,
+								Index: indexParseResult.Node,
+							},
+						}
+						index = closingIndex + 1
+					}
+				}
+			}
+
+			// structure.member and object:MemberFunction
+			if index < numBytes && (byteAt(index) == 8 || byteAt(index) == 0x42) {
+				var kind compiler.AstKind = compiler.AstKind_DotExpression
+				if byteAt(index) == 0x42 {
+					kind = compiler.AstKind_ColonExpression
+				}
+				if rightSideParseResult := ParseOperand(allowInvocations)(index + 1); rightSideParseResult.WasSuccessful {
+					node = compiler.AstNode{
+						Kind: kind,
+						Data: compiler.AstData_BinaryExpression{
+							LeftNode:  node,
+							RightNode: rightSideParseResult.Node,
+						},
+					}
+					index += 1 + rightSideParseResult.BytesRead
+				}
+			}
+
+			return ParserSuccess(index-start, node)
 		}
 	}
 
+	// ParseBinaryExpression reads operands separated by binary operators, then rebuilds the tree using operator precedence.
+	// '=' is only treated as a comparison inside parentheses, elsewhere it's an assignment.
+	ParseBinaryExpression = func(allowInvocations bool, allowEquals bool) ParserFunction {
+		return func(index int) ParseResult {
+			start := index
+
+			firstParseResult := ParseOperand(allowInvocations)(index)
+			if !firstParseResult.WasSuccessful {
+				return firstParseResult
+			}
+			index += firstParseResult.BytesRead
+
+			operands := []compiler.AstNode{firstParseResult.Node}
+			var operators []byte
+			for index < numBytes {
+				operator := byteAt(index)
+				if _, ok := binaryOperators[operator]; !ok || (operator == 7 && !allowEquals) {
+					break
+				}
+				// the right side of 'and'/'or' can't be an invocation with parameters in NeverScript
+				allowRightInvocations := allowInvocations && operator != 0x32 && operator != 0x33
+				rightSideParseResult := ParseOperand(allowRightInvocations)(index + 1)
+				if !rightSideParseResult.WasSuccessful {
+					break
+				}
+				operators = append(operators, operator)
+				operands = append(operands, rightSideParseResult.Node)
+				index += 1 + rightSideParseResult.BytesRead
+			}
+
+			var nodeStack []compiler.AstNode
+			var operatorStack []byte
+			reduce := func() {
+				operator := operatorStack[len(operatorStack)-1]
+				operatorStack = operatorStack[:len(operatorStack)-1]
+				right := nodeStack[len(nodeStack)-1]
+				left := nodeStack[len(nodeStack)-2]
+				nodeStack = nodeStack[:len(nodeStack)-2]
+				nodeStack = append(nodeStack, compiler.AstNode{
+					Kind: binaryOperators[operator].Kind,
+					Data: compiler.AstData_BinaryExpression{
+						LeftNode:  left,
+						RightNode: right,
+					},
+				})
+			}
+			nodeStack = append(nodeStack, operands[0])
+			for i, operator := range operators {
+				for len(operatorStack) > 0 &&
+					binaryOperators[operatorStack[len(operatorStack)-1]].Precedence >= binaryOperators[operator].Precedence {
+					reduce()
+				}
+				operatorStack = append(operatorStack, operator)
+				nodeStack = append(nodeStack, operands[i+1])
+			}
+			for len(operatorStack) > 0 {
+				reduce()
+			}
+
+			return ParserSuccess(index-start, nodeStack[0])
+		}
+	}
+
+	ParseExpression = func(allowInvocations bool) ParserFunction {
+		return ParseBinaryExpression(allowInvocations, false)
+	}
+
 	ParseInvocation = func(index int) ParseResult {
 		start := index
 		checksumParseResult := ParseChecksum(index)
@@ -422,6 +887,9 @@ func ParseByteCode(arguments *Arguments) error {
 				break
 			}
 		}
+		if len(parameterNodes) == 0 { // a lone checksum or <local reference>
+			return checksumParseResult
+		}
 		return ParserSuccess(index-start, compiler.AstNode{
 			Kind: compiler.AstKind_Invocation,
 			Data: compiler.AstData_Invocation{
@@ -433,7 +901,7 @@ func ParseByteCode(arguments *Arguments) error {
 
 	ParseReturn = func(index int) ParseResult {
 		start := index
-		if bytes[index] != 0x29 {
+		if byteAt(index) != 0x29 {
 			return ParserFailure(WrapIndex(index, "Not a 'return' statement (expected 0x29)"))
 		}
 		index++
@@ -457,20 +925,25 @@ func ParseByteCode(arguments *Arguments) error {
 				break
 			}
 		}
-		// FIXME(brandon): I'm returning an "invocation" to save time because it uses the same syntax as 'return'.
+		// Same shape as the compiler's AST: 'return' is an invocation of a script named "return".
 		return ParserSuccess(index-start, compiler.AstNode{
-			Kind: compiler.AstKind_Invocation,
-			Data: compiler.AstData_Invocation{
-				ScriptIdentifierNode: compiler.AstNode{
-					Kind: compiler.AstKind_Checksum,
-					Data: compiler.AstData_Checksum{
-						ChecksumToken: compiler.Token{
-							Kind: compiler.TokenKind_Identifier,
-							Data: "return",
+			Kind: compiler.AstKind_Return,
+			Data: compiler.AstData_UnaryExpression{
+				Node: compiler.AstNode{
+					Kind: compiler.AstKind_Invocation,
+					Data: compiler.AstData_Invocation{
+						ScriptIdentifierNode: compiler.AstNode{
+							Kind: compiler.AstKind_Checksum,
+							Data: compiler.AstData_Checksum{
+								ChecksumToken: compiler.Token{
+									Kind: compiler.TokenKind_Return,
+									Data: "return",
+								},
+							},
 						},
+						ParameterNodes: parameterNodes,
 					},
 				},
-				ParameterNodes:       parameterNodes,
 			},
 		})
 	}
@@ -478,12 +951,12 @@ func ParseByteCode(arguments *Arguments) error {
 	ParseChecksum = func(index int) ParseResult {
 		start := index
 		isLocalReference := false
-		if bytes[index] == 0x2D {
+		if byteAt(index) == 0x2D {
 			isLocalReference = true
 			index++
 		}
-		if bytes[index] != 0x16 {
-			return ParserFailure(WrapLine(WrapIndex(index, "Checksum doesn't have 0x16"), hex.Dump(bytes[index:index+32])))
+		if byteAt(index) != 0x16 {
+			return ParserFailure(WrapLine(WrapIndex(index, "Checksum doesn't have 0x16"), dumpBytes(index, 32)))
 		}
 		index++
 		if index+4 >= numBytes {
@@ -500,7 +973,7 @@ func ParseByteCode(arguments *Arguments) error {
 		if isLocalReference {
 			node = compiler.AstNode{
 				Kind: compiler.AstKind_LocalReference,
-				Data: compiler.AstData_UnaryExpression{
+				Data: compiler.AstData_LocalReference{
 					Node: node,
 				},
 			}
@@ -509,8 +982,8 @@ func ParseByteCode(arguments *Arguments) error {
 	}
 
 	ParseFloat = func(index int) ParseResult {
-		if bytes[index] != 0x1A {
-			return ParserFailure(WrapLine(WrapIndex(index, "Float doesn't start with 0x1A"), hex.Dump(bytes[index:index+32])))
+		if byteAt(index) != 0x1A {
+			return ParserFailure(WrapLine(WrapIndex(index, "Float doesn't start with 0x1A"), dumpBytes(index, 32)))
 		}
 		index++
 		if index+4 >= numBytes {
@@ -524,9 +997,10 @@ func ParseByteCode(arguments *Arguments) error {
 		})
 	}
 
+	// Hex ints (0x18) and enums (0x19) are decompiled as regular ints.
 	ParseInteger = func(index int) ParseResult {
-		if bytes[index] != 0x17 {
-			return ParserFailure(WrapLine(WrapIndex(index, "Integer doesn't start with 0x17"), hex.Dump(bytes[index:index+32])))
+		if byteAt(index) != 0x17 && byteAt(index) != 0x18 && byteAt(index) != 0x19 {
+			return ParserFailure(WrapLine(WrapIndex(index, "Integer doesn't start with 0x17"), dumpBytes(index, 32)))
 		}
 		index++
 		if index+4 >= numBytes {
@@ -541,23 +1015,23 @@ func ParseByteCode(arguments *Arguments) error {
 	}
 
 	ParseUnaryExpression = func(index int) ParseResult {
-		if bytes[index] != 0xE {
+		if byteAt(index) != 0xE {
 			return ParserFailure("Unary expression doesn't begin with '(' (0xE)")
 		}
 		index++
 
-		expressionParseResult := ParseExpression(true)(index)
+		expressionParseResult := ParseBinaryExpression(true, true)(index)
 		if !expressionParseResult.WasSuccessful {
 			return ParserFailure(WrapLine(WrapIndex(index, "Couldn't parser inner area of unary expression"), expressionParseResult.Reason))
 		}
 		index += expressionParseResult.BytesRead
 
-		if bytes[index] != 0xF {
+		if index >= numBytes || byteAt(index) != 0xF {
 			return ParserFailure("Unary expression doesn't end with ')' (0xF)")
 		}
 		index++
 
-		return ParserSuccess(2 + expressionParseResult.BytesRead, compiler.AstNode{
+		return ParserSuccess(2+expressionParseResult.BytesRead, compiler.AstNode{
 			Kind: compiler.AstKind_UnaryExpression,
 			Data: compiler.AstData_UnaryExpression{
 				Node: expressionParseResult.Node,
@@ -566,8 +1040,8 @@ func ParseByteCode(arguments *Arguments) error {
 	}
 
 	ParsePair = func(index int) ParseResult {
-		if bytes[index] != 0x1F {
-			return ParserFailure(WrapLine(WrapIndex(index, "Pair doesn't start with 0x1F"), hex.Dump(bytes[index:index+32])))
+		if byteAt(index) != 0x1F {
+			return ParserFailure(WrapLine(WrapIndex(index, "Pair doesn't start with 0x1F"), dumpBytes(index, 32)))
 		}
 		index++
 		if index+8 >= numBytes {
@@ -581,20 +1055,22 @@ func ParseByteCode(arguments *Arguments) error {
 					Data: compiler.AstData_Float{
 						FloatBytes: bytes[index : index+4],
 					},
+					Offset: index,
 				},
 				FloatNodeB: compiler.AstNode{
 					Kind: compiler.AstKind_Float,
 					Data: compiler.AstData_Float{
 						FloatBytes: bytes[index+4 : index+8],
 					},
+					Offset: index + 4,
 				},
 			},
 		})
 	}
 
 	ParseVector = func(index int) ParseResult {
-		if bytes[index] != 0x1E {
-			return ParserFailure(WrapLine(WrapIndex(index, "Vector doesn't start with 0x1E"), hex.Dump(bytes[index:index+32])))
+		if byteAt(index) != 0x1E {
+			return ParserFailure(WrapLine(WrapIndex(index, "Vector doesn't start with 0x1E"), dumpBytes(index, 32)))
 		}
 		index++
 		if index+12 >= numBytes {
@@ -608,48 +1084,68 @@ func ParseByteCode(arguments *Arguments) error {
 					Data: compiler.AstData_Float{
 						FloatBytes: bytes[index : index+4],
 					},
+					Offset: index,
 				},
 				FloatNodeB: compiler.AstNode{
 					Kind: compiler.AstKind_Float,
 					Data: compiler.AstData_Float{
 						FloatBytes: bytes[index+4 : index+8],
 					},
+					Offset: index + 4,
 				},
 				FloatNodeC: compiler.AstNode{
 					Kind: compiler.AstKind_Float,
 					Data: compiler.AstData_Float{
 						FloatBytes: bytes[index+8 : index+12],
 					},
+					Offset: index + 8,
 				},
 			},
 		})
 	}
 
+	// Local strings (0x1C) are decompiled as regular strings, as are wide strings (0x4C) when every character is ASCII.
 	ParseString = func(index int) ParseResult {
-		if bytes[index] != 0x1B {
+		opcode := byteAt(index)
+		if opcode != 0x1B && opcode != 0x1C && opcode != 0x4C {
 			return ParserFailure(WrapIndex(index, "String doesn't start with 0x1B"))
 		}
 		index++
 		if index+4 >= numBytes {
 			return ParserFailure(WrapIndex(index+4, "Reached EOF when scanning string size"))
 		}
-		stringSize := binary.LittleEndian.Uint32(bytes[index : index+4])
+		stringSize := int(binary.LittleEndian.Uint32(bytes[index : index+4]))
 		index += 4
-		if index+int(stringSize) >= numBytes {
+		if stringSize < 0 || index+stringSize >= numBytes {
 			return ParserFailure(WrapIndex(index+4, "Reached EOF when scanning string contents"))
 		}
-		return ParserSuccess(5+int(stringSize), compiler.AstNode{
+		stringBytes := bytes[index : index+stringSize]
+		if opcode == 0x4C {
+			if stringSize%2 != 0 {
+				return ParserFailure(WrapIndex(index, "Wide string has an odd number of bytes"))
+			}
+			narrowBytes := make([]byte, stringSize/2)
+			for i := range narrowBytes {
+				if stringBytes[2*i+1] != 0 || stringBytes[2*i] >= 0x80 || stringBytes[2*i] == '"' {
+					return ParserFailure(WrapIndex(index+2*i, "Wide string has characters that can't be written in NeverScript"))
+				}
+				narrowBytes[i] = stringBytes[2*i]
+			}
+			stringBytes = narrowBytes
+		}
+		return ParserSuccess(5+stringSize, compiler.AstNode{
 			Kind: compiler.AstKind_String,
 			Data: compiler.AstData_String{
-				StringBytes: bytes[index : index+int(stringSize)],
+				StringBytes:   stringBytes,
+				IsLocalString: opcode == 0x1C,
 			},
 		})
 	}
 
 	ParseStruct = func(index int) ParseResult {
 		start := index
-		if bytes[index] != 3 {
-			return ParserFailure(WrapLine(WrapIndex(index, "Struct doesn't start with 0x3"), hex.Dump(bytes[index:index+32])))
+		if byteAt(index) != 3 {
+			return ParserFailure(WrapLine(WrapIndex(index, "Struct doesn't start with 0x3"), dumpBytes(index, 32)))
 		}
 		index++
 		var structElementNodes []compiler.AstNode
@@ -660,7 +1156,7 @@ func ParseByteCode(arguments *Arguments) error {
 			ParseExpression(true),
 		}
 		for {
-			if bytes[index] == 4 {
+			if byteAt(index) == 4 {
 				index++
 				break
 			}
@@ -675,7 +1171,7 @@ func ParseByteCode(arguments *Arguments) error {
 				}
 			}
 			if !foundElement {
-				return ParserFailure(WrapLine(WrapIndex(index, "Bytes not recognised as a struct element"), hex.Dump(bytes[index:index+32])))
+				return ParserFailure(WrapLine(WrapIndex(index, "Bytes not recognised as a struct element"), dumpBytes(index, 32)))
 			}
 		}
 
@@ -689,8 +1185,8 @@ func ParseByteCode(arguments *Arguments) error {
 
 	ParseArray = func(index int) ParseResult {
 		start := index
-		if bytes[index] != 5 {
-			return ParserFailure(WrapLine(WrapIndex(index, "Array doesn't start with 0x5"), hex.Dump(bytes[index:index+32])))
+		if byteAt(index) != 5 {
+			return ParserFailure(WrapLine(WrapIndex(index, "Array doesn't start with 0x5"), dumpBytes(index, 32)))
 		}
 		index++
 		var elements []compiler.AstNode
@@ -700,7 +1196,7 @@ func ParseByteCode(arguments *Arguments) error {
 			ParseExpression(true),
 		}
 		for {
-			if bytes[index] == 6 {
+			if byteAt(index) == 6 {
 				index++
 				break
 			}
@@ -715,7 +1211,7 @@ func ParseByteCode(arguments *Arguments) error {
 				}
 			}
 			if !foundElement {
-				return ParserFailure(WrapLine(WrapIndex(index, "Bytes not recognised as an array element"), hex.Dump(bytes[index:index+32])))
+				return ParserFailure(WrapLine(WrapIndex(index, "Bytes not recognised as an array element"), dumpBytes(index, 32)))
 			}
 		}
 
@@ -728,7 +1224,7 @@ func ParseByteCode(arguments *Arguments) error {
 	}
 
 	ParseAllArgumentsSymbol = func(index int) ParseResult {
-		if bytes[index] != 0x2C {
+		if byteAt(index) != 0x2C {
 			return ParserFailure("Not an AllArgumentsSymbol (<...>) (0x2C)")
 		}
 		return ParserSuccess(1, compiler.AstNode{
@@ -740,8 +1236,8 @@ func ParseByteCode(arguments *Arguments) error {
 	ParseNameTableEntry = func(index int) ParseResult {
 		start := index
 
-		if bytes[index] != 0x2B {
-			return ParserFailure(WrapLine(WrapIndex(index, "Name table entry doesn't start with 0x2B"), hex.Dump(bytes[index:index+32])))
+		if byteAt(index) != 0x2B {
+			return ParserFailure(WrapLine(WrapIndex(index, "Name table entry doesn't start with 0x2B"), dumpBytes(index, 32)))
 		}
 		index++
 
@@ -754,7 +1250,10 @@ func ParseByteCode(arguments *Arguments) error {
 		nameStart := index
 		var name string
 		for {
-			if bytes[index] == 0 {
+			if index >= numBytes {
+				return ParserFailure(WrapIndex(index, "Reached EOF when reading name for name table entry"))
+			}
+			if byteAt(index) == 0 {
 				index++
 				name = string(bytes[nameStart : index-1])
 				break
@@ -771,16 +1270,25 @@ func ParseByteCode(arguments *Arguments) error {
 		})
 	}
 
-	ParseBodyOfCode = func(index *int) []compiler.AstNode {
-		var bodyNodes []compiler.AstNode
-		parserFunctions := []ParserFunction{
+	bodyOfCodeParserFunctions = func() []ParserFunction {
+		return []ParserFunction{
 			ParseNewLine,
-			ParseAssignment,
+			ParseLineNumber,
+			ParseBreak,
+			ParseReturn,
 			ParseIfStatement,
+			ParseOldIfStatement,
+			ParseSwitch,
+			ParseWhileLoop,
+			ParseAssignment,
 			ParseExpression(true),
-			ParseReturn,
 		}
-		for {
+	}
+
+	ParseBodyOfCode = func(index *int) []compiler.AstNode {
+		var bodyNodes []compiler.AstNode
+		parserFunctions := bodyOfCodeParserFunctions()
+		for *index < numBytes {
 			foundSomething := false
 			for _, parserFunction := range parserFunctions {
 				parseResult := parserFunction(*index)
@@ -798,6 +1306,58 @@ func ParseByteCode(arguments *Arguments) error {
 		return bodyNodes
 	}
 
+	// ParseBodyOfCodeUntil parses a body of code that must end exactly at 'end'.
+	ParseBodyOfCodeUntil = func(index *int, end int) ([]compiler.AstNode, bool) {
+		var bodyNodes []compiler.AstNode
+		parserFunctions := bodyOfCodeParserFunctions()
+		for *index < end {
+			foundSomething := false
+			for _, parserFunction := range parserFunctions {
+				parseResult := parserFunction(*index)
+				if parseResult.WasSuccessful && *index+parseResult.BytesRead <= end {
+					foundSomething = true
+					bodyNodes = append(bodyNodes, parseResult.Node)
+					*index += parseResult.BytesRead
+					break
+				}
+			}
+			if !foundSomething {
+				return bodyNodes, false
+			}
+		}
+		return bodyNodes, *index == end
+	}
+
+	// every node records where it starts, so problems found in the tree can point at its bytes
+	recordOffset := func(parserFunction ParserFunction) ParserFunction {
+		return func(index int) ParseResult {
+			parseResult := parserFunction(index)
+			if parseResult.WasSuccessful {
+				parseResult.Node.Offset = index
+			}
+			return parseResult
+		}
+	}
+	for _, parserFunction := range []*ParserFunction{
+		&ParseRoot, &ParseRootBodyNode, &ParseEndOfFile, &ParseNewLine, &ParseLineNumber, &ParseComma,
+		&ParseAssignment, &ParseScript, &ParseIfStatement, &ParseOldIfStatement, &ParseSwitch, &ParseWhileLoop,
+		&ParseBreak, &ParseRandom, &ParseInvocation, &ParseReturn, &ParseChecksum, &ParseFloat, &ParseInteger,
+		&ParseUnaryExpression, &ParsePair, &ParseVector, &ParseString, &ParseStruct, &ParseArray,
+		&ParseAllArgumentsSymbol, &ParseNameTableEntry,
+	} {
+		*parserFunction = recordOffset(*parserFunction)
+	}
+	parseOperand, parseExpression, parseBinaryExpression := ParseOperand, ParseExpression, ParseBinaryExpression
+	ParseOperand = func(allowInvocations bool) ParserFunction {
+		return recordOffset(parseOperand(allowInvocations))
+	}
+	ParseExpression = func(allowInvocations bool) ParserFunction {
+		return recordOffset(parseExpression(allowInvocations))
+	}
+	ParseBinaryExpression = func(allowInvocations bool, allowEquals bool) ParserFunction {
+		return recordOffset(parseBinaryExpression(allowInvocations, allowEquals))
+	}
+
 	parseResult := ParseRoot(0)
 	if !parseResult.WasSuccessful {
 		return errors.New(parseResult.Reason)
@@ -807,6 +1367,21 @@ func ParseByteCode(arguments *Arguments) error {
 	return nil
 }
 
+// describeSkippedBytes explains why bytes couldn't be decompiled, when it's because of something neither syntax can write.
+func describeSkippedBytes(byteCode []byte, start, end int) string {
+	for index := start; index < end; {
+		instruction, err := disassembler.DecodeInstruction(byteCode, index)
+		if err != nil {
+			break
+		}
+		if instruction.Opcode == 0x35 || instruction.Opcode == 0x36 { // shift left and right
+			return " (shift operators can't be decompiled)"
+		}
+		index = instruction.End()
+	}
+	return ""
+}
+
 func WrapLine(outer, inner string) string {
 	return fmt.Sprintf("%s:\n%s", outer, inner)
 }
@@ -0,0 +1,169 @@
+package disassembler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type DisassemblyArguments struct {
+	ByteCode  []byte
+	NameTable map[uint32]string // optional, names found in the file are always used
+}
+
+// Disassemble produces qbasm: one instruction per line, with symbolic labels for jump targets.
+// Feeding the result to assembler.Assemble reproduces the original bytes exactly.
+func Disassemble(arguments DisassemblyArguments) string {
+	bytes := arguments.ByteCode
+
+	nameTable := ScrapeNameTable(bytes)
+	for checksum, name := range arguments.NameTable {
+		nameTable[checksum] = name
+	}
+
+	type line struct {
+		Offset      int
+		Size        int
+		Instruction Instruction
+		IsRaw       bool // written as a 'bytes' directive
+		IsUnknown   bool // couldn't be decoded, so consecutive unknown bytes are grouped together
+	}
+
+	// decode everything up front so we know where the instruction boundaries are
+	var lines []line
+	isBoundary := map[int]bool{len(bytes): true}
+	index := 0
+	for index < len(bytes) {
+		instruction, err := DecodeInstruction(bytes, index)
+		if err != nil {
+			if numLines := len(lines); numLines > 0 && lines[numLines-1].IsUnknown {
+				lines[numLines-1].Size++
+			} else {
+				isBoundary[index] = true
+				lines = append(lines, line{Offset: index, Size: 1, IsRaw: true, IsUnknown: true})
+			}
+			index++
+			continue
+		}
+		isBoundary[index] = true
+		lines = append(lines, line{
+			Offset:      index,
+			Size:        instruction.Size(),
+			Instruction: instruction,
+			IsRaw:       instruction.Opcode == Opcode_InlineStruct,
+		})
+		index = instruction.End()
+	}
+
+	labels := make(map[int]string)
+	for _, l := range lines {
+		for _, target := range l.Instruction.JumpTargets {
+			if isBoundary[target] {
+				labels[target] = Label(target)
+			}
+		}
+	}
+
+	jump := func(raw int, target int) string {
+		if label, ok := labels[target]; ok {
+			return "@" + label
+		}
+		return fmt.Sprintf("%+#x", raw)
+	}
+
+	var code strings.Builder
+	writeLine := func(offset int, text string, comment string) {
+		row := fmt.Sprintf("    %-40s ; %08x", text, offset)
+		if comment != "" {
+			row += "  " + comment
+		}
+		code.WriteString(row)
+		code.WriteString("\n")
+	}
+	writeLabel := func(offset int) {
+		if label, ok := labels[offset]; ok {
+			code.WriteString(label + ":\n")
+		}
+	}
+
+	for _, l := range lines {
+		writeLabel(l.Offset)
+
+		if l.IsRaw {
+			hexBytes := make([]string, l.Size)
+			for i, b := range bytes[l.Offset : l.Offset+l.Size] {
+				hexBytes[i] = fmt.Sprintf("%02x", b)
+			}
+			writeLine(l.Offset, "bytes "+strings.Join(hexBytes, " "), "")
+			continue
+		}
+
+		instruction := l.Instruction
+		mnemonic := Opcodes[instruction.Opcode].Mnemonic
+		text := mnemonic
+		comment := ""
+		switch Opcodes[instruction.Opcode].Operands {
+		case Operands_Uint16:
+			text += " " + jump(int(instruction.Uint16), instruction.JumpTargets[0])
+		case Operands_Uint32:
+			switch instruction.Opcode {
+			case Opcode_Checksum:
+				text += fmt.Sprintf(" #%08X", instruction.Uint32)
+				comment = nameTable[instruction.Uint32]
+			case Opcode_LongJump:
+				text += " " + jump(int(int32(instruction.Uint32)), instruction.JumpTargets[0])
+			case Opcode_HexInteger:
+				text += fmt.Sprintf(" %#08x", instruction.Uint32)
+			case Opcode_LineNumber:
+				text += fmt.Sprintf(" %d", instruction.Uint32)
+			default:
+				text += fmt.Sprintf(" %d", int32(instruction.Uint32))
+			}
+		case Operands_Float, Operands_Pair, Operands_Vector:
+			for _, f := range instruction.Floats {
+				text += " " + FormatExactFloat(f)
+			}
+		case Operands_SizedString:
+			stringBytes := instruction.Bytes[5:]
+			if len(stringBytes) == 0 || stringBytes[len(stringBytes)-1] != 0 {
+				text += " unterminated"
+			}
+			text += " " + strconv.Quote(instruction.Text)
+		case Operands_NameTableEntry:
+			text += fmt.Sprintf(" #%08X %s", instruction.Uint32, strconv.Quote(instruction.Text))
+		case Operands_Random:
+			numBranches := len(instruction.Weights)
+			for i, weight := range instruction.Weights {
+				endOfOffset := instruction.Offset + 5 + 2*numBranches + 4*(i+1)
+				raw := instruction.JumpTargets[i] - endOfOffset
+				text += fmt.Sprintf(" %d:%s", weight, jump(raw, instruction.JumpTargets[i]))
+			}
+		}
+		writeLine(l.Offset, text, comment)
+	}
+	writeLabel(len(bytes))
+
+	return code.String()
+}
+
+func Label(offset int) string {
+	return fmt.Sprintf("L%08x", offset)
+}
+
+// FormatExactFloat renders a float so that parsing it again gives back the same bits.
+func FormatExactFloat(f float32) string {
+	if math.IsNaN(float64(f)) {
+		return fmt.Sprintf("%#08x", math.Float32bits(f))
+	}
+	return strconv.FormatFloat(float64(f), 'g', -1, 32)
+}
+
+// MnemonicToOpcode is the reverse of the Mnemonic column in Opcodes.
+func MnemonicToOpcode() map[string]byte {
+	opcodes := make(map[string]byte, len(Opcodes))
+	for opcode, info := range Opcodes {
+		opcodes[info.Mnemonic] = opcode
+	}
+	return opcodes
+}
@@ -0,0 +1,215 @@
+package disassembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+type Instruction struct {
+	Offset int
+	Opcode byte
+	Bytes  []byte // the whole instruction, including the opcode
+
+	Uint32      uint32    // checksums, ints, line numbers, long jump offsets
+	Uint16      uint16    // if/else/short jump offsets
+	Floats      []float32 // floats, pairs and vectors
+	Text        string    // strings (without the null terminator) and name table entries
+	Weights     []uint16  // random branch weights
+	JumpTargets []int     // absolute offsets that this instruction can jump to
+}
+
+func (instruction Instruction) Size() int {
+	return len(instruction.Bytes)
+}
+
+func (instruction Instruction) End() int {
+	return instruction.Offset + len(instruction.Bytes)
+}
+
+func (instruction Instruction) Name() string {
+	if info, ok := Opcodes[instruction.Opcode]; ok {
+		return info.Name
+	}
+	return fmt.Sprintf("unknown opcode %#02x", instruction.Opcode)
+}
+
+func DecodeInstruction(bytes []byte, index int) (Instruction, error) {
+	if index < 0 || index >= len(bytes) {
+		return Instruction{}, fmt.Errorf("[%#X] No instruction to decode (file is %#X bytes)", index, len(bytes))
+	}
+
+	opcode := bytes[index]
+	info, ok := Opcodes[opcode]
+	if !ok {
+		return Instruction{}, fmt.Errorf("[%#X] Unknown opcode %#02x", index, opcode)
+	}
+
+	instruction := Instruction{
+		Offset: index,
+		Opcode: opcode,
+	}
+
+	end := index + 1
+	need := func(size int) error {
+		if end+size > len(bytes) {
+			return fmt.Errorf("[%#X] Reached EOF when reading operands of '%s' (needed %d more bytes)", index, info.Name, end+size-len(bytes))
+		}
+		return nil
+	}
+	readUint16 := func() uint16 {
+		value := binary.LittleEndian.Uint16(bytes[end:])
+		end += 2
+		return value
+	}
+	readUint32 := func() uint32 {
+		value := binary.LittleEndian.Uint32(bytes[end:])
+		end += 4
+		return value
+	}
+	readFloats := func(count int) error {
+		if err := need(4 * count); err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			instruction.Floats = append(instruction.Floats, math.Float32frombits(readUint32()))
+		}
+		return nil
+	}
+
+	switch info.Operands {
+	case Operands_None:
+	case Operands_Uint16:
+		if err := need(2); err != nil {
+			return Instruction{}, err
+		}
+		instruction.Uint16 = readUint16()
+		if opcode == Opcode_If || opcode == Opcode_Else || opcode == Opcode_ShortJump {
+			// relative to the start of the offset
+			instruction.JumpTargets = []int{index + 1 + int(instruction.Uint16)}
+		}
+	case Operands_Uint32:
+		if err := need(4); err != nil {
+			return Instruction{}, err
+		}
+		instruction.Uint32 = readUint32()
+		if opcode == Opcode_LongJump {
+			// relative to the end of the offset
+			instruction.JumpTargets = []int{end + int(int32(instruction.Uint32))}
+		}
+	case Operands_Float:
+		if err := readFloats(1); err != nil {
+			return Instruction{}, err
+		}
+	case Operands_Pair:
+		if err := readFloats(2); err != nil {
+			return Instruction{}, err
+		}
+	case Operands_Vector:
+		if err := readFloats(3); err != nil {
+			return Instruction{}, err
+		}
+	case Operands_SizedString:
+		if err := need(4); err != nil {
+			return Instruction{}, err
+		}
+		size := readUint32()
+		if err := need(int(size)); err != nil {
+			return Instruction{}, fmt.Errorf("[%#X] String size %#X runs past EOF", index, size)
+		}
+		instruction.Uint32 = size
+		instruction.Text = string(bytes[end : end+int(size)])
+		if size > 0 && bytes[end+int(size)-1] == 0 {
+			instruction.Text = instruction.Text[:size-1]
+		}
+		end += int(size)
+	case Operands_NameTableEntry:
+		if err := need(4); err != nil {
+			return Instruction{}, err
+		}
+		instruction.Uint32 = readUint32()
+		nameStart := end
+		for {
+			if end >= len(bytes) {
+				return Instruction{}, fmt.Errorf("[%#X] Name table entry isn't null-terminated", index)
+			}
+			if bytes[end] == 0 {
+				break
+			}
+			end++
+		}
+		instruction.Text = string(bytes[nameStart:end])
+		end++
+	case Operands_Random:
+		if err := need(4); err != nil {
+			return Instruction{}, err
+		}
+		count := readUint32()
+		if err := need(6 * int(count)); err != nil {
+			return Instruction{}, fmt.Errorf("[%#X] Random with %d branches runs past EOF", index, count)
+		}
+		instruction.Uint32 = count
+		for i := 0; i < int(count); i++ {
+			instruction.Weights = append(instruction.Weights, readUint16())
+		}
+		for i := 0; i < int(count); i++ {
+			offset := readUint32()
+			// relative to the end of each offset
+			instruction.JumpTargets = append(instruction.JumpTargets, end+int(int32(offset)))
+		}
+	case Operands_InlineStruct:
+		if err := need(2); err != nil {
+			return Instruction{}, err
+		}
+		size := readUint16()
+		for end%4 != 0 {
+			end++
+		}
+		if err := need(int(size)); err != nil {
+			return Instruction{}, err
+		}
+		instruction.Uint16 = size
+		end += int(size)
+	}
+
+	instruction.Bytes = bytes[index:end]
+	return instruction, nil
+}
+
+// ScrapeNameTable collects the names stored in the file's own name table entries (0x2B).
+func ScrapeNameTable(bytes []byte) map[uint32]string {
+	nameTable := make(map[uint32]string)
+	index := 0
+	for index < len(bytes) {
+		instruction, err := DecodeInstruction(bytes, index)
+		if err != nil {
+			index++
+			continue
+		}
+		if instruction.Opcode == Opcode_NameTableEntry {
+			nameTable[instruction.Uint32] = instruction.Text
+		}
+		index = instruction.End()
+	}
+	return nameTable
+}
+
+// ScrapeChecksums collects every checksum used by the file's code (0x16), without duplicates, in the order they're used.
+func ScrapeChecksums(bytes []byte) []uint32 {
+	var checksums []uint32
+	seen := make(map[uint32]bool)
+	index := 0
+	for index < len(bytes) {
+		instruction, err := DecodeInstruction(bytes, index)
+		if err != nil {
+			index++
+			continue
+		}
+		if instruction.Opcode == Opcode_Checksum && !seen[instruction.Uint32] {
+			seen[instruction.Uint32] = true
+			checksums = append(checksums, instruction.Uint32)
+		}
+		index = instruction.End()
+	}
+	return checksums
+}
@@ -0,0 +1,136 @@
+package disassembler
+
+import (
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"strconv"
+	"strings"
+)
+
+const listingBytesPerRow = 8
+
+type ListingArguments struct {
+	ByteCode    []byte
+	NameTable   map[uint32]string   // optional, names found in the file are always used
+	SourceMap   *compiler.SourceMap // optional
+	SourceLines []string            // optional, used with SourceMap
+}
+
+// MakeListing renders every instruction with its offset, bytes, meaning and (when known) the source line that produced it.
+func MakeListing(arguments ListingArguments) string {
+	bytes := arguments.ByteCode
+
+	nameTable := ScrapeNameTable(bytes)
+	for checksum, name := range arguments.NameTable {
+		nameTable[checksum] = name
+	}
+
+	var listing strings.Builder
+	writeRow := func(offset int, rowBytes []byte, description string, source string) {
+		hexBytes := make([]string, len(rowBytes))
+		for i, b := range rowBytes {
+			hexBytes[i] = fmt.Sprintf("%02x", b)
+		}
+		row := fmt.Sprintf("%08x  %-*s  %-44s  %s", offset, listingBytesPerRow*3-1, strings.Join(hexBytes, " "), description, source)
+		listing.WriteString(strings.TrimRight(row, " "))
+		listing.WriteString("\n")
+	}
+
+	lastLineNumber := 0
+	index := 0
+	for index < len(bytes) {
+		source := ""
+		if arguments.SourceMap != nil {
+			if entry, found := arguments.SourceMap.Lookup(index); found && entry.LineNumber != lastLineNumber {
+				lastLineNumber = entry.LineNumber
+				source = fmt.Sprintf("%4d | ", entry.LineNumber)
+				if entry.LineNumber >= 1 && entry.LineNumber <= len(arguments.SourceLines) {
+					source += strings.TrimSpace(arguments.SourceLines[entry.LineNumber-1])
+				}
+			}
+		}
+
+		instruction, err := DecodeInstruction(bytes, index)
+		if err != nil {
+			writeRow(index, bytes[index:index+1], "?? "+err.Error(), source)
+			index++
+			continue
+		}
+
+		description := DescribeInstruction(instruction, nameTable)
+		for i := 0; i < instruction.Size(); i += listingBytesPerRow {
+			end := i + listingBytesPerRow
+			if end > instruction.Size() {
+				end = instruction.Size()
+			}
+			writeRow(instruction.Offset+i, instruction.Bytes[i:end], description, source)
+			description = ""
+			source = ""
+		}
+		index = instruction.End()
+	}
+
+	return listing.String()
+}
+
+func DescribeInstruction(instruction Instruction, nameTable map[uint32]string) string {
+	jumpOffset := func(offset int, target int) string {
+		return fmt.Sprintf("%+#x (-> %08x)", offset, target)
+	}
+
+	switch instruction.Opcode {
+	case Opcode_Checksum:
+		return "checksum " + DescribeChecksum(instruction.Uint32, nameTable)
+	case Opcode_Integer, Opcode_Enum:
+		return fmt.Sprintf("%s %d", instruction.Name(), int32(instruction.Uint32))
+	case Opcode_HexInteger:
+		return fmt.Sprintf("%s %#08x", instruction.Name(), instruction.Uint32)
+	case Opcode_LineNumber:
+		return fmt.Sprintf("%s %d", instruction.Name(), instruction.Uint32)
+	case Opcode_Float, Opcode_Pair, Opcode_Vector:
+		floats := make([]string, len(instruction.Floats))
+		for i, f := range instruction.Floats {
+			floats[i] = formatFloat(f)
+		}
+		if len(floats) == 1 {
+			return fmt.Sprintf("%s %s", instruction.Name(), floats[0])
+		}
+		return fmt.Sprintf("%s (%s)", instruction.Name(), strings.Join(floats, ", "))
+	case Opcode_String, Opcode_LocalString, Opcode_WideString:
+		return fmt.Sprintf("%s %q", instruction.Name(), instruction.Text)
+	case Opcode_NameTableEntry:
+		return fmt.Sprintf("%s #%08X = %q", instruction.Name(), instruction.Uint32, instruction.Text)
+	case Opcode_If, Opcode_Else, Opcode_ShortJump:
+		return fmt.Sprintf("%s-offset %s", instruction.Name(), jumpOffset(int(instruction.Uint16), instruction.JumpTargets[0]))
+	case Opcode_LongJump:
+		return fmt.Sprintf("%s-offset %s", instruction.Name(), jumpOffset(int(int32(instruction.Uint32)), instruction.JumpTargets[0]))
+	case Opcode_Random, Opcode_Random2, Opcode_RandomNoRepeat, Opcode_RandomPermute:
+		weights := make([]string, len(instruction.Weights))
+		for i, weight := range instruction.Weights {
+			weights[i] = strconv.Itoa(int(weight))
+		}
+		offsets := make([]string, len(instruction.JumpTargets))
+		for i, target := range instruction.JumpTargets {
+			offsets[i] = fmt.Sprintf("%08x", target)
+		}
+		return fmt.Sprintf("%s %d branches, weights [%s], branches at [%s]", instruction.Name(), len(instruction.Weights), strings.Join(weights, " "), strings.Join(offsets, " "))
+	case Opcode_InlineStruct:
+		return fmt.Sprintf("%s (%d bytes)", instruction.Name(), instruction.Uint16)
+	}
+	return instruction.Name()
+}
+
+func DescribeChecksum(checksum uint32, nameTable map[uint32]string) string {
+	if name, ok := nameTable[checksum]; ok {
+		return fmt.Sprintf("#%08X (%s)", checksum, name)
+	}
+	return fmt.Sprintf("#%08X", checksum)
+}
+
+func formatFloat(f float32) string {
+	result := strconv.FormatFloat(float64(f), 'f', -1, 32)
+	if !strings.Contains(result, ".") {
+		result += ".0"
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+package disassembler_test
+
+import (
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"strings"
+	"testing"
+)
+
+func TestMakeListing(t *testing.T) {
+	sourceCode := "x = 1\nscript Foo {\n    y = \"a long string\"\n}\n"
+	var lexer compiler.Lexer
+	var parser compiler.Parser
+	if err := compiler.ParseSourceCode(sourceCode, false, &lexer, &parser); err != nil {
+		t.Fatal(err)
+	}
+	bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: parser.Result.Node, SourceMap: &compiler.SourceMap{}}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+
+	listing := disassembler.MakeListing(disassembler.ListingArguments{
+		ByteCode:    bytecodeCompiler.Bytes,
+		SourceMap:   bytecodeCompiler.SourceMap,
+		SourceLines: strings.Split(sourceCode, "\n"),
+	})
+	// source lines are only shown when they change, and long instructions wrap onto more rows
+	expected := `00000000  01                       newline
+00000001  16 7c e9 23 73           checksum #7323E97C (x)                           1 | x = 1
+00000006  07                       equals
+00000007  17 01 00 00 00           int 1
+0000000c  01                       newline
+0000000d  23                       script begin                                     2 | script Foo {
+0000000e  16 de 9a 8c 73           checksum #738C9ADE (Foo)
+00000013  01                       newline
+00000014  16 ea d9 24 04           checksum #0424D9EA (y)                           3 | y = "a long string"
+00000019  07                       equals
+0000001a  1b 0e 00 00 00 61 20 6c  string "a long string"
+00000022  6f 6e 67 20 73 74 72 69
+0000002a  6e 67 00
+0000002d  01                       newline                                          2 | script Foo {
+0000002e  24                       script end
+0000002f  01                       newline
+00000030  2b 7c e9 23 73 78 00     name table entry #7323E97C = "x"
+00000037  2b de 9a 8c 73 46 6f 6f  name table entry #738C9ADE = "Foo"
+0000003f  00
+00000040  2b ea d9 24 04 79 00     name table entry #0424D9EA = "y"
+00000047  00                       end of file
+`
+	if listing != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, listing)
+	}
+}
+
+// Without a source map or a name table, names come from the arguments, and bytes that can't be decoded get a row each.
+func TestMakeListingWithoutSourceMap(t *testing.T) {
+	listing := disassembler.MakeListing(disassembler.ListingArguments{
+		ByteCode:  []byte{0x16, 0xDE, 0x9A, 0x8C, 0x73, 0xFF, 0x16, 0x7C, 0xE9, 0x23, 0x73},
+		NameTable: map[uint32]string{0x738C9ADE: "Foo"},
+	})
+	expected := `00000000  16 de 9a 8c 73           checksum #738C9ADE (Foo)
+00000005  ff                       ?? [0X5] Unknown opcode 0xff
+00000006  16 7c e9 23 73           checksum #7323E97C
+`
+	if listing != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, listing)
+	}
+}
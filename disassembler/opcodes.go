@@ -0,0 +1,153 @@
+package disassembler
+
+type OperandLayout int
+
+const (
+	Operands_None           OperandLayout = iota
+	Operands_Uint16                       // 2 bytes
+	Operands_Uint32                       // 4 bytes
+	Operands_Float                        // 4 bytes
+	Operands_Pair                         // 8 bytes
+	Operands_Vector                       // 12 bytes
+	Operands_SizedString                  // 4 byte size, then the string (including the null terminator)
+	Operands_NameTableEntry               // 4 byte checksum, then a null-terminated string
+	Operands_Random                       // 4 byte count, then 2 byte weights, then 4 byte offsets
+	Operands_InlineStruct                 // 2 byte size, then padding up to a 4 byte boundary, then the packed struct
+)
+
+type OpcodeInfo struct {
+	Name     string // used in listings
+	Mnemonic string // used in qbasm
+	Operands OperandLayout
+}
+
+const (
+	Opcode_EndOfFile        = 0x00
+	Opcode_NewLine          = 0x01
+	Opcode_LineNumber       = 0x02
+	Opcode_StructBegin      = 0x03
+	Opcode_StructEnd        = 0x04
+	Opcode_ArrayBegin       = 0x05
+	Opcode_ArrayEnd         = 0x06
+	Opcode_Equals           = 0x07
+	Opcode_Dot              = 0x08
+	Opcode_Comma            = 0x09
+	Opcode_Minus            = 0x0A
+	Opcode_Add              = 0x0B
+	Opcode_Divide           = 0x0C
+	Opcode_Multiply         = 0x0D
+	Opcode_OpenParenthesis  = 0x0E
+	Opcode_CloseParenthesis = 0x0F
+	Opcode_Checksum         = 0x16
+	Opcode_Integer          = 0x17
+	Opcode_HexInteger       = 0x18
+	Opcode_Enum             = 0x19
+	Opcode_Float            = 0x1A
+	Opcode_String           = 0x1B
+	Opcode_LocalString      = 0x1C
+	Opcode_Vector           = 0x1E
+	Opcode_Pair             = 0x1F
+	Opcode_WhileBegin       = 0x20
+	Opcode_WhileEnd         = 0x21
+	Opcode_Break            = 0x22
+	Opcode_ScriptBegin      = 0x23
+	Opcode_ScriptEnd        = 0x24
+	Opcode_IfOld            = 0x25
+	Opcode_ElseOld          = 0x26
+	Opcode_ElseIfOld        = 0x27
+	Opcode_EndIf            = 0x28
+	Opcode_Return           = 0x29
+	Opcode_NameTableEntry   = 0x2B
+	Opcode_AllArguments     = 0x2C
+	Opcode_LocalReference   = 0x2D
+	Opcode_LongJump         = 0x2E
+	Opcode_Random           = 0x2F
+	Opcode_Random2          = 0x37
+	Opcode_Not              = 0x39
+	Opcode_RandomNoRepeat   = 0x40
+	Opcode_RandomPermute    = 0x41
+	Opcode_Colon            = 0x42
+	Opcode_If               = 0x47
+	Opcode_Else             = 0x48
+	Opcode_ShortJump        = 0x49
+	Opcode_InlineStruct     = 0x4A
+	Opcode_WideString       = 0x4C
+)
+
+// Opcodes used by THPS3 - THUG Pro, as documented by the community (see Gone's bytecode documentation).
+var Opcodes = map[byte]OpcodeInfo{
+	0x00: {"end of file", "end_of_file", Operands_None},
+	0x01: {"newline", "newline", Operands_None},
+	0x02: {"line number", "line_number", Operands_Uint32},
+	0x03: {"struct begin", "struct_begin", Operands_None},
+	0x04: {"struct end", "struct_end", Operands_None},
+	0x05: {"array begin", "array_begin", Operands_None},
+	0x06: {"array end", "array_end", Operands_None},
+	0x07: {"equals", "equals", Operands_None},
+	0x08: {"dot", "dot", Operands_None},
+	0x09: {"comma", "comma", Operands_None},
+	0x0A: {"minus", "minus", Operands_None},
+	0x0B: {"add", "add", Operands_None},
+	0x0C: {"divide", "divide", Operands_None},
+	0x0D: {"multiply", "multiply", Operands_None},
+	0x0E: {"open parenthesis", "open_parenthesis", Operands_None},
+	0x0F: {"close parenthesis", "close_parenthesis", Operands_None},
+	0x10: {"debug info", "debug_info", Operands_None},
+	0x11: {"same as", "same_as", Operands_None},
+	0x12: {"less than", "less_than", Operands_None},
+	0x13: {"less than equal", "less_than_equal", Operands_None},
+	0x14: {"greater than", "greater_than", Operands_None},
+	0x15: {"greater than equal", "greater_than_equal", Operands_None},
+	0x16: {"checksum", "checksum", Operands_Uint32},
+	0x17: {"int", "int", Operands_Uint32},
+	0x18: {"hex int", "hex_int", Operands_Uint32},
+	0x19: {"enum", "enum", Operands_Uint32},
+	0x1A: {"float", "float", Operands_Float},
+	0x1B: {"string", "string", Operands_SizedString},
+	0x1C: {"local string", "local_string", Operands_SizedString},
+	0x1D: {"array", "array", Operands_None},
+	0x1E: {"vector", "vector", Operands_Vector},
+	0x1F: {"pair", "pair", Operands_Pair},
+	0x20: {"while begin", "while_begin", Operands_None},
+	0x21: {"while end", "while_end", Operands_None},
+	0x22: {"break", "break", Operands_None},
+	0x23: {"script begin", "script_begin", Operands_None},
+	0x24: {"script end", "script_end", Operands_None},
+	0x25: {"if (old)", "if_old", Operands_None},
+	0x26: {"else (old)", "else_old", Operands_None},
+	0x27: {"else if (old)", "else_if_old", Operands_None},
+	0x28: {"end if", "end_if", Operands_None},
+	0x29: {"return", "return", Operands_None},
+	0x2A: {"undefined", "undefined", Operands_None},
+	0x2B: {"name table entry", "name_table_entry", Operands_NameTableEntry},
+	0x2C: {"all arguments", "all_arguments", Operands_None},
+	0x2D: {"local reference", "local_reference", Operands_None},
+	0x2E: {"long jump", "long_jump", Operands_Uint32},
+	0x2F: {"random", "random", Operands_Random},
+	0x30: {"random range", "random_range", Operands_None},
+	0x31: {"at", "at", Operands_None},
+	0x32: {"or", "or", Operands_None},
+	0x33: {"and", "and", Operands_None},
+	0x34: {"xor", "xor", Operands_None},
+	0x35: {"shift left", "shift_left", Operands_None},
+	0x36: {"shift right", "shift_right", Operands_None},
+	0x37: {"random 2", "random_2", Operands_Random},
+	0x38: {"random range 2", "random_range_2", Operands_None},
+	0x39: {"not", "not", Operands_None},
+	0x3A: {"and (keyword)", "and_keyword", Operands_None},
+	0x3B: {"or (keyword)", "or_keyword", Operands_None},
+	0x3C: {"switch", "switch", Operands_None},
+	0x3D: {"end switch", "end_switch", Operands_None},
+	0x3E: {"case", "case", Operands_None},
+	0x3F: {"default", "default", Operands_None},
+	0x40: {"random no repeat", "random_no_repeat", Operands_Random},
+	0x41: {"random permute", "random_permute", Operands_Random},
+	0x42: {"colon", "colon", Operands_None},
+	0x43: {"runtime c function", "runtime_c_function", Operands_Uint32},
+	0x44: {"runtime member function", "runtime_member_function", Operands_Uint32},
+	0x47: {"if", "if", Operands_Uint16},
+	0x48: {"else", "else", Operands_Uint16},
+	0x49: {"short jump", "short_jump", Operands_Uint16},
+	0x4A: {"inline struct", "inline_struct", Operands_InlineStruct},
+	0x4C: {"wide string", "wide_string", Operands_SizedString},
+}
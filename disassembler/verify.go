@@ -0,0 +1,176 @@
+package disassembler
+
+import (
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+)
+
+// Verify checks the structure of a QB file without decompiling it: that every instruction decodes, brackets and
+// blocks are balanced, jumps land on instructions, random branches are laid out the way the game expects, name table
+// entries are well-formed, and the file ends with a single end of file.
+// An empty result means the file looks safe to load.
+func Verify(bytes []byte) []error {
+	var problems []error
+	report := func(offset int, format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf("[%#X] %s", offset, fmt.Sprintf(format, args...)))
+	}
+
+	var instructions []Instruction
+	isBoundary := map[int]bool{len(bytes): true}
+	index := 0
+	for index < len(bytes) {
+		instruction, err := DecodeInstruction(bytes, index)
+		if err != nil {
+			// nothing after this can be trusted
+			return append(problems, err)
+		}
+		isBoundary[index] = true
+		instructions = append(instructions, instruction)
+		index = instruction.End()
+	}
+
+	if len(instructions) == 0 {
+		report(0, "File is empty (expected at least an end of file)")
+		return problems
+	}
+	if last := instructions[len(instructions)-1]; last.Opcode != Opcode_EndOfFile {
+		report(last.Offset, "File doesn't end with an end of file (found '%s')", last.Name())
+	}
+
+	closers := map[byte]byte{
+		Opcode_StructBegin:     Opcode_StructEnd,
+		Opcode_ArrayBegin:      Opcode_ArrayEnd,
+		Opcode_OpenParenthesis: Opcode_CloseParenthesis,
+		Opcode_ScriptBegin:     Opcode_ScriptEnd,
+		Opcode_WhileBegin:      Opcode_WhileEnd,
+		Opcode_If:              Opcode_EndIf,
+		Opcode_Else:            Opcode_EndIf,
+		Opcode_IfOld:           Opcode_EndIf,
+		Opcode_ElseOld:         Opcode_EndIf,
+		Opcode_ElseIfOld:       Opcode_EndIf,
+	}
+	isCloser := make(map[byte]bool)
+	for _, closer := range closers {
+		isCloser[closer] = true
+	}
+	var openers []Instruction
+	isIf := func(opcode byte) bool {
+		return opcode == Opcode_If || opcode == Opcode_IfOld || opcode == Opcode_ElseIfOld
+	}
+	isInside := func(opcode byte) bool {
+		for _, opener := range openers {
+			if opener.Opcode == opcode {
+				return true
+			}
+		}
+		return false
+	}
+	// if/else jump to just after the else/end if that ends their branch
+	checkBranchTarget := func(opener Instruction, end Instruction) {
+		if (opener.Opcode == Opcode_If || opener.Opcode == Opcode_Else) && opener.JumpTargets[0] != end.End() {
+			report(opener.Offset, "'%s' jumps to %#X, but its branch ends at %#X", opener.Name(), opener.JumpTargets[0], end.End())
+		}
+	}
+
+	for i, instruction := range instructions {
+		opcode := instruction.Opcode
+
+		for _, target := range instruction.JumpTargets {
+			if target < 0 || target > len(bytes) {
+				report(instruction.Offset, "'%s' jumps outside of the file (to %#X)", instruction.Name(), target)
+			} else if !isBoundary[target] {
+				report(instruction.Offset, "'%s' jumps into the middle of an instruction (at %#X)", instruction.Name(), target)
+			}
+		}
+
+		switch {
+		case opcode == Opcode_EndOfFile && i != len(instructions)-1:
+			report(instruction.Offset, "End of file before the end of the file")
+		case opcode == Opcode_ScriptBegin && len(openers) > 0:
+			report(instruction.Offset, "Script begins inside '%s' (at %#X)", openers[len(openers)-1].Name(), openers[len(openers)-1].Offset)
+		case opcode == Opcode_Break && !isInside(Opcode_WhileBegin):
+			report(instruction.Offset, "Break outside of a while loop")
+		case opcode == Opcode_NameTableEntry && compiler.StringToChecksum(instruction.Text) != instruction.Uint32:
+			report(instruction.Offset, "Name table entry '%s' should have checksum #%08X, not #%08X",
+				instruction.Text, compiler.StringToChecksum(instruction.Text), instruction.Uint32)
+		case Opcodes[opcode].Operands == Operands_SizedString &&
+			(instruction.Uint32 == 0 || instruction.Bytes[len(instruction.Bytes)-1] != 0):
+			report(instruction.Offset, "'%s' isn't null-terminated", instruction.Name())
+		case Opcodes[opcode].Operands == Operands_Random:
+			verifyRandom(instruction, instructions[i+1:], report)
+		}
+
+		// balance brackets & blocks
+		if opcode == Opcode_Else || opcode == Opcode_ElseOld || opcode == Opcode_ElseIfOld {
+			// else closes the if's branch and opens its own
+			if len(openers) == 0 || !isIf(openers[len(openers)-1].Opcode) {
+				report(instruction.Offset, "'%s' without an if", instruction.Name())
+			} else {
+				checkBranchTarget(openers[len(openers)-1], instruction)
+				openers = openers[:len(openers)-1]
+			}
+			openers = append(openers, instruction)
+		} else if _, isOpener := closers[opcode]; isOpener {
+			openers = append(openers, instruction)
+		} else if isCloser[opcode] {
+			if len(openers) == 0 {
+				report(instruction.Offset, "'%s' without a matching opener", instruction.Name())
+			} else {
+				// a mismatch is still treated as closing the opener, so one bad byte is only reported once
+				if opener := openers[len(openers)-1]; closers[opener.Opcode] != opcode {
+					report(instruction.Offset, "'%s' closes '%s' (at %#X)", instruction.Name(), opener.Name(), opener.Offset)
+				} else {
+					checkBranchTarget(opener, instruction)
+				}
+				openers = openers[:len(openers)-1]
+			}
+		}
+	}
+	for _, opener := range openers {
+		report(opener.Offset, "'%s' is never closed", opener.Name())
+	}
+
+	return problems
+}
+
+// verifyRandom checks that each branch starts where the previous one ends, and that every branch except the last ends
+// with a long jump past the final branch.
+func verifyRandom(random Instruction, following []Instruction, report func(offset int, format string, args ...interface{})) {
+	targets := random.JumpTargets
+	if len(targets) == 0 {
+		report(random.Offset, "'%s' has no branches", random.Name())
+		return
+	}
+	if targets[0] != random.End() {
+		report(random.Offset, "'%s' branch 0 starts at %#X, not straight after the offsets (%#X)", random.Name(), targets[0], random.End())
+	}
+
+	endOfRandom := -1
+	for i := 1; i < len(targets); i++ {
+		if targets[i] <= targets[i-1] {
+			report(random.Offset, "'%s' branch %d starts at %#X, before branch %d (%#X)", random.Name(), i, targets[i], i-1, targets[i-1])
+			return
+		}
+		var longJump *Instruction
+		for j := range following {
+			if following[j].End() == targets[i] {
+				longJump = &following[j]
+			}
+			if following[j].End() >= targets[i] {
+				break
+			}
+		}
+		if longJump == nil || longJump.Opcode != Opcode_LongJump {
+			report(random.Offset, "'%s' branch %d doesn't end with a long jump", random.Name(), i-1)
+			continue
+		}
+		if endOfRandom == -1 {
+			endOfRandom = longJump.JumpTargets[0]
+		} else if longJump.JumpTargets[0] != endOfRandom {
+			report(longJump.Offset, "'%s' branch %d jumps to %#X, but branch 0 jumps to %#X", random.Name(), i-1, longJump.JumpTargets[0], endOfRandom)
+		}
+	}
+	if endOfRandom != -1 && endOfRandom < targets[len(targets)-1] {
+		report(random.Offset, "'%s' branches jump to %#X, before the last branch (%#X)", random.Name(), endOfRandom, targets[len(targets)-1])
+	}
+}
@@ -0,0 +1,109 @@
+package disassembler_test
+
+import (
+	"github.com/byxor/NeverScript/assembler"
+	"github.com/byxor/NeverScript/disassembler"
+	"strings"
+	"testing"
+)
+
+const verifiedQbasm = `
+    newline
+    script_begin
+    checksum "Foo"
+    random 1:@Branch0 2:@Branch1
+Branch0:
+    int 1
+    long_jump @EndOfRandom
+Branch1:
+    int 2
+EndOfRandom:
+    if @Else
+    checksum "x"
+    else @EndIf
+Else:
+    string "hi"
+    end_if
+EndIf:
+    while_begin
+    break
+    while_end
+    script_end
+    name_table_entry "Foo"
+    name_table_entry "x"
+    end_of_file
+`
+
+func verifyQbasm(t *testing.T, qbasm string) []error {
+	t.Helper()
+	byteCode, err := assembler.Assemble(qbasm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return disassembler.Verify(byteCode)
+}
+
+func TestVerify(t *testing.T) {
+	if problems := verifyQbasm(t, verifiedQbasm); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
+
+// Each test case breaks the valid qbasm in one way.
+func TestVerifyFindsProblems(t *testing.T) {
+	testCases := []struct {
+		description     string
+		old, new        string
+		expectedProblem string
+	}{
+		{"unclosed block", "    while_end\n", "",
+			"[0X3D] 'script end' closes 'while begin' (at 0X3B)"},
+		{"mismatched closer", "    script_end\n", "    close_parenthesis\n    script_end\n",
+			"[0X3E] 'close parenthesis' closes 'script begin' (at 0X1)"},
+		{"unopened block", "    script_begin\n", "    close_parenthesis\n    script_begin\n",
+			"[0X1] 'close parenthesis' without a matching opener"},
+		{"break outside of a loop", "    while_begin\n", "",
+			"[0X3B] Break outside of a while loop"},
+		{"jump into an instruction", "long_jump @EndOfRandom", "long_jump +1",
+			"[0X1D] 'long jump' jumps into the middle of an instruction (at 0X23)"},
+		{"jump outside of the file", "if @Else", "if +0x1000",
+			"[0X27] 'if' jumps outside of the file (to 0X1028)"},
+		{"if jumping to the wrong place", "if @Else", "if @EndIf",
+			"[0X27] 'if' jumps to 0X3B, but its branch ends at 0X32"},
+		{"random branches out of order", "random 1:@Branch0 2:@Branch1", "random 1:@Branch1 2:@Branch0",
+			"[0X7] 'random' branch 0 starts at 0X22, not straight after the offsets (0X18)"},
+		{"random branch without a long jump", "    long_jump @EndOfRandom\n", "",
+			"[0X7] 'random' branch 0 doesn't end with a long jump"},
+		{"name table checksum mismatch", `name_table_entry "x"`, `name_table_entry #12345678 "x"`,
+			"[0X48] Name table entry 'x' should have checksum #7323E97C, not #12345678"},
+		{"unterminated string", `string "hi"`, `string unterminated "hi"`,
+			"[0X32] 'string' isn't null-terminated"},
+		{"missing end of file", "    end_of_file\n", "",
+			"[0X48] File doesn't end with an end of file (found 'name table entry')"},
+		{"extra end of file", "    end_of_file\n", "    end_of_file\n    end_of_file\n",
+			"[0X4F] End of file before the end of the file"},
+	}
+	for _, testCase := range testCases {
+		if !strings.Contains(verifiedQbasm, testCase.old) {
+			t.Fatalf("%s: the qbasm doesn't contain %q", testCase.description, testCase.old)
+		}
+		problems := verifyQbasm(t, strings.Replace(verifiedQbasm, testCase.old, testCase.new, 1))
+		found := false
+		for _, problem := range problems {
+			found = found || problem.Error() == testCase.expectedProblem
+		}
+		if !found {
+			t.Errorf("%s: expected '%s', got %v", testCase.description, testCase.expectedProblem, problems)
+		}
+	}
+}
+
+func TestVerifyEmptyAndTruncatedFiles(t *testing.T) {
+	if problems := disassembler.Verify(nil); len(problems) != 1 || !strings.Contains(problems[0].Error(), "File is empty") {
+		t.Errorf("Expected the empty file to be reported, got %v", problems)
+	}
+	// a checksum missing its last byte can't be decoded
+	if problems := disassembler.Verify([]byte{0x16, 0xDE, 0x9A, 0x8C}); len(problems) != 1 {
+		t.Errorf("Expected 1 problem, got %v", problems)
+	}
+}
@@ -0,0 +1,25 @@
+package interpreter
+
+// gotParam tells whether the caller has a parameter (or flag) with each name given, e.g. GotParam speed.
+func gotParam(call *Call) (bool, error) {
+	for _, element := range call.Arguments.Elements {
+		name, ok := element.Value.(Checksum)
+		if element.Name != 0 || !ok {
+			continue
+		}
+		if !call.Locals.HasFlagChecksum(uint32(name)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// change sets globals, e.g. Change my_string="Changed".
+func change(call *Call) (bool, error) {
+	for _, element := range call.Arguments.Elements {
+		if element.Name != 0 {
+			call.Interpreter.Globals[element.Name] = element.Value
+		}
+	}
+	return true, nil
+}
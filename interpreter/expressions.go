@@ -0,0 +1,462 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+)
+
+func (interpreter *Interpreter) evaluate(node compiler.AstNode, frame *frame) (Value, error) {
+	switch data := node.Data.(type) {
+	case compiler.AstData_Integer:
+		return data.Value(), nil
+	case compiler.AstData_Float:
+		return data.Value(), nil
+	case compiler.AstData_String:
+		return data.Text(), nil
+	case compiler.AstData_Checksum:
+		return Checksum(data.Checksum()), nil
+	case compiler.AstData_Pair:
+		return Pair{
+			data.FloatNodeA.Data.(compiler.AstData_Float).Value(),
+			data.FloatNodeB.Data.(compiler.AstData_Float).Value(),
+		}, nil
+	case compiler.AstData_Vector:
+		return Vector{
+			data.FloatNodeA.Data.(compiler.AstData_Float).Value(),
+			data.FloatNodeB.Data.(compiler.AstData_Float).Value(),
+			data.FloatNodeC.Data.(compiler.AstData_Float).Value(),
+		}, nil
+	case compiler.AstData_LocalReference:
+		value, exists, err := interpreter.local(node, frame)
+		if err == nil && !exists {
+			err = fmt.Errorf("<%s> isn't set", interpreter.Name(data.Node.Data.(compiler.AstData_Checksum).Checksum()))
+		}
+		return value, err
+	case compiler.AstData_Struct:
+		return interpreter.evaluateStruct(data.ElementNodes, frame)
+	case compiler.AstData_Array:
+		array := Array{}
+		for _, elementNode := range flattenElements(data.ElementNodes) {
+			if elementNode.Kind == compiler.AstKind_NewLine || elementNode.Kind == compiler.AstKind_Comma {
+				continue
+			}
+			value, err := interpreter.evaluate(elementNode, frame)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		return array, nil
+	case compiler.AstData_ArrayAccess:
+		return interpreter.evaluateArrayAccess(data, frame)
+	case compiler.AstData_Random:
+		branch, err := interpreter.chooseBranch(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, branchNode := range data.Branches[branch] {
+			if branchNode.Kind != compiler.AstKind_NewLine && branchNode.Kind != compiler.AstKind_Comma {
+				return interpreter.evaluate(branchNode, frame)
+			}
+		}
+		return nil, errors.New("Random branch has no value")
+	}
+
+	switch node.Kind {
+	case compiler.AstKind_AllArguments:
+		if frame.locals == nil {
+			return nil, errors.New("<...> can only be used in a script")
+		}
+		return frame.locals.Copy(), nil
+	case compiler.AstKind_UnaryExpression:
+		return interpreter.evaluate(node.Data.(compiler.AstData_UnaryExpression).Node, frame)
+	case compiler.AstKind_AdditionExpression, compiler.AstKind_SubtractionExpression,
+		compiler.AstKind_MultiplicationExpression, compiler.AstKind_DivisionExpression:
+		data := node.Data.(compiler.AstData_BinaryExpression)
+		left, right, err := interpreter.evaluateOperands(data, frame)
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic(node.Kind, left, right)
+	case compiler.AstKind_EqualsExpression, compiler.AstKind_NotEqualExpression,
+		compiler.AstKind_LessThanExpression, compiler.AstKind_LessThanEqualsExpression,
+		compiler.AstKind_GreaterThanExpression, compiler.AstKind_GreaterThanEqualsExpression:
+		data := node.Data.(compiler.AstData_BinaryExpression)
+		left, right, err := interpreter.evaluateOperands(data, frame)
+		if err != nil {
+			return nil, err
+		}
+		isTrue, err := compare(node.Kind, left, right)
+		return boolToInt(isTrue), err
+	case compiler.AstKind_DotExpression:
+		data := node.Data.(compiler.AstData_BinaryExpression)
+		left, err := interpreter.evaluate(data.LeftNode, frame)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := interpreter.resolveGlobal(left).(*Struct)
+		if !ok {
+			return nil, fmt.Errorf("Can't use '.' on a %s", typeName(left))
+		}
+		member, err := checksumOf(data.RightNode)
+		if err != nil {
+			return nil, err
+		}
+		value, exists := s.GetChecksum(member)
+		if !exists {
+			return nil, fmt.Errorf("%s has no '%s'", interpreter.Format(left), interpreter.Name(member))
+		}
+		return value, nil
+	case compiler.AstKind_LogicalNot, compiler.AstKind_LogicalAnd, compiler.AstKind_LogicalOr,
+		compiler.AstKind_Invocation, compiler.AstKind_ColonExpression:
+		if arrayAccess, ok := interpreter.asArrayAccess(node, frame); ok {
+			return interpreter.evaluateArrayAccess(arrayAccess, frame)
+		}
+		isTrue, err := interpreter.condition(node, frame)
+		return boolToInt(isTrue), err
+	}
+	return nil, fmt.Errorf("Can't evaluate a %s", kindName(node))
+}
+
+// evaluateOperands evaluates both sides of a binary expression. Names of globals that are numbers are replaced by their
+// values, e.g. in (speed * 2).
+func (interpreter *Interpreter) evaluateOperands(data compiler.AstData_BinaryExpression, frame *frame) (Value, Value, error) {
+	left, err := interpreter.evaluate(data.LeftNode, frame)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, err := interpreter.evaluate(data.RightNode, frame)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, isNumber := toNumber(interpreter.resolveGlobal(left)); isNumber {
+		left = interpreter.resolveGlobal(left)
+	}
+	if _, isNumber := toNumber(interpreter.resolveGlobal(right)); isNumber {
+		right = interpreter.resolveGlobal(right)
+	}
+	return left, right, nil
+}
+
+func (interpreter *Interpreter) evaluateArrayAccess(data compiler.AstData_ArrayAccess, frame *frame) (Value, error) {
+	arrayValue, err := interpreter.evaluate(data.Array, frame)
+	if err != nil {
+		return nil, err
+	}
+	array, ok := interpreter.resolveGlobal(arrayValue).(Array)
+	if !ok {
+		return nil, fmt.Errorf("Can't index a %s", typeName(arrayValue))
+	}
+	indexValue, err := interpreter.evaluate(data.Index, frame)
+	if err != nil {
+		return nil, err
+	}
+	index, ok := interpreter.resolveGlobal(indexValue).(int32)
+	if !ok {
+		return nil, fmt.Errorf("Can't index an array with a %s", typeName(indexValue))
+	}
+	if index < 0 || int(index) >= len(array) {
+		return nil, fmt.Errorf("Index %d is out of range (the array has %d elements)", index, len(array))
+	}
+	return array[index], nil
+}
+
+// Inside parentheses, the decompiler reads <array>[index] and array[index] as a call to the array with the parameter
+// [index] (the bytes are the same), so that's turned back into an array access when the local or global is an array.
+func (interpreter *Interpreter) asArrayAccess(node compiler.AstNode, frame *frame) (compiler.AstData_ArrayAccess, bool) {
+	data, ok := node.Data.(compiler.AstData_Invocation)
+	if !ok || len(data.ParameterNodes) != 1 {
+		return compiler.AstData_ArrayAccess{}, false
+	}
+	indexNode := data.ParameterNodes[0]
+	if indexNode.Kind != compiler.AstKind_Array {
+		return compiler.AstData_ArrayAccess{}, false
+	}
+	var indexNodes []compiler.AstNode
+	for _, elementNode := range indexNode.Data.(compiler.AstData_Array).ElementNodes {
+		if elementNode.Kind != compiler.AstKind_NewLine && elementNode.Kind != compiler.AstKind_Comma {
+			indexNodes = append(indexNodes, elementNode)
+		}
+	}
+	if len(indexNodes) != 1 {
+		return compiler.AstData_ArrayAccess{}, false
+	}
+	var array Value
+	switch data.ScriptIdentifierNode.Kind {
+	case compiler.AstKind_LocalReference:
+		array, _, _ = interpreter.local(data.ScriptIdentifierNode, frame)
+	case compiler.AstKind_Checksum:
+		if name, err := checksumOf(data.ScriptIdentifierNode); err == nil {
+			array = interpreter.Globals[name]
+		}
+	}
+	if _, isArray := array.(Array); !isArray {
+		return compiler.AstData_ArrayAccess{}, false
+	}
+	return compiler.AstData_ArrayAccess{Array: data.ScriptIdentifierNode, Index: indexNodes[0]}, true
+}
+
+// evaluateStruct builds a struct from the elements of a struct, or the parameters of a call or 'return'.
+func (interpreter *Interpreter) evaluateStruct(elementNodes []compiler.AstNode, frame *frame) (*Struct, error) {
+	s := &Struct{}
+	for _, elementNode := range flattenElements(elementNodes) {
+		switch elementNode.Kind {
+		case compiler.AstKind_NewLine, compiler.AstKind_Comma:
+			continue
+		case compiler.AstKind_Assignment:
+			data := elementNode.Data.(compiler.AstData_Assignment)
+			name, err := checksumOf(data.NameNode)
+			if err != nil {
+				return nil, err
+			}
+			if data.ValueNode.Kind == compiler.AstKind_LocalReference {
+				value, exists, err := interpreter.local(data.ValueNode, frame)
+				if err != nil {
+					return nil, err
+				}
+				if exists {
+					s.SetChecksum(name, value)
+				}
+				continue
+			}
+			value, err := interpreter.evaluate(data.ValueNode, frame)
+			if err != nil {
+				return nil, err
+			}
+			s.SetChecksum(name, value)
+		default:
+			var value Value
+			if elementNode.Kind == compiler.AstKind_LocalReference {
+				var exists bool
+				var err error
+				if value, exists, err = interpreter.local(elementNode, frame); err != nil {
+					return nil, err
+				} else if !exists {
+					continue
+				}
+			} else {
+				var err error
+				if value, err = interpreter.evaluate(elementNode, frame); err != nil {
+					return nil, err
+				}
+			}
+			switch v := value.(type) {
+			case *Struct:
+				s.Merge(v)
+			case Checksum:
+				if global, ok := interpreter.Globals[uint32(v)].(*Struct); ok {
+					s.Merge(global)
+				} else {
+					s.Add(v)
+				}
+			default:
+				s.Add(v)
+			}
+		}
+	}
+	return s, nil
+}
+
+// The decompiler reads a name followed by more elements (e.g. the flag in { hidden x = 1 }) as an invocation.
+func flattenElements(elementNodes []compiler.AstNode) []compiler.AstNode {
+	var flattened []compiler.AstNode
+	for _, elementNode := range elementNodes {
+		if elementNode.Kind == compiler.AstKind_Invocation {
+			data := elementNode.Data.(compiler.AstData_Invocation)
+			flattened = append(flattened, data.ScriptIdentifierNode)
+			flattened = append(flattened, data.ParameterNodes...)
+			continue
+		}
+		flattened = append(flattened, elementNode)
+	}
+	return flattened
+}
+
+// local reads <name>.
+func (interpreter *Interpreter) local(node compiler.AstNode, frame *frame) (Value, bool, error) {
+	if frame.locals == nil {
+		return nil, false, errors.New("Locals can only be used in a script")
+	}
+	name, err := checksumOf(node)
+	if err != nil {
+		return nil, false, err
+	}
+	value, exists := frame.locals.GetChecksum(name)
+	return value, exists, nil
+}
+
+// condition works out whether a condition is true. Scripts and builtins in conditions (if Foo, if (GotParam x)) are
+// called, and their results are used.
+func (interpreter *Interpreter) condition(node compiler.AstNode, frame *frame) (bool, error) {
+	switch node.Kind {
+	case compiler.AstKind_UnaryExpression:
+		return interpreter.condition(node.Data.(compiler.AstData_UnaryExpression).Node, frame)
+	case compiler.AstKind_LogicalNot:
+		isTrue, err := interpreter.condition(node.Data.(compiler.AstData_UnaryExpression).Node, frame)
+		return !isTrue, err
+	case compiler.AstKind_LogicalAnd, compiler.AstKind_LogicalOr:
+		data := node.Data.(compiler.AstData_BinaryExpression)
+		isTrue, err := interpreter.condition(data.LeftNode, frame)
+		if err != nil || isTrue == (node.Kind == compiler.AstKind_LogicalOr) {
+			return isTrue, err
+		}
+		return interpreter.condition(data.RightNode, frame)
+	case compiler.AstKind_Invocation, compiler.AstKind_ColonExpression:
+		if _, ok := interpreter.asArrayAccess(node, frame); !ok {
+			return interpreter.call(node, frame)
+		}
+	case compiler.AstKind_Checksum:
+		if interpreter.isCallable(node.Data.(compiler.AstData_Checksum).Checksum()) {
+			return interpreter.call(node, frame)
+		}
+	}
+
+	value, err := interpreter.evaluate(node, frame)
+	if err != nil {
+		return false, err
+	}
+	number, isNumber := toNumber(interpreter.resolveGlobal(value))
+	if !isNumber {
+		return false, fmt.Errorf("Can't use a %s as a condition", typeName(value))
+	}
+	return number != 0, nil
+}
+
+// resolveGlobal gives the value of a global when a value is the name of one.
+func (interpreter *Interpreter) resolveGlobal(value Value) Value {
+	if checksum, ok := value.(Checksum); ok {
+		if global, exists := interpreter.Globals[uint32(checksum)]; exists {
+			return global
+		}
+	}
+	return value
+}
+
+func arithmetic(kind compiler.AstKind, left, right Value) (Value, error) {
+	operators := map[compiler.AstKind]string{
+		compiler.AstKind_AdditionExpression:       "+",
+		compiler.AstKind_SubtractionExpression:    "-",
+		compiler.AstKind_MultiplicationExpression: "*",
+		compiler.AstKind_DivisionExpression:       "/",
+	}
+	unsupported := fmt.Errorf("Can't do %s %s %s", typeName(left), operators[kind], typeName(right))
+
+	floats := func(a, b float32) (Value, error) {
+		switch kind {
+		case compiler.AstKind_AdditionExpression:
+			return a + b, nil
+		case compiler.AstKind_SubtractionExpression:
+			return a - b, nil
+		case compiler.AstKind_MultiplicationExpression:
+			return a * b, nil
+		}
+		if b == 0 {
+			return nil, errors.New("Division by zero")
+		}
+		return a / b, nil
+	}
+
+	switch l := left.(type) {
+	case int32:
+		switch r := right.(type) {
+		case int32:
+			switch kind {
+			case compiler.AstKind_AdditionExpression:
+				return l + r, nil
+			case compiler.AstKind_SubtractionExpression:
+				return l - r, nil
+			case compiler.AstKind_MultiplicationExpression:
+				return l * r, nil
+			}
+			if r == 0 {
+				return nil, errors.New("Division by zero")
+			}
+			return l / r, nil
+		case float32:
+			return floats(float32(l), r)
+		}
+	case float32:
+		if r, isNumber := toNumber(right); isNumber {
+			return floats(l, float32(r))
+		}
+	case string:
+		if r, ok := right.(string); ok && kind == compiler.AstKind_AdditionExpression {
+			return l + r, nil
+		}
+	}
+
+	// pairs and vectors can be added to and subtracted from each other, and multiplied or divided by numbers
+	isAddition := kind == compiler.AstKind_AdditionExpression || kind == compiler.AstKind_SubtractionExpression
+	if a, ok := components(left); ok {
+		b, ok := components(right)
+		if ok && isAddition && len(a) == len(b) {
+			return combine(left, a, b, floats)
+		}
+		if number, isNumber := toNumber(right); isNumber && !isAddition {
+			return combine(left, a, []float32{float32(number), float32(number), float32(number)}, floats)
+		}
+	}
+	if number, isNumber := toNumber(left); isNumber && kind == compiler.AstKind_MultiplicationExpression {
+		if b, ok := components(right); ok {
+			return combine(right, b, []float32{float32(number), float32(number), float32(number)}, floats)
+		}
+	}
+	return nil, unsupported
+}
+
+func components(value Value) ([]float32, bool) {
+	switch v := value.(type) {
+	case Pair:
+		return v[:], true
+	case Vector:
+		return v[:], true
+	}
+	return nil, false
+}
+
+// combine applies an operator to each component of a pair or vector, giving a value of the same type.
+func combine(like Value, a, b []float32, operator func(a, b float32) (Value, error)) (Value, error) {
+	result := make([]float32, len(a))
+	for i := range a {
+		value, err := operator(a[i], b[i])
+		if err != nil {
+			return nil, err
+		}
+		result[i] = value.(float32)
+	}
+	if _, isPair := like.(Pair); isPair {
+		return Pair{result[0], result[1]}, nil
+	}
+	return Vector{result[0], result[1], result[2]}, nil
+}
+
+func compare(kind compiler.AstKind, left, right Value) (bool, error) {
+	switch kind {
+	case compiler.AstKind_EqualsExpression:
+		return valuesEqual(left, right), nil
+	case compiler.AstKind_NotEqualExpression:
+		return !valuesEqual(left, right), nil
+	}
+	l, leftIsNumber := toNumber(left)
+	r, rightIsNumber := toNumber(right)
+	if !leftIsNumber || !rightIsNumber {
+		return false, fmt.Errorf("Can't compare a %s with a %s", typeName(left), typeName(right))
+	}
+	switch kind {
+	case compiler.AstKind_LessThanExpression:
+		return l < r, nil
+	case compiler.AstKind_LessThanEqualsExpression:
+		return l <= r, nil
+	case compiler.AstKind_GreaterThanExpression:
+		return l > r, nil
+	}
+	return l >= r, nil
+}
+
+func boolToInt(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
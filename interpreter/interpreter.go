@@ -0,0 +1,407 @@
+// Package interpreter runs compiled QB scripts outside of the game, so mod logic can be tested without launching it.
+//
+// QB files are loaded with Load, which decompiles them and adds their globals and scripts to the interpreter. Run
+// calls a script by name. Scripts behave the way they do in the game:
+//
+//   - a script's locals are its parameters (with the defaults from its declaration), and assignments inside a script
+//     set locals,
+//   - <name> reads a local, and <...> passes every local on to another script,
+//   - a flag (a checksum without a name) that names a global struct is replaced by the struct's elements,
+//   - parameters set to a local that isn't set (e.g. Foo x=<x>) are left out,
+//   - values returned with 'return' are added to the caller's locals (this is how 'if @(Foo)' sees 'return true').
+//
+// Engine functions are written in Go and registered as builtins. A call to a script that isn't loaded or registered is
+// an error, unless there's a Fallback.
+package interpreter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"math/rand"
+)
+
+// A Builtin is a script written in Go. The bool it returns is what 'if' sees when the builtin is used as a condition.
+type Builtin func(call *Call) (bool, error)
+
+// Call describes a call to a builtin.
+type Call struct {
+	Interpreter *Interpreter
+	Name        uint32
+	Object      Value   // the object in object:Function calls, nil otherwise
+	Arguments   *Struct // with <...> and global structs already merged in
+	Locals      *Struct // the caller's locals, which builtins can change (e.g. to return values)
+}
+
+type Interpreter struct {
+	Builtins map[uint32]Builtin
+	Fallback Builtin    // optional, called for scripts that aren't loaded or registered
+	Random   *rand.Rand // optional, picks 'random' branches (seeded with 0 when nil, so runs are repeatable)
+	MaxSteps int        // optional, stops runaway loops after this many statements (0 means no limit)
+
+	Globals map[uint32]Value
+	Scripts map[uint32]compiler.AstNode
+	Names   map[uint32]string // from the name tables of loaded files and the names of builtins
+
+	steps int
+}
+
+// There's no limit on the game's call stack that scripts should reach, so deeper calls are treated as runaway recursion.
+const maxCallDepth = 1000
+
+type flow int
+
+const (
+	flow_Next flow = iota
+	flow_Break
+	flow_Return
+)
+
+// frame is a script being run.
+type frame struct {
+	locals *Struct // nil when loading globals
+	depth  int
+}
+
+// NewInterpreter returns an interpreter with the builtins GotParam and Change.
+func NewInterpreter() *Interpreter {
+	interpreter := &Interpreter{
+		Builtins: make(map[uint32]Builtin),
+		Globals:  make(map[uint32]Value),
+		Scripts:  make(map[uint32]compiler.AstNode),
+		Names:    make(map[uint32]string),
+	}
+	interpreter.Register("GotParam", gotParam)
+	interpreter.Register("Change", change)
+	return interpreter
+}
+
+// Register adds (or replaces) a builtin.
+func (interpreter *Interpreter) Register(name string, builtin Builtin) {
+	checksum := compiler.StringToChecksum(name)
+	interpreter.Builtins[checksum] = builtin
+	interpreter.Names[checksum] = name
+}
+
+// Load adds the globals and scripts of a QB file. Later files replace globals and scripts with the same names.
+func (interpreter *Interpreter) Load(byteCode []byte) error {
+	arguments := decompiler.Arguments{ByteCode: byteCode}
+	if err := decompiler.ParseByteCode(&arguments); err != nil {
+		return err
+	}
+	if len(arguments.Problems) > 0 {
+		return errors.New(arguments.Problems[0].String())
+	}
+
+	rootNodes := arguments.RootNode.Data.(compiler.AstData_Root).BodyNodes
+	for _, node := range rootNodes {
+		if node.Kind == compiler.AstKind_NameTableEntry {
+			data := node.Data.(compiler.AstData_NameTableEntry)
+			interpreter.Names[binary.LittleEndian.Uint32(data.ChecksumBytes)] = data.Name
+		}
+	}
+	for _, node := range rootNodes {
+		switch data := node.Data.(type) {
+		case compiler.AstData_Script:
+			interpreter.Scripts[data.NameNode.Data.(compiler.AstData_Checksum).Checksum()] = node
+		case compiler.AstData_Assignment:
+			name, err := checksumOf(data.NameNode)
+			if err != nil {
+				return err
+			}
+			value, err := interpreter.evaluate(data.ValueNode, &frame{})
+			if err != nil {
+				return fmt.Errorf("%s: %s", interpreter.Name(name), err)
+			}
+			interpreter.Globals[name] = value
+		}
+	}
+	return nil
+}
+
+// Global gives the value of a global.
+func (interpreter *Interpreter) Global(name string) (Value, bool) {
+	value, exists := interpreter.Globals[compiler.StringToChecksum(name)]
+	return value, exists
+}
+
+// Name gives the name of a checksum when it's known, or #XXXXXXXX.
+func (interpreter *Interpreter) Name(checksum uint32) string {
+	if name, exists := interpreter.Names[checksum]; exists {
+		if rendered, ok := decompiler.RenderName(name); ok {
+			return rendered
+		}
+	}
+	return fmt.Sprintf("#%08X", checksum)
+}
+
+// Run calls a script (or builtin) and gives the values it returned. arguments is optional.
+func (interpreter *Interpreter) Run(name string, arguments *Struct) (*Struct, error) {
+	interpreter.steps = 0
+	checksum := compiler.StringToChecksum(name)
+	if _, exists := interpreter.Scripts[checksum]; !exists {
+		locals := &Struct{}
+		_, err := interpreter.callChecksum(checksum, nil, arguments.Copy(), &frame{locals: locals})
+		return locals, err
+	}
+	return interpreter.runScript(checksum, arguments.Copy(), 0)
+}
+
+func (interpreter *Interpreter) runScript(name uint32, arguments *Struct, depth int) (*Struct, error) {
+	if depth >= maxCallDepth {
+		return nil, fmt.Errorf("%s: Calls are nested more than %d deep", interpreter.Name(name), maxCallDepth)
+	}
+	data := interpreter.Scripts[name].Data.(compiler.AstData_Script)
+
+	locals, err := interpreter.evaluateStruct(data.DefaultParameterNodes, &frame{depth: depth})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", interpreter.Name(name), err)
+	}
+	locals.Merge(arguments)
+
+	_, returned, err := interpreter.runBody(data.BodyNodes, &frame{locals: locals, depth: depth})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", interpreter.Name(name), err)
+	}
+	if returned == nil {
+		returned = &Struct{}
+	}
+	return returned, nil
+}
+
+// runBody runs statements until the end of the body, a 'break' or a 'return' (which gives the returned values).
+func (interpreter *Interpreter) runBody(nodes []compiler.AstNode, frame *frame) (flow, *Struct, error) {
+	for _, node := range nodes {
+		if node.Kind == compiler.AstKind_NewLine || node.Kind == compiler.AstKind_Comment {
+			continue
+		}
+		interpreter.steps++
+		if interpreter.MaxSteps > 0 && interpreter.steps > interpreter.MaxSteps {
+			return flow_Next, nil, fmt.Errorf("Gave up after %d statements (is there an infinite loop?)", interpreter.MaxSteps)
+		}
+
+		switch data := node.Data.(type) {
+		case compiler.AstData_Assignment:
+			name, err := checksumOf(data.NameNode)
+			if err != nil {
+				return flow_Next, nil, err
+			}
+			value, err := interpreter.evaluate(data.ValueNode, frame)
+			if err != nil {
+				return flow_Next, nil, err
+			}
+			frame.locals.SetChecksum(name, value)
+		case compiler.AstData_IfStatement:
+			for i, body := range data.Bodies {
+				if i < len(data.Conditions) {
+					isTrue, err := interpreter.condition(data.Conditions[i], frame)
+					if err != nil {
+						return flow_Next, nil, err
+					}
+					if !isTrue {
+						continue
+					}
+				}
+				if flow, returned, err := interpreter.runBody(body, frame); flow != flow_Next || err != nil {
+					return flow, returned, err
+				}
+				break
+			}
+		case compiler.AstData_WhileLoop:
+			for {
+				flow, returned, err := interpreter.runBody(data.BodyNodes, frame)
+				if err != nil || flow == flow_Return {
+					return flow, returned, err
+				}
+				if flow == flow_Break {
+					break
+				}
+				interpreter.steps++
+				if interpreter.MaxSteps > 0 && interpreter.steps > interpreter.MaxSteps {
+					return flow_Next, nil, fmt.Errorf("Gave up after %d statements (is there an infinite loop?)", interpreter.MaxSteps)
+				}
+			}
+		case compiler.AstData_Random:
+			branch, err := interpreter.chooseBranch(data)
+			if err != nil {
+				return flow_Next, nil, err
+			}
+			if flow, returned, err := interpreter.runBody(data.Branches[branch], frame); flow != flow_Next || err != nil {
+				return flow, returned, err
+			}
+		case compiler.AstData_UnaryExpression:
+			switch node.Kind {
+			case compiler.AstKind_Return:
+				returned := &Struct{}
+				if data.Node.Kind == compiler.AstKind_Invocation {
+					var err error
+					if returned, err = interpreter.evaluateStruct(data.Node.Data.(compiler.AstData_Invocation).ParameterNodes, frame); err != nil {
+						return flow_Next, nil, err
+					}
+				}
+				return flow_Return, returned, nil
+			case compiler.AstKind_UnaryExpression:
+				// (Foo) is how the compiler calls Foo for 'if @(Foo)', which then checks <__boolean_result__>
+				isTrue, err := interpreter.condition(data.Node, frame)
+				if err != nil {
+					return flow_Next, nil, err
+				}
+				result := int32(0)
+				if isTrue {
+					result = 1
+				}
+				frame.locals.Set("__boolean_result__", result)
+			default:
+				return flow_Next, nil, fmt.Errorf("Can't run a %s as a statement", kindName(node))
+			}
+		default:
+			switch node.Kind {
+			case compiler.AstKind_Break:
+				return flow_Break, nil, nil
+			case compiler.AstKind_Checksum, compiler.AstKind_LocalReference, compiler.AstKind_Invocation, compiler.AstKind_ColonExpression:
+				if _, err := interpreter.call(node, frame); err != nil {
+					return flow_Next, nil, err
+				}
+			default:
+				return flow_Next, nil, fmt.Errorf("Can't run a %s as a statement", kindName(node))
+			}
+		}
+	}
+	return flow_Next, nil, nil
+}
+
+// call runs an invocation (Foo x=1), a lone name (Foo or <script_name>) or object:Function, and gives its result.
+func (interpreter *Interpreter) call(node compiler.AstNode, frame *frame) (bool, error) {
+	if frame.locals == nil {
+		return false, errors.New("Scripts can only be called from a script")
+	}
+	var object Value
+	if node.Kind == compiler.AstKind_ColonExpression {
+		data := node.Data.(compiler.AstData_BinaryExpression)
+		var err error
+		if object, err = interpreter.evaluate(data.LeftNode, frame); err != nil {
+			return false, err
+		}
+		node = data.RightNode
+	}
+
+	nameNode := node
+	var argumentNodes []compiler.AstNode
+	if data, ok := node.Data.(compiler.AstData_Invocation); ok {
+		nameNode = data.ScriptIdentifierNode
+		argumentNodes = data.ParameterNodes
+	}
+	var name uint32
+	switch nameNode.Kind {
+	case compiler.AstKind_Checksum:
+		name = nameNode.Data.(compiler.AstData_Checksum).Checksum()
+	case compiler.AstKind_LocalReference:
+		value, err := interpreter.evaluate(nameNode, frame)
+		if err != nil {
+			return false, err
+		}
+		checksum, ok := value.(Checksum)
+		if !ok {
+			return false, fmt.Errorf("Can't call a %s", typeName(value))
+		}
+		name = uint32(checksum)
+	default:
+		return false, fmt.Errorf("Can't call a %s", kindName(nameNode))
+	}
+
+	arguments, err := interpreter.evaluateStruct(argumentNodes, frame)
+	if err != nil {
+		return false, err
+	}
+	return interpreter.callChecksum(name, object, arguments, frame)
+}
+
+func (interpreter *Interpreter) callChecksum(name uint32, object Value, arguments *Struct, frame *frame) (bool, error) {
+	if _, exists := interpreter.Scripts[name]; exists {
+		returned, err := interpreter.runScript(name, arguments, frame.depth+1)
+		if err != nil {
+			return false, err
+		}
+		frame.locals.Merge(returned)
+		if result, exists := returned.Get("__boolean_result__"); exists {
+			return !valuesEqual(result, int32(0)), nil
+		}
+		return true, nil
+	}
+
+	builtin, exists := interpreter.Builtins[name]
+	if !exists {
+		builtin = interpreter.Fallback
+	}
+	if builtin == nil {
+		return false, fmt.Errorf("Unknown script '%s'", interpreter.Name(name))
+	}
+	result, err := builtin(&Call{
+		Interpreter: interpreter,
+		Name:        name,
+		Object:      object,
+		Arguments:   arguments,
+		Locals:      frame.locals,
+	})
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", interpreter.Name(name), err)
+	}
+	return result, nil
+}
+
+// isCallable tells whether a name can be called (so it's called when it's used as a condition).
+func (interpreter *Interpreter) isCallable(name uint32) bool {
+	_, isScript := interpreter.Scripts[name]
+	_, isBuiltin := interpreter.Builtins[name]
+	return isScript || isBuiltin || interpreter.Fallback != nil
+}
+
+func (interpreter *Interpreter) chooseBranch(data compiler.AstData_Random) (int, error) {
+	if len(data.Branches) == 0 {
+		return 0, errors.New("Random has no branches")
+	}
+	if interpreter.Random == nil {
+		interpreter.Random = rand.New(rand.NewSource(0))
+	}
+	total := 0
+	weights := make([]int, len(data.Branches))
+	for i := range data.Branches {
+		weights[i] = 1
+		if i < len(data.BranchWeights) {
+			weights[i] = int(data.BranchWeights[i].Data.(compiler.AstData_Integer).Value())
+		}
+		if weights[i] < 0 {
+			weights[i] = 0
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	pick := interpreter.Random.Intn(total)
+	for i, weight := range weights {
+		if pick < weight {
+			return i, nil
+		}
+		pick -= weight
+	}
+	return len(weights) - 1, nil
+}
+
+// checksumOf gives the name of an assignment (x = 1 or <x> = 1).
+func checksumOf(node compiler.AstNode) (uint32, error) {
+	if node.Kind == compiler.AstKind_LocalReference {
+		node = node.Data.(compiler.AstData_LocalReference).Node
+	}
+	data, ok := node.Data.(compiler.AstData_Checksum)
+	if !ok {
+		return 0, fmt.Errorf("Expected a name, found a %s", kindName(node))
+	}
+	return data.Checksum(), nil
+}
+
+func kindName(node compiler.AstNode) string {
+	return node.Kind.String()[len("AstKind_"):]
+}
@@ -0,0 +1,275 @@
+package interpreter_test
+
+import (
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/interpreter"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// load compiles NeverScript into a QB file and loads it into a new interpreter.
+func load(t *testing.T, sourceCode string) *interpreter.Interpreter {
+	t.Helper()
+	byteCode, err := compiler.CompileSourceCode(sourceCode, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qb := interpreter.NewInterpreter()
+	if err := qb.Load(byteCode); err != nil {
+		t.Fatal(err)
+	}
+	return qb
+}
+
+// run runs a script and gives what it returned, written as NeverScript.
+func run(t *testing.T, qb *interpreter.Interpreter, script string, arguments *interpreter.Struct) string {
+	t.Helper()
+	returned, err := qb.Run(script, arguments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return qb.Format(returned)
+}
+
+func expect(t *testing.T, description, expected, actual string) {
+	t.Helper()
+	if expected != actual {
+		t.Errorf("%s: expected %s, got %s", description, expected, actual)
+	}
+}
+
+func TestLocalsAndArithmetic(t *testing.T) {
+	qb := load(t, `
+script add {
+    return sum=(<a> + <b>)
+}
+script main {
+    add a=1 b=2
+    x = (<sum> * 2.5)
+    y = ((<sum> - 7) / 2)
+    return x=<x> y=<y> text=("a" + "b") v=((1.0, 2.0, 3.0) * 2)
+}
+`)
+	expect(t, "main", `{x=7.5 y=-2 text="ab" v=(2.0, 4.0, 6.0)}`, run(t, qb, "main", nil))
+}
+
+func TestParameters(t *testing.T) {
+	qb := load(t, `
+script greet name="nobody" {
+    return greeting=("hello " + <name>)
+}
+script passOn {
+    greet <...>
+    return greeting=<greeting>
+}
+script passMaybe {
+    greet name=<name>
+    return greeting=<greeting>
+}
+`)
+	arguments := &interpreter.Struct{}
+	arguments.Set("name", "tony")
+	expect(t, "default parameter", `{greeting="hello nobody"}`, run(t, qb, "greet", nil))
+	expect(t, "<...>", `{greeting="hello tony"}`, run(t, qb, "passOn", arguments))
+	expect(t, "unset local", `{greeting="hello nobody"}`, run(t, qb, "passMaybe", nil))
+	expect(t, "set local", `{greeting="hello tony"}`, run(t, qb, "passMaybe", arguments))
+}
+
+func TestControlFlow(t *testing.T) {
+	qb := load(t, `
+script IsBig {
+    if (<x> > 10) {
+        return true
+    }
+    return false
+}
+script Classify {
+    if @(IsBig x=<x>) {
+        return size=big
+    } else if (<x> > 5) {
+        return size=medium
+    } else {
+        return size=small
+    }
+}
+script SumBelow {
+    i = 0
+    total = 0
+    while {
+        if (<i> = <limit>) {
+            break
+        }
+        total = (<total> + <i>)
+        i = (<i> + 1)
+    }
+    return total=<total>
+}
+`)
+	for x, size := range map[int32]string{20: "big", 7: "medium", 1: "small"} {
+		arguments := &interpreter.Struct{}
+		arguments.Set("x", x)
+		expect(t, "Classify", "{size="+size+"}", run(t, qb, "Classify", arguments))
+	}
+
+	arguments := &interpreter.Struct{}
+	arguments.Set("limit", int32(5))
+	expect(t, "SumBelow", "{total=10}", run(t, qb, "SumBelow", arguments))
+}
+
+func TestStructsAndArrays(t *testing.T) {
+	qb := load(t, `
+Settings = {
+    speed = 10
+    colours = [red green blue]
+    hidden
+}
+script Describe {
+    if (GotParam hidden) {
+        visibility = hidden
+    } else {
+        visibility = visible
+    }
+    return speed=<speed> colour=(<colours>[1]) visibility=<visibility>
+}
+script main {
+    Describe Settings speed=(Settings.speed * 2)
+    return <...>
+}
+`)
+	expect(t, "main", "{speed=20 colour=green visibility=hidden}", run(t, qb, "main", nil))
+}
+
+func TestGlobalArrays(t *testing.T) {
+	qb := load(t, `
+speeds = [5 10 15]
+script main {
+    i = 2
+    return second=(speeds[1]) last=(speeds[<i>]) total=((speeds[0]) + (speeds[2]))
+}
+`)
+	expect(t, "main", "{second=10 last=15 total=20}", run(t, qb, "main", nil))
+}
+
+func TestRandom(t *testing.T) {
+	source := `
+script Pick {
+    random {
+        1 { return choice=a }
+        3 { return choice=b }
+    }
+}
+`
+	picks := func(seed int64) string {
+		qb := load(t, source)
+		qb.Random = rand.New(rand.NewSource(seed))
+		var picks strings.Builder
+		for i := 0; i < 400; i++ {
+			returned, err := qb.Run("Pick", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			choice, _ := returned.Get("choice")
+			picks.WriteString(qb.Format(choice))
+		}
+		return picks.String()
+	}
+
+	first := picks(1)
+	if picks(1) != first {
+		t.Error("Expected the same seed to pick the same branches")
+	}
+	if a, b := strings.Count(first, "a"), strings.Count(first, "b"); a < 60 || a > 140 || a+b != 400 {
+		t.Errorf("Expected about 100 of 400 picks to be the branch with weight 1, got %d", a)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	qb := load(t, `
+Message = "unchanged"
+script main {
+    GetSkaterVelocity
+    if (<vel_y> < 0.0) {
+        Log text="falling" speed=<vel_y>
+    }
+    if IsOnGround {
+        Log text="on the ground"
+    }
+    if @(IsOnGround) {
+        Log text="still on the ground"
+    } else {
+        Log text="in the air"
+    }
+    Skater:Jump height=2
+    Change Message="changed"
+}
+`)
+	var logged []string
+	qb.Register("GetSkaterVelocity", func(call *interpreter.Call) (bool, error) {
+		call.Locals.Set("vel_y", float32(-1.5))
+		return true, nil
+	})
+	qb.Register("IsOnGround", func(call *interpreter.Call) (bool, error) {
+		return false, nil
+	})
+	qb.Register("Log", func(call *interpreter.Call) (bool, error) {
+		logged = append(logged, qb.Format(call.Arguments))
+		return true, nil
+	})
+	qb.Register("Jump", func(call *interpreter.Call) (bool, error) {
+		logged = append(logged, qb.Format(call.Object)+" jumps "+qb.Format(call.Arguments))
+		return true, nil
+	})
+	run(t, qb, "main", nil)
+
+	expect(t, "builtin calls", `{text="falling" speed=-1.5} | {text="in the air"} | Skater jumps {height=2}`, strings.Join(logged, " | "))
+	message, _ := qb.Global("Message")
+	expect(t, "Change", `"changed"`, qb.Format(message))
+}
+
+func TestErrors(t *testing.T) {
+	qb := load(t, `
+script main {
+    Helper
+}
+script Helper {
+    x = (<missing> + 1)
+}
+script Forever {
+    while {
+        Spin
+    }
+}
+script Unknown {
+    DoesntExist
+}
+`)
+	testCases := []struct {
+		script        string
+		expectedError string
+	}{
+		{"main", "main: Helper: <missing> isn't set"},
+		{"Unknown", "Unknown: Unknown script 'DoesntExist'"},
+		{"Forever", "Forever: Unknown script 'Spin'"},
+	}
+	for _, testCase := range testCases {
+		_, err := qb.Run(testCase.script, nil)
+		if err == nil || err.Error() != testCase.expectedError {
+			t.Errorf("Expected error '%s', got %v", testCase.expectedError, err)
+		}
+	}
+
+	var called []string
+	qb.Fallback = func(call *interpreter.Call) (bool, error) {
+		called = append(called, qb.Name(call.Name))
+		return true, nil
+	}
+	qb.MaxSteps = 100
+	if _, err := qb.Run("Forever", nil); err == nil || !strings.Contains(err.Error(), "Gave up after 100 statements") {
+		t.Errorf("Expected the infinite loop to be stopped, got %v", err)
+	}
+	if len(called) == 0 || called[0] != "Spin" {
+		t.Errorf("Expected unknown scripts to be passed to the fallback, got %v", called)
+	}
+}
@@ -0,0 +1,236 @@
+package interpreter
+
+import (
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A Value is one of: int32, float32, string, Checksum, Pair, Vector, *Struct or Array.
+type Value interface{}
+
+type Checksum uint32
+type Pair [2]float32
+type Vector [3]float32
+type Array []Value
+
+// A Struct is an ordered list of elements. Elements without names (like the flag in { hidden x = 1 }) have Name 0.
+// Script parameters, locals and return values are all structs.
+type Struct struct {
+	Elements []Element
+}
+
+type Element struct {
+	Name  uint32
+	Value Value
+}
+
+func (s *Struct) Get(name string) (Value, bool) {
+	return s.GetChecksum(compiler.StringToChecksum(name))
+}
+
+func (s *Struct) GetChecksum(name uint32) (Value, bool) {
+	if s == nil || name == 0 {
+		return nil, false
+	}
+	for _, element := range s.Elements {
+		if element.Name == name {
+			return element.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set replaces the element with the same name, or adds one to the end.
+func (s *Struct) Set(name string, value Value) {
+	s.SetChecksum(compiler.StringToChecksum(name), value)
+}
+
+func (s *Struct) SetChecksum(name uint32, value Value) {
+	if name == 0 {
+		s.Add(value)
+		return
+	}
+	for i, element := range s.Elements {
+		if element.Name == name {
+			s.Elements[i].Value = value
+			return
+		}
+	}
+	s.Elements = append(s.Elements, Element{Name: name, Value: value})
+}
+
+// Add adds an element without a name, unless an equal one is already there.
+func (s *Struct) Add(value Value) {
+	for _, element := range s.Elements {
+		if element.Name == 0 && valuesEqual(element.Value, value) {
+			return
+		}
+	}
+	s.Elements = append(s.Elements, Element{Value: value})
+}
+
+// HasFlag tells whether the struct has a flag (a checksum without a name), or an element, with the given name.
+// This is what GotParam checks.
+func (s *Struct) HasFlag(name string) bool {
+	return s.HasFlagChecksum(compiler.StringToChecksum(name))
+}
+
+func (s *Struct) HasFlagChecksum(name uint32) bool {
+	if s == nil {
+		return false
+	}
+	for _, element := range s.Elements {
+		if element.Name == name || (element.Name == 0 && element.Value == Checksum(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge copies every element of other into the struct, replacing elements with the same names.
+func (s *Struct) Merge(other *Struct) {
+	if other == nil {
+		return
+	}
+	for _, element := range other.Copy().Elements {
+		s.SetChecksum(element.Name, element.Value)
+	}
+}
+
+// Copy returns a deep copy, so changing it doesn't change the original.
+func (s *Struct) Copy() *Struct {
+	if s == nil {
+		return &Struct{}
+	}
+	elements := make([]Element, len(s.Elements))
+	for i, element := range s.Elements {
+		elements[i] = Element{Name: element.Name, Value: copyValue(element.Value)}
+	}
+	return &Struct{Elements: elements}
+}
+
+func copyValue(value Value) Value {
+	switch v := value.(type) {
+	case *Struct:
+		return v.Copy()
+	case Array:
+		array := make(Array, len(v))
+		for i, element := range v {
+			array[i] = copyValue(element)
+		}
+		return array
+	}
+	return value
+}
+
+func valuesEqual(a, b Value) bool {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x == y
+	}
+	switch v := a.(type) {
+	case *Struct:
+		other, ok := b.(*Struct)
+		if !ok || len(v.Elements) != len(other.Elements) {
+			return false
+		}
+		for i, element := range v.Elements {
+			if element.Name != other.Elements[i].Name || !valuesEqual(element.Value, other.Elements[i].Value) {
+				return false
+			}
+		}
+		return true
+	case Array:
+		other, ok := b.(Array)
+		if !ok || len(v) != len(other) {
+			return false
+		}
+		for i := range v {
+			if !valuesEqual(v[i], other[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// toNumber gives the value of an int or float.
+func toNumber(value Value) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func typeName(value Value) string {
+	switch value.(type) {
+	case int32:
+		return "int"
+	case float32:
+		return "float"
+	case string:
+		return "string"
+	case Checksum:
+		return "checksum"
+	case Pair:
+		return "pair"
+	case Vector:
+		return "vector"
+	case *Struct:
+		return "struct"
+	case Array:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// Format writes a value as NeverScript, using the names of checksums when they're known.
+func (interpreter *Interpreter) Format(value Value) string {
+	formatFloat := func(f float32) string {
+		text := strconv.FormatFloat(float64(f), 'g', -1, 32)
+		if !math.IsInf(float64(f), 0) && !math.IsNaN(float64(f)) && !strings.ContainsAny(text, ".e") {
+			text += ".0"
+		}
+		return text
+	}
+
+	switch v := value.(type) {
+	case int32:
+		return strconv.Itoa(int(v))
+	case float32:
+		return formatFloat(v)
+	case string:
+		return strconv.Quote(v)
+	case Checksum:
+		return interpreter.Name(uint32(v))
+	case Pair:
+		return fmt.Sprintf("(%s, %s)", formatFloat(v[0]), formatFloat(v[1]))
+	case Vector:
+		return fmt.Sprintf("(%s, %s, %s)", formatFloat(v[0]), formatFloat(v[1]), formatFloat(v[2]))
+	case *Struct:
+		var elements []string
+		for _, element := range v.Elements {
+			if element.Name == 0 {
+				elements = append(elements, interpreter.Format(element.Value))
+			} else {
+				elements = append(elements, interpreter.Name(element.Name)+"="+interpreter.Format(element.Value))
+			}
+		}
+		return "{" + strings.Join(elements, " ") + "}"
+	case Array:
+		var elements []string
+		for _, element := range v {
+			elements = append(elements, interpreter.Format(element))
+		}
+		return "[" + strings.Join(elements, " ") + "]"
+	}
+	return fmt.Sprintf("%v", value)
+}
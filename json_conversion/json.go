@@ -0,0 +1,662 @@
+// Package json_conversion converts QB data (the globals at the root of a QB file) to and from JSON.
+//
+// The root of the JSON is an object with a member for each global. Ints and strings are written as they are, arrays
+// are JSON arrays, and everything else is an object with a single member naming its kind:
+//
+//	{
+//	    "speed": 10,
+//	    "title": "Menu",
+//	    "scale": {"float": 1.5},
+//	    "icon": {"checksum": "icon_skater"},
+//	    "unknown": {"checksum": "#1CA1FF20"},
+//	    "offset": {"pair": [1, 2]},
+//	    "position": {"vector": [1, 2, 3]},
+//	    "caption": {"localString": "Press start"},
+//	    "options": {"struct": {"speed": 10, "colour": {"checksum": "red"}}},
+//	    "flags": {"struct": [{"value": {"checksum": "hidden"}}, {"name": "x", "value": 1}]}
+//	}
+//
+// Structs are written as objects, unless they contain values without names (like flags) or the same name twice, in
+// which case they're written as a list of elements instead.
+package json_conversion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type ExportArguments struct {
+	ByteCode   []byte
+	Dictionary map[uint32]string // optional, names for checksums that aren't in the file's name table
+
+	Json     []byte
+	Warnings []string // scripts and globals that couldn't be exported, and bytes that couldn't be decompiled
+}
+
+// member is one member of a JSON object. Objects are kept as lists of members so that globals and struct elements
+// stay in the same order.
+type member struct {
+	Key   string
+	Value interface{}
+}
+
+type object []member
+
+// Export turns the globals at the root of a QB file into JSON. Scripts, and globals with values that aren't data
+// (like expressions), are left out with a warning.
+func Export(arguments *ExportArguments) error {
+	decompilerArguments := decompiler.Arguments{ByteCode: arguments.ByteCode}
+	if err := decompiler.ParseByteCode(&decompilerArguments); err != nil {
+		return err
+	}
+	arguments.Warnings = nil
+	for _, problem := range decompilerArguments.Problems {
+		arguments.Warnings = append(arguments.Warnings, problem.String())
+	}
+
+	rootNodes := decompilerArguments.RootNode.Data.(compiler.AstData_Root).BodyNodes
+	nameTable := make(map[uint32]string)
+	for checksum, name := range arguments.Dictionary {
+		nameTable[checksum] = name
+	}
+	for _, node := range rootNodes {
+		if node.Kind == compiler.AstKind_NameTableEntry {
+			data := node.Data.(compiler.AstData_NameTableEntry)
+			nameTable[binary.LittleEndian.Uint32(data.ChecksumBytes)] = data.Name
+		}
+	}
+	// only names that hash to their checksums can be imported again
+	nameOf := func(checksumBytes []byte) string {
+		checksum := binary.LittleEndian.Uint32(checksumBytes)
+		if name, exists := nameTable[checksum]; exists && compiler.StringToChecksum(name) == checksum {
+			return name
+		}
+		return fmt.Sprintf("#%08X", checksum)
+	}
+
+	var exportValue func(node compiler.AstNode) (interface{}, error)
+	exportFloat := func(node compiler.AstNode) (json.Number, error) {
+		f := math.Float32frombits(binary.LittleEndian.Uint32(node.Data.(compiler.AstData_Float).FloatBytes))
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return "", fmt.Errorf("%v can't be written in JSON", f)
+		}
+		return json.Number(strconv.FormatFloat(float64(f), 'g', -1, 32)), nil
+	}
+	exportFloats := func(nodes ...compiler.AstNode) ([]json.Number, error) {
+		var numbers []json.Number
+		for _, node := range nodes {
+			number, err := exportFloat(node)
+			if err != nil {
+				return nil, err
+			}
+			numbers = append(numbers, number)
+		}
+		return numbers, nil
+	}
+	// The decompiler reads a checksum followed by more elements (e.g. the flag in { hidden x = 1 }) as an invocation.
+	flattenElements := func(elementNodes []compiler.AstNode) []compiler.AstNode {
+		var flattened []compiler.AstNode
+		for _, elementNode := range elementNodes {
+			if elementNode.Kind == compiler.AstKind_Invocation {
+				data := elementNode.Data.(compiler.AstData_Invocation)
+				flattened = append(flattened, data.ScriptIdentifierNode)
+				flattened = append(flattened, data.ParameterNodes...)
+				continue
+			}
+			flattened = append(flattened, elementNode)
+		}
+		return flattened
+	}
+	exportStruct := func(elementNodes []compiler.AstNode) (interface{}, error) {
+		var members object
+		var elements []interface{}
+		isObject := true
+		seen := make(map[string]bool)
+		for _, elementNode := range flattenElements(elementNodes) {
+			switch elementNode.Kind {
+			case compiler.AstKind_NewLine, compiler.AstKind_Comma:
+				continue
+			case compiler.AstKind_Assignment:
+				data := elementNode.Data.(compiler.AstData_Assignment)
+				if data.NameNode.Kind != compiler.AstKind_Checksum {
+					return nil, fmt.Errorf("struct element has a name that isn't a checksum (%s)", data.NameNode.Kind)
+				}
+				name := nameOf(data.NameNode.Data.(compiler.AstData_Checksum).ChecksumBytes)
+				value, err := exportValue(data.ValueNode)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", name, err)
+				}
+				if seen[name] {
+					isObject = false
+				}
+				seen[name] = true
+				members = append(members, member{name, value})
+				elements = append(elements, object{{"name", name}, {"value", value}})
+			default:
+				value, err := exportValue(elementNode)
+				if err != nil {
+					return nil, err
+				}
+				isObject = false
+				elements = append(elements, object{{"value", value}})
+			}
+		}
+		if isObject {
+			if members == nil {
+				members = object{}
+			}
+			return members, nil
+		}
+		return elements, nil
+	}
+
+	exportValue = func(node compiler.AstNode) (interface{}, error) {
+		switch data := node.Data.(type) {
+		case compiler.AstData_Integer:
+			return json.Number(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(data.IntegerBytes))))), nil
+		case compiler.AstData_Float:
+			number, err := exportFloat(node)
+			if err != nil {
+				return nil, err
+			}
+			return object{{"float", number}}, nil
+		case compiler.AstData_String:
+			text := strings.TrimSuffix(string(data.StringBytes), "\x00")
+			if data.IsLocalString {
+				return object{{"localString", text}}, nil
+			}
+			return text, nil
+		case compiler.AstData_Checksum:
+			if node.Kind == compiler.AstKind_Checksum {
+				return object{{"checksum", nameOf(data.ChecksumBytes)}}, nil
+			}
+		case compiler.AstData_Pair:
+			numbers, err := exportFloats(data.FloatNodeA, data.FloatNodeB)
+			if err != nil {
+				return nil, err
+			}
+			return object{{"pair", numbers}}, nil
+		case compiler.AstData_Vector:
+			numbers, err := exportFloats(data.FloatNodeA, data.FloatNodeB, data.FloatNodeC)
+			if err != nil {
+				return nil, err
+			}
+			return object{{"vector", numbers}}, nil
+		case compiler.AstData_Array:
+			values := []interface{}{}
+			for _, elementNode := range flattenElements(data.ElementNodes) {
+				if elementNode.Kind == compiler.AstKind_NewLine || elementNode.Kind == compiler.AstKind_Comma {
+					continue
+				}
+				value, err := exportValue(elementNode)
+				if err != nil {
+					return nil, fmt.Errorf("[%d]: %s", len(values), err)
+				}
+				values = append(values, value)
+			}
+			return values, nil
+		case compiler.AstData_Struct:
+			value, err := exportStruct(data.ElementNodes)
+			if err != nil {
+				return nil, err
+			}
+			return object{{"struct", value}}, nil
+		}
+		return nil, fmt.Errorf("%s isn't data", strings.TrimPrefix(node.Kind.String(), "AstKind_"))
+	}
+
+	var globals object
+	seen := make(map[string]bool)
+	for _, node := range rootNodes {
+		switch node.Kind {
+		case compiler.AstKind_NewLine, compiler.AstKind_NameTableEntry, compiler.AstKind_EndOfFile:
+			continue
+		case compiler.AstKind_Assignment:
+			data := node.Data.(compiler.AstData_Assignment)
+			if data.NameNode.Kind != compiler.AstKind_Checksum {
+				arguments.Warnings = append(arguments.Warnings, fmt.Sprintf("Skipped a global whose name isn't a checksum (%s)", data.NameNode.Kind))
+				continue
+			}
+			name := nameOf(data.NameNode.Data.(compiler.AstData_Checksum).ChecksumBytes)
+			value, err := exportValue(data.ValueNode)
+			if err != nil {
+				arguments.Warnings = append(arguments.Warnings, fmt.Sprintf("Skipped global '%s': %s", name, err))
+				continue
+			}
+			if seen[name] {
+				arguments.Warnings = append(arguments.Warnings, fmt.Sprintf("Global '%s' is defined more than once (only the last one is used when importing)", name))
+			}
+			seen[name] = true
+			globals = append(globals, member{name, value})
+		case compiler.AstKind_Script:
+			nameBytes := node.Data.(compiler.AstData_Script).NameNode.Data.(compiler.AstData_Checksum).ChecksumBytes
+			arguments.Warnings = append(arguments.Warnings, fmt.Sprintf("Skipped script '%s'", nameOf(nameBytes)))
+		default:
+			arguments.Warnings = append(arguments.Warnings, fmt.Sprintf("Skipped root-level %s", strings.TrimPrefix(node.Kind.String(), "AstKind_")))
+		}
+	}
+	if globals == nil {
+		globals = object{}
+	}
+
+	var buffer bytes.Buffer
+	if err := writeJson(&buffer, globals, 0); err != nil {
+		return err
+	}
+	buffer.WriteString("\n")
+	arguments.Json = buffer.Bytes()
+	return nil
+}
+
+const maxLineLength = 100
+
+// writeJson writes objects and arrays on one line when they fit, and with one member or element per line when they
+// don't. The root is always written on separate lines.
+func writeJson(buffer *bytes.Buffer, value interface{}, indentation int) error {
+	line, err := jsonOnOneLine(value)
+	if err != nil {
+		return err
+	}
+	members, isObject := value.(object)
+	elements, isArray := value.([]interface{})
+	isEmpty := (isObject && len(members) == 0) || (isArray && len(elements) == 0)
+	if (!isObject && !isArray) || isEmpty || (indentation > 0 && 4*indentation+len(line) <= maxLineLength) {
+		buffer.WriteString(line)
+		return nil
+	}
+
+	prefix := strings.Repeat("    ", indentation+1)
+	if isObject {
+		buffer.WriteString("{\n")
+		for i, member := range members {
+			key, err := json.Marshal(member.Key)
+			if err != nil {
+				return err
+			}
+			buffer.WriteString(prefix)
+			buffer.Write(key)
+			buffer.WriteString(": ")
+			if err := writeJson(buffer, member.Value, indentation+1); err != nil {
+				return err
+			}
+			if i < len(members)-1 {
+				buffer.WriteString(",")
+			}
+			buffer.WriteString("\n")
+		}
+		buffer.WriteString(strings.Repeat("    ", indentation) + "}")
+		return nil
+	}
+	buffer.WriteString("[\n")
+	for i, element := range elements {
+		buffer.WriteString(prefix)
+		if err := writeJson(buffer, element, indentation+1); err != nil {
+			return err
+		}
+		if i < len(elements)-1 {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("\n")
+	}
+	buffer.WriteString(strings.Repeat("    ", indentation) + "]")
+	return nil
+}
+
+func jsonOnOneLine(value interface{}) (string, error) {
+	var parts []string
+	switch value := value.(type) {
+	case object:
+		for _, member := range value {
+			key, err := json.Marshal(member.Key)
+			if err != nil {
+				return "", err
+			}
+			memberValue, err := jsonOnOneLine(member.Value)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, string(key)+": "+memberValue)
+		}
+		return "{" + strings.Join(parts, ", ") + "}", nil
+	case []interface{}:
+		for _, element := range value {
+			elementValue, err := jsonOnOneLine(element)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, elementValue)
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case []json.Number:
+		for _, number := range value {
+			parts = append(parts, number.String())
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	}
+	jsonBytes, err := json.Marshal(value)
+	return string(jsonBytes), err
+}
+
+// Import turns JSON (in the format written by Export) into QB bytecode.
+func Import(jsonBytes []byte) ([]byte, error) {
+	rootNode, err := ImportAst(jsonBytes)
+	if err != nil {
+		return nil, err
+	}
+	bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: rootNode}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+	return bytecodeCompiler.Bytes, nil
+}
+
+var rawChecksum = regexp.MustCompile(`^#[0-9A-Fa-f]{8}$`)
+
+// ImportAst turns JSON (in the format written by Export) into an AST for the compiler, with one assignment per line.
+func ImportAst(jsonBytes []byte) (compiler.AstNode, error) {
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.UseNumber()
+	root, err := readJson(decoder)
+	if err != nil {
+		return compiler.AstNode{}, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return compiler.AstNode{}, fmt.Errorf("Expected the end of the JSON after the globals")
+	}
+	globals, isObject := root.(object)
+	if !isObject {
+		return compiler.AstNode{}, fmt.Errorf("Expected an object containing the globals, found %s", describeJson(root))
+	}
+
+	newLine := compiler.AstNode{Kind: compiler.AstKind_NewLine, Data: compiler.AstData_Empty{}}
+	var rootNodes []compiler.AstNode
+	for _, global := range globals {
+		valueNode, err := importValue(global.Value, global.Key)
+		if err != nil {
+			return compiler.AstNode{}, err
+		}
+		rootNodes = append(rootNodes, assignmentNode(global.Key, valueNode), newLine)
+	}
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Root,
+		Data: compiler.AstData_Root{BodyNodes: rootNodes},
+	}, nil
+}
+
+// readJson reads a JSON value, keeping the members of objects in order.
+func readJson(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		members := object{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readJson(decoder)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, member{key.(string), value})
+		}
+		_, err := decoder.Token()
+		return members, err
+	case json.Delim('['):
+		values := []interface{}{}
+		for decoder.More() {
+			value, err := readJson(decoder)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		_, err := decoder.Token()
+		return values, err
+	}
+	return token, nil
+}
+
+func describeJson(value interface{}) string {
+	switch value := value.(type) {
+	case object:
+		if len(value) == 1 {
+			return fmt.Sprintf("an object with '%s'", value[0].Key)
+		}
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	}
+	return "null"
+}
+
+func importValue(value interface{}, path string) (compiler.AstNode, error) {
+	fail := func(format string, args ...interface{}) (compiler.AstNode, error) {
+		return compiler.AstNode{}, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+	newLine := compiler.AstNode{Kind: compiler.AstKind_NewLine, Data: compiler.AstData_Empty{}}
+	// one element per line, like the compiler does for code written that way
+	onSeparateLines := func(nodes []compiler.AstNode) []compiler.AstNode {
+		if len(nodes) == 0 {
+			return nodes
+		}
+		lines := []compiler.AstNode{newLine}
+		for _, node := range nodes {
+			lines = append(lines, node, newLine)
+		}
+		return lines
+	}
+	floats := func(value interface{}, kind string, size int) ([]compiler.AstNode, error) {
+		values, isArray := value.([]interface{})
+		if !isArray || len(values) != size {
+			_, err := fail("Expected %s to have an array of %d numbers", kind, size)
+			return nil, err
+		}
+		var nodes []compiler.AstNode
+		for _, value := range values {
+			number, isNumber := value.(json.Number)
+			if !isNumber {
+				_, err := fail("Expected %s to have an array of %d numbers, found %s", kind, size, describeJson(value))
+				return nil, err
+			}
+			node, err := floatNode(number)
+			if err != nil {
+				_, err = fail("%s", err)
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes, nil
+	}
+
+	switch value := value.(type) {
+	case json.Number:
+		if strings.ContainsAny(value.String(), ".eE") {
+			node, err := floatNode(value)
+			if err != nil {
+				return fail("%s", err)
+			}
+			return node, nil
+		}
+		if _, err := strconv.ParseInt(value.String(), 10, 32); err != nil {
+			return fail("%s isn't a 32-bit int", value)
+		}
+		return compiler.AstNode{
+			Kind: compiler.AstKind_Integer,
+			Data: compiler.AstData_Integer{IntegerToken: compiler.Token{Kind: compiler.TokenKind_Integer, Data: value.String()}},
+		}, nil
+	case string:
+		return stringNode(value, false), nil
+	case []interface{}:
+		var elementNodes []compiler.AstNode
+		for i, element := range value {
+			elementNode, err := importValue(element, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return compiler.AstNode{}, err
+			}
+			elementNodes = append(elementNodes, elementNode)
+		}
+		return compiler.AstNode{
+			Kind: compiler.AstKind_Array,
+			Data: compiler.AstData_Array{ElementNodes: onSeparateLines(elementNodes)},
+		}, nil
+	case object:
+		if len(value) != 1 {
+			return fail("Expected an object with one of float, checksum, localString, pair, vector or struct, found %d members", len(value))
+		}
+		kind, kindValue := value[0].Key, value[0].Value
+		path += "." + kind
+		switch kind {
+		case "float":
+			number, isNumber := kindValue.(json.Number)
+			if !isNumber {
+				return fail("Expected a number, found %s", describeJson(kindValue))
+			}
+			node, err := floatNode(number)
+			if err != nil {
+				return fail("%s", err)
+			}
+			return node, nil
+		case "checksum":
+			name, isString := kindValue.(string)
+			if !isString {
+				return fail("Expected a name or #XXXXXXXX, found %s", describeJson(kindValue))
+			}
+			return checksumNode(name), nil
+		case "localString":
+			text, isString := kindValue.(string)
+			if !isString {
+				return fail("Expected a string, found %s", describeJson(kindValue))
+			}
+			return stringNode(text, true), nil
+		case "pair":
+			nodes, err := floats(kindValue, kind, 2)
+			if err != nil {
+				return compiler.AstNode{}, err
+			}
+			return compiler.AstNode{
+				Kind: compiler.AstKind_Pair,
+				Data: compiler.AstData_Pair{FloatNodeA: nodes[0], FloatNodeB: nodes[1]},
+			}, nil
+		case "vector":
+			nodes, err := floats(kindValue, kind, 3)
+			if err != nil {
+				return compiler.AstNode{}, err
+			}
+			return compiler.AstNode{
+				Kind: compiler.AstKind_Vector,
+				Data: compiler.AstData_Vector{FloatNodeA: nodes[0], FloatNodeB: nodes[1], FloatNodeC: nodes[2]},
+			}, nil
+		case "struct":
+			var elementNodes []compiler.AstNode
+			switch elements := kindValue.(type) {
+			case object:
+				for _, element := range elements {
+					valueNode, err := importValue(element.Value, path+"."+element.Key)
+					if err != nil {
+						return compiler.AstNode{}, err
+					}
+					elementNodes = append(elementNodes, assignmentNode(element.Key, valueNode))
+				}
+			case []interface{}:
+				for i, element := range elements {
+					elementPath := fmt.Sprintf("%s[%d]", path, i)
+					members, isObject := element.(object)
+					var name, elementValue interface{}
+					for _, member := range members {
+						switch member.Key {
+						case "name":
+							name = member.Value
+						case "value":
+							elementValue = member.Value
+						default:
+							isObject = false
+						}
+					}
+					if !isObject || elementValue == nil {
+						return fail("Expected struct elements like {\"name\": \"x\", \"value\": 1} or {\"value\": 1}, found %s at [%d]", describeJson(element), i)
+					}
+					valueNode, err := importValue(elementValue, elementPath)
+					if err != nil {
+						return compiler.AstNode{}, err
+					}
+					if name == nil {
+						elementNodes = append(elementNodes, valueNode)
+					} else if name, isString := name.(string); isString {
+						elementNodes = append(elementNodes, assignmentNode(name, valueNode))
+					} else {
+						return fail("Expected the name at [%d] to be a string, found %s", i, describeJson(name))
+					}
+				}
+			default:
+				return fail("Expected an object or an array of elements, found %s", describeJson(kindValue))
+			}
+			return compiler.AstNode{
+				Kind: compiler.AstKind_Struct,
+				Data: compiler.AstData_Struct{ElementNodes: onSeparateLines(elementNodes)},
+			}, nil
+		}
+		return fail("Unknown kind '%s' (expected float, checksum, localString, pair, vector or struct)", kind)
+	}
+	return fail("Found %s, which can't be written in QB", describeJson(value))
+}
+
+func floatNode(number json.Number) (compiler.AstNode, error) {
+	if _, err := strconv.ParseFloat(number.String(), 32); err != nil {
+		return compiler.AstNode{}, fmt.Errorf("%s isn't a 32-bit float", number)
+	}
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Float,
+		Data: compiler.AstData_Float{FloatToken: compiler.Token{Kind: compiler.TokenKind_Float, Data: number.String()}},
+	}, nil
+}
+
+func stringNode(text string, isLocalString bool) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_String,
+		Data: compiler.AstData_String{
+			StringToken:   compiler.Token{Kind: compiler.TokenKind_String, Data: "\"" + text + "\""},
+			IsLocalString: isLocalString,
+		},
+	}
+}
+
+// checksumNode takes a name, or #XXXXXXXX for a checksum without one.
+func checksumNode(name string) compiler.AstNode {
+	if rawChecksum.MatchString(name) {
+		return compiler.AstNode{
+			Kind: compiler.AstKind_Checksum,
+			Data: compiler.AstData_Checksum{
+				IsRawChecksum: true,
+				ChecksumToken: compiler.Token{Kind: compiler.TokenKind_RawChecksum, Data: name},
+			},
+		}
+	}
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Checksum,
+		Data: compiler.AstData_Checksum{ChecksumToken: compiler.Token{Kind: compiler.TokenKind_Identifier, Data: name}},
+	}
+}
+
+func assignmentNode(name string, valueNode compiler.AstNode) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Assignment,
+		Data: compiler.AstData_Assignment{NameNode: checksumNode(name), ValueNode: valueNode},
+	}
+}
@@ -0,0 +1,96 @@
+package json_conversion_test
+
+import (
+	"bytes"
+	"flag"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"github.com/byxor/NeverScript/json_conversion"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/data.json")
+
+// testdata/data.ns is compiled and exported, then imported and exported again, which should give the same JSON.
+func TestRoundTrip(t *testing.T) {
+	var lexer compiler.Lexer
+	var parser compiler.Parser
+	var bytecodeCompiler compiler.BytecodeCompiler
+	if err := compiler.CompileToBytes(filepath.Join("testdata", "data.ns"), &lexer, &parser, &bytecodeCompiler); err != nil {
+		t.Fatal(err)
+	}
+
+	exported := export(t, bytecodeCompiler.Bytes)
+	goldenPath := filepath.Join("testdata", "data.json")
+	if *update {
+		if err := ioutil.WriteFile(goldenPath, exported.Json, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, exported.Json) {
+		t.Errorf("'%s' changed (run 'go test ./json_conversion -update' if that's on purpose), got:\n%s", goldenPath, exported.Json)
+	}
+	if strings.Join(exported.Warnings, "\n") != "Skipped script 'Foo'" {
+		t.Errorf("Unexpected warnings: %v", exported.Warnings)
+	}
+
+	imported, err := json_conversion.Import(exported.Json)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range disassembler.Verify(imported) {
+		t.Error(problem)
+	}
+	if reexported := export(t, imported); !bytes.Equal(exported.Json, reexported.Json) {
+		t.Errorf("Exporting the imported QB gave different JSON:\n%s", reexported.Json)
+	}
+}
+
+func TestLocalStrings(t *testing.T) {
+	imported, err := json_conversion.Import([]byte(`{"caption": {"localString": "Press start"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(imported, append([]byte{disassembler.Opcode_LocalString, 12, 0, 0, 0}, "Press start"...)) {
+		t.Errorf("Expected a local string in:\n%s", disassembler.Disassemble(disassembler.DisassemblyArguments{ByteCode: imported}))
+	}
+	if exported := export(t, imported); !strings.Contains(string(exported.Json), `"caption": {"localString": "Press start"}`) {
+		t.Errorf("Expected a local string in:\n%s", exported.Json)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	for _, test := range []struct {
+		json  string
+		error string
+	}{
+		{`[1, 2]`, "Expected an object containing the globals, found an array"},
+		{`{"x": true}`, "x: Found a boolean, which can't be written in QB"},
+		{`{"x": 4294967296}`, "x: 4294967296 isn't a 32-bit int"},
+		{`{"x": {"struct": {"y": [1, {"colour": "red"}]}}}`, "x.struct.y[1].colour: Unknown kind 'colour'"},
+		{`{"x": {"pair": [1]}}`, "x.pair: Expected pair to have an array of 2 numbers"},
+		{`{"x": {"struct": [{"name": "y"}]}}`, "x.struct: Expected struct elements like"},
+		{`{"x": 1} {}`, "Expected the end of the JSON after the globals"},
+	} {
+		_, err := json_conversion.Import([]byte(test.json))
+		if err == nil || !strings.HasPrefix(err.Error(), test.error) {
+			t.Errorf("Importing %s: expected an error starting with %q, got %v", test.json, test.error, err)
+		}
+	}
+}
+
+func export(t *testing.T, byteCode []byte) json_conversion.ExportArguments {
+	t.Helper()
+	arguments := json_conversion.ExportArguments{ByteCode: byteCode}
+	if err := json_conversion.Export(&arguments); err != nil {
+		t.Fatal(err)
+	}
+	return arguments
+}
@@ -0,0 +1,170 @@
+package qb
+
+import (
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"math"
+)
+
+// A Block is a script, or the body of an if-statement, while loop or random branch.
+// Each method adds a statement and returns the block, so they can be chained.
+type Block struct {
+	isScript       bool
+	name           compiler.AstNode
+	parameterNodes []compiler.AstNode
+	statements     []compiler.AstNode
+}
+
+func Script(name string) *Block {
+	return &Block{isScript: true, name: Name(name)}
+}
+
+// Param adds a parameter with a default value to a script.
+func (block *Block) Param(name string, defaultValue interface{}) *Block {
+	if !block.isScript {
+		panic("qb: only scripts have parameters")
+	}
+	block.parameterNodes = append(block.parameterNodes, Arg(name, defaultValue))
+	return block
+}
+
+// Node is the script.
+func (block *Block) Node() compiler.AstNode {
+	if !block.isScript {
+		panic("qb: only scripts can be turned into a node")
+	}
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Script,
+		Data: compiler.AstData_Script{
+			NameNode:              block.name,
+			DefaultParameterNodes: block.parameterNodes,
+			BodyNodes:             block.bodyNodes(),
+		},
+	}
+}
+
+// bodyNodes puts each statement on its own line, like the parser does.
+func (block *Block) bodyNodes() []compiler.AstNode {
+	if len(block.statements) == 0 {
+		return nil
+	}
+	bodyNodes := []compiler.AstNode{newLine()}
+	for _, statement := range block.statements {
+		bodyNodes = append(bodyNodes, statement, newLine())
+	}
+	return bodyNodes
+}
+
+func newLine() compiler.AstNode {
+	return compiler.AstNode{Kind: compiler.AstKind_NewLine, Data: compiler.AstData_Empty{}}
+}
+
+func body(build func(*Block)) []compiler.AstNode {
+	block := &Block{}
+	if build != nil {
+		build(block)
+	}
+	return block.bodyNodes()
+}
+
+// Statement adds any node as a statement.
+func (block *Block) Statement(node compiler.AstNode) *Block {
+	block.statements = append(block.statements, node)
+	return block
+}
+
+// Call calls a script.
+func (block *Block) Call(name string, arguments ...interface{}) *Block {
+	return block.Statement(Invocation(name, arguments...))
+}
+
+// Set assigns a value to a name.
+func (block *Block) Set(name string, value interface{}) *Block {
+	return block.Statement(Arg(name, value))
+}
+
+// If adds an if-statement. Conditions can be any value, or a BooleanInvocation from ReturnsTrue.
+func (block *Block) If(condition interface{}, build func(*Block)) *Block {
+	return block.Statement(compiler.AstNode{
+		Kind: compiler.AstKind_IfStatement,
+		Data: compiler.AstData_IfStatement{},
+	}).addBranch("If", condition, build)
+}
+
+// ElseIf adds an else-if to the if-statement that was just added.
+func (block *Block) ElseIf(condition interface{}, build func(*Block)) *Block {
+	return block.addBranch("ElseIf", condition, build)
+}
+
+// Else adds an else to the if-statement that was just added.
+func (block *Block) Else(build func(*Block)) *Block {
+	return block.addBranch("Else", nil, build)
+}
+
+func (block *Block) addBranch(method string, condition interface{}, build func(*Block)) *Block {
+	last := len(block.statements) - 1
+	if last < 0 || block.statements[last].Kind != compiler.AstKind_IfStatement {
+		panic(fmt.Sprintf("qb: %s has to come straight after an If", method))
+	}
+	data := block.statements[last].Data.(compiler.AstData_IfStatement)
+	if len(data.Bodies) > len(data.Conditions) {
+		panic(fmt.Sprintf("qb: %s can't come after an Else", method))
+	}
+
+	if method != "Else" {
+		isBooleanInvocation := false
+		if booleanInvocation, ok := condition.(BooleanInvocation); ok {
+			condition = booleanInvocation.Node
+			isBooleanInvocation = true
+		}
+		data.Conditions = append(data.Conditions, Value(condition))
+		data.BooleanInvocationData = append(data.BooleanInvocationData, isBooleanInvocation)
+	}
+	data.Bodies = append(data.Bodies, body(build))
+	block.statements[last].Data = data
+	return block
+}
+
+func (block *Block) While(build func(*Block)) *Block {
+	return block.Statement(compiler.AstNode{
+		Kind: compiler.AstKind_WhileLoop,
+		Data: compiler.AstData_WhileLoop{BodyNodes: body(build)},
+	})
+}
+
+func (block *Block) Break() *Block {
+	return block.Statement(compiler.AstNode{Kind: compiler.AstKind_Break, Data: compiler.AstData_Empty{}})
+}
+
+// Return returns from a script, with arguments like Arg("x", 1) or Name("true").
+func (block *Block) Return(arguments ...interface{}) *Block {
+	return block.Statement(compiler.AstNode{
+		Kind: compiler.AstKind_Return,
+		Data: compiler.AstData_UnaryExpression{Node: Invocation("return", arguments...)},
+	})
+}
+
+type RandomBranch struct {
+	Weight int
+	Build  func(*Block)
+}
+
+func Branch(weight int, build func(*Block)) RandomBranch {
+	return RandomBranch{Weight: weight, Build: build}
+}
+
+// Random picks one of the branches, with a chance of weight/(total weight).
+func (block *Block) Random(branches ...RandomBranch) *Block {
+	if len(branches) == 0 {
+		panic("qb: Random needs at least one branch")
+	}
+	var data compiler.AstData_Random
+	for _, branch := range branches {
+		if branch.Weight < 0 || branch.Weight > math.MaxUint16 {
+			panic(fmt.Sprintf("qb: random branch weights have to fit in 16 bits, not %d", branch.Weight))
+		}
+		data.BranchWeights = append(data.BranchWeights, Int(int32(branch.Weight)))
+		data.Branches = append(data.Branches, body(branch.Build))
+	}
+	return block.Statement(compiler.AstNode{Kind: compiler.AstKind_Random, Data: data})
+}
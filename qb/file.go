@@ -0,0 +1,44 @@
+package qb
+
+import (
+	"github.com/byxor/NeverScript/compiler"
+)
+
+// A FileBuilder collects the globals and scripts of a QB file, in order.
+type FileBuilder struct {
+	items []func() compiler.AstNode
+}
+
+func File() *FileBuilder {
+	return &FileBuilder{}
+}
+
+func (file *FileBuilder) Global(name string, value interface{}) *FileBuilder {
+	node := Arg(name, value)
+	file.items = append(file.items, func() compiler.AstNode { return node })
+	return file
+}
+
+// Script adds a script. Statements added to it afterwards are still included.
+func (file *FileBuilder) Script(script *Block) *FileBuilder {
+	file.items = append(file.items, script.Node)
+	return file
+}
+
+// Node is the root of the file, which can be passed to compiler.GenerateBytecode.
+func (file *FileBuilder) Node() compiler.AstNode {
+	bodyNodes := []compiler.AstNode{newLine()}
+	for _, item := range file.items {
+		bodyNodes = append(bodyNodes, item(), newLine())
+	}
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Root,
+		Data: compiler.AstData_Root{BodyNodes: bodyNodes},
+	}
+}
+
+func (file *FileBuilder) Bytes() []byte {
+	bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: file.Node()}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+	return bytecodeCompiler.Bytes
+}
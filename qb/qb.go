@@ -0,0 +1,277 @@
+// Package qb builds QB code from Go without writing NeverScript source code first.
+//
+//	setSpeed := qb.Script("SetSpeed").Param("speed", 10)
+//	setSpeed.If(qb.Gt(qb.Local("speed"), qb.Name("MaxSpeed")), func(body *qb.Block) {
+//	    body.Call("printf", "Too fast")
+//	    body.Return()
+//	})
+//	setSpeed.Call("SetSkaterSpeed", qb.Arg("speed", qb.Local("speed")))
+//
+//	byteCode := qb.File().Global("MaxSpeed", 20).Script(setSpeed).Bytes()
+//
+// gives the same bytes as compiling
+//
+//	MaxSpeed = 20
+//	script SetSpeed speed=10 {
+//	    if (<speed> > MaxSpeed) {
+//	        printf "Too fast"
+//	        return
+//	    }
+//	    SetSkaterSpeed speed=<speed>
+//	}
+//
+// Wherever a value is expected, Go ints, float32s, float64s and strings can be used as well as nodes.
+// Mistakes in the calling code (values of other types, an Else without an If...) panic, like regexp.MustCompile.
+package qb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"math"
+)
+
+// Value turns an int, float32, float64 or string into a node. Nodes are returned as they are.
+func Value(value interface{}) compiler.AstNode {
+	switch value := value.(type) {
+	case compiler.AstNode:
+		return value
+	case int:
+		if value < math.MinInt32 || value > math.MaxInt32 {
+			panic(fmt.Sprintf("qb: %d doesn't fit in a 32-bit int", value))
+		}
+		return Int(int32(value))
+	case int32:
+		return Int(value)
+	case float32:
+		return Float(value)
+	case float64:
+		return Float(float32(value))
+	case string:
+		return String(value)
+	case BooleanInvocation:
+		panic("qb: ReturnsTrue can only be used as the condition of an if-statement")
+	}
+	panic(fmt.Sprintf("qb: can't turn %#v (%T) into a node", value, value))
+}
+
+func values(values []interface{}) []compiler.AstNode {
+	var nodes []compiler.AstNode
+	for _, value := range values {
+		nodes = append(nodes, Value(value))
+	}
+	return nodes
+}
+
+func Int(n int32) compiler.AstNode {
+	integerBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(integerBytes, uint32(n))
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Integer,
+		Data: compiler.AstData_Integer{IntegerBytes: integerBytes},
+	}
+}
+
+func Float(f float32) compiler.AstNode {
+	floatBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(floatBytes, math.Float32bits(f))
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Float,
+		Data: compiler.AstData_Float{FloatBytes: floatBytes},
+	}
+}
+
+func String(text string) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_String,
+		Data: compiler.AstData_String{StringToken: compiler.Token{Kind: compiler.TokenKind_String, Data: "\"" + text + "\""}},
+	}
+}
+
+func LocalString(text string) compiler.AstNode {
+	node := String(text)
+	data := node.Data.(compiler.AstData_String)
+	data.IsLocalString = true
+	node.Data = data
+	return node
+}
+
+// Name is the checksum of a name, which is added to the name table.
+func Name(name string) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Checksum,
+		Data: compiler.AstData_Checksum{ChecksumToken: compiler.Token{Kind: compiler.TokenKind_Identifier, Data: name}},
+	}
+}
+
+// Checksum is a checksum without a name, like #1CA1FF20 in NeverScript.
+func Checksum(checksum uint32) compiler.AstNode {
+	checksumBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(checksumBytes, checksum)
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Checksum,
+		Data: compiler.AstData_Checksum{IsRawChecksum: true, ChecksumBytes: checksumBytes},
+	}
+}
+
+func Pair(a, b float32) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Pair,
+		Data: compiler.AstData_Pair{FloatNodeA: Float(a), FloatNodeB: Float(b)},
+	}
+}
+
+func Vector(a, b, c float32) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Vector,
+		Data: compiler.AstData_Vector{FloatNodeA: Float(a), FloatNodeB: Float(b), FloatNodeC: Float(c)},
+	}
+}
+
+// Array is [a, b, c].
+func Array(elements ...interface{}) compiler.AstNode {
+	var elementNodes []compiler.AstNode
+	for i, element := range elements {
+		if i > 0 {
+			elementNodes = append(elementNodes, compiler.AstNode{Kind: compiler.AstKind_Comma, Data: compiler.AstData_Empty{}})
+		}
+		elementNodes = append(elementNodes, Value(element))
+	}
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Array,
+		Data: compiler.AstData_Array{ElementNodes: elementNodes},
+	}
+}
+
+// Struct is {a=1 b=2 flag}, made from Args and Names.
+func Struct(elements ...interface{}) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Struct,
+		Data: compiler.AstData_Struct{ElementNodes: values(elements)},
+	}
+}
+
+// Arg is name=value, for arguments, structs and default parameters.
+func Arg(name string, value interface{}) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Assignment,
+		Data: compiler.AstData_Assignment{NameNode: Name(name), ValueNode: Value(value)},
+	}
+}
+
+// Local is <name>.
+func Local(name string) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_LocalReference,
+		Data: compiler.AstData_LocalReference{Node: Name(name)},
+	}
+}
+
+// AllArgs is <...>, which passes every argument along.
+func AllArgs() compiler.AstNode {
+	return compiler.AstNode{Kind: compiler.AstKind_AllArguments, Data: compiler.AstData_Empty{}}
+}
+
+func binaryExpression(kind compiler.AstKind, left, right interface{}) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: kind,
+		Data: compiler.AstData_BinaryExpression{LeftNode: Value(left), RightNode: Value(right)},
+	}
+}
+
+func Add(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_AdditionExpression, left, right)
+}
+
+func Sub(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_SubtractionExpression, left, right)
+}
+
+func Mul(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_MultiplicationExpression, left, right)
+}
+
+func Div(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_DivisionExpression, left, right)
+}
+
+func Eq(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_EqualsExpression, left, right)
+}
+
+func NotEq(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_NotEqualExpression, left, right)
+}
+
+func Lt(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_LessThanExpression, left, right)
+}
+
+func LtEq(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_LessThanEqualsExpression, left, right)
+}
+
+func Gt(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_GreaterThanExpression, left, right)
+}
+
+func GtEq(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_GreaterThanEqualsExpression, left, right)
+}
+
+func And(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_LogicalAnd, left, right)
+}
+
+func Or(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_LogicalOr, left, right)
+}
+
+// Dot is left.right, e.g. a member of a struct.
+func Dot(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_DotExpression, left, right)
+}
+
+// Colon is left:right.
+func Colon(left, right interface{}) compiler.AstNode {
+	return binaryExpression(compiler.AstKind_ColonExpression, left, right)
+}
+
+func Not(value interface{}) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_LogicalNot,
+		Data: compiler.AstData_UnaryExpression{Node: Value(value)},
+	}
+}
+
+// Index is array[index].
+func Index(array, index interface{}) compiler.AstNode {
+	return compiler.AstNode{
+		Kind: compiler.AstKind_ArrayAccess,
+		Data: compiler.AstData_ArrayAccess{Array: Value(array), Index: Value(index)},
+	}
+}
+
+// Invocation is a call to a script, e.g. as the value of a global. Use Block.Call for statements.
+func Invocation(name string, arguments ...interface{}) compiler.AstNode {
+	if len(arguments) == 0 {
+		return Name(name)
+	}
+	return compiler.AstNode{
+		Kind: compiler.AstKind_Invocation,
+		Data: compiler.AstData_Invocation{ScriptIdentifierNode: Name(name), ParameterNodes: values(arguments)},
+	}
+}
+
+// A BooleanInvocation is the condition in if @(name arguments...).
+type BooleanInvocation struct {
+	Node compiler.AstNode
+}
+
+// ReturnsTrue is a condition that calls a script and checks whether it returned true.
+func ReturnsTrue(name string, arguments ...interface{}) BooleanInvocation {
+	return BooleanInvocation{Node: compiler.AstNode{
+		Kind: compiler.AstKind_UnaryExpression,
+		Data: compiler.AstData_UnaryExpression{Node: Invocation(name, arguments...)},
+	}}
+}
@@ -0,0 +1,176 @@
+package qb_test
+
+import (
+	"bytes"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"github.com/byxor/NeverScript/qb"
+	"strings"
+	"testing"
+)
+
+// Each builder should give exactly the same bytes as compiling the NeverScript next to it.
+func TestBuildersMatchTheCompiler(t *testing.T) {
+	testCases := []struct {
+		file       *qb.FileBuilder
+		sourceCode string
+	}{
+		{
+			qb.File().
+				Global("speed", 10).
+				Global("scale", -1.5).
+				Global("title", "Menu").
+				Global("icon", qb.Name("icon_skater")).
+				Global("unknown", qb.Checksum(0x1CA1FF20)).
+				Global("offset", qb.Pair(1, 2.5)).
+				Global("position", qb.Vector(1, -2, 3.25)),
+			`speed = 10
+scale = -1.5
+title = "Menu"
+icon = icon_skater
+unknown = #1CA1FF20
+offset = (1.0, 2.5)
+position = (1.0, -2.0, 3.25)
+`,
+		},
+		{
+			qb.File().
+				Global("options", qb.Struct(qb.Arg("speed", 10), qb.Name("hidden"), qb.Arg("colour", qb.Name("red")))).
+				Global("list", qb.Array(1, 2, qb.Array(), qb.Struct())),
+			`options = { speed=10 hidden colour=red }
+list = [1, 2, [], {}]
+`,
+		},
+		{
+			qb.File().Script(
+				qb.Script("SetSpeed").Param("speed", 10).
+					If(qb.Gt(qb.Local("speed"), qb.Name("MaxSpeed")), func(body *qb.Block) {
+						body.Call("printf", "Too fast")
+						body.Return()
+					}).
+					Call("SetSkaterSpeed", qb.Arg("speed", qb.Local("speed")), qb.AllArgs()),
+			),
+			`script SetSpeed speed=10 {
+    if (<speed> > MaxSpeed) {
+        printf "Too fast"
+        return
+    }
+    SetSkaterSpeed speed=<speed> <...>
+}
+`,
+		},
+		{
+			qb.File().Script(
+				qb.Script("Conditions").
+					If(qb.ReturnsTrue("is_north"), func(body *qb.Block) {
+						body.Set("x", qb.Add(qb.Local("x"), 1))
+					}).
+					ElseIf(qb.And(qb.Eq(qb.Local("a"), 1), qb.Not(qb.Local("b"))), func(body *qb.Block) {
+						body.Return(qb.Name("true"))
+					}).
+					ElseIf(qb.ReturnsTrue("is_east", qb.Arg("strict", 1)), func(body *qb.Block) {
+						body.Return(qb.Name("false"))
+					}).
+					Else(func(body *qb.Block) {
+						body.Return(qb.Arg("x", 1), qb.Arg("y", qb.Index(qb.Local("list"), 0)))
+					}),
+			),
+			`script Conditions {
+    if @(is_north) {
+        x = (<x> + 1)
+    } else if (<a> = 1) and ! <b> {
+        return true
+    } else if @(is_east strict=1) {
+        return false
+    } else {
+        return x=1 y=<list>[0]
+    }
+}
+`,
+		},
+		{
+			qb.File().Script(
+				qb.Script("Loops").
+					While(func(body *qb.Block) {
+						body.Call("Tick").Call("Wait", 1, qb.Name("frame"))
+						body.If(qb.LtEq(qb.Local("time"), 0.5), func(body *qb.Block) {
+							body.Break()
+						})
+					}).
+					Random(
+						qb.Branch(10, func(body *qb.Block) { body.Call("print", "a") }),
+						qb.Branch(5, func(body *qb.Block) { body.Call("print", "b") }),
+					),
+			),
+			`script Loops {
+    while {
+        Tick
+        Wait 1 frame
+        if (<time> <= 0.5) {
+            break
+        }
+    }
+    random {
+        10 {
+            print "a"
+        }
+        5 {
+            print "b"
+        }
+    }
+}
+`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		expected := compileSourceCode(t, testCase.sourceCode)
+		if actual := testCase.file.Bytes(); !bytes.Equal(expected, actual) {
+			t.Errorf("Expected the same bytes as compiling:\n%s\nexpected % X\ngot      % X", testCase.sourceCode, expected, actual)
+		}
+	}
+}
+
+func TestStatementsAddedAfterTheScriptAreIncluded(t *testing.T) {
+	script := qb.Script("Foo")
+	file := qb.File().Script(script)
+	script.Call("Bar")
+
+	arguments := decompiler.Arguments{ByteCode: file.Bytes()}
+	if err := decompiler.Decompile(&arguments); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(arguments.SourceCode, "Bar") {
+		t.Errorf("Expected a call to Bar, got:\n%s", arguments.SourceCode)
+	}
+}
+
+func TestMistakesPanic(t *testing.T) {
+	mistakes := map[string]func(){
+		"Else without If":         func() { qb.Script("Foo").Call("Bar").Else(nil) },
+		"ElseIf after Else":       func() { qb.Script("Foo").If(1, nil).Else(nil).ElseIf(1, nil) },
+		"unsupported value":       func() { qb.Value(true) },
+		"int too big":             func() { qb.Value(1 << 40) },
+		"ReturnsTrue as value":    func() { qb.File().Global("x", qb.ReturnsTrue("Foo")) },
+		"random without branches": func() { qb.Script("Foo").Random() },
+	}
+	for name, mistake := range mistakes {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected %s to panic", name)
+				}
+			}()
+			mistake()
+		}()
+	}
+}
+
+func compileSourceCode(t *testing.T, sourceCode string) []byte {
+	t.Helper()
+	byteCode, err := compiler.CompileSourceCode(sourceCode, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return byteCode
+}
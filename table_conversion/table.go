@@ -0,0 +1,227 @@
+// Package table_conversion turns spreadsheets (CSV or TSV files with a header row) into a global array of structs.
+//
+// Each column in the header has a name and a type, e.g.
+//
+//	trick:checksum, score:int, multiplier:float, name:string, position:vector
+//	Kickflip,       100,       1.5,              Kickflip,    1 2 3
+//
+// becomes
+//
+//	Tricks = [
+//	    { trick = Kickflip score = 100 multiplier = 1.5 name = "Kickflip" position = (1.0, 2.0, 3.0) }
+//	]
+//
+// Empty cells are left out of their row's struct.
+package table_conversion
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/decompiler"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type ColumnType int
+
+const (
+	ColumnType_Int ColumnType = iota
+	ColumnType_Float
+	ColumnType_String
+	ColumnType_Checksum
+	ColumnType_Pair
+	ColumnType_Vector
+)
+
+var columnTypeNames = [...]string{
+	"int",
+	"float",
+	"string",
+	"checksum",
+	"pair",
+	"vector",
+}
+
+func (columnType ColumnType) String() string {
+	return columnTypeNames[columnType]
+}
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+type Table struct {
+	Columns []Column
+	Rows    [][]string // one cell per column
+}
+
+// ReadTable reads a table with a header row of 'name:type' columns. Use ',' for CSV files and '\t' for TSV files.
+func ReadTable(reader io.Reader, delimiter rune) (Table, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = delimiter
+	csvReader.TrimLeadingSpace = true
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return Table{}, err
+	}
+	if len(records) == 0 {
+		return Table{}, errors.New("The table is empty (expected a header row like 'name:string,score:int')")
+	}
+
+	var table Table
+	for _, header := range records[0] {
+		separator := strings.LastIndex(header, ":")
+		if separator == -1 {
+			return Table{}, fmt.Errorf("Column '%s' needs a type, e.g. '%s:int' (%s)", header, header, strings.Join(columnTypeNames[:], ", "))
+		}
+		column := Column{Name: strings.TrimSpace(header[:separator])}
+		typeName := strings.ToLower(strings.TrimSpace(header[separator+1:]))
+		isKnownType := false
+		for i, name := range columnTypeNames {
+			if name == typeName {
+				column.Type = ColumnType(i)
+				isKnownType = true
+			}
+		}
+		if !isKnownType {
+			return Table{}, fmt.Errorf("Column '%s' has an unknown type '%s' (expected %s)", column.Name, typeName, strings.Join(columnTypeNames[:], ", "))
+		}
+		if _, canBeWritten := decompiler.RenderName(column.Name); !canBeWritten {
+			return Table{}, fmt.Errorf("Column '%s' can't be used as a name", column.Name)
+		}
+		table.Columns = append(table.Columns, column)
+	}
+	table.Rows = records[1:]
+	return table, nil
+}
+
+var rawChecksum = regexp.MustCompile(`^(#|0x)[0-9A-Fa-f]{8}$`)
+
+// ToNeverScript writes the table as a global array with one struct per row.
+func (table Table) ToNeverScript(globalName string) (string, error) {
+	name, canBeWritten := decompiler.RenderName(globalName)
+	if !canBeWritten {
+		return "", fmt.Errorf("'%s' can't be used as a name", globalName)
+	}
+
+	var code strings.Builder
+	code.WriteString(name + " = [\n")
+	for i, row := range table.Rows {
+		lineNumber := i + 2 // counting the header, like a spreadsheet does
+		var elements []string
+		for j, cell := range row {
+			cell = strings.TrimSpace(cell)
+			if cell == "" {
+				continue
+			}
+			column := table.Columns[j]
+			value, err := renderCell(cell, column.Type)
+			if err != nil {
+				return "", fmt.Errorf("Row %d, column '%s': %s", lineNumber, column.Name, err)
+			}
+			columnName, _ := decompiler.RenderName(column.Name)
+			elements = append(elements, columnName+" = "+value)
+		}
+		if len(elements) == 0 {
+			code.WriteString("    {}\n")
+			continue
+		}
+		code.WriteString("    { " + strings.Join(elements, " ") + " }\n")
+	}
+	code.WriteString("]\n")
+	return code.String(), nil
+}
+
+// ToByteCode compiles the NeverScript from ToNeverScript.
+func (table Table) ToByteCode(globalName string) ([]byte, error) {
+	sourceCode, err := table.ToNeverScript(globalName)
+	if err != nil {
+		return nil, err
+	}
+	var lexer compiler.Lexer
+	lexer.SourceCode = sourceCode
+	lexer.SourceCodeSize = len(sourceCode)
+	compiler.LexSourceCode(&lexer)
+	var parser compiler.Parser
+	parser.Tokens = lexer.Tokens
+	compiler.BuildAbstractSyntaxTree(&parser)
+	if !parser.Result.WasSuccessful {
+		return nil, errors.New(parser.Result.Reason)
+	}
+	bytecodeCompiler := compiler.BytecodeCompiler{RootAstNode: parser.Result.Node}
+	compiler.GenerateBytecode(&bytecodeCompiler)
+	return bytecodeCompiler.Bytes, nil
+}
+
+// parseFloat rejects NaN and infinity, which NeverScript can't write.
+func parseFloat(text string) (float32, error) {
+	f, err := strconv.ParseFloat(text, 32)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' isn't a number", text)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("'%s' isn't a finite number", text)
+	}
+	return float32(f), nil
+}
+
+func renderCell(cell string, columnType ColumnType) (string, error) {
+	renderFloats := func(size int) (string, error) {
+		// accept "1 2 3", "1, 2, 3" and "(1, 2, 3)"
+		fields := strings.FieldsFunc(strings.Trim(cell, "()"), func(character rune) bool {
+			return character == ',' || character == ' ' || character == '\t'
+		})
+		if len(fields) != size {
+			return "", fmt.Errorf("Expected %d numbers, found '%s'", size, cell)
+		}
+		var floats []string
+		for _, field := range fields {
+			f, err := parseFloat(field)
+			if err != nil {
+				return "", err
+			}
+			floats = append(floats, decompiler.RenderFloat(f))
+		}
+		return "(" + strings.Join(floats, ", ") + ")", nil
+	}
+
+	switch columnType {
+	case ColumnType_Int:
+		i, err := strconv.ParseInt(cell, 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("'%s' isn't a 32-bit int", cell)
+		}
+		return strconv.FormatInt(i, 10), nil
+	case ColumnType_Float:
+		f, err := parseFloat(cell)
+		if err != nil {
+			return "", err
+		}
+		return decompiler.RenderFloat(f), nil
+	case ColumnType_String:
+		if strings.ContainsAny(cell, "\"\n") {
+			return "", fmt.Errorf("Strings can't contain quotes or newlines")
+		}
+		return "\"" + cell + "\"", nil
+	case ColumnType_Checksum:
+		if rawChecksum.MatchString(cell) {
+			return "#" + strings.ToUpper(cell[len(cell)-8:]), nil
+		}
+		name, canBeWritten := decompiler.RenderName(cell)
+		if !canBeWritten {
+			return "", fmt.Errorf("'%s' can't be used as a name", cell)
+		}
+		return name, nil
+	case ColumnType_Pair:
+		return renderFloats(2)
+	case ColumnType_Vector:
+		return renderFloats(3)
+	}
+	return "", fmt.Errorf("Unknown column type %d", columnType)
+}
@@ -0,0 +1,120 @@
+package table_conversion_test
+
+import (
+	"bytes"
+	"flag"
+	"github.com/byxor/NeverScript/compiler"
+	"github.com/byxor/NeverScript/disassembler"
+	"github.com/byxor/NeverScript/table_conversion"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/tricks.ns")
+
+func TestToNeverScript(t *testing.T) {
+	table := readTable(t, "tricks.csv", ',')
+	sourceCode, err := table.ToNeverScript("Tricks")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goldenPath := filepath.Join("testdata", "tricks.ns")
+	if *update {
+		if err := ioutil.WriteFile(goldenPath, []byte(sourceCode), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(expected) != sourceCode {
+		t.Errorf("'%s' changed (run 'go test ./table_conversion -update' if that's on purpose), got:\n%s", goldenPath, sourceCode)
+	}
+}
+
+// The QB output should be exactly what compiling the NeverScript output gives.
+func TestToByteCode(t *testing.T) {
+	byteCode, err := readTable(t, "tricks.csv", ',').ToByteCode("Tricks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range disassembler.Verify(byteCode) {
+		t.Error(problem)
+	}
+
+	var lexer compiler.Lexer
+	var parser compiler.Parser
+	var bytecodeCompiler compiler.BytecodeCompiler
+	if err := compiler.CompileToBytes(filepath.Join("testdata", "tricks.ns"), &lexer, &parser, &bytecodeCompiler); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(byteCode, bytecodeCompiler.Bytes) {
+		t.Errorf("ToByteCode and compiling testdata/tricks.ns gave different bytes")
+	}
+}
+
+func TestTabSeparatedValues(t *testing.T) {
+	sourceCode, err := readTable(t, "tricks.tsv", '\t').ToNeverScript("Tricks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Tricks = [\n    { trick = Kickflip score = 100 }\n    { trick = Heelflip score = 200 }\n]\n"
+	if sourceCode != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, sourceCode)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	testCases := []struct {
+		csv           string
+		expectedError string
+	}{
+		{"", "The table is empty"},
+		{"score\n1\n", "Column 'score' needs a type"},
+		{"score:number\n1\n", "Column 'score' has an unknown type 'number'"},
+		{"score:int\n1.5\n", "Row 2, column 'score': '1.5' isn't a 32-bit int"},
+		{"score:int\n1\n4294967296\n", "Row 3, column 'score': '4294967296' isn't a 32-bit int"},
+		{"speed:float\nfast\n", "Row 2, column 'speed': 'fast' isn't a number"},
+		{"name:string\n\"say \"\"hi\"\"\"\n", "Row 2, column 'name': Strings can't contain quotes or newlines"},
+		{"position:vector\n1 2\n", "Row 2, column 'position': Expected 3 numbers, found '1 2'"},
+		{"offset:pair\n1 x\n", "Row 2, column 'offset': 'x' isn't a number"},
+		{"speed:float\nNaN\n", "Row 2, column 'speed': 'NaN' isn't a finite number"},
+		{"offset:pair\n1 +Inf\n", "Row 2, column 'offset': '+Inf' isn't a finite number"},
+		{"position:vector\ninf 0 0\n", "Row 2, column 'position': 'inf' isn't a finite number"},
+		{"trick:checksum\n\"a\"\"b\"\n", "Row 2, column 'trick': 'a\"b' can't be used as a name"},
+	}
+	for _, testCase := range testCases {
+		err := toNeverScript(testCase.csv)
+		if err == nil || !strings.HasPrefix(err.Error(), testCase.expectedError) {
+			t.Errorf("Expected error '%s...' for %q, got %v", testCase.expectedError, testCase.csv, err)
+		}
+	}
+}
+
+func toNeverScript(csv string) error {
+	table, err := table_conversion.ReadTable(strings.NewReader(csv), ',')
+	if err != nil {
+		return err
+	}
+	_, err = table.ToNeverScript("Table")
+	return err
+}
+
+func readTable(t *testing.T, fileName string, delimiter rune) table_conversion.Table {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	table, err := table_conversion.ReadTable(file, delimiter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}